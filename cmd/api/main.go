@@ -3,23 +3,43 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"time"
 
 	"matching-engine/internal/account"
 	"matching-engine/internal/api"
 	"matching-engine/internal/engine"
-	"matching-engine/internal/matching"
 	"matching-engine/internal/persistence"
+	"matching-engine/internal/recovery"
+	"matching-engine/internal/symbolspec"
 )
 
 func main() {
+	verify := flag.Bool("verify", false, "cross-check snapshots against full event replay after recovery and refuse to start on divergence")
+	asOfSeq := flag.Int64("as-of-seq", 0, "time-travel mode: serve each symbol read-only as of this event sequence")
+	asOf := flag.String("as-of", "", "time-travel mode: serve every symbol read-only as of this RFC3339 time")
+	flag.Parse()
+
 	ctx := context.Background()
 
+	// SYMBOL_SPECS replaces the built-in symbol specs with the ones in a JSON file.
+	// Recovery registers the specs last recorded in the event log; file specs that differ from
+	// them are then recorded as spec changes, so replay sees every change made through the file.
+	var fileSpecs []symbolspec.Spec
+	if path := os.Getenv("SYMBOL_SPECS"); path != "" {
+		if err := symbolspec.LoadFile(path); err != nil {
+			log.Fatalf("Failed to load symbol specs: %v", err)
+		}
+		fileSpecs = symbolspec.List()
+		log.Printf("Loaded symbol specs from %s", path)
+	}
+
 	// Initialize persistence layer
 	dataDir := getenv("DATA_DIR", "./data")
 	eventStore, snapshotStore, recoveryService, err := initPersistence(dataDir)
@@ -32,29 +52,120 @@ func main() {
 	// Initialize account service
 	accountSvc := account.NewMemoryService()
 	// Initialize test accounts for development/testing before replaying events.
-	initTestAccounts(accountSvc)
+	if err := account.SeedTestAccounts(accountSvc); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+	log.Println("Test accounts initialized with balance")
 
 	// Initialize engine
-	eng := engine.NewEngine(&engine.EngineConfig{
+	// ENGINE_QUEUE_HIGH_WATER sets the shard queue depth at which new orders are shed (default: 80% of the queue)
+	queueHighWater, err := strconv.Atoi(getenv("ENGINE_QUEUE_HIGH_WATER", "0"))
+	if err != nil {
+		log.Fatalf("Invalid ENGINE_QUEUE_HIGH_WATER: %v", err)
+	}
+	engineConfig := &engine.EngineConfig{
 		ShardCount:     8,
 		QueueSize:      1000,
+		QueueHighWater: queueHighWater,
 		IdempotencyTTL: 24 * time.Hour,
-	})
-	defer eng.Close()
+	}
+	var eng *engine.Engine
+	var deadManTimeouts map[string]time.Duration
+	if target, ok := timeTravelTarget(*asOfSeq, *asOf); ok {
+		// Time-travel mode: serve depth and order queries against historical state, read-only
+		eng, err = recovery.NewTimeTravelEngine(ctx, engineConfig, eventStore, recoveryService, target)
+		if err != nil {
+			log.Fatalf("Failed to rebuild historical state: %v", err)
+		}
+		defer eng.Close()
+		log.Printf("Time-travel mode: serving read-only state as of sequence %d / time %q", *asOfSeq, *asOf)
+	} else {
+		eng = engine.NewEngine(engineConfig)
+		defer eng.Close()
+
+		// Set event store for persistence
+		eng.SetEventStore(eventStore)
+
+		// Set snapshot store for periodic snapshots
+		eng.SetSnapshotStore(snapshotStore)
+
+		// Restore symbol→shard assignments before recovery rebuilds books on their shards
+		assignmentStore, err := persistence.NewFileShardAssignmentStore(dataDir)
+		if err != nil {
+			log.Fatalf("Failed to open shard assignment store: %v", err)
+		}
+		assignments, err := assignmentStore.Load(ctx)
+		if err != nil {
+			log.Fatalf("Failed to load shard assignments: %v", err)
+		}
+		if err := eng.RestoreShardAssignments(assignments); err != nil {
+			log.Fatalf("Failed to restore shard assignments: %v", err)
+		}
+		eng.SetShardAssignmentStore(assignmentStore)
+
+		// Perform recovery
+		if err := performRecovery(ctx, eng, accountSvc, eventStore, recoveryService); err != nil {
+			log.Fatalf("Failed to recover engine state: %v", err)
+		}
+		if *verify {
+			if err := verifyRecovery(ctx, eventStore, recoveryService); err != nil {
+				log.Fatalf("Recovery verification failed: %v", err)
+			}
+		}
+		changed, err := recovery.RecordSpecChanges(ctx, eng, eventStore, fileSpecs)
+		if err != nil {
+			log.Fatalf("Failed to record symbol spec changes: %v", err)
+		}
+		log.Printf("Recorded %d symbol spec changes from the specs file", changed)
 
-	// Set event store for persistence
-	eng.SetEventStore(eventStore)
+		// Restore idempotency records so retries after a restart get their original results
+		idemStore, err := persistence.NewFileIdempotencyStore(filepath.Join(dataDir, "idempotency"))
+		if err != nil {
+			log.Fatalf("Failed to open idempotency store: %v", err)
+		}
+		defer idemStore.Close()
+		restored, err := recovery.RestoreIdempotencyRecords(ctx, eng, idemStore)
+		if err != nil {
+			log.Fatalf("Failed to restore idempotency records: %v", err)
+		}
+		log.Printf("Restored %d idempotency records", restored)
+		eng.SetIdempotencyRecordStore(idemStore)
 
-	// Set snapshot store for periodic snapshots
-	eng.SetSnapshotStore(snapshotStore)
+		// COMMAND_JOURNAL=true records executed commands for `eventlog replay`
+		if getenv("COMMAND_JOURNAL", "false") == "true" {
+			journal, err := persistence.NewFileCommandJournal(filepath.Join(dataDir, "journal"))
+			if err != nil {
+				log.Fatalf("Failed to open command journal: %v", err)
+			}
+			defer journal.Close()
+			eng.SetCommandJournal(journal)
+		}
 
-	// Perform recovery
-	if err := performRecovery(ctx, eng, accountSvc, eventStore, recoveryService); err != nil {
-		log.Fatalf("Failed to recover engine state: %v", err)
+		// Armed dead-man's switches are re-armed below, once the API can release the funds of expiries
+		deadManStore, err := persistence.NewFileDeadManSwitchStore(dataDir)
+		if err != nil {
+			log.Fatalf("Failed to open dead-man's switch store: %v", err)
+		}
+		deadManTimeouts, err = deadManStore.Load(ctx)
+		if err != nil {
+			log.Fatalf("Failed to load dead-man's switches: %v", err)
+		}
+		eng.SetDeadManSwitchStore(deadManStore)
 	}
 
 	// Create router
 	router := api.NewRouter(accountSvc, eng)
+	// API_KEY_SECRET keys the HMAC that turns API keys into the IDs stored with orders.
+	// Keep it stable: orders recovered under a different secret no longer match their keys.
+	if secret := os.Getenv("API_KEY_SECRET"); secret != "" {
+		router.SetAPIKeySecret([]byte(secret))
+	} else {
+		log.Printf("API_KEY_SECRET is not set; API key IDs are unkeyed hashes")
+	}
+	if err := eng.RestoreDeadManSwitches(deadManTimeouts); err != nil {
+		log.Fatalf("Failed to restore dead-man's switches: %v", err)
+	}
+	log.Printf("Re-armed %d dead-man's switches", len(deadManTimeouts))
 	addr := getenv("APP_ADDR", ":8080")
 
 	log.Printf("Starting server on %s", addr)
@@ -65,13 +176,31 @@ func main() {
 
 func initPersistence(dataDir string) (persistence.EventStore, persistence.SnapshotStore, persistence.RecoveryService, error) {
 	// Create event store
-	eventStore, err := persistence.NewFileEventStore(filepath.Join(dataDir, "events"))
+	durability, err := persistence.ParseDurabilityPolicy(getenv("EVENT_DURABILITY", string(persistence.DefaultDurability)))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	encoding, err := persistence.ParseEventEncoding(getenv("EVENT_ENCODING", string(persistence.EncodingJSON)))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	eventConfig := persistence.DefaultFileEventStoreConfig()
+	eventConfig.Durability = durability
+	eventConfig.Encoding = encoding
+	// EVENT_REPAIR_MODE=true cuts damaged event logs at the first bad record instead of refusing to start
+	eventConfig.RepairMode = getenv("EVENT_REPAIR_MODE", "false") == "true"
+	eventStore, err := persistence.NewFileEventStoreWithConfig(filepath.Join(dataDir, "events"), eventConfig)
 	if err != nil {
 		return nil, nil, nil, err
 	}
 
 	// Create snapshot store
-	snapshotStore, err := persistence.NewFileSnapshotStore(filepath.Join(dataDir, "snapshots"))
+	snapshotConfig, err := snapshotStoreConfig(eventStore)
+	if err != nil {
+		eventStore.Close()
+		return nil, nil, nil, err
+	}
+	snapshotStore, err := persistence.NewFileSnapshotStoreWithConfig(filepath.Join(dataDir, "snapshots"), snapshotConfig)
 	if err != nil {
 		eventStore.Close()
 		return nil, nil, nil, err
@@ -83,6 +212,30 @@ func initPersistence(dataDir string) (persistence.EventStore, persistence.Snapsh
 	return eventStore, snapshotStore, recoveryService, nil
 }
 
+// snapshotStoreConfig reads snapshot retention settings from the environment:
+// SNAPSHOT_KEEP_LAST (count), SNAPSHOT_MAX_AGE (duration) and EVENT_ARCHIVE=true
+// to archive event segments covered by the oldest retained snapshot.
+func snapshotStoreConfig(eventStore *persistence.FileEventStore) (*persistence.FileSnapshotStoreConfig, error) {
+	config := &persistence.FileSnapshotStoreConfig{}
+
+	keepLast, err := strconv.Atoi(getenv("SNAPSHOT_KEEP_LAST", "0"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SNAPSHOT_KEEP_LAST: %w", err)
+	}
+	config.Retention.KeepLast = keepLast
+
+	maxAge, err := time.ParseDuration(getenv("SNAPSHOT_MAX_AGE", "0"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SNAPSHOT_MAX_AGE: %w", err)
+	}
+	config.Retention.MaxAge = maxAge
+
+	if getenv("EVENT_ARCHIVE", "false") == "true" {
+		config.Archiver = eventStore
+	}
+	return config, nil
+}
+
 func performRecovery(
 	ctx context.Context,
 	eng *engine.Engine,
@@ -116,7 +269,7 @@ func performRecovery(
 		// Log recovery info
 		if snapshot != nil {
 			log.Printf("  Loaded snapshot at sequence %d", snapshot.LastSequence)
-			state, err := decodeOrderBookState(snapshot.Orderbook, symbol)
+			state, err := recovery.DecodeOrderBookState(snapshot.Orderbook, symbol)
 			if err != nil {
 				return fmt.Errorf("failed to decode snapshot for %s: %w", symbol, err)
 			}
@@ -142,7 +295,7 @@ func performRecovery(
 		if err := recoveryService.ValidateSequence(allEvents); err != nil {
 			return fmt.Errorf("account recovery sequence validation failed for %s: %w", symbol, err)
 		}
-		if err := replayAccountEvents(accountSvc, symbol, allEvents); err != nil {
+		if err := recovery.ReplayAccountEvents(accountSvc, symbol, allEvents); err != nil {
 			return fmt.Errorf("account recovery failed for %s: %w", symbol, err)
 		}
 
@@ -153,136 +306,41 @@ func performRecovery(
 	return nil
 }
 
-func decodeOrderBookState(raw any, symbol string) (*matching.OrderBookState, error) {
-	if raw == nil {
-		return nil, nil
-	}
-
-	data, err := json.Marshal(raw)
-	if err != nil {
-		return nil, err
-	}
-
-	var state matching.OrderBookState
-	if err := json.Unmarshal(data, &state); err != nil {
-		return nil, err
-	}
-	if state.Symbol == "" {
-		state.Symbol = symbol
+// timeTravelTarget builds the point-in-time target from the -as-of flags; ok is false in normal mode
+func timeTravelTarget(seq int64, at string) (persistence.RecoveryTarget, bool) {
+	target := persistence.RecoveryTarget{Sequence: seq}
+	if at != "" {
+		t, err := time.Parse(time.RFC3339Nano, at)
+		if err != nil {
+			log.Fatalf("Invalid -as-of time %q: %v", at, err)
+		}
+		target.Time = t
 	}
-
-	return &state, nil
+	return target, target.Sequence != 0 || !target.Time.IsZero()
 }
 
-func replayAccountEvents(accountSvc account.Service, symbol string, events []matching.Event) error {
-	type orderMeta struct {
-		accountID string
-		side      matching.Side
+// verifyRecovery rebuilds every symbol from full replay and from snapshot + tail and compares them
+func verifyRecovery(ctx context.Context, eventStore persistence.EventStore, recoveryService persistence.RecoveryService) error {
+	verifier := recovery.NewVerifier(eventStore, recoveryService, newReplayAccounts)
+	report, err := verifier.Verify(ctx)
+	if err != nil {
+		return err
 	}
-
-	orderLookup := make(map[string]orderMeta)
-	for _, event := range events {
-		switch e := event.(type) {
-		case *matching.OrderAcceptedEvent:
-			intent := account.PlaceIntent{
-				AccountID: e.AccountID,
-				OrderID:   e.OrderID,
-				Symbol:    symbol,
-				Side:      string(e.Side),
-				PriceInt:  e.Price,
-				QtyInt:    e.Quantity,
-			}
-			if err := accountSvc.CheckAndFreezeForPlace(intent); err != nil {
-				return fmt.Errorf("freeze failed for order %s: %w", e.OrderID, err)
-			}
-			orderLookup[e.OrderID] = orderMeta{accountID: e.AccountID, side: e.Side}
-
-		case *matching.OrderMatchedEvent:
-			maker, ok := orderLookup[e.MakerOrderID]
-			if !ok {
-				return fmt.Errorf("missing maker order metadata for %s", e.MakerOrderID)
-			}
-			taker, ok := orderLookup[e.TakerOrderID]
-			if !ok {
-				return fmt.Errorf("missing taker order metadata for %s", e.TakerOrderID)
-			}
-
-			tradeIntent := account.TradeIntent{
-				TradeID:     e.TradeID,
-				Symbol:      symbol,
-				PriceInt:    e.Price,
-				QuantityInt: e.Quantity,
-			}
-
-			if maker.side == matching.SideBuy {
-				tradeIntent.BuyerAccountID = maker.accountID
-				tradeIntent.BuyerOrderID = e.MakerOrderID
-				tradeIntent.SellerAccountID = taker.accountID
-				tradeIntent.SellerOrderID = e.TakerOrderID
-			} else {
-				tradeIntent.BuyerAccountID = taker.accountID
-				tradeIntent.BuyerOrderID = e.TakerOrderID
-				tradeIntent.SellerAccountID = maker.accountID
-				tradeIntent.SellerOrderID = e.MakerOrderID
-			}
-
-			if err := accountSvc.ApplyTrade(tradeIntent); err != nil {
-				return fmt.Errorf("trade apply failed for %s: %w", e.TradeID, err)
-			}
-
-		case *matching.OrderCanceledEvent:
-			cancelIntent := account.CancelIntent{
-				AccountID: e.AccountID,
-				OrderID:   e.OrderID,
-				Symbol:    symbol,
-			}
-			if err := accountSvc.ReleaseOnCancel(cancelIntent); err != nil {
-				return fmt.Errorf("cancel release failed for order %s: %w", e.OrderID, err)
-			}
-		default:
-			return fmt.Errorf("unknown event type: %T", e)
-		}
+	if !report.OK() {
+		data, _ := json.MarshalIndent(report, "", "  ")
+		return fmt.Errorf("snapshot and full replay diverge:\n%s", data)
 	}
-
+	log.Printf("Verified %d symbols: snapshots match full replay", len(report.Symbols))
 	return nil
 }
 
-func initTestAccounts(accountSvc *account.MemoryService) {
-	// Initialize test accounts with balance for development/testing
-	// Using fixed-point decimals (8 decimal places)
-
-	testAccounts := []struct {
-		accountID string
-		balances  map[string]int64
-	}{
-		{
-			accountID: "acc-001",
-			balances: map[string]int64{
-				"USDT": 100000000000000, // 1,000,000 USDT (8 decimals)
-				"BTC":  10000000000,     // 100 BTC (8 decimals)
-			},
-		},
-		{
-			accountID: "acc-002",
-			balances: map[string]int64{
-				"USDT": 100000000000000, // 1,000,000 USDT (8 decimals)
-				"BTC":  10000000000,     // 100 BTC (8 decimals)
-			},
-		},
-	}
-
-	for _, acc := range testAccounts {
-		for asset, amount := range acc.balances {
-			if err := accountSvc.SetBalance(acc.accountID, asset, account.Balance{
-				Available: amount,
-				Frozen:    0,
-			}); err != nil {
-				log.Printf("Warning: Failed to initialize test account %s with %s: %v", acc.accountID, asset, err)
-			}
-		}
+// newReplayAccounts returns the account state event replay starts from
+func newReplayAccounts() (*account.MemoryService, error) {
+	accountSvc := account.NewMemoryService()
+	if err := account.SeedTestAccounts(accountSvc); err != nil {
+		return nil, err
 	}
-
-	log.Println("Test accounts initialized with balance")
+	return accountSvc, nil
 }
 
 func getenv(key, fallback string) string {
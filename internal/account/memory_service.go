@@ -13,6 +13,7 @@ type MemoryService struct {
 	mu            sync.RWMutex
 	balances      map[string]map[string]*Balance // accountID -> asset -> Balance
 	freezes       map[string]*FreezeRecord       // orderID -> FreezeRecord
+	groupFreezes  map[string]*groupFreeze        // accountID|symbol|groupID -> freeze shared by the legs
 	appliedTrades map[string]struct{}            // symbol|tradeID -> applied marker
 }
 
@@ -22,6 +23,26 @@ type FreezeRecord struct {
 	Asset                string
 	OriginalFrozenAmount int64
 	FrozenAmount         int64
+	group                *groupFreeze // Set for a leg of an order group
+}
+
+// groupFreeze is the balance frozen once for every leg of an order group. Only one leg can
+// trade, so it holds what the costliest leg still needs rather than the sum.
+type groupFreeze struct {
+	asset string
+	held  int64
+	legs  []*FreezeRecord
+}
+
+// needWithout returns what the group's other legs still need: the most any of them has frozen
+func (g *groupFreeze) needWithout(released *FreezeRecord) int64 {
+	var need int64
+	for _, leg := range g.legs {
+		if leg != released {
+			need = max(need, leg.FrozenAmount)
+		}
+	}
+	return need
 }
 
 // NewMemoryService creates a new in-memory account service
@@ -29,6 +50,7 @@ func NewMemoryService() *MemoryService {
 	return &MemoryService{
 		balances:      make(map[string]map[string]*Balance),
 		freezes:       make(map[string]*FreezeRecord),
+		groupFreezes:  make(map[string]*groupFreeze),
 		appliedTrades: make(map[string]struct{}),
 	}
 }
@@ -86,6 +108,10 @@ func (s *MemoryService) CheckAndFreezeForPlace(intent PlaceIntent) error {
 		accountBalances[assetToFreeze] = balance
 	}
 
+	if intent.GroupID != "" {
+		return s.freezeGroupLeg(intent, balance, assetToFreeze, amountToFreeze)
+	}
+
 	// Check if sufficient balance
 	if balance.Available < amountToFreeze {
 		return &InsufficientBalanceError{
@@ -111,6 +137,43 @@ func (s *MemoryService) CheckAndFreezeForPlace(intent PlaceIntent) error {
 	return nil
 }
 
+// freezeGroupLeg freezes what a leg of an order group needs beyond what the group already holds
+func (s *MemoryService) freezeGroupLeg(intent PlaceIntent, balance *Balance, asset string, amount int64) error {
+	key := intent.AccountID + "|" + intent.Symbol + "|" + intent.GroupID
+	group, exists := s.groupFreezes[key]
+	if !exists {
+		group = &groupFreeze{asset: asset}
+		s.groupFreezes[key] = group
+	}
+	if group.asset != asset {
+		return fmt.Errorf("group %s freezes %s, order %s needs %s", intent.GroupID, group.asset, intent.OrderID, asset)
+	}
+
+	extra := max(amount-group.held, 0)
+	if balance.Available < extra {
+		return &InsufficientBalanceError{
+			AccountID: intent.AccountID,
+			Asset:     asset,
+			Required:  extra,
+			Available: balance.Available,
+		}
+	}
+	balance.Available -= extra
+	balance.Frozen += extra
+	group.held += extra
+
+	record := &FreezeRecord{
+		AccountID:            intent.AccountID,
+		Asset:                asset,
+		OriginalFrozenAmount: amount,
+		FrozenAmount:         amount,
+		group:                group,
+	}
+	group.legs = append(group.legs, record)
+	s.freezes[intent.OrderID] = record
+	return nil
+}
+
 // ReleaseOnCancel releases frozen funds when an order is canceled
 func (s *MemoryService) ReleaseOnCancel(intent CancelIntent) error {
 	if err := intent.Validate(); err != nil {
@@ -149,14 +212,24 @@ func (s *MemoryService) ReleaseOnCancel(intent CancelIntent) error {
 	if freeze.FrozenAmount <= 0 {
 		return nil
 	}
-	if balance.Frozen < freeze.FrozenAmount {
+
+	// A group leg releases only what the other legs don't still need
+	release := freeze.FrozenAmount
+	group := freeze.group
+	if group != nil {
+		release = max(group.held-group.needWithout(freeze), 0)
+	}
+	if balance.Frozen < release {
 		return fmt.Errorf("frozen balance underflow for order %s", intent.OrderID)
 	}
 
 	// Unfreeze remaining reserved funds.
-	balance.Frozen -= freeze.FrozenAmount
-	balance.Available += freeze.FrozenAmount
+	balance.Frozen -= release
+	balance.Available += release
 	freeze.FrozenAmount = 0
+	if group != nil {
+		group.held -= release
+	}
 
 	return nil
 }
@@ -232,6 +305,9 @@ func (s *MemoryService) ApplyTrade(intent TradeIntent) error {
 			return fmt.Errorf("buyer freeze record underflow for order %s", intent.BuyerOrderID)
 		}
 		buyerFreeze.FrozenAmount -= quoteAmount
+		if buyerFreeze.group != nil {
+			buyerFreeze.group.held -= quoteAmount
+		}
 	}
 
 	sellerFreeze, sellerExists := s.freezes[intent.SellerOrderID]
@@ -240,6 +316,9 @@ func (s *MemoryService) ApplyTrade(intent TradeIntent) error {
 			return fmt.Errorf("seller freeze record underflow for order %s", intent.SellerOrderID)
 		}
 		sellerFreeze.FrozenAmount -= baseAmount
+		if sellerFreeze.group != nil {
+			sellerFreeze.group.held -= baseAmount
+		}
 	}
 	s.appliedTrades[tradeKey] = struct{}{}
 
@@ -264,6 +343,22 @@ func (s *MemoryService) GetBalance(accountID, asset string) (Balance, error) {
 	return *balance, nil
 }
 
+// ExportBalances returns a copy of all balances keyed by account and asset
+func (s *MemoryService) ExportBalances() map[string]map[string]Balance {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	balances := make(map[string]map[string]Balance, len(s.balances))
+	for accountID, assets := range s.balances {
+		copied := make(map[string]Balance, len(assets))
+		for asset, balance := range assets {
+			copied[asset] = *balance
+		}
+		balances[accountID] = copied
+	}
+	return balances
+}
+
 // SetBalance sets the balance for a specific account and asset
 func (s *MemoryService) SetBalance(accountID, asset string, balance Balance) error {
 	s.mu.Lock()
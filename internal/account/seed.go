@@ -0,0 +1,28 @@
+package account
+
+import "fmt"
+
+// TestAccountBalances are the development/testing balances every fresh deployment starts with.
+// Using fixed-point decimals (8 decimal places).
+var TestAccountBalances = map[string]map[string]int64{
+	"acc-001": {
+		"USDT": 100000000000000, // 1,000,000 USDT (8 decimals)
+		"BTC":  10000000000,     // 100 BTC (8 decimals)
+	},
+	"acc-002": {
+		"USDT": 100000000000000, // 1,000,000 USDT (8 decimals)
+		"BTC":  10000000000,     // 100 BTC (8 decimals)
+	},
+}
+
+// SeedTestAccounts sets the development/testing balances; event replay starts from them
+func SeedTestAccounts(svc Service) error {
+	for accountID, balances := range TestAccountBalances {
+		for asset, amount := range balances {
+			if err := svc.SetBalance(accountID, asset, Balance{Available: amount}); err != nil {
+				return fmt.Errorf("failed to initialize test account %s with %s: %w", accountID, asset, err)
+			}
+		}
+	}
+	return nil
+}
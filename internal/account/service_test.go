@@ -412,3 +412,83 @@ func TestApplyTradeIsIdempotentByTradeID(t *testing.T) {
 		t.Fatalf("expected buyer available quote %d, got %d", want, buyerUSDT.Available)
 	}
 }
+
+func TestGroupLegsShareOneFreeze(t *testing.T) {
+	svc := NewMemoryService()
+	symbol := "BTC-USDT"
+	one := mustQtyInt(t, symbol, "1")
+	if err := svc.SetBalance("acc1", "BTC", Balance{Available: 2 * one}); err != nil {
+		t.Fatalf("SetBalance failed: %v", err)
+	}
+	expect := func(available, frozen int64) {
+		t.Helper()
+		balance, _ := svc.GetBalance("acc1", "BTC")
+		if balance.Available != available || balance.Frozen != frozen {
+			t.Fatalf("expected available %d frozen %d, got %+v", available, frozen, balance)
+		}
+	}
+	sell := func(orderID, price string, groupID string) error {
+		return svc.CheckAndFreezeForPlace(PlaceIntent{
+			AccountID: "acc1", OrderID: orderID, Symbol: symbol, Side: "SELL",
+			PriceInt: mustPriceInt(t, symbol, price), QtyInt: one, GroupID: groupID,
+		})
+	}
+
+	// Take-profit and stop-loss legs of 1 BTC each reserve 1 BTC between them
+	for _, leg := range []struct{ orderID, price string }{{"tp", "45000"}, {"sl", "41000"}, {"tp", "45000"}} {
+		if err := sell(leg.orderID, leg.price, "oco1"); err != nil {
+			t.Fatalf("freeze %s failed: %v", leg.orderID, err)
+		}
+	}
+	expect(one, one)
+	if err := svc.CheckAndFreezeForPlace(PlaceIntent{
+		AccountID: "acc1", OrderID: "buy", Symbol: symbol, Side: "BUY",
+		PriceInt: mustPriceInt(t, symbol, "40000"), QtyInt: one, GroupID: "oco1",
+	}); err == nil {
+		t.Fatalf("expected a leg freezing another asset to be rejected")
+	}
+
+	// tp sells 0.4; canceling sl keeps the 0.6 tp still needs
+	tradeQty := mustQtyInt(t, symbol, "0.4")
+	if err := svc.SetBalance("acc2", "USDT", Balance{Frozen: mustQuoteAmount(t, symbol, mustPriceInt(t, symbol, "45000"), tradeQty)}); err != nil {
+		t.Fatalf("SetBalance failed: %v", err)
+	}
+	if err := svc.ApplyTrade(TradeIntent{
+		TradeID: "t1", BuyerAccountID: "acc2", SellerAccountID: "acc1", BuyerOrderID: "b1", SellerOrderID: "tp",
+		Symbol: symbol, PriceInt: mustPriceInt(t, symbol, "45000"), QuantityInt: tradeQty,
+	}); err != nil {
+		t.Fatalf("ApplyTrade failed: %v", err)
+	}
+	if err := svc.ReleaseOnCancel(CancelIntent{AccountID: "acc1", OrderID: "sl", Symbol: symbol}); err != nil {
+		t.Fatalf("release sl failed: %v", err)
+	}
+	expect(one, one-tradeQty)
+	if err := svc.ReleaseOnCancel(CancelIntent{AccountID: "acc1", OrderID: "tp", Symbol: symbol}); err != nil {
+		t.Fatalf("release tp failed: %v", err)
+	}
+	expect(2*one-tradeQty, 0)
+
+	// Legs at different costs reserve the costliest; canceling it releases the difference
+	if err := svc.SetBalance("acc3", "USDT", Balance{Available: mustQuoteAmount(t, symbol, mustPriceInt(t, symbol, "44000"), one)}); err != nil {
+		t.Fatalf("SetBalance failed: %v", err)
+	}
+	buy := func(orderID, price string) error {
+		return svc.CheckAndFreezeForPlace(PlaceIntent{
+			AccountID: "acc3", OrderID: orderID, Symbol: symbol, Side: "BUY",
+			PriceInt: mustPriceInt(t, symbol, price), QtyInt: one, GroupID: "oco2",
+		})
+	}
+	if err := buy("low", "40000"); err != nil {
+		t.Fatalf("freeze low failed: %v", err)
+	}
+	if err := buy("high", "44000"); err != nil {
+		t.Fatalf("freeze high failed: %v", err)
+	}
+	if err := svc.ReleaseOnCancel(CancelIntent{AccountID: "acc3", OrderID: "high", Symbol: symbol}); err != nil {
+		t.Fatalf("release high failed: %v", err)
+	}
+	balance, _ := svc.GetBalance("acc3", "USDT")
+	if want := mustQuoteAmount(t, symbol, mustPriceInt(t, symbol, "40000"), one); balance.Frozen != want {
+		t.Fatalf("expected %d to stay frozen for low, got %+v", want, balance)
+	}
+}
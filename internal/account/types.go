@@ -24,6 +24,7 @@ type PlaceIntent struct {
 	Side        string // "BUY" or "SELL"
 	PriceInt    int64  // fixed-scale price, precision from symbol spec
 	QtyInt      int64  // fixed-scale quantity, precision from symbol spec
+	GroupID     string // one-cancels-other group; its legs share one freeze
 	IdemKey     string
 	PayloadHash string
 }
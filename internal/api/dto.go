@@ -1,16 +1,27 @@
 package api
 
-import "time"
+import (
+	"time"
+
+	"matching-engine/internal/engine"
+)
 
 // PlaceOrderRequest represents the request body for placing an order
 type PlaceOrderRequest struct {
-	ClientOrderID  string `json:"client_order_id"` // Client-provided order ID
-	AccountID      string `json:"account_id"`      // Account ID
-	Symbol         string `json:"symbol"`          // Trading symbol (e.g., "BTC-USDT")
-	Side           string `json:"side"`            // Order side: "BUY" or "SELL"
-	Price          string `json:"price"`           // Price as decimal string
-	Quantity       string `json:"quantity"`        // Quantity as decimal string
-	IdempotencyKey string `json:"idempotency_key"` // Idempotency key for deduplication
+	ClientOrderID  string `json:"client_order_id"`    // Client-provided order ID
+	AccountID      string `json:"account_id"`         // Account ID
+	Symbol         string `json:"symbol"`             // Trading symbol (e.g., "BTC-USDT")
+	Side           string `json:"side"`               // Order side: "BUY" or "SELL"
+	Price          string `json:"price"`              // Price as decimal string
+	Quantity       string `json:"quantity"`           // Quantity as decimal string
+	IdempotencyKey string `json:"idempotency_key"`    // Idempotency key for deduplication
+	GroupID        string `json:"group_id,omitempty"` // One-cancels-other group: a fill or cancel of one leg cancels the others
+}
+
+// BatchPlaceOrderRequest represents the request body for placing a batch of orders
+type BatchPlaceOrderRequest struct {
+	Orders       []PlaceOrderRequest `json:"orders"`         // Orders in submission order
+	AllOrNothing bool                `json:"all_or_nothing"` // Place all orders of a symbol or none of them
 }
 
 // SuccessResponse represents the unified success envelope.
@@ -22,16 +33,36 @@ type SuccessResponse struct {
 
 // PlaceOrderResponse represents the response for placing an order
 type PlaceOrderResponse struct {
-	OrderID       string     `json:"order_id"`        // System-generated order ID
-	ClientOrderID string     `json:"client_order_id"` // Client-provided order ID
-	AccountID     string     `json:"account_id"`      // Account ID
-	Symbol        string     `json:"symbol"`          // Trading symbol
-	Side          string     `json:"side"`            // Order side
-	Price         string     `json:"price"`           // Price as decimal string
-	Quantity      string     `json:"quantity"`        // Quantity as decimal string
-	Status        string     `json:"status"`          // Order status
-	CreatedAt     time.Time  `json:"created_at"`      // Order creation time
-	Trades        []TradeDTO `json:"trades"`          // Trades executed (if any)
+	OrderID       string     `json:"order_id"`           // System-generated order ID
+	ClientOrderID string     `json:"client_order_id"`    // Client-provided order ID
+	AccountID     string     `json:"account_id"`         // Account ID
+	Symbol        string     `json:"symbol"`             // Trading symbol
+	Side          string     `json:"side"`               // Order side
+	Price         string     `json:"price"`              // Price as decimal string
+	Quantity      string     `json:"quantity"`           // Quantity as decimal string
+	Status        string     `json:"status"`             // Order status
+	CreatedAt     time.Time  `json:"created_at"`         // Order creation time
+	Trades        []TradeDTO `json:"trades"`             // Trades executed (if any)
+	GroupID       string     `json:"group_id,omitempty"` // One-cancels-other group of the order
+}
+
+// BatchPlaceOrderResponse represents the response for placing a batch of orders
+type BatchPlaceOrderResponse struct {
+	Results []BatchOrderResult `json:"results"` // One result per order, in request order
+}
+
+// BatchOrderResult represents the outcome of one order of a batch
+type BatchOrderResult struct {
+	Index  int                 `json:"index"`           // Position of the order in the request
+	Status int                 `json:"status"`          // HTTP status the order would have on its own
+	Order  *PlaceOrderResponse `json:"order,omitempty"` // Placed order, on success
+	Error  *BatchErrorDTO      `json:"error,omitempty"` // Failure, otherwise
+}
+
+// BatchErrorDTO represents the error of one order of a batch
+type BatchErrorDTO struct {
+	Code    string `json:"code"`    // Error code
+	Message string `json:"message"` // Error message
 }
 
 // CancelOrderResponse represents the response for canceling an order
@@ -42,19 +73,58 @@ type CancelOrderResponse struct {
 	FilledQty    string `json:"filled_qty"`    // Filled quantity
 }
 
+// MassCancelResponse summarizes a mass cancel
+type MassCancelResponse struct {
+	CanceledCount int                `json:"canceled_count"` // Number of orders canceled
+	Orders        []CanceledOrderDTO `json:"orders"`         // Canceled orders in cancellation order
+}
+
+// CanceledOrderDTO represents one order canceled by a mass cancel
+type CanceledOrderDTO struct {
+	OrderID      string `json:"order_id"`      // Order ID
+	AccountID    string `json:"account_id"`    // Account ID
+	Symbol       string `json:"symbol"`        // Trading symbol
+	RemainingQty string `json:"remaining_qty"` // Remaining quantity at cancellation
+}
+
 // QueryOrderResponse represents the response for querying an order
 type QueryOrderResponse struct {
-	OrderID       string    `json:"order_id"`        // Order ID
-	ClientOrderID string    `json:"client_order_id"` // Client-provided order ID
-	AccountID     string    `json:"account_id"`      // Account ID
-	Symbol        string    `json:"symbol"`          // Trading symbol
-	Side          string    `json:"side"`            // Order side
-	Price         string    `json:"price"`           // Price as decimal string
-	Quantity      string    `json:"quantity"`        // Quantity as decimal string
-	RemainingQty  string    `json:"remaining_qty"`   // Remaining quantity
-	FilledQty     string    `json:"filled_qty"`      // Filled quantity
-	Status        string    `json:"status"`          // Order status
-	CreatedAt     time.Time `json:"created_at"`      // Order creation time
+	OrderID       string    `json:"order_id"`           // Order ID
+	ClientOrderID string    `json:"client_order_id"`    // Client-provided order ID
+	AccountID     string    `json:"account_id"`         // Account ID
+	Symbol        string    `json:"symbol"`             // Trading symbol
+	Side          string    `json:"side"`               // Order side
+	Price         string    `json:"price"`              // Price as decimal string
+	Quantity      string    `json:"quantity"`           // Quantity as decimal string
+	RemainingQty  string    `json:"remaining_qty"`      // Remaining quantity
+	FilledQty     string    `json:"filled_qty"`         // Filled quantity
+	Status        string    `json:"status"`             // Order status
+	CreatedAt     time.Time `json:"created_at"`         // Order creation time
+	GroupID       string    `json:"group_id,omitempty"` // One-cancels-other group of the order
+}
+
+// DepthResponse represents the response for querying book depth
+type DepthResponse struct {
+	Symbol   string          `json:"symbol"`            // Trading symbol
+	Status   string          `json:"status"`            // Trading status: TRADING, HALTED, CANCEL_ONLY or PRE_OPEN
+	Sequence int64           `json:"sequence"`          // Last event sequence reflected in the depth
+	Bids     []DepthLevelDTO `json:"bids"`              // Highest price first
+	Asks     []DepthLevelDTO `json:"asks"`              // Lowest price first
+	Auction  *AuctionDTO     `json:"auction,omitempty"` // Indicative uncross while PRE_OPEN
+}
+
+// AuctionDTO represents the indicative outcome of a call auction
+type AuctionDTO struct {
+	Price     string `json:"price"`     // Equilibrium price, 0 if the book does not cross
+	Volume    string `json:"volume"`    // Quantity that would execute at the price
+	Imbalance string `json:"imbalance"` // Unmatched quantity: positive for surplus bids, negative for surplus asks
+}
+
+// DepthLevelDTO represents the aggregated quantity at one price
+type DepthLevelDTO struct {
+	Price    string `json:"price"`    // Price as decimal string
+	Quantity string `json:"quantity"` // Total remaining quantity as decimal string
+	Orders   int    `json:"orders"`   // Number of resting orders
 }
 
 // TradeDTO represents a trade execution
@@ -66,6 +136,107 @@ type TradeDTO struct {
 	Timestamp time.Time `json:"timestamp"` // Trade timestamp
 }
 
+// ShardsResponse represents the symbol→shard layout of the engine
+type ShardsResponse struct {
+	Assignments map[string]int      `json:"assignments"` // Explicitly assigned symbols; others are hashed
+	Queues      []engine.QueueStats `json:"queues"`      // Queue state of every shard
+}
+
+// MoveSymbolRequest represents the request body for moving a symbol to another shard
+type MoveSymbolRequest struct {
+	Symbol  string `json:"symbol"`   // Trading symbol
+	ShardID int    `json:"shard_id"` // Target shard
+}
+
+// MoveSymbolResponse represents the response for moving a symbol
+type MoveSymbolResponse struct {
+	Symbol    string `json:"symbol"`     // Trading symbol
+	FromShard int    `json:"from_shard"` // Shard the symbol was on
+	ToShard   int    `json:"to_shard"`   // Shard the symbol is on now
+}
+
+// SetSymbolStatusRequest represents the request body for changing a symbol's trading status
+type SetSymbolStatusRequest struct {
+	Symbol string `json:"symbol"`           // Trading symbol
+	Status string `json:"status"`           // TRADING, HALTED, CANCEL_ONLY or PRE_OPEN
+	Reason string `json:"reason,omitempty"` // Why the status changes, recorded on the event
+}
+
+// SetSymbolStatusResponse represents the response for changing a symbol's trading status
+type SetSymbolStatusResponse struct {
+	Symbol         string     `json:"symbol"`           // Trading symbol
+	PreviousStatus string     `json:"previous_status"`  // Status before the change
+	Status         string     `json:"status"`           // Status now
+	Trades         []TradeDTO `json:"trades,omitempty"` // Auction trades of the uncross (if any), with the taker's side
+}
+
+// SymbolSpecDTO represents a symbol's spec in admin requests and responses.
+// Tick and step are decimal strings in the symbol's own scales.
+type SymbolSpecDTO struct {
+	Symbol              string `json:"symbol"`                           // Trading symbol, BASE-QUOTE
+	PriceScale          int    `json:"price_scale"`                      // Decimal places of prices
+	QuantityScale       int    `json:"quantity_scale"`                   // Decimal places of quantities
+	PriceTick           string `json:"price_tick"`                       // Smallest price increment
+	QuantityStep        string `json:"quantity_step"`                    // Smallest quantity increment
+	PriceBandBps        int64  `json:"price_band_bps,omitempty"`         // Limit price band around the reference price, 0 for none
+	TradeBandBps        int64  `json:"trade_band_bps,omitempty"`         // Trade price band that trips the circuit breaker, 0 for none
+	BreakerAuction      bool   `json:"breaker_auction,omitempty"`        // Trip into PRE_OPEN instead of HALTED
+	BreakerCoolingOffMs int64  `json:"breaker_cooling_off_ms,omitempty"` // Reopen this long after a trip, 0 to wait for an admin
+	MinQuantity         string `json:"min_quantity,omitempty"`           // Smallest order quantity
+	MaxQuantity         string `json:"max_quantity,omitempty"`           // Largest order quantity
+	MinPrice            string `json:"min_price,omitempty"`              // Lowest order price
+	MaxPrice            string `json:"max_price,omitempty"`              // Highest order price
+	MinNotional         string `json:"min_notional,omitempty"`           // Smallest price × quantity, in the quote asset
+	Allocation          string `json:"allocation,omitempty"`             // FIFO (default), PRO_RATA, PRO_RATA_TOP_ORDER or LMM
+	LMMAccountID        string `json:"lmm_account_id,omitempty"`         // Lead market maker of the LMM allocation
+	LMMShareBps         int64  `json:"lmm_share_bps,omitempty"`          // Share the lead market maker gets first, in basis points
+}
+
+// ListSymbolSpecsResponse represents the response for listing symbol specs
+type ListSymbolSpecsResponse struct {
+	Symbols []SymbolSpecDTO `json:"symbols"` // Specs sorted by symbol
+}
+
+// MarketDTO represents a tradable market
+type MarketDTO struct {
+	Symbol        string `json:"symbol"`                 // Trading symbol
+	BaseAsset     string `json:"base_asset"`             // Asset bought and sold
+	QuoteAsset    string `json:"quote_asset"`            // Asset prices are quoted in
+	PriceScale    int    `json:"price_scale"`            // Decimal places of prices
+	QuantityScale int    `json:"quantity_scale"`         // Decimal places of quantities
+	PriceTick     string `json:"price_tick"`             // Smallest price increment
+	QuantityStep  string `json:"quantity_step"`          // Smallest quantity increment
+	MinQuantity   string `json:"min_quantity,omitempty"` // Smallest order quantity
+	MaxQuantity   string `json:"max_quantity,omitempty"` // Largest order quantity
+	MinPrice      string `json:"min_price,omitempty"`    // Lowest order price
+	MaxPrice      string `json:"max_price,omitempty"`    // Highest order price
+	MinNotional   string `json:"min_notional,omitempty"` // Smallest price × quantity, in the quote asset
+	Allocation    string `json:"allocation"`             // How fills split across a price level
+}
+
+// MarketsResponse represents the response for listing markets
+type MarketsResponse struct {
+	Markets []MarketDTO `json:"markets"` // Markets sorted by symbol
+}
+
+// ArmDeadManSwitchRequest represents the request body for arming a dead-man's switch
+type ArmDeadManSwitchRequest struct {
+	AccountID string `json:"account_id"` // Account ID
+	TimeoutMs int64  `json:"timeout_ms"` // Cancel all orders if no heartbeat arrives within this many milliseconds
+}
+
+// DeadManSwitchHeartbeatRequest represents the request body for a dead-man's switch heartbeat
+type DeadManSwitchHeartbeatRequest struct {
+	AccountID string `json:"account_id"` // Account ID
+}
+
+// DeadManSwitchResponse represents a dead-man's switch; timeout and deadline are omitted once disarmed
+type DeadManSwitchResponse struct {
+	AccountID string    `json:"account_id"`          // Account ID
+	TimeoutMs int64     `json:"timeout_ms,omitzero"` // Heartbeat timeout in milliseconds
+	Deadline  time.Time `json:"deadline,omitzero"`   // Orders are canceled if no heartbeat arrives by then
+}
+
 // ErrorResponse represents an error response
 type ErrorResponse struct {
 	Code      string `json:"code"`       // Error code
@@ -21,6 +21,22 @@ const (
 	ErrorCodeUnauthorized         ErrorCode = "UNAUTHORIZED"
 	ErrorCodeDuplicateRequest     ErrorCode = "DUPLICATE_REQUEST"
 	ErrorCodeInternalError        ErrorCode = "INTERNAL_ERROR"
+	ErrorCodeReadOnly             ErrorCode = "READ_ONLY"
+	ErrorCodeTimeout              ErrorCode = "TIMEOUT"
+	ErrorCodeOverloaded           ErrorCode = "OVERLOADED"
+	ErrorCodeBatchAborted         ErrorCode = "BATCH_ABORTED"
+	ErrorCodeSwitchNotArmed       ErrorCode = "SWITCH_NOT_ARMED"
+	ErrorCodeSymbolHalted         ErrorCode = "SYMBOL_HALTED"
+	ErrorCodeSymbolCancelOnly     ErrorCode = "SYMBOL_CANCEL_ONLY"
+	ErrorCodePriceOutOfBand       ErrorCode = "PRICE_OUT_OF_BAND"
+	ErrorCodeSpecConflict         ErrorCode = "SPEC_CONFLICT"
+	ErrorCodeSymbolExists         ErrorCode = "SYMBOL_EXISTS"
+	ErrorCodeSymbolNotFound       ErrorCode = "SYMBOL_NOT_FOUND"
+	ErrorCodePriceTooLow          ErrorCode = "PRICE_TOO_LOW"
+	ErrorCodePriceTooHigh         ErrorCode = "PRICE_TOO_HIGH"
+	ErrorCodeQtyTooSmall          ErrorCode = "QTY_TOO_SMALL"
+	ErrorCodeQtyTooLarge          ErrorCode = "QTY_TOO_LARGE"
+	ErrorCodeMinNotional          ErrorCode = "MIN_NOTIONAL"
 )
 
 // MapErrorToHTTP maps errors to HTTP status codes and error responses
@@ -122,6 +138,72 @@ func MapEngineErrorToHTTP(errorCode engine.ErrorCode, err error) (int, ErrorResp
 			Message: getErrorMessage(err, "duplicate request with different payload"),
 		}
 
+	case engine.ErrorCodeReadOnly:
+		return http.StatusForbidden, ErrorResponse{
+			Code:    string(ErrorCodeReadOnly),
+			Message: getErrorMessage(err, "engine is read-only"),
+		}
+
+	case engine.ErrorCodeTimeout:
+		// Not queued means not executed: the service is busy. Otherwise the outcome is unknown.
+		statusCode := http.StatusGatewayTimeout
+		if errors.Is(err, engine.ErrCommandNotQueued) {
+			statusCode = http.StatusServiceUnavailable
+		}
+		return statusCode, ErrorResponse{
+			Code:    string(ErrorCodeTimeout),
+			Message: getErrorMessage(err, "timed out"),
+		}
+
+	case engine.ErrorCodeOverloaded:
+		// Shed at the high-water mark: slow down. Full queue: even cancels were turned away.
+		statusCode := http.StatusTooManyRequests
+		var overload *engine.OverloadError
+		if errors.As(err, &overload) && overload.Full {
+			statusCode = http.StatusServiceUnavailable
+		}
+		return statusCode, ErrorResponse{
+			Code:    string(ErrorCodeOverloaded),
+			Message: getErrorMessage(err, "overloaded"),
+		}
+
+	case engine.ErrorCodeBatchAborted:
+		return http.StatusConflict, ErrorResponse{
+			Code:    string(ErrorCodeBatchAborted),
+			Message: getErrorMessage(err, "batch aborted"),
+		}
+
+	case engine.ErrorCodeSymbolHalted:
+		return http.StatusConflict, ErrorResponse{
+			Code:    string(ErrorCodeSymbolHalted),
+			Message: getErrorMessage(err, "symbol is halted"),
+		}
+
+	case engine.ErrorCodeSymbolCancelOnly:
+		return http.StatusConflict, ErrorResponse{
+			Code:    string(ErrorCodeSymbolCancelOnly),
+			Message: getErrorMessage(err, "symbol accepts cancels only"),
+		}
+
+	case engine.ErrorCodePriceOutOfBand:
+		return http.StatusBadRequest, ErrorResponse{
+			Code:    string(ErrorCodePriceOutOfBand),
+			Message: getErrorMessage(err, "price is outside the price band"),
+		}
+
+	case engine.ErrorCodeSpecConflict:
+		return http.StatusConflict, ErrorResponse{
+			Code:    string(ErrorCodeSpecConflict),
+			Message: getErrorMessage(err, "spec conflicts with resting orders"),
+		}
+
+	case engine.ErrorCodePriceTooLow, engine.ErrorCodePriceTooHigh, engine.ErrorCodeQtyTooSmall,
+		engine.ErrorCodeQtyTooLarge, engine.ErrorCodeMinNotional:
+		return http.StatusBadRequest, ErrorResponse{
+			Code:    string(errorCode),
+			Message: getErrorMessage(err, "order is outside the symbol's limits"),
+		}
+
 	case engine.ErrorCodeInternalError:
 		return http.StatusInternalServerError, ErrorResponse{
 			Code:    string(ErrorCodeInternalError),
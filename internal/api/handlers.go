@@ -1,9 +1,15 @@
 package api
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -15,24 +21,64 @@ import (
 	"github.com/google/uuid"
 )
 
+// overloadRetryAfterSeconds is the Retry-After sent with shed commands; a queue drains within about a second
+const overloadRetryAfterSeconds = "1"
+
+// maxBatchOrders caps the orders of one POST /v1/orders/batch request
+const maxBatchOrders = 100
+
+// apiKeyHeader carries the API key an order is placed with; mass cancels can target it
+const apiKeyHeader = "X-API-Key"
+
 // Handler handles HTTP requests for the order API
 type Handler struct {
-	accountSvc account.Service
-	engine     *engine.Engine
+	accountSvc   account.Service
+	engine       *engine.Engine
+	apiKeySecret []byte // Keys the HMAC that derives API key IDs
 }
 
 // NewHandler creates a new API handler
+// It releases the funds of orders canceled by expired dead-man's switches,
+// and settles the auction trades of symbols reopened after a circuit breaker.
 func NewHandler(accountSvc account.Service, engine *engine.Engine) *Handler {
-	return &Handler{
+	h := &Handler{
 		accountSvc: accountSvc,
 		engine:     engine,
 	}
+	engine.SetDeadManExpiryHandler(h.releaseExpiredSwitch)
+	engine.SetBreakerReopenHandler(h.settleReopenedSymbol)
+	return h
+}
+
+// SetAPIKeySecret sets the secret API key IDs are derived with.
+// It must stay the same across restarts, or recovered orders no longer match their keys.
+func (h *Handler) SetAPIKeySecret(secret []byte) {
+	h.apiKeySecret = secret
+}
+
+// apiKeyID returns the ID of the request's API key, empty without one.
+// Orders store the ID, an HMAC of the key, so the key itself never reaches events,
+// snapshots or idempotency records.
+func (h *Handler) apiKeyID(r *http.Request) string {
+	key := r.Header.Get(apiKeyHeader)
+	if key == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, h.apiKeySecret)
+	mac.Write([]byte(key))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
 }
 
 // PlaceOrder handles POST /v1/orders
 func (h *Handler) PlaceOrder(w http.ResponseWriter, r *http.Request) {
 	requestID := generateRequestID()
 
+	// Refuse before freezing any balance
+	if h.engine.ReadOnly() {
+		writeErrorResponse(w, http.StatusForbidden, requestID, ErrorCodeReadOnly, "engine is read-only")
+		return
+	}
+
 	// Parse request body
 	var req PlaceOrderRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -40,61 +86,116 @@ func (h *Handler) PlaceOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate required fields
-	if err := h.validatePlaceOrderRequest(&req); err != nil {
-		writeErrorResponse(w, http.StatusBadRequest, requestID, ErrorCodeInvalidArgument, err.Error())
+	order, reqErr := h.preparePlaceOrder(&req, h.apiKeyID(r))
+	if reqErr != nil {
+		writeErrorResponse(w, reqErr.statusCode, requestID, reqErr.code, reqErr.message)
+		return
+	}
+
+	// Shed early under load, before funds are frozen for an order the engine would turn away
+	if shed := h.shedPlace(req.Symbol); shed != nil {
+		writeEngineErrorResponse(w, requestID, shed)
+		return
+	}
+
+	// Step 1: Check and freeze balance
+	if err := h.freezeForPlace(order); err != nil {
+		statusCode, errResp := MapErrorToHTTP(err)
+		writeMappedErrorResponse(w, statusCode, requestID, errResp)
+		return
+	}
+
+	// Step 2: Submit to engine
+	result := waitOrSettleLater(r.Context(), h.engine.SubmitAsync(r.Context(), order.envelope), func(result *engine.CommandExecResult) {
+		h.completePlace(order, result)
+	})
+
+	// Step 3: Handle engine result
+	resp, failed := h.completePlace(order, result)
+	if failed != nil {
+		writeEngineErrorResponse(w, requestID, failed)
 		return
 	}
+	writeSuccessResponse(w, http.StatusOK, requestID, resp)
+}
+
+// placeOrder is a validated order request and the engine command that places it
+type placeOrder struct {
+	req      *PlaceOrderRequest
+	spec     symbolspec.Spec
+	orderID  string
+	priceInt int64
+	qtyInt   int64
+	envelope *engine.CommandEnvelope
+}
+
+// requestError is a request rejected before it reaches the engine
+type requestError struct {
+	statusCode int
+	code       ErrorCode
+	message    string
+}
+
+func badRequest(message string) *requestError {
+	return &requestError{statusCode: http.StatusBadRequest, code: ErrorCodeInvalidArgument, message: message}
+}
+
+// limitViolation is an order outside its symbol's order limits
+func limitViolation(err error) *requestError {
+	code := ErrorCodeInvalidArgument
+	switch {
+	case errors.Is(err, symbolspec.ErrPriceTooLow):
+		code = ErrorCodePriceTooLow
+	case errors.Is(err, symbolspec.ErrPriceTooHigh):
+		code = ErrorCodePriceTooHigh
+	case errors.Is(err, symbolspec.ErrQtyTooSmall):
+		code = ErrorCodeQtyTooSmall
+	case errors.Is(err, symbolspec.ErrQtyTooLarge):
+		code = ErrorCodeQtyTooLarge
+	case errors.Is(err, symbolspec.ErrMinNotional):
+		code = ErrorCodeMinNotional
+	}
+	return &requestError{statusCode: http.StatusBadRequest, code: code, message: err.Error()}
+}
+
+// preparePlaceOrder validates an order request and builds its place command
+func (h *Handler) preparePlaceOrder(req *PlaceOrderRequest, apiKeyID string) (*placeOrder, *requestError) {
+	// Validate required fields
+	if err := h.validatePlaceOrderRequest(req); err != nil {
+		return nil, badRequest(err.Error())
+	}
 
 	// Parse symbol precision spec.
 	spec, err := symbolspec.Get(req.Symbol)
 	if err != nil {
-		writeErrorResponse(w, http.StatusBadRequest, requestID, ErrorCodeInvalidArgument, err.Error())
-		return
+		return nil, badRequest(err.Error())
 	}
 
 	// Convert decimal price/quantity strings into fixed-scale int64.
 	priceInt, err := symbolspec.ParseScaledInt(req.Price, spec.PriceScale)
 	if err != nil {
-		writeErrorResponse(w, http.StatusBadRequest, requestID, ErrorCodeInvalidArgument, fmt.Sprintf("invalid price: %v", err))
-		return
+		return nil, badRequest(fmt.Sprintf("invalid price: %v", err))
 	}
 
 	qtyInt, err := symbolspec.ParseScaledInt(req.Quantity, spec.QuantityScale)
 	if err != nil {
-		writeErrorResponse(w, http.StatusBadRequest, requestID, ErrorCodeInvalidArgument, fmt.Sprintf("invalid quantity: %v", err))
-		return
+		return nil, badRequest(fmt.Sprintf("invalid quantity: %v", err))
 	}
 
 	if spec.PriceTickInt > 0 && priceInt%spec.PriceTickInt != 0 {
-		writeErrorResponse(w, http.StatusBadRequest, requestID, ErrorCodeInvalidArgument, "price does not match tick size")
-		return
+		return nil, badRequest("price does not match tick size")
 	}
 	if spec.QtyStepInt > 0 && qtyInt%spec.QtyStepInt != 0 {
-		writeErrorResponse(w, http.StatusBadRequest, requestID, ErrorCodeInvalidArgument, "quantity does not match lot size")
-		return
+		return nil, badRequest("quantity does not match lot size")
+	}
+	// The engine checks again against the spec in force when the order executes
+	if err := spec.CheckOrder(priceInt, qtyInt); err != nil {
+		return nil, limitViolation(err)
 	}
 
 	// Generate deterministic order ID in scoped namespace to avoid cross-account collisions.
 	orderID := generateOrderIDFromIdempotencyKey(req.AccountID, req.Symbol, req.IdempotencyKey)
 
-	// Step 1: Check and freeze balance
-	placeIntent := account.PlaceIntent{
-		AccountID: req.AccountID,
-		OrderID:   orderID,
-		Symbol:    req.Symbol,
-		Side:      req.Side,
-		PriceInt:  priceInt,
-		QtyInt:    qtyInt,
-	}
-
-	if err := h.accountSvc.CheckAndFreezeForPlace(placeIntent); err != nil {
-		statusCode, errResp := MapErrorToHTTP(err)
-		writeMappedErrorResponse(w, statusCode, requestID, errResp)
-		return
-	}
-
-	// Step 2: Submit to engine
 	placeReq := &matching.PlaceOrderRequest{
 		OrderID:       orderID,
 		ClientOrderID: req.ClientOrderID,
@@ -103,60 +204,214 @@ func (h *Handler) PlaceOrder(w http.ResponseWriter, r *http.Request) {
 		Side:          matching.Side(req.Side),
 		PriceInt:      priceInt,
 		QuantityInt:   qtyInt,
+		APIKeyID:      apiKeyID,
+		GroupID:       req.GroupID,
 	}
 
 	payloadHash, err := engine.ComputePayloadHash(placeReq)
 	if err != nil {
-		// Rollback freeze
-		h.rollbackFreeze(orderID, req.AccountID, req.Symbol)
-		writeErrorResponse(w, http.StatusInternalServerError, requestID, ErrorCodeInternalError, "failed to compute payload hash")
-		return
+		return nil, &requestError{statusCode: http.StatusInternalServerError, code: ErrorCodeInternalError, message: "failed to compute payload hash"}
 	}
 
-	envelope := &engine.CommandEnvelope{
-		CommandID:      generateCommandID(),
-		CommandType:    engine.CommandTypePlace,
-		IdempotencyKey: req.IdempotencyKey,
-		Symbol:         req.Symbol,
-		AccountID:      req.AccountID,
-		PayloadHash:    payloadHash,
-		Payload:        placeReq,
-		CreatedAt:      time.Now(),
+	return &placeOrder{
+		req:      req,
+		spec:     spec,
+		orderID:  orderID,
+		priceInt: priceInt,
+		qtyInt:   qtyInt,
+		envelope: &engine.CommandEnvelope{
+			CommandID:      generateCommandID(),
+			CommandType:    engine.CommandTypePlace,
+			IdempotencyKey: req.IdempotencyKey,
+			Symbol:         req.Symbol,
+			AccountID:      req.AccountID,
+			PayloadHash:    payloadHash,
+			Payload:        placeReq,
+			CreatedAt:      time.Now(),
+		},
+	}, nil
+}
+
+// shedPlace returns an overloaded result when the symbol's shard is shedding places, or nil
+func (h *Handler) shedPlace(symbol string) *engine.CommandExecResult {
+	stats := h.engine.SymbolQueueStats(symbol)
+	if !stats.SheddingPlaces() {
+		return nil
 	}
+	return &engine.CommandExecResult{
+		ErrorCode: engine.ErrorCodeOverloaded,
+		Err:       &engine.OverloadError{ShardID: stats.ShardID, Depth: stats.Depth, Capacity: stats.Capacity},
+	}
+}
 
-	result := h.engine.Submit(envelope)
+// freezeForPlace checks and freezes the balance an order needs
+func (h *Handler) freezeForPlace(order *placeOrder) error {
+	return h.accountSvc.CheckAndFreezeForPlace(account.PlaceIntent{
+		AccountID: order.req.AccountID,
+		OrderID:   order.orderID,
+		Symbol:    order.req.Symbol,
+		Side:      order.req.Side,
+		PriceInt:  order.priceInt,
+		QtyInt:    order.qtyInt,
+		GroupID:   order.req.GroupID,
+	})
+}
 
-	// Step 3: Handle engine result
+// completePlace settles the trades of a placed order and builds its response.
+// A failed place releases its freeze and is returned as the failure.
+func (h *Handler) completePlace(order *placeOrder, result *engine.CommandExecResult) (*PlaceOrderResponse, *engine.CommandExecResult) {
+	req := order.req
 	if result.ErrorCode != engine.ErrorCodeNone {
-		// Rollback freeze
-		h.rollbackFreeze(orderID, req.AccountID, req.Symbol)
-		statusCode, errResp := MapEngineErrorToHTTP(result.ErrorCode, result.Err)
-		writeMappedErrorResponse(w, statusCode, requestID, errResp)
-		return
+		// Rollback freeze, unless the command was queued before the timeout and may still execute:
+		// the order would then need its funds, and its outcome is settled once it executes
+		if !outcomeUnknown(result) {
+			h.rollbackFreeze(order.orderID, req.AccountID, req.Symbol)
+		}
+		return nil, result
 	}
 
 	// Success: convert result to response
 	matchResult, ok := result.Result.(*matching.CommandResult)
 	if !ok {
 		// Rollback freeze
-		h.rollbackFreeze(orderID, req.AccountID, req.Symbol)
-		writeErrorResponse(w, http.StatusInternalServerError, requestID, ErrorCodeInternalError, "invalid result type")
-		return
+		h.rollbackFreeze(order.orderID, req.AccountID, req.Symbol)
+		return nil, &engine.CommandExecResult{ErrorCode: engine.ErrorCodeInternalError, Err: fmt.Errorf("invalid result type")}
 	}
 	if err := h.applyTrades(matchResult.Trades); err != nil {
-		writeErrorResponse(w, http.StatusInternalServerError, requestID, ErrorCodeInternalError, "failed to settle trade balances")
-		return
+		return nil, &engine.CommandExecResult{ErrorCode: engine.ErrorCodeInternalError, Err: fmt.Errorf("failed to settle trade balances")}
 	}
+	// Release the group legs the place canceled, the order's own or a filled maker's
+	h.releaseCanceled(result)
 
 	// Build response
-	resp := h.buildPlaceOrderResponse(orderID, &req, priceInt, qtyInt, matchResult, spec)
-	writeSuccessResponse(w, http.StatusOK, requestID, resp)
+	resp := h.buildPlaceOrderResponse(order.orderID, req, order.priceInt, order.qtyInt, matchResult, order.spec)
+	return &resp, nil
+}
+
+// PlaceOrderBatch handles POST /v1/orders/batch.
+// Orders are submitted together, so each shard runs its share back to back, and every order
+// gets its own result. With all_or_nothing, the orders of a symbol are all placed or none are.
+func (h *Handler) PlaceOrderBatch(w http.ResponseWriter, r *http.Request) {
+	requestID := generateRequestID()
+
+	// Refuse before freezing any balance
+	if h.engine.ReadOnly() {
+		writeErrorResponse(w, http.StatusForbidden, requestID, ErrorCodeReadOnly, "engine is read-only")
+		return
+	}
+
+	var req BatchPlaceOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, requestID, ErrorCodeInvalidArgument, "invalid request body")
+		return
+	}
+	if len(req.Orders) == 0 {
+		writeErrorResponse(w, http.StatusBadRequest, requestID, ErrorCodeInvalidArgument, "orders required")
+		return
+	}
+	if len(req.Orders) > maxBatchOrders {
+		writeErrorResponse(w, http.StatusBadRequest, requestID, ErrorCodeInvalidArgument, fmt.Sprintf("at most %d orders per batch", maxBatchOrders))
+		return
+	}
+
+	results := make([]BatchOrderResult, len(req.Orders))
+	orders := make([]*placeOrder, len(req.Orders))
+	failedSymbols := make(map[string]ErrorCode) // All-or-nothing symbols with a failed order
+	fail := func(i int, statusCode int, errResp ErrorResponse) {
+		results[i].Status = statusCode
+		results[i].Error = &BatchErrorDTO{Code: errResp.Code, Message: errResp.Message}
+		if _, ok := failedSymbols[req.Orders[i].Symbol]; req.AllOrNothing && !ok {
+			failedSymbols[req.Orders[i].Symbol] = ErrorCode(errResp.Code)
+		}
+	}
+
+	// Step 1: Validate and freeze each order
+	for i := range req.Orders {
+		results[i].Index = i
+		if code, ok := failedSymbols[req.Orders[i].Symbol]; ok {
+			fail(i, http.StatusConflict, batchAbortedResponse(code))
+			continue
+		}
+		order, reqErr := h.preparePlaceOrder(&req.Orders[i], h.apiKeyID(r))
+		if reqErr != nil {
+			fail(i, reqErr.statusCode, ErrorResponse{Code: string(reqErr.code), Message: reqErr.message})
+			continue
+		}
+		if shed := h.shedPlace(order.req.Symbol); shed != nil {
+			w.Header().Set("Retry-After", overloadRetryAfterSeconds)
+			statusCode, errResp := MapEngineErrorToHTTP(shed.ErrorCode, shed.Err)
+			fail(i, statusCode, errResp)
+			continue
+		}
+		if err := h.freezeForPlace(order); err != nil {
+			statusCode, errResp := MapErrorToHTTP(err)
+			fail(i, statusCode, errResp)
+			continue
+		}
+		orders[i] = order
+	}
+
+	// Orders frozen before another order of their symbol failed are not submitted
+	var envelopes []*engine.CommandEnvelope
+	var submitted []int
+	for i, order := range orders {
+		if order == nil {
+			continue
+		}
+		if code, ok := failedSymbols[order.req.Symbol]; ok {
+			h.rollbackFreeze(order.orderID, order.req.AccountID, order.req.Symbol)
+			results[i].Status = http.StatusConflict
+			errResp := batchAbortedResponse(code)
+			results[i].Error = &BatchErrorDTO{Code: errResp.Code, Message: errResp.Message}
+			continue
+		}
+		envelopes = append(envelopes, order.envelope)
+		submitted = append(submitted, i)
+	}
+
+	// Step 2: Submit to engine
+	futures := h.engine.SubmitBatchAsync(r.Context(), envelopes, req.AllOrNothing)
+
+	// Step 3: Handle each engine result
+	for j, future := range futures {
+		i := submitted[j]
+		result := waitOrSettleLater(r.Context(), future, func(result *engine.CommandExecResult) {
+			h.completePlace(orders[i], result)
+		})
+		resp, failed := h.completePlace(orders[i], result)
+		if failed != nil {
+			if failed.ErrorCode == engine.ErrorCodeOverloaded {
+				w.Header().Set("Retry-After", overloadRetryAfterSeconds)
+			}
+			statusCode, errResp := MapEngineErrorToHTTP(failed.ErrorCode, failed.Err)
+			results[i].Status = statusCode
+			results[i].Error = &BatchErrorDTO{Code: errResp.Code, Message: errResp.Message}
+			continue
+		}
+		results[i].Status = http.StatusOK
+		results[i].Order = resp
+	}
+
+	writeSuccessResponse(w, http.StatusOK, requestID, BatchPlaceOrderResponse{Results: results})
+}
+
+// batchAbortedResponse is the error of an order withdrawn because another order of its symbol failed
+func batchAbortedResponse(code ErrorCode) ErrorResponse {
+	return ErrorResponse{
+		Code:    string(ErrorCodeBatchAborted),
+		Message: fmt.Sprintf("batch aborted: another order for the symbol failed with %s", code),
+	}
 }
 
 // CancelOrder handles DELETE /v1/orders/{order_id}
 func (h *Handler) CancelOrder(w http.ResponseWriter, r *http.Request) {
 	requestID := generateRequestID()
 
+	if h.engine.ReadOnly() {
+		writeErrorResponse(w, http.StatusForbidden, requestID, ErrorCodeReadOnly, "engine is read-only")
+		return
+	}
+
 	// Extract order_id from URL path
 	orderID := extractOrderID(r.URL.Path)
 	if orderID == "" {
@@ -201,25 +456,16 @@ func (h *Handler) CancelOrder(w http.ResponseWriter, r *http.Request) {
 		CreatedAt:      time.Now(),
 	}
 
-	result := h.engine.Submit(envelope)
+	result := h.engine.SubmitContext(r.Context(), envelope)
 
 	// Handle engine result
 	if result.ErrorCode != engine.ErrorCodeNone {
-		statusCode, errResp := MapEngineErrorToHTTP(result.ErrorCode, result.Err)
-		writeMappedErrorResponse(w, statusCode, requestID, errResp)
+		writeEngineErrorResponse(w, requestID, result)
 		return
 	}
 
-	// Release frozen funds
-	cancelIntent := account.CancelIntent{
-		AccountID: accountID,
-		OrderID:   orderID,
-		Symbol:    symbol,
-	}
-	if err := h.accountSvc.ReleaseOnCancel(cancelIntent); err != nil {
-		// Log error but don't fail the request (order is already canceled in engine)
-		// In production, this should be handled with retry or compensation
-	}
+	// Release frozen funds of the order and of the other legs of its group
+	h.releaseCanceled(result)
 
 	// Build response
 	matchResult, ok := result.Result.(*matching.CommandResult)
@@ -232,6 +478,497 @@ func (h *Handler) CancelOrder(w http.ResponseWriter, r *http.Request) {
 	writeSuccessResponse(w, http.StatusOK, requestID, resp)
 }
 
+// MassCancelOrders handles DELETE /v1/orders.
+// It cancels the orders of account_id, or of every account placed with the request's
+// X-API-Key, optionally narrowed to one symbol and side.
+func (h *Handler) MassCancelOrders(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	req := &matching.MassCancelRequest{
+		AccountID: query.Get("account_id"),
+		Symbol:    query.Get("symbol"),
+		Side:      matching.Side(query.Get("side")),
+		APIKeyID:  h.apiKeyID(r),
+	}
+	if req.AccountID == "" && req.APIKeyID == "" {
+		writeErrorResponse(w, http.StatusBadRequest, generateRequestID(), ErrorCodeInvalidArgument, "account_id or X-API-Key required")
+		return
+	}
+	h.massCancel(w, r, req)
+}
+
+// AdminMassCancelOrders handles DELETE /v1/admin/orders.
+// It cancels the orders of every account on a symbol, optionally on one side, as SYSTEM cancels.
+func (h *Handler) AdminMassCancelOrders(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	req := &matching.MassCancelRequest{
+		Symbol: query.Get("symbol"),
+		Side:   matching.Side(query.Get("side")),
+		Reason: matching.CancelReasonSystem,
+	}
+	if req.Symbol == "" {
+		writeErrorResponse(w, http.StatusBadRequest, generateRequestID(), ErrorCodeInvalidArgument, "symbol required")
+		return
+	}
+	h.massCancel(w, r, req)
+}
+
+// massCancel submits a mass cancel and releases the funds of every order it canceled.
+// Funds are released even when a shard fails, for the orders the other shards canceled.
+func (h *Handler) massCancel(w http.ResponseWriter, r *http.Request, req *matching.MassCancelRequest) {
+	requestID := generateRequestID()
+
+	if h.engine.ReadOnly() {
+		writeErrorResponse(w, http.StatusForbidden, requestID, ErrorCodeReadOnly, "engine is read-only")
+		return
+	}
+	if req.Symbol != "" {
+		if _, err := symbolspec.Get(req.Symbol); err != nil {
+			writeErrorResponse(w, http.StatusBadRequest, requestID, ErrorCodeInvalidArgument, err.Error())
+			return
+		}
+	}
+	if err := req.Validate(); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, requestID, ErrorCodeInvalidArgument, err.Error())
+		return
+	}
+
+	payloadHash, err := engine.ComputePayloadHash(req)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, requestID, ErrorCodeInternalError, "failed to compute payload hash")
+		return
+	}
+
+	commandID := generateCommandID()
+	envelope := &engine.CommandEnvelope{
+		CommandID:      commandID,
+		CommandType:    engine.CommandTypeMassCancel,
+		IdempotencyKey: "mass_cancel_" + commandID,
+		Symbol:         req.Symbol,
+		AccountID:      req.AccountID,
+		PayloadHash:    payloadHash,
+		Payload:        req,
+		CreatedAt:      time.Now(),
+	}
+
+	result := waitOrSettleLater(r.Context(), h.engine.SubmitAsync(r.Context(), envelope), func(result *engine.CommandExecResult) {
+		h.releaseCanceled(result)
+	})
+
+	resp := MassCancelResponse{Orders: h.releaseCanceled(result)}
+	resp.CanceledCount = len(resp.Orders)
+
+	if result.ErrorCode != engine.ErrorCodeNone {
+		writeEngineErrorResponse(w, requestID, result)
+		return
+	}
+	writeSuccessResponse(w, http.StatusOK, requestID, resp)
+}
+
+// releaseCanceled releases the frozen funds of every order a command canceled and returns the orders
+func (h *Handler) releaseCanceled(result *engine.CommandExecResult) []CanceledOrderDTO {
+	orders := []CanceledOrderDTO{}
+	matchResult, ok := result.Result.(*matching.CommandResult)
+	if !ok {
+		return orders
+	}
+	for _, event := range matchResult.Events {
+		canceled, ok := event.(*matching.OrderCanceledEvent)
+		if !ok {
+			continue
+		}
+		// Release frozen funds; the order is already canceled in the engine
+		_ = h.accountSvc.ReleaseOnCancel(account.CancelIntent{
+			AccountID: canceled.AccountID,
+			OrderID:   canceled.OrderID,
+			Symbol:    canceled.SymbolValue,
+		})
+		spec, err := symbolspec.Get(canceled.SymbolValue)
+		if err != nil {
+			spec = symbolspec.Spec{}
+		}
+		orders = append(orders, CanceledOrderDTO{
+			OrderID:      canceled.OrderID,
+			AccountID:    canceled.AccountID,
+			Symbol:       canceled.SymbolValue,
+			RemainingQty: symbolspec.FormatScaledInt(canceled.RemainingQty, spec.QuantityScale),
+		})
+	}
+	return orders
+}
+
+// releaseExpiredSwitch releases the funds of the orders an expired dead-man's switch canceled
+func (h *Handler) releaseExpiredSwitch(accountID string, result *engine.CommandExecResult) {
+	h.releaseCanceled(result)
+}
+
+// settleReopenedSymbol settles the auction trades of a symbol reopened after a circuit breaker
+// or a status change, and releases the group legs they canceled
+func (h *Handler) settleReopenedSymbol(symbol string, result *engine.CommandExecResult) {
+	matchResult, ok := result.Result.(*matching.CommandResult)
+	if !ok {
+		return
+	}
+	if err := h.applyTrades(matchResult.Trades); err != nil {
+		fmt.Printf("Warning: failed to settle the reopening trades of %s: %v\n", symbol, err)
+	}
+	h.releaseCanceled(result)
+}
+
+// SetSymbolStatus handles POST /v1/admin/symbols/status.
+// HALTED rejects every order command and CANCEL_ONLY rejects places. PRE_OPEN collects
+// orders for a call auction, which leaving it for TRADING or CANCEL_ONLY uncrosses.
+func (h *Handler) SetSymbolStatus(w http.ResponseWriter, r *http.Request) {
+	requestID := generateRequestID()
+
+	if h.engine.ReadOnly() {
+		writeErrorResponse(w, http.StatusForbidden, requestID, ErrorCodeReadOnly, "engine is read-only")
+		return
+	}
+	var body SetSymbolStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, requestID, ErrorCodeInvalidArgument, "invalid request body")
+		return
+	}
+	spec, err := symbolspec.Get(body.Symbol)
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, requestID, ErrorCodeInvalidArgument, err.Error())
+		return
+	}
+	req := &matching.SetSymbolStatusRequest{
+		Symbol: body.Symbol,
+		Status: matching.SymbolStatus(body.Status),
+		Reason: body.Reason,
+	}
+	if err := req.Validate(); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, requestID, ErrorCodeInvalidArgument, err.Error())
+		return
+	}
+
+	payloadHash, err := engine.ComputePayloadHash(req)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, requestID, ErrorCodeInternalError, "failed to compute payload hash")
+		return
+	}
+	commandID := generateCommandID()
+	future := h.engine.SubmitAsync(r.Context(), &engine.CommandEnvelope{
+		CommandID:      commandID,
+		CommandType:    engine.CommandTypeSetSymbolStatus,
+		IdempotencyKey: "symbol_status_" + commandID,
+		Symbol:         req.Symbol,
+		PayloadHash:    payloadHash,
+		Payload:        req,
+		CreatedAt:      time.Now(),
+	})
+	result := waitOrSettleLater(r.Context(), future, func(result *engine.CommandExecResult) {
+		h.settleReopenedSymbol(req.Symbol, result)
+	})
+	if result.ErrorCode != engine.ErrorCodeNone {
+		writeEngineErrorResponse(w, requestID, result)
+		return
+	}
+
+	// Setting the current status changes nothing and records no event
+	resp := SetSymbolStatusResponse{Symbol: req.Symbol, PreviousStatus: string(req.Status), Status: string(req.Status)}
+	if matchResult, ok := result.Result.(*matching.CommandResult); ok {
+		for _, event := range matchResult.Events {
+			if changed, ok := event.(*matching.SymbolStatusChangedEvent); ok {
+				resp.PreviousStatus = string(changed.OldStatus)
+			}
+		}
+		// Settle the auction trades of an uncross, and release the group legs they canceled
+		if err := h.applyTrades(matchResult.Trades); err != nil {
+			writeErrorResponse(w, http.StatusInternalServerError, requestID, ErrorCodeInternalError, "failed to settle trade balances")
+			return
+		}
+		h.releaseCanceled(result)
+		for _, trade := range matchResult.Trades {
+			resp.Trades = append(resp.Trades, TradeDTO{
+				TradeID:   trade.TradeID,
+				Price:     symbolspec.FormatScaledInt(trade.Price, spec.PriceScale),
+				Quantity:  symbolspec.FormatScaledInt(trade.Quantity, spec.QuantityScale),
+				Side:      string(trade.TakerSide),
+				Timestamp: trade.OccurredAt,
+			})
+		}
+	}
+	writeSuccessResponse(w, http.StatusOK, requestID, resp)
+}
+
+// ListMarkets handles GET /v1/markets
+func (h *Handler) ListMarkets(w http.ResponseWriter, r *http.Request) {
+	requestID := generateRequestID()
+
+	resp := MarketsResponse{Markets: []MarketDTO{}}
+	for _, spec := range symbolspec.List() {
+		base, quote, err := account.ParseSymbol(spec.Symbol)
+		if err != nil {
+			continue
+		}
+		resp.Markets = append(resp.Markets, MarketDTO{
+			Symbol:        spec.Symbol,
+			BaseAsset:     base,
+			QuoteAsset:    quote,
+			PriceScale:    spec.PriceScale,
+			QuantityScale: spec.QuantityScale,
+			PriceTick:     symbolspec.FormatScaledInt(spec.PriceTickInt, spec.PriceScale),
+			QuantityStep:  symbolspec.FormatScaledInt(spec.QtyStepInt, spec.QuantityScale),
+			MinQuantity:   formatLimit(spec.MinQtyInt, spec.QuantityScale),
+			MaxQuantity:   formatLimit(spec.MaxQtyInt, spec.QuantityScale),
+			MinPrice:      formatLimit(spec.MinPriceInt, spec.PriceScale),
+			MaxPrice:      formatLimit(spec.MaxPriceInt, spec.PriceScale),
+			MinNotional:   formatLimit(spec.MinNotionalInt, spec.PriceScale),
+			Allocation:    string(allocationOf(spec)),
+		})
+	}
+	writeSuccessResponse(w, http.StatusOK, requestID, resp)
+}
+
+// ListSymbolSpecs handles GET /v1/admin/symbols
+func (h *Handler) ListSymbolSpecs(w http.ResponseWriter, r *http.Request) {
+	requestID := generateRequestID()
+
+	resp := ListSymbolSpecsResponse{Symbols: []SymbolSpecDTO{}}
+	for _, spec := range symbolspec.List() {
+		resp.Symbols = append(resp.Symbols, symbolSpecDTO(spec))
+	}
+	writeSuccessResponse(w, http.StatusOK, requestID, resp)
+}
+
+// CreateSymbol handles POST /v1/admin/symbols; the symbol must not exist yet
+func (h *Handler) CreateSymbol(w http.ResponseWriter, r *http.Request) {
+	h.setSymbolSpec(w, r, false)
+}
+
+// UpdateSymbol handles PUT /v1/admin/symbols; the symbol must exist.
+// Changes that resting orders would not satisfy are rejected with SPEC_CONFLICT.
+func (h *Handler) UpdateSymbol(w http.ResponseWriter, r *http.Request) {
+	h.setSymbolSpec(w, r, true)
+}
+
+// setSymbolSpec submits a symbol's new spec as a SET_SYMBOL_SPEC command, which persists it
+func (h *Handler) setSymbolSpec(w http.ResponseWriter, r *http.Request, update bool) {
+	requestID := generateRequestID()
+
+	if h.engine.ReadOnly() {
+		writeErrorResponse(w, http.StatusForbidden, requestID, ErrorCodeReadOnly, "engine is read-only")
+		return
+	}
+	var body SymbolSpecDTO
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, requestID, ErrorCodeInvalidArgument, "invalid request body")
+		return
+	}
+	spec, err := parseSymbolSpec(body)
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, requestID, ErrorCodeInvalidArgument, err.Error())
+		return
+	}
+
+	_, err = symbolspec.Get(spec.Symbol)
+	exists := err == nil
+	if update && !exists {
+		writeErrorResponse(w, http.StatusNotFound, requestID, ErrorCodeSymbolNotFound, fmt.Sprintf("symbol %s not found", spec.Symbol))
+		return
+	}
+	if !update && exists {
+		writeErrorResponse(w, http.StatusConflict, requestID, ErrorCodeSymbolExists, fmt.Sprintf("symbol %s already exists", spec.Symbol))
+		return
+	}
+
+	payloadHash, err := engine.ComputePayloadHash(spec)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, requestID, ErrorCodeInternalError, "failed to compute payload hash")
+		return
+	}
+	commandID := generateCommandID()
+	result := h.engine.SubmitContext(r.Context(), &engine.CommandEnvelope{
+		CommandID:      commandID,
+		CommandType:    engine.CommandTypeSetSymbolSpec,
+		IdempotencyKey: "symbol_spec_" + commandID,
+		Symbol:         spec.Symbol,
+		PayloadHash:    payloadHash,
+		Payload:        spec,
+		CreatedAt:      time.Now(),
+	})
+	if result.ErrorCode != engine.ErrorCodeNone {
+		writeEngineErrorResponse(w, requestID, result)
+		return
+	}
+
+	statusCode := http.StatusOK
+	if !update {
+		statusCode = http.StatusCreated
+	}
+	writeSuccessResponse(w, statusCode, requestID, symbolSpecDTO(*spec))
+}
+
+// parseSymbolSpec converts an admin request into a validated spec
+func parseSymbolSpec(body SymbolSpecDTO) (*symbolspec.Spec, error) {
+	spec := &symbolspec.Spec{
+		Symbol:            strings.ToUpper(strings.TrimSpace(body.Symbol)),
+		PriceScale:        body.PriceScale,
+		QuantityScale:     body.QuantityScale,
+		PriceBandBps:      body.PriceBandBps,
+		TradeBandBps:      body.TradeBandBps,
+		BreakerAuction:    body.BreakerAuction,
+		BreakerCoolingOff: time.Duration(body.BreakerCoolingOffMs) * time.Millisecond,
+		Allocation:        symbolspec.Allocation(strings.ToUpper(body.Allocation)),
+		LMMAccountID:      body.LMMAccountID,
+		LMMShareBps:       body.LMMShareBps,
+	}
+	if spec.PriceScale < 0 || spec.PriceScale > symbolspec.MaxScale || spec.QuantityScale < 0 || spec.QuantityScale > symbolspec.MaxScale {
+		return nil, fmt.Errorf("scales must be between 0 and %d", symbolspec.MaxScale)
+	}
+	var err error
+	if spec.PriceTickInt, err = symbolspec.ParseScaledInt(body.PriceTick, spec.PriceScale); err != nil {
+		return nil, fmt.Errorf("invalid price_tick: %w", err)
+	}
+	if spec.QtyStepInt, err = symbolspec.ParseScaledInt(body.QuantityStep, spec.QuantityScale); err != nil {
+		return nil, fmt.Errorf("invalid quantity_step: %w", err)
+	}
+	for _, limit := range []struct {
+		name  string
+		value string
+		scale int
+		into  *int64
+	}{
+		{"min_quantity", body.MinQuantity, spec.QuantityScale, &spec.MinQtyInt},
+		{"max_quantity", body.MaxQuantity, spec.QuantityScale, &spec.MaxQtyInt},
+		{"min_price", body.MinPrice, spec.PriceScale, &spec.MinPriceInt},
+		{"max_price", body.MaxPrice, spec.PriceScale, &spec.MaxPriceInt},
+		{"min_notional", body.MinNotional, spec.PriceScale, &spec.MinNotionalInt},
+	} {
+		if limit.value == "" {
+			continue
+		}
+		if *limit.into, err = symbolspec.ParseScaledInt(limit.value, limit.scale); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", limit.name, err)
+		}
+	}
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+// symbolSpecDTO converts a spec into its admin representation
+func symbolSpecDTO(spec symbolspec.Spec) SymbolSpecDTO {
+	return SymbolSpecDTO{
+		Symbol:              spec.Symbol,
+		PriceScale:          spec.PriceScale,
+		QuantityScale:       spec.QuantityScale,
+		PriceTick:           symbolspec.FormatScaledInt(spec.PriceTickInt, spec.PriceScale),
+		QuantityStep:        symbolspec.FormatScaledInt(spec.QtyStepInt, spec.QuantityScale),
+		PriceBandBps:        spec.PriceBandBps,
+		TradeBandBps:        spec.TradeBandBps,
+		BreakerAuction:      spec.BreakerAuction,
+		BreakerCoolingOffMs: spec.BreakerCoolingOff.Milliseconds(),
+		MinQuantity:         formatLimit(spec.MinQtyInt, spec.QuantityScale),
+		MaxQuantity:         formatLimit(spec.MaxQtyInt, spec.QuantityScale),
+		MinPrice:            formatLimit(spec.MinPriceInt, spec.PriceScale),
+		MaxPrice:            formatLimit(spec.MaxPriceInt, spec.PriceScale),
+		MinNotional:         formatLimit(spec.MinNotionalInt, spec.PriceScale),
+		Allocation:          string(spec.Allocation),
+		LMMAccountID:        spec.LMMAccountID,
+		LMMShareBps:         spec.LMMShareBps,
+	}
+}
+
+// allocationOf returns the spec's allocation, spelling out the FIFO default
+func allocationOf(spec symbolspec.Spec) symbolspec.Allocation {
+	if spec.Allocation == "" {
+		return symbolspec.AllocationFIFO
+	}
+	return spec.Allocation
+}
+
+// formatLimit formats an order limit, or returns "" for no limit
+func formatLimit(v int64, scale int) string {
+	if v == 0 {
+		return ""
+	}
+	return symbolspec.FormatScaledInt(v, scale)
+}
+
+// ArmDeadManSwitch handles POST /v1/dead-man-switch.
+// Unless the account heartbeats within timeout_ms, all its orders are canceled.
+func (h *Handler) ArmDeadManSwitch(w http.ResponseWriter, r *http.Request) {
+	requestID := generateRequestID()
+
+	if h.engine.ReadOnly() {
+		writeErrorResponse(w, http.StatusForbidden, requestID, ErrorCodeReadOnly, "engine is read-only")
+		return
+	}
+	var req ArmDeadManSwitchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, requestID, ErrorCodeInvalidArgument, "invalid request body")
+		return
+	}
+	if strings.TrimSpace(req.AccountID) == "" {
+		writeErrorResponse(w, http.StatusBadRequest, requestID, ErrorCodeInvalidArgument, "account_id required")
+		return
+	}
+	timeout := time.Duration(req.TimeoutMs) * time.Millisecond
+	if timeout < engine.MinDeadManTimeout {
+		writeErrorResponse(w, http.StatusBadRequest, requestID, ErrorCodeInvalidArgument, fmt.Sprintf("timeout_ms must be at least %d", engine.MinDeadManTimeout.Milliseconds()))
+		return
+	}
+
+	sw, err := h.engine.ArmDeadManSwitch(req.AccountID, timeout)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, requestID, ErrorCodeInternalError, err.Error())
+		return
+	}
+	writeSuccessResponse(w, http.StatusOK, requestID, deadManSwitchResponse(sw))
+}
+
+// HeartbeatDeadManSwitch handles POST /v1/dead-man-switch/heartbeat
+func (h *Handler) HeartbeatDeadManSwitch(w http.ResponseWriter, r *http.Request) {
+	requestID := generateRequestID()
+
+	var req DeadManSwitchHeartbeatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, requestID, ErrorCodeInvalidArgument, "invalid request body")
+		return
+	}
+	if strings.TrimSpace(req.AccountID) == "" {
+		writeErrorResponse(w, http.StatusBadRequest, requestID, ErrorCodeInvalidArgument, "account_id required")
+		return
+	}
+
+	sw, err := h.engine.HeartbeatDeadManSwitch(req.AccountID)
+	if err != nil {
+		// Not armed, or it already expired and canceled the account's orders
+		writeErrorResponse(w, http.StatusNotFound, requestID, ErrorCodeSwitchNotArmed, err.Error())
+		return
+	}
+	writeSuccessResponse(w, http.StatusOK, requestID, deadManSwitchResponse(sw))
+}
+
+// DisarmDeadManSwitch handles DELETE /v1/dead-man-switch?account_id=
+func (h *Handler) DisarmDeadManSwitch(w http.ResponseWriter, r *http.Request) {
+	requestID := generateRequestID()
+
+	accountID := r.URL.Query().Get("account_id")
+	if accountID == "" {
+		writeErrorResponse(w, http.StatusBadRequest, requestID, ErrorCodeInvalidArgument, "account_id required")
+		return
+	}
+	if err := h.engine.DisarmDeadManSwitch(accountID); err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, requestID, ErrorCodeInternalError, err.Error())
+		return
+	}
+	writeSuccessResponse(w, http.StatusOK, requestID, DeadManSwitchResponse{AccountID: accountID})
+}
+
+func deadManSwitchResponse(sw engine.DeadManSwitch) DeadManSwitchResponse {
+	return DeadManSwitchResponse{
+		AccountID: sw.AccountID,
+		TimeoutMs: sw.Timeout.Milliseconds(),
+		Deadline:  sw.Deadline,
+	}
+}
+
 // QueryOrder handles GET /v1/orders/{order_id}
 func (h *Handler) QueryOrder(w http.ResponseWriter, r *http.Request) {
 	requestID := generateRequestID()
@@ -280,12 +1017,11 @@ func (h *Handler) QueryOrder(w http.ResponseWriter, r *http.Request) {
 		CreatedAt:      time.Now(),
 	}
 
-	result := h.engine.Submit(envelope)
+	result := h.engine.SubmitContext(r.Context(), envelope)
 
 	// Handle engine result
 	if result.ErrorCode != engine.ErrorCodeNone {
-		statusCode, errResp := MapEngineErrorToHTTP(result.ErrorCode, result.Err)
-		writeMappedErrorResponse(w, statusCode, requestID, errResp)
+		writeEngineErrorResponse(w, requestID, result)
 		return
 	}
 
@@ -301,6 +1037,109 @@ func (h *Handler) QueryOrder(w http.ResponseWriter, r *http.Request) {
 	writeSuccessResponse(w, http.StatusOK, requestID, resp)
 }
 
+// QueryDepth handles GET /v1/depth?symbol=&levels=
+func (h *Handler) QueryDepth(w http.ResponseWriter, r *http.Request) {
+	requestID := generateRequestID()
+
+	symbol := r.URL.Query().Get("symbol")
+	if symbol == "" {
+		writeErrorResponse(w, http.StatusBadRequest, requestID, ErrorCodeInvalidArgument, "symbol required")
+		return
+	}
+	spec, err := symbolspec.Get(symbol)
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, requestID, ErrorCodeInvalidArgument, err.Error())
+		return
+	}
+	levels := 0
+	if raw := r.URL.Query().Get("levels"); raw != "" {
+		levels, err = strconv.Atoi(raw)
+		if err != nil || levels < 0 {
+			writeErrorResponse(w, http.StatusBadRequest, requestID, ErrorCodeInvalidArgument, "levels must be a non-negative integer")
+			return
+		}
+	}
+
+	depthReq := &matching.DepthRequest{
+		Symbol: symbol,
+		Levels: levels,
+	}
+
+	payloadHash, err := engine.ComputePayloadHash(depthReq)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, requestID, ErrorCodeInternalError, "failed to compute payload hash")
+		return
+	}
+
+	envelope := &engine.CommandEnvelope{
+		CommandID:      generateCommandID(),
+		CommandType:    engine.CommandTypeDepth,
+		IdempotencyKey: fmt.Sprintf("depth_%s_%d", symbol, time.Now().UnixNano()),
+		Symbol:         symbol,
+		PayloadHash:    payloadHash,
+		Payload:        depthReq,
+		CreatedAt:      time.Now(),
+	}
+
+	result := h.engine.SubmitContext(r.Context(), envelope)
+	if result.ErrorCode != engine.ErrorCodeNone {
+		writeEngineErrorResponse(w, requestID, result)
+		return
+	}
+
+	depth, ok := result.Result.(*matching.BookDepth)
+	if !ok {
+		writeErrorResponse(w, http.StatusInternalServerError, requestID, ErrorCodeInternalError, "invalid result type")
+		return
+	}
+
+	writeSuccessResponse(w, http.StatusOK, requestID, h.buildDepthResponse(depth, spec))
+}
+
+// ListShards handles GET /v1/admin/shards
+func (h *Handler) ListShards(w http.ResponseWriter, r *http.Request) {
+	requestID := generateRequestID()
+	writeSuccessResponse(w, http.StatusOK, requestID, ShardsResponse{
+		Assignments: h.engine.ShardAssignments(),
+		Queues:      h.engine.QueueStats(),
+	})
+}
+
+// MoveSymbol handles POST /v1/admin/shards/move.
+// Commands for the symbol wait while it moves; none are lost or reordered.
+func (h *Handler) MoveSymbol(w http.ResponseWriter, r *http.Request) {
+	requestID := generateRequestID()
+
+	if h.engine.ReadOnly() {
+		writeErrorResponse(w, http.StatusForbidden, requestID, ErrorCodeReadOnly, "engine is read-only")
+		return
+	}
+	var req MoveSymbolRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, requestID, ErrorCodeInvalidArgument, "invalid request body")
+		return
+	}
+	if _, err := symbolspec.Get(req.Symbol); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, requestID, ErrorCodeInvalidArgument, err.Error())
+		return
+	}
+	if shardCount := len(h.engine.QueueStats()); req.ShardID < 0 || req.ShardID >= shardCount {
+		writeErrorResponse(w, http.StatusBadRequest, requestID, ErrorCodeInvalidArgument, fmt.Sprintf("shard_id must be between 0 and %d", shardCount-1))
+		return
+	}
+
+	from := h.engine.GetShardID(req.Symbol)
+	if err := h.engine.MoveSymbol(r.Context(), req.Symbol, req.ShardID); err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, requestID, ErrorCodeInternalError, err.Error())
+		return
+	}
+	writeSuccessResponse(w, http.StatusOK, requestID, MoveSymbolResponse{
+		Symbol:    req.Symbol,
+		FromShard: from,
+		ToShard:   req.ShardID,
+	})
+}
+
 // Helper functions
 
 func (h *Handler) validatePlaceOrderRequest(req *PlaceOrderRequest) error {
@@ -337,6 +1176,22 @@ func (h *Handler) rollbackFreeze(orderID, accountID, symbol string) {
 	_ = h.accountSvc.ReleaseOnCancel(cancelIntent)
 }
 
+// waitOrSettleLater waits for a command's result within the request's context. If the request
+// gives up after the command was queued, settle runs with the result once the command executes,
+// so its funds are settled whether or not the client retries.
+func waitOrSettleLater(ctx context.Context, future *engine.Future, settle func(*engine.CommandExecResult)) *engine.CommandExecResult {
+	result := future.Wait(ctx)
+	if outcomeUnknown(result) {
+		go func() { settle(future.Result()) }()
+	}
+	return result
+}
+
+// outcomeUnknown reports whether a command gave up waiting after it was queued
+func outcomeUnknown(result *engine.CommandExecResult) bool {
+	return result.ErrorCode == engine.ErrorCodeTimeout && !errors.Is(result.Err, engine.ErrCommandNotQueued)
+}
+
 func (h *Handler) applyTrades(trades []matching.Trade) error {
 	for _, trade := range trades {
 		intent := account.TradeIntent{
@@ -366,10 +1221,12 @@ func (h *Handler) applyTrades(trades []matching.Trade) error {
 }
 
 func (h *Handler) buildPlaceOrderResponse(orderID string, req *PlaceOrderRequest, priceInt, qtyInt int64, result *matching.CommandResult, spec symbolspec.Spec) PlaceOrderResponse {
-	// Determine final status
+	// Determine final status; other changes are of makers or of legs of the order's group
 	status := "NEW"
-	if len(result.OrderStatusChanges) > 0 {
-		status = string(result.OrderStatusChanges[len(result.OrderStatusChanges)-1].NewStatus)
+	for _, change := range result.OrderStatusChanges {
+		if change.OrderID == orderID {
+			status = string(change.NewStatus)
+		}
 	}
 
 	// Convert trades
@@ -403,6 +1260,7 @@ func (h *Handler) buildPlaceOrderResponse(orderID string, req *PlaceOrderRequest
 		Status:        status,
 		CreatedAt:     time.Now(),
 		Trades:        trades,
+		GroupID:       req.GroupID,
 	}
 }
 
@@ -415,11 +1273,13 @@ func (h *Handler) buildCancelOrderResponse(orderID, symbol string, result *match
 		spec = symbolspec.Spec{QuantityScale: 0}
 	}
 
-	if len(result.OrderStatusChanges) > 0 {
-		lastChange := result.OrderStatusChanges[len(result.OrderStatusChanges)-1]
-		status = string(lastChange.NewStatus)
-		remainingQty = lastChange.RemainingQty
-		filledQty = lastChange.FilledQty
+	// Other changes are of the legs of the order's group
+	for _, change := range result.OrderStatusChanges {
+		if change.OrderID == orderID {
+			status = string(change.NewStatus)
+			remainingQty = change.RemainingQty
+			filledQty = change.FilledQty
+		}
 	}
 
 	return CancelOrderResponse{
@@ -447,9 +1307,39 @@ func (h *Handler) buildQueryOrderResponse(snapshot *matching.OrderSnapshot) Quer
 		FilledQty:     symbolspec.FormatScaledInt(snapshot.FilledQty, spec.QuantityScale),
 		Status:        string(snapshot.Status),
 		CreatedAt:     snapshot.CreatedAt,
+		GroupID:       snapshot.GroupID,
 	}
 }
 
+func (h *Handler) buildDepthResponse(depth *matching.BookDepth, spec symbolspec.Spec) DepthResponse {
+	convert := func(levels []matching.DepthLevel) []DepthLevelDTO {
+		dtos := make([]DepthLevelDTO, 0, len(levels))
+		for _, level := range levels {
+			dtos = append(dtos, DepthLevelDTO{
+				Price:    symbolspec.FormatScaledInt(level.Price, spec.PriceScale),
+				Quantity: symbolspec.FormatScaledInt(level.Quantity, spec.QuantityScale),
+				Orders:   level.Orders,
+			})
+		}
+		return dtos
+	}
+	resp := DepthResponse{
+		Symbol:   depth.Symbol,
+		Status:   string(depth.Status),
+		Sequence: depth.Sequence,
+		Bids:     convert(depth.Bids),
+		Asks:     convert(depth.Asks),
+	}
+	if depth.Auction != nil {
+		resp.Auction = &AuctionDTO{
+			Price:     symbolspec.FormatScaledInt(depth.Auction.Price, spec.PriceScale),
+			Volume:    symbolspec.FormatScaledInt(depth.Auction.Volume, spec.QuantityScale),
+			Imbalance: symbolspec.FormatScaledInt(depth.Auction.Imbalance, spec.QuantityScale),
+		}
+	}
+	return resp
+}
+
 // Utility functions
 
 func generateOrderID() string {
@@ -496,6 +1386,15 @@ func writeMappedErrorResponse(w http.ResponseWriter, statusCode int, requestID s
 	writeJSONResponse(w, statusCode, errResp)
 }
 
+// writeEngineErrorResponse writes a failed engine result; shed commands carry a Retry-After hint
+func writeEngineErrorResponse(w http.ResponseWriter, requestID string, result *engine.CommandExecResult) {
+	if result.ErrorCode == engine.ErrorCodeOverloaded {
+		w.Header().Set("Retry-After", overloadRetryAfterSeconds)
+	}
+	statusCode, errResp := MapEngineErrorToHTTP(result.ErrorCode, result.Err)
+	writeMappedErrorResponse(w, statusCode, requestID, errResp)
+}
+
 func writeErrorResponse(w http.ResponseWriter, statusCode int, requestID string, code ErrorCode, message string) {
 	writeJSONResponse(w, statusCode, ErrorResponse{
 		Code:      string(code),
@@ -2,16 +2,20 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"math/big"
 	"net/http"
 	"net/http/httptest"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"matching-engine/internal/account"
 	"matching-engine/internal/engine"
+	"matching-engine/internal/matching"
 	"matching-engine/internal/symbolspec"
 )
 
@@ -862,3 +866,1070 @@ func TestQueryClosedOrderAfterCancel(t *testing.T) {
 		t.Fatalf("expected CANCELED, got %s", queryResp.Status)
 	}
 }
+
+func TestQueryDepth_AggregatesLevels(t *testing.T) {
+	accountSvc := account.NewMemoryService()
+	eng := engine.NewEngine(&engine.EngineConfig{
+		ShardCount:     1,
+		QueueSize:      100,
+		IdempotencyTTL: time.Minute,
+	})
+	defer eng.Close()
+
+	router := NewRouter(accountSvc, eng)
+	_ = accountSvc.SetBalance("acc1", "USDT", account.Balance{Available: 1_000_000_000_000_000})
+
+	for i, price := range []string{"43000", "43000", "42000"} {
+		body, _ := json.Marshal(PlaceOrderRequest{
+			ClientOrderID:  fmt.Sprintf("client_depth_%d", i),
+			AccountID:      "acc1",
+			Symbol:         "BTC-USDT",
+			Side:           "BUY",
+			Price:          price,
+			Quantity:       "1",
+			IdempotencyKey: fmt.Sprintf("idem_depth_%d", i),
+		})
+		req := httptest.NewRequest(http.MethodPost, "/v1/orders", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("place failed: %d %s", w.Code, w.Body.String())
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/depth?symbol=BTC-USDT&levels=1", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("depth failed: %d %s", w.Code, w.Body.String())
+	}
+	resp := decodeSuccess[DepthResponse](t, w.Body)
+	if len(resp.Bids) != 1 || len(resp.Asks) != 0 {
+		t.Fatalf("expected one bid level and no asks, got %+v", resp)
+	}
+	if resp.Bids[0].Price != "43000" || resp.Bids[0].Quantity != "2" || resp.Bids[0].Orders != 2 {
+		t.Fatalf("unexpected best bid: %+v", resp.Bids[0])
+	}
+}
+
+func TestReadOnlyEngine_RejectsPlace(t *testing.T) {
+	accountSvc := account.NewMemoryService()
+	eng := engine.NewEngine(&engine.EngineConfig{
+		ShardCount:     1,
+		QueueSize:      100,
+		IdempotencyTTL: time.Minute,
+		ReadOnly:       true,
+	})
+	defer eng.Close()
+
+	router := NewRouter(accountSvc, eng)
+	required := requiredQuoteAmount(t, "BTC-USDT", "43000", "100")
+	_ = accountSvc.SetBalance("acc1", "USDT", account.Balance{Available: required})
+
+	body, _ := json.Marshal(PlaceOrderRequest{
+		ClientOrderID:  "client_read_only",
+		AccountID:      "acc1",
+		Symbol:         "BTC-USDT",
+		Side:           "BUY",
+		Price:          "43000",
+		Quantity:       "100",
+		IdempotencyKey: "idem_read_only",
+	})
+	req := httptest.NewRequest(http.MethodPost, "/v1/orders", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d %s", w.Code, w.Body.String())
+	}
+	if errResp := decodeError(t, w.Body); errResp.Code != string(ErrorCodeReadOnly) {
+		t.Fatalf("expected READ_ONLY, got %s", errResp.Code)
+	}
+	balance, _ := accountSvc.GetBalance("acc1", "USDT")
+	if balance.Frozen != 0 {
+		t.Fatalf("expected nothing frozen, got %d", balance.Frozen)
+	}
+
+	depthReq := httptest.NewRequest(http.MethodGet, "/v1/depth?symbol=BTC-USDT", nil)
+	depthW := httptest.NewRecorder()
+	router.ServeHTTP(depthW, depthReq)
+	if depthW.Code != http.StatusOK {
+		t.Fatalf("expected depth to be served read-only, got %d %s", depthW.Code, depthW.Body.String())
+	}
+
+	moveBody, _ := json.Marshal(MoveSymbolRequest{Symbol: "BTC-USDT", ShardID: 0})
+	moveW := httptest.NewRecorder()
+	router.ServeHTTP(moveW, httptest.NewRequest(http.MethodPost, "/v1/admin/shards/move", bytes.NewReader(moveBody)))
+	if moveW.Code != http.StatusForbidden || decodeError(t, moveW.Body).Code != string(ErrorCodeReadOnly) {
+		t.Fatalf("expected a symbol move to be rejected read-only, got %d %s", moveW.Code, moveW.Body.String())
+	}
+}
+
+func TestPlaceOrder_CanceledContextReturnsTimeout(t *testing.T) {
+	accountSvc := account.NewMemoryService()
+	eng := engine.NewEngine(&engine.EngineConfig{ShardCount: 1, QueueSize: 100, IdempotencyTTL: time.Minute})
+	defer eng.Close()
+
+	router := NewRouter(accountSvc, eng)
+	required := requiredQuoteAmount(t, "BTC-USDT", "43000", "100")
+	_ = accountSvc.SetBalance("acc1", "USDT", account.Balance{Available: required})
+
+	body, _ := json.Marshal(PlaceOrderRequest{
+		ClientOrderID:  "client_timeout",
+		AccountID:      "acc1",
+		Symbol:         "BTC-USDT",
+		Side:           "BUY",
+		Price:          "43000",
+		Quantity:       "100",
+		IdempotencyKey: "idem_timeout",
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodPost, "/v1/orders", bytes.NewReader(body)).WithContext(ctx)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d %s", w.Code, w.Body.String())
+	}
+	if errResp := decodeError(t, w.Body); errResp.Code != string(ErrorCodeTimeout) {
+		t.Fatalf("expected TIMEOUT, got %s", errResp.Code)
+	}
+	// The command never reached the engine, so its freeze is released
+	balance, _ := accountSvc.GetBalance("acc1", "USDT")
+	if balance.Frozen != 0 {
+		t.Fatalf("expected nothing frozen, got %d", balance.Frozen)
+	}
+
+	if status, _ := MapEngineErrorToHTTP(engine.ErrorCodeTimeout, context.DeadlineExceeded); status != http.StatusGatewayTimeout {
+		t.Fatalf("expected 504 for a timeout after queueing, got %d", status)
+	}
+}
+
+// blockingRecordStore holds the shard inside a command until released
+type blockingRecordStore struct {
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingRecordStore) Save(ctx context.Context, record any) error {
+	s.entered <- struct{}{}
+	<-s.release
+	return nil
+}
+
+// pausableRecordStore holds the shard inside the next command saved while paused
+type pausableRecordStore struct {
+	paused  atomic.Bool
+	entered chan struct{}
+	release chan struct{}
+}
+
+func newPausableRecordStore() *pausableRecordStore {
+	return &pausableRecordStore{entered: make(chan struct{}), release: make(chan struct{})}
+}
+
+func (s *pausableRecordStore) Save(ctx context.Context, record any) error {
+	if s.paused.CompareAndSwap(true, false) {
+		s.entered <- struct{}{}
+		<-s.release
+	}
+	return nil
+}
+
+// holdShard places an order that holds its shard until the returned function is called,
+// so commands sent meanwhile stay queued
+func holdShard(t *testing.T, router *Router, accountSvc *account.MemoryService, store *pausableRecordStore) func() {
+	t.Helper()
+	if err := accountSvc.SetBalance("holder", "USDT", account.Balance{Available: requiredQuoteAmount(t, "BTC-USDT", "1", "1")}); err != nil {
+		t.Fatalf("SetBalance failed: %v", err)
+	}
+	body, _ := json.Marshal(PlaceOrderRequest{
+		ClientOrderID: "client_hold", AccountID: "holder", Symbol: "BTC-USDT",
+		Side: "BUY", Price: "1", Quantity: "1", IdempotencyKey: "hold",
+	})
+	store.paused.Store(true)
+	done := make(chan struct{})
+	go func() {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/orders", bytes.NewReader(body)))
+		close(done)
+	}()
+	<-store.entered
+	return func() {
+		close(store.release)
+		<-done
+	}
+}
+
+// timedOutRequest is a request whose context ends shortly, while its command is still queued
+func timedOutRequest(t *testing.T, method, path string, body []byte) *http.Request {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	t.Cleanup(cancel)
+	return httptest.NewRequest(method, path, bytes.NewReader(body)).WithContext(ctx)
+}
+
+// eventually polls cond until it holds or a second passes
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !cond(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+func TestPlaceOrder_OverloadedShardReturns429(t *testing.T) {
+	accountSvc := account.NewMemoryService()
+	eng := engine.NewEngine(&engine.EngineConfig{ShardCount: 1, QueueSize: 2, QueueHighWater: 1, IdempotencyTTL: time.Minute})
+	defer eng.Close()
+	store := &blockingRecordStore{entered: make(chan struct{}, 2), release: make(chan struct{})}
+	eng.SetIdempotencyRecordStore(store)
+
+	router := NewRouter(accountSvc, eng)
+	required := requiredQuoteAmount(t, "BTC-USDT", "43000", "100")
+	_ = accountSvc.SetBalance("acc1", "USDT", account.Balance{Available: 3 * required})
+	placeBody := func(key string) []byte {
+		body, _ := json.Marshal(PlaceOrderRequest{
+			ClientOrderID:  "client_" + key,
+			AccountID:      "acc1",
+			Symbol:         "BTC-USDT",
+			Side:           "BUY",
+			Price:          "43000",
+			Quantity:       "100",
+			IdempotencyKey: key,
+		})
+		return body
+	}
+	place := func(key string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/orders", bytes.NewReader(placeBody(key))))
+		return w
+	}
+
+	// One place executes and blocks the shard, a second one waits in the queue
+	done := make(chan struct{}, 2)
+	go func() { place("idem_busy_1"); done <- struct{}{} }()
+	<-store.entered
+	go func() { place("idem_busy_2"); done <- struct{}{} }()
+	for eng.SymbolQueueStats("BTC-USDT").Depth < 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	w := place("idem_shed")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected a Retry-After header")
+	}
+	if errResp := decodeError(t, w.Body); errResp.Code != string(ErrorCodeOverloaded) {
+		t.Fatalf("expected OVERLOADED, got %s", errResp.Code)
+	}
+	balance, _ := accountSvc.GetBalance("acc1", "USDT")
+	if balance.Frozen != 2*required {
+		t.Fatalf("expected only the two admitted orders frozen, got %d", balance.Frozen)
+	}
+
+	close(store.release)
+	<-done
+	<-done
+}
+
+func TestPlaceOrderBatch_PerItemResultsAndAllOrNothing(t *testing.T) {
+	accountSvc := account.NewMemoryService()
+	eng := engine.NewEngine(&engine.EngineConfig{
+		ShardCount:     2,
+		QueueSize:      100,
+		IdempotencyTTL: time.Minute,
+	})
+	defer eng.Close()
+	router := NewRouter(accountSvc, eng)
+
+	btcRequired := requiredQuoteAmount(t, "BTC-USDT", "43000", "1")
+	ethRequired := requiredQuoteAmount(t, "ETH-USDT", "2000", "1")
+	if err := accountSvc.SetBalance("acc1", "USDT", account.Balance{Available: btcRequired + ethRequired}); err != nil {
+		t.Fatalf("SetBalance failed: %v", err)
+	}
+
+	order := func(account, symbol, price, key string) PlaceOrderRequest {
+		return PlaceOrderRequest{
+			ClientOrderID:  "client_" + key,
+			AccountID:      account,
+			Symbol:         symbol,
+			Side:           "BUY",
+			Price:          price,
+			Quantity:       "1",
+			IdempotencyKey: key,
+		}
+	}
+	submit := func(batch BatchPlaceOrderRequest) []BatchOrderResult {
+		t.Helper()
+		body, _ := json.Marshal(batch)
+		req := httptest.NewRequest(http.MethodPost, "/v1/orders/batch", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		return decodeSuccess[BatchPlaceOrderResponse](t, w.Body).Results
+	}
+
+	// acc2 has no balance, so the second BTC order fails and withdraws the first
+	results := submit(BatchPlaceOrderRequest{
+		AllOrNothing: true,
+		Orders: []PlaceOrderRequest{
+			order("acc1", "BTC-USDT", "43000", "btc1"),
+			order("acc1", "ETH-USDT", "2000", "eth1"),
+			order("acc2", "BTC-USDT", "43000", "btc2"),
+		},
+	})
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(results))
+	}
+	if results[0].Error == nil || results[0].Error.Code != string(ErrorCodeBatchAborted) || results[0].Status != http.StatusConflict {
+		t.Fatalf("expected the first BTC order to be aborted, got %+v", results[0])
+	}
+	if results[1].Error != nil || results[1].Order == nil || results[1].Order.Status != "NEW" {
+		t.Fatalf("expected the ETH order to be placed, got %+v", results[1])
+	}
+	if results[2].Error == nil || results[2].Error.Code != string(ErrorCodeInsufficientBalance) || results[2].Index != 2 {
+		t.Fatalf("expected the second BTC order to fail on balance, got %+v", results[2])
+	}
+	balance, err := accountSvc.GetBalance("acc1", "USDT")
+	if err != nil {
+		t.Fatalf("GetBalance failed: %v", err)
+	}
+	if balance.Frozen != ethRequired {
+		t.Fatalf("expected only the ETH order frozen (%d), got %d", ethRequired, balance.Frozen)
+	}
+
+	// Without all_or_nothing, the BTC order stands on its own
+	results = submit(BatchPlaceOrderRequest{
+		Orders: []PlaceOrderRequest{
+			order("acc1", "BTC-USDT", "43000", "btc3"),
+			order("acc2", "BTC-USDT", "43000", "btc4"),
+		},
+	})
+	if results[0].Error != nil || results[0].Order == nil {
+		t.Fatalf("expected the acc1 order to be placed, got %+v", results[0])
+	}
+	if results[1].Error == nil || results[1].Error.Code != string(ErrorCodeInsufficientBalance) {
+		t.Fatalf("expected the acc2 order to fail on balance, got %+v", results[1])
+	}
+}
+
+// acceptedEventStore records the API key ID of every accepted order, from any shard
+type acceptedEventStore struct {
+	mu        sync.Mutex
+	apiKeyIDs map[string]string
+}
+
+func (s *acceptedEventStore) Append(ctx context.Context, symbol string, event matching.Event) error {
+	if e, ok := event.(*matching.OrderAcceptedEvent); ok {
+		s.mu.Lock()
+		s.apiKeyIDs[e.ClientOrderID] = e.APIKeyID
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+func TestMassCancelOrders_ReleasesFundsOfEveryCanceledOrder(t *testing.T) {
+	accountSvc := account.NewMemoryService()
+	eng := engine.NewEngine(&engine.EngineConfig{
+		ShardCount:     2,
+		QueueSize:      100,
+		IdempotencyTTL: time.Minute,
+	})
+	defer eng.Close()
+	events := &acceptedEventStore{apiKeyIDs: make(map[string]string)}
+	eng.SetEventStore(events)
+	router := NewRouter(accountSvc, eng)
+	router.SetAPIKeySecret([]byte("secret"))
+
+	btcRequired := requiredQuoteAmount(t, "BTC-USDT", "43000", "1")
+	ethRequired := requiredQuoteAmount(t, "ETH-USDT", "2000", "1")
+	for _, accountID := range []string{"acc1", "acc2"} {
+		if err := accountSvc.SetBalance(accountID, "USDT", account.Balance{Available: 2*btcRequired + ethRequired}); err != nil {
+			t.Fatalf("SetBalance failed: %v", err)
+		}
+	}
+
+	place := func(accountID, symbol, price, key, apiKey string) {
+		t.Helper()
+		body, _ := json.Marshal(PlaceOrderRequest{
+			ClientOrderID:  "client_" + key,
+			AccountID:      accountID,
+			Symbol:         symbol,
+			Side:           "BUY",
+			Price:          price,
+			Quantity:       "1",
+			IdempotencyKey: key,
+		})
+		req := httptest.NewRequest(http.MethodPost, "/v1/orders", bytes.NewReader(body))
+		req.Header.Set("X-API-Key", apiKey)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("place %s failed with %d: %s", key, w.Code, w.Body.String())
+		}
+	}
+	massCancel := func(path, apiKey string) MassCancelResponse {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodDelete, path, nil)
+		req.Header.Set("X-API-Key", apiKey)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("DELETE %s failed with %d: %s", path, w.Code, w.Body.String())
+		}
+		return decodeSuccess[MassCancelResponse](t, w.Body)
+	}
+	frozen := func(accountID string) int64 {
+		balance, _ := accountSvc.GetBalance(accountID, "USDT")
+		return balance.Frozen
+	}
+
+	place("acc1", "BTC-USDT", "43000", "btc1", "bot")
+	place("acc1", "BTC-USDT", "43000", "btc2", "manual")
+	place("acc1", "ETH-USDT", "2000", "eth1", "bot")
+	place("acc2", "BTC-USDT", "43000", "btc3", "")
+
+	// Orders carry a key ID, never the key
+	ids := events.apiKeyIDs
+	if ids["client_btc1"] == "" || ids["client_btc1"] == "bot" || ids["client_btc1"] != ids["client_eth1"] ||
+		ids["client_btc2"] == ids["client_btc1"] || ids["client_btc3"] != "" {
+		t.Fatalf("expected one ID per API key in the events, got %v", ids)
+	}
+
+	// By API key, across symbols
+	resp := massCancel("/v1/orders?account_id=acc1", "bot")
+	if resp.CanceledCount != 2 {
+		t.Fatalf("expected 2 orders canceled by api key, got %d", resp.CanceledCount)
+	}
+	if got := frozen("acc1"); got != btcRequired {
+		t.Fatalf("expected %d frozen for the remaining order, got %d", btcRequired, got)
+	}
+
+	// Account and symbol
+	resp = massCancel("/v1/orders?account_id=acc1&symbol=BTC-USDT&side=BUY", "")
+	if resp.CanceledCount != 1 || resp.Orders[0].RemainingQty != "1" {
+		t.Fatalf("expected the remaining BTC order canceled, got %+v", resp)
+	}
+	if got := frozen("acc1"); got != 0 {
+		t.Fatalf("expected nothing frozen for acc1, got %d", got)
+	}
+
+	// Admin: every account on the symbol
+	resp = massCancel("/v1/admin/orders?symbol=BTC-USDT", "")
+	if resp.CanceledCount != 1 || resp.Orders[0].AccountID != "acc2" {
+		t.Fatalf("expected acc2's order canceled, got %+v", resp)
+	}
+	if got := frozen("acc2"); got != 0 {
+		t.Fatalf("expected nothing frozen for acc2, got %d", got)
+	}
+
+	// A user mass cancel must be scoped to an account or the request's API key; a key in
+	// the URL doesn't count
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/v1/orders?symbol=BTC-USDT&api_key=bot", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unscoped mass cancel, got %d", w.Code)
+	}
+}
+
+func TestPlaceOrder_TimedOutRequestStillSettlesTrades(t *testing.T) {
+	accountSvc := account.NewMemoryService()
+	eng := engine.NewEngine(&engine.EngineConfig{ShardCount: 1, QueueSize: 100, IdempotencyTTL: time.Minute})
+	defer eng.Close()
+	store := newPausableRecordStore()
+	eng.SetIdempotencyRecordStore(store)
+	router := NewRouter(accountSvc, eng)
+
+	if err := accountSvc.SetBalance("buyer", "USDT", account.Balance{Available: requiredQuoteAmount(t, "BTC-USDT", "43000", "1")}); err != nil {
+		t.Fatalf("SetBalance failed: %v", err)
+	}
+	spec, _ := symbolspec.Get("BTC-USDT")
+	oneBTC, _ := symbolspec.ParseScaledInt("1", spec.QuantityScale)
+	if err := accountSvc.SetBalance("seller", "BTC", account.Balance{Available: oneBTC}); err != nil {
+		t.Fatalf("SetBalance failed: %v", err)
+	}
+	placeBody := func(accountID, side string) []byte {
+		body, _ := json.Marshal(PlaceOrderRequest{
+			ClientOrderID: "client_" + accountID, AccountID: accountID, Symbol: "BTC-USDT",
+			Side: side, Price: "43000", Quantity: "1", IdempotencyKey: "key_" + accountID,
+		})
+		return body
+	}
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/orders", bytes.NewReader(placeBody("seller", "SELL"))))
+
+	// The crossing order is queued behind a held command and the request gives up
+	release := holdShard(t, router, accountSvc, store)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, timedOutRequest(t, http.MethodPost, "/v1/orders", placeBody("buyer", "BUY")))
+	if w.Code != http.StatusGatewayTimeout {
+		t.Fatalf("expected 504, got %d: %s", w.Code, w.Body.String())
+	}
+	release()
+
+	eventually(t, "the trade's settlement", func() bool {
+		balance, _ := accountSvc.GetBalance("buyer", "BTC")
+		return balance.Available == oneBTC
+	})
+	if balance, _ := accountSvc.GetBalance("buyer", "USDT"); balance.Frozen != 0 {
+		t.Fatalf("expected the filled order's funds to be spent, got %+v", balance)
+	}
+}
+
+func TestMassCancelOrders_TimedOutRequestStillReleasesFunds(t *testing.T) {
+	accountSvc := account.NewMemoryService()
+	eng := engine.NewEngine(&engine.EngineConfig{ShardCount: 1, QueueSize: 100, IdempotencyTTL: time.Minute})
+	defer eng.Close()
+	store := newPausableRecordStore()
+	eng.SetIdempotencyRecordStore(store)
+	router := NewRouter(accountSvc, eng)
+
+	if err := accountSvc.SetBalance("acc1", "USDT", account.Balance{Available: requiredQuoteAmount(t, "BTC-USDT", "43000", "1")}); err != nil {
+		t.Fatalf("SetBalance failed: %v", err)
+	}
+	body, _ := json.Marshal(PlaceOrderRequest{
+		ClientOrderID: "client_1", AccountID: "acc1", Symbol: "BTC-USDT",
+		Side: "BUY", Price: "43000", Quantity: "1", IdempotencyKey: "key_1",
+	})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/orders", bytes.NewReader(body)))
+
+	// The mass cancel is queued behind a held command and the request gives up
+	release := holdShard(t, router, accountSvc, store)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, timedOutRequest(t, http.MethodDelete, "/v1/orders?account_id=acc1", nil))
+	if w.Code != http.StatusGatewayTimeout {
+		t.Fatalf("expected 504, got %d: %s", w.Code, w.Body.String())
+	}
+	release()
+
+	eventually(t, "the canceled order's funds", func() bool {
+		balance, _ := accountSvc.GetBalance("acc1", "USDT")
+		return balance.Frozen == 0
+	})
+}
+
+func TestDeadManSwitch_ExpiryCancelsOrdersAndReleasesFunds(t *testing.T) {
+	accountSvc := account.NewMemoryService()
+	eng := engine.NewEngine(&engine.EngineConfig{
+		ShardCount:     1,
+		QueueSize:      100,
+		IdempotencyTTL: time.Minute,
+	})
+	defer eng.Close()
+	router := NewRouter(accountSvc, eng)
+
+	required := requiredQuoteAmount(t, "BTC-USDT", "43000", "1")
+	if err := accountSvc.SetBalance("mm1", "USDT", account.Balance{Available: required}); err != nil {
+		t.Fatalf("SetBalance failed: %v", err)
+	}
+
+	post := func(path string, body any) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(payload)))
+		return w
+	}
+
+	// Heartbeats need an armed switch
+	w := post("/v1/dead-man-switch/heartbeat", DeadManSwitchHeartbeatRequest{AccountID: "mm1"})
+	if w.Code != http.StatusNotFound || decodeError(t, w.Body).Code != string(ErrorCodeSwitchNotArmed) {
+		t.Fatalf("expected 404 SWITCH_NOT_ARMED, got %d", w.Code)
+	}
+	w = post("/v1/dead-man-switch", ArmDeadManSwitchRequest{AccountID: "mm1", TimeoutMs: 10})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a timeout below the minimum, got %d", w.Code)
+	}
+
+	w = post("/v1/orders", PlaceOrderRequest{
+		ClientOrderID:  "quote1",
+		AccountID:      "mm1",
+		Symbol:         "BTC-USDT",
+		Side:           "BUY",
+		Price:          "43000",
+		Quantity:       "1",
+		IdempotencyKey: "quote1",
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("place failed with %d: %s", w.Code, w.Body.String())
+	}
+
+	w = post("/v1/dead-man-switch", ArmDeadManSwitchRequest{AccountID: "mm1", TimeoutMs: 1000})
+	if w.Code != http.StatusOK {
+		t.Fatalf("arm failed with %d: %s", w.Code, w.Body.String())
+	}
+	if armed := decodeSuccess[DeadManSwitchResponse](t, w.Body); armed.TimeoutMs != 1000 || armed.Deadline.IsZero() {
+		t.Fatalf("unexpected switch %+v", armed)
+	}
+	w = post("/v1/dead-man-switch/heartbeat", DeadManSwitchHeartbeatRequest{AccountID: "mm1"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("heartbeat failed with %d: %s", w.Code, w.Body.String())
+	}
+
+	// No more heartbeats: the quote is canceled and its funds released
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		balance, _ := accountSvc.GetBalance("mm1", "USDT")
+		if balance.Frozen == 0 && balance.Available == required {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("funds not released after expiry: %+v", balance)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if len(eng.DeadManSwitches()) != 0 {
+		t.Fatalf("expected the switch to be disarmed after expiry")
+	}
+}
+
+func TestSetSymbolStatus_HaltRejectsPlacesAndRollsBackFreeze(t *testing.T) {
+	accountSvc := account.NewMemoryService()
+	eng := engine.NewEngine(&engine.EngineConfig{
+		ShardCount:     1,
+		QueueSize:      100,
+		IdempotencyTTL: time.Minute,
+	})
+	defer eng.Close()
+	router := NewRouter(accountSvc, eng)
+
+	required := requiredQuoteAmount(t, "BTC-USDT", "43000", "1")
+	if err := accountSvc.SetBalance("acc1", "USDT", account.Balance{Available: required}); err != nil {
+		t.Fatalf("SetBalance failed: %v", err)
+	}
+
+	setStatus := func(status string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(SetSymbolStatusRequest{Symbol: "BTC-USDT", Status: status, Reason: "incident"})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/admin/symbols/status", bytes.NewReader(body)))
+		return w
+	}
+
+	if w := setStatus("PAUSED"); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unknown status, got %d", w.Code)
+	}
+	w := setStatus("HALTED")
+	if w.Code != http.StatusOK {
+		t.Fatalf("halt failed with %d: %s", w.Code, w.Body.String())
+	}
+	if resp := decodeSuccess[SetSymbolStatusResponse](t, w.Body); resp.PreviousStatus != "TRADING" || resp.Status != "HALTED" {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+
+	body, _ := json.Marshal(PlaceOrderRequest{
+		ClientOrderID:  "client_1",
+		AccountID:      "acc1",
+		Symbol:         "BTC-USDT",
+		Side:           "BUY",
+		Price:          "43000",
+		Quantity:       "1",
+		IdempotencyKey: "key_1",
+	})
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/orders", bytes.NewReader(body)))
+	if w.Code != http.StatusConflict || decodeError(t, w.Body).Code != string(ErrorCodeSymbolHalted) {
+		t.Fatalf("expected 409 SYMBOL_HALTED, got %d", w.Code)
+	}
+	if balance, _ := accountSvc.GetBalance("acc1", "USDT"); balance.Frozen != 0 || balance.Available != required {
+		t.Fatalf("expected the freeze to be rolled back, got %+v", balance)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/depth?symbol=BTC-USDT", nil))
+	if depth := decodeSuccess[DepthResponse](t, w.Body); depth.Status != "HALTED" {
+		t.Fatalf("expected depth to report HALTED, got %q", depth.Status)
+	}
+}
+
+func TestCallAuction_DepthPublishesIndicativeAndOpenSettlesTrades(t *testing.T) {
+	accountSvc := account.NewMemoryService()
+	eng := engine.NewEngine(&engine.EngineConfig{
+		ShardCount:     1,
+		QueueSize:      100,
+		IdempotencyTTL: time.Minute,
+	})
+	defer eng.Close()
+	router := NewRouter(accountSvc, eng)
+
+	if err := accountSvc.SetBalance("buyer", "USDT", account.Balance{Available: requiredQuoteAmount(t, "BTC-USDT", "43000", "1")}); err != nil {
+		t.Fatalf("SetBalance failed: %v", err)
+	}
+	spec, _ := symbolspec.Get("BTC-USDT")
+	oneBTC, _ := symbolspec.ParseScaledInt("1", spec.QuantityScale)
+	if err := accountSvc.SetBalance("seller", "BTC", account.Balance{Available: oneBTC}); err != nil {
+		t.Fatalf("SetBalance failed: %v", err)
+	}
+
+	setStatus := func(status string) SetSymbolStatusResponse {
+		t.Helper()
+		body, _ := json.Marshal(SetSymbolStatusRequest{Symbol: "BTC-USDT", Status: status})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/admin/symbols/status", bytes.NewReader(body)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("set status %s failed with %d: %s", status, w.Code, w.Body.String())
+		}
+		return decodeSuccess[SetSymbolStatusResponse](t, w.Body)
+	}
+	place := func(accountID, side, price string) {
+		t.Helper()
+		body, _ := json.Marshal(PlaceOrderRequest{
+			ClientOrderID:  "client_" + accountID,
+			AccountID:      accountID,
+			Symbol:         "BTC-USDT",
+			Side:           side,
+			Price:          price,
+			Quantity:       "1",
+			IdempotencyKey: "key_" + accountID,
+		})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/orders", bytes.NewReader(body)))
+		if w.Code != http.StatusOK && w.Code != http.StatusCreated {
+			t.Fatalf("place failed with %d: %s", w.Code, w.Body.String())
+		}
+	}
+
+	setStatus("PRE_OPEN")
+	place("buyer", "BUY", "43000")
+	place("seller", "SELL", "42000")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/depth?symbol=BTC-USDT", nil))
+	depth := decodeSuccess[DepthResponse](t, w.Body)
+	if depth.Auction == nil || depth.Auction.Price != "42000" || depth.Auction.Volume != "1" || depth.Auction.Imbalance != "0" {
+		t.Fatalf("expected an indicative uncross of 1 at 42000, got %+v", depth.Auction)
+	}
+	if len(depth.Bids) != 1 || len(depth.Asks) != 1 {
+		t.Fatalf("expected both orders to rest before the open")
+	}
+
+	resp := setStatus("TRADING")
+	if len(resp.Trades) != 1 || resp.Trades[0].Price != "42000" || resp.Trades[0].Quantity != "1" {
+		t.Fatalf("expected the open to trade 1 at 42000, got %+v", resp.Trades)
+	}
+	if balance, _ := accountSvc.GetBalance("buyer", "BTC"); balance.Available != oneBTC {
+		t.Fatalf("expected the buyer to receive 1 BTC, got %+v", balance)
+	}
+	if balance, _ := accountSvc.GetBalance("seller", "USDT"); balance.Available != requiredQuoteAmount(t, "BTC-USDT", "42000", "1") {
+		t.Fatalf("expected the seller to receive the auction price, got %+v", balance)
+	}
+}
+
+func TestSetSymbolStatus_TimedOutOpenStillSettlesAuctionTrades(t *testing.T) {
+	accountSvc := account.NewMemoryService()
+	eng := engine.NewEngine(&engine.EngineConfig{ShardCount: 1, QueueSize: 100, IdempotencyTTL: time.Minute})
+	defer eng.Close()
+	store := newPausableRecordStore()
+	eng.SetIdempotencyRecordStore(store)
+	router := NewRouter(accountSvc, eng)
+
+	if err := accountSvc.SetBalance("buyer", "USDT", account.Balance{Available: requiredQuoteAmount(t, "BTC-USDT", "43000", "1")}); err != nil {
+		t.Fatalf("SetBalance failed: %v", err)
+	}
+	spec, _ := symbolspec.Get("BTC-USDT")
+	oneBTC, _ := symbolspec.ParseScaledInt("1", spec.QuantityScale)
+	if err := accountSvc.SetBalance("seller", "BTC", account.Balance{Available: oneBTC}); err != nil {
+		t.Fatalf("SetBalance failed: %v", err)
+	}
+
+	statusBody := func(status string) []byte {
+		body, _ := json.Marshal(SetSymbolStatusRequest{Symbol: "BTC-USDT", Status: status})
+		return body
+	}
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/admin/symbols/status", bytes.NewReader(statusBody("PRE_OPEN"))))
+	for _, order := range []struct{ accountID, side, price string }{{"buyer", "BUY", "43000"}, {"seller", "SELL", "42000"}} {
+		body, _ := json.Marshal(PlaceOrderRequest{
+			ClientOrderID: "client_" + order.accountID, AccountID: order.accountID, Symbol: "BTC-USDT",
+			Side: order.side, Price: order.price, Quantity: "1", IdempotencyKey: "key_" + order.accountID,
+		})
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/orders", bytes.NewReader(body)))
+	}
+
+	// The open is queued behind a held command and the request gives up
+	release := holdShard(t, router, accountSvc, store)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, timedOutRequest(t, http.MethodPost, "/v1/admin/symbols/status", statusBody("TRADING")))
+	if w.Code != http.StatusGatewayTimeout {
+		t.Fatalf("expected 504, got %d: %s", w.Code, w.Body.String())
+	}
+	release()
+
+	eventually(t, "the auction trade's settlement", func() bool {
+		balance, _ := accountSvc.GetBalance("buyer", "BTC")
+		return balance.Available == oneBTC
+	})
+}
+
+func TestPlaceOrder_OutsidePriceBandRejectedAndFreezeRolledBack(t *testing.T) {
+	accountSvc := account.NewMemoryService()
+	eng := engine.NewEngine(&engine.EngineConfig{
+		ShardCount:     1,
+		QueueSize:      100,
+		IdempotencyTTL: time.Minute,
+	})
+	defer eng.Close()
+	router := NewRouter(accountSvc, eng)
+
+	body, _ := json.Marshal(SymbolSpecDTO{
+		Symbol: "LINK-USDT", PriceScale: 2, QuantityScale: 0, PriceTick: "0.01", QuantityStep: "1",
+		PriceBandBps: 1000, TradeBandBps: 500,
+	})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/admin/symbols", bytes.NewReader(body)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create failed with %d: %s", w.Code, w.Body.String())
+	}
+
+	resting := requiredQuoteAmount(t, "LINK-USDT", "43000", "1")
+	if err := accountSvc.SetBalance("buyer", "USDT", account.Balance{Available: resting + requiredQuoteAmount(t, "LINK-USDT", "48000", "1")}); err != nil {
+		t.Fatalf("SetBalance failed: %v", err)
+	}
+	if err := accountSvc.SetBalance("seller", "LINK", account.Balance{Available: 1}); err != nil {
+		t.Fatalf("SetBalance failed: %v", err)
+	}
+
+	place := func(accountID, side, price, key string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(PlaceOrderRequest{
+			ClientOrderID:  "client_" + key,
+			AccountID:      accountID,
+			Symbol:         "LINK-USDT",
+			Side:           side,
+			Price:          price,
+			Quantity:       "1",
+			IdempotencyKey: key,
+		})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/orders", bytes.NewReader(body)))
+		return w
+	}
+	place("buyer", "BUY", "43000", "key_1")
+	place("seller", "SELL", "44000", "key_2")
+
+	// More than 10% above the 43500 mid price
+	w = place("buyer", "BUY", "48000", "key_3")
+	if w.Code != http.StatusBadRequest || decodeError(t, w.Body).Code != string(ErrorCodePriceOutOfBand) {
+		t.Fatalf("expected 400 PRICE_OUT_OF_BAND, got %d", w.Code)
+	}
+	if balance, _ := accountSvc.GetBalance("buyer", "USDT"); balance.Frozen != resting {
+		t.Fatalf("expected only the resting order's funds to stay frozen, got %+v", balance)
+	}
+}
+
+func TestAdminSymbols_CreateListUpdateAndRejectConflicts(t *testing.T) {
+	accountSvc := account.NewMemoryService()
+	eng := engine.NewEngine(&engine.EngineConfig{
+		ShardCount:     1,
+		QueueSize:      100,
+		IdempotencyTTL: time.Minute,
+	})
+	defer eng.Close()
+	router := NewRouter(accountSvc, eng)
+
+	send := func(method string, spec SymbolSpecDTO) *httptest.ResponseRecorder {
+		t.Helper()
+		body, _ := json.Marshal(spec)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, "/v1/admin/symbols", bytes.NewReader(body)))
+		return w
+	}
+	xrp := SymbolSpecDTO{Symbol: "XRP-USDT", PriceScale: 4, QuantityScale: 0, PriceTick: "0.0005", QuantityStep: "1"}
+	w := send(http.MethodPost, xrp)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create failed with %d: %s", w.Code, w.Body.String())
+	}
+	if created := decodeSuccess[SymbolSpecDTO](t, w.Body); created != xrp {
+		t.Fatalf("expected the created spec back, got %+v", created)
+	}
+	if w := send(http.MethodPost, xrp); w.Code != http.StatusConflict || decodeError(t, w.Body).Code != string(ErrorCodeSymbolExists) {
+		t.Fatalf("expected 409 SYMBOL_EXISTS for a second create, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := send(http.MethodPut, SymbolSpecDTO{Symbol: "ZZZ-USDT", PriceTick: "1", QuantityStep: "1"}); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for updating an unknown symbol, got %d", w.Code)
+	}
+	if w := send(http.MethodPost, SymbolSpecDTO{Symbol: "ADA", PriceTick: "1", QuantityStep: "1"}); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a symbol without a quote asset, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/markets", nil))
+	var market *MarketDTO
+	for _, m := range decodeSuccess[MarketsResponse](t, w.Body).Markets {
+		if m.Symbol == "XRP-USDT" {
+			market = &m
+		}
+	}
+	if market == nil || market.BaseAsset != "XRP" || market.QuoteAsset != "USDT" || market.PriceTick != "0.0005" {
+		t.Fatalf("expected XRP-USDT to be listed, got %+v", market)
+	}
+
+	// A resting order at 0.5505 is on a 0.0005 tick but not on a 0.0004 one
+	if err := accountSvc.SetBalance("buyer", "USDT", account.Balance{Available: requiredQuoteAmount(t, "XRP-USDT", "0.5505", "10")}); err != nil {
+		t.Fatalf("SetBalance failed: %v", err)
+	}
+	body, _ := json.Marshal(PlaceOrderRequest{
+		ClientOrderID: "c1", AccountID: "buyer", Symbol: "XRP-USDT", Side: "BUY",
+		Price: "0.5505", Quantity: "10", IdempotencyKey: "k1",
+	})
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/orders", bytes.NewReader(body)))
+	if w.Code != http.StatusOK && w.Code != http.StatusCreated {
+		t.Fatalf("place failed with %d: %s", w.Code, w.Body.String())
+	}
+
+	conflicting := xrp
+	conflicting.PriceTick = "0.0004"
+	if w := send(http.MethodPut, conflicting); w.Code != http.StatusConflict || decodeError(t, w.Body).Code != string(ErrorCodeSpecConflict) {
+		t.Fatalf("expected 409 SPEC_CONFLICT, got %d: %s", w.Code, w.Body.String())
+	}
+	banded := xrp
+	banded.PriceBandBps = 2000
+	if w := send(http.MethodPut, banded); w.Code != http.StatusOK {
+		t.Fatalf("update failed with %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/admin/symbols", nil))
+	var listed *SymbolSpecDTO
+	for _, s := range decodeSuccess[ListSymbolSpecsResponse](t, w.Body).Symbols {
+		if s.Symbol == "XRP-USDT" {
+			listed = &s
+		}
+	}
+	if listed == nil || *listed != banded {
+		t.Fatalf("expected the updated spec to be listed, got %+v", listed)
+	}
+}
+
+func TestPlaceOrder_OrderLimitsRejectedWithPreciseCodes(t *testing.T) {
+	accountSvc := account.NewMemoryService()
+	eng := engine.NewEngine(&engine.EngineConfig{
+		ShardCount:     1,
+		QueueSize:      100,
+		IdempotencyTTL: time.Minute,
+	})
+	defer eng.Close()
+	router := NewRouter(accountSvc, eng)
+
+	body, _ := json.Marshal(SymbolSpecDTO{
+		Symbol: "ADA-USDT", PriceScale: 4, QuantityScale: 1, PriceTick: "0.0001", QuantityStep: "0.1",
+		MinQuantity: "1", MaxQuantity: "100000", MinPrice: "0.01", MinNotional: "5",
+	})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/admin/symbols", bytes.NewReader(body)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create failed with %d: %s", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/markets", nil))
+	for _, m := range decodeSuccess[MarketsResponse](t, w.Body).Markets {
+		if m.Symbol == "ADA-USDT" && (m.MinNotional != "5" || m.MinQuantity != "1" || m.MaxPrice != "") {
+			t.Fatalf("expected the limits to be published, got %+v", m)
+		}
+	}
+
+	funds := requiredQuoteAmount(t, "ADA-USDT", "0.5", "200000")
+	if err := accountSvc.SetBalance("buyer", "USDT", account.Balance{Available: funds}); err != nil {
+		t.Fatalf("SetBalance failed: %v", err)
+	}
+	for i, tc := range []struct {
+		price, quantity string
+		code            ErrorCode
+	}{
+		{"0.5", "9.9", ErrorCodeMinNotional}, // 4.95 USDT
+		{"0.5", "0.5", ErrorCodeQtyTooSmall},
+		{"0.5", "100000.1", ErrorCodeQtyTooLarge},
+		{"0.005", "2000", ErrorCodePriceTooLow},
+	} {
+		body, _ := json.Marshal(PlaceOrderRequest{
+			ClientOrderID: fmt.Sprintf("c%d", i), AccountID: "buyer", Symbol: "ADA-USDT", Side: "BUY",
+			Price: tc.price, Quantity: tc.quantity, IdempotencyKey: fmt.Sprintf("k%d", i),
+		})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/orders", bytes.NewReader(body)))
+		if w.Code != http.StatusBadRequest || decodeError(t, w.Body).Code != string(tc.code) {
+			t.Fatalf("%s × %s: expected 400 %s, got %d: %s", tc.price, tc.quantity, tc.code, w.Code, w.Body.String())
+		}
+	}
+	if balance, _ := accountSvc.GetBalance("buyer", "USDT"); balance.Available != funds || balance.Frozen != 0 {
+		t.Fatalf("expected rejected orders to freeze nothing, got %+v", balance)
+	}
+}
+
+func TestOrderGroup_LegsShareAFreezeAndReleaseOnOCOCancel(t *testing.T) {
+	accountSvc := account.NewMemoryService()
+	eng := engine.NewEngine(&engine.EngineConfig{
+		ShardCount:     1,
+		QueueSize:      100,
+		IdempotencyTTL: time.Minute,
+	})
+	defer eng.Close()
+	router := NewRouter(accountSvc, eng)
+
+	body, _ := json.Marshal(SymbolSpecDTO{Symbol: "DOT-USDT", PriceScale: 2, QuantityScale: 0, PriceTick: "0.01", QuantityStep: "1"})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/admin/symbols", bytes.NewReader(body)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create failed with %d: %s", w.Code, w.Body.String())
+	}
+	if err := accountSvc.SetBalance("acc1", "DOT", account.Balance{Available: 10}); err != nil {
+		t.Fatalf("SetBalance failed: %v", err)
+	}
+	if err := accountSvc.SetBalance("acc2", "USDT", account.Balance{Available: requiredQuoteAmount(t, "DOT-USDT", "8", "4")}); err != nil {
+		t.Fatalf("SetBalance failed: %v", err)
+	}
+	expectDOT := func(available, frozen int64) {
+		t.Helper()
+		balance, _ := accountSvc.GetBalance("acc1", "DOT")
+		if balance.Available != available || balance.Frozen != frozen {
+			t.Fatalf("expected DOT available %d frozen %d, got %+v", available, frozen, balance)
+		}
+	}
+	order := func(accountID, side, price, quantity, key, groupID string) PlaceOrderRequest {
+		return PlaceOrderRequest{
+			ClientOrderID: "client_" + key, AccountID: accountID, Symbol: "DOT-USDT", Side: side,
+			Price: price, Quantity: quantity, IdempotencyKey: key, GroupID: groupID,
+		}
+	}
+
+	// Two exits of the whole position, placed together, freeze the 10 DOT once
+	body, _ = json.Marshal(BatchPlaceOrderRequest{
+		AllOrNothing: true,
+		Orders: []PlaceOrderRequest{
+			order("acc1", "SELL", "8", "10", "tp", "oco1"),
+			order("acc1", "SELL", "9", "10", "exit", "oco1"),
+		},
+	})
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/orders/batch", bytes.NewReader(body)))
+	results := decodeSuccess[BatchPlaceOrderResponse](t, w.Body).Results
+	for _, result := range results {
+		if result.Order == nil || result.Order.GroupID != "oco1" {
+			t.Fatalf("expected both legs to be placed in oco1, got %+v", result)
+		}
+	}
+	tpID, exitID := results[0].Order.OrderID, results[1].Order.OrderID
+	expectDOT(0, 10)
+
+	// Another account buys 4 from tp, which cancels exit; the 6 tp still sells stay frozen
+	body, _ = json.Marshal(order("acc2", "BUY", "8", "4", "buy", ""))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/orders", bytes.NewReader(body)))
+	if resp := decodeSuccess[PlaceOrderResponse](t, w.Body); resp.Status != "FILLED" {
+		t.Fatalf("expected the buy to fill, got %+v", resp)
+	}
+	expectDOT(0, 6)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/v1/orders/%s?account_id=acc1&symbol=DOT-USDT", exitID), nil))
+	if resp := decodeSuccess[QueryOrderResponse](t, w.Body); resp.Status != "CANCELED" || resp.GroupID != "oco1" {
+		t.Fatalf("expected exit to be canceled with its group, got %+v", resp)
+	}
+
+	// Canceling tp releases the rest
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/v1/orders/%s?account_id=acc1&symbol=DOT-USDT", tpID), nil))
+	if resp := decodeSuccess[CancelOrderResponse](t, w.Body); resp.Status != "CANCELED" || resp.RemainingQty != "6" {
+		t.Fatalf("expected tp to be canceled with 6 left, got %+v", resp)
+	}
+	expectDOT(6, 0)
+}
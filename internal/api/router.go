@@ -31,7 +31,23 @@ func NewRouter(accountSvc account.Service, engine *engine.Engine) *Router {
 func (r *Router) setupRoutes() {
 	// Order endpoints
 	r.mux.HandleFunc("/v1/orders", r.routeOrders)
+	r.mux.HandleFunc("/v1/orders/batch", r.routeOrderBatch)
 	r.mux.HandleFunc("/v1/orders/", r.routeOrderByID)
+
+	// Dead-man's switch endpoints
+	r.mux.HandleFunc("/v1/dead-man-switch", r.routeDeadManSwitch)
+	r.mux.HandleFunc("/v1/dead-man-switch/heartbeat", r.routeDeadManSwitchHeartbeat)
+
+	// Market data endpoints
+	r.mux.HandleFunc("/v1/depth", r.routeDepth)
+	r.mux.HandleFunc("/v1/markets", r.routeMarkets)
+
+	// Admin endpoints
+	r.mux.HandleFunc("/v1/admin/shards", r.routeShards)
+	r.mux.HandleFunc("/v1/admin/shards/move", r.routeMoveSymbol)
+	r.mux.HandleFunc("/v1/admin/orders", r.routeAdminOrders)
+	r.mux.HandleFunc("/v1/admin/symbols", r.routeSymbols)
+	r.mux.HandleFunc("/v1/admin/symbols/status", r.routeSymbolStatus)
 }
 
 // routeOrders handles /v1/orders endpoint
@@ -39,6 +55,18 @@ func (r *Router) routeOrders(w http.ResponseWriter, req *http.Request) {
 	switch req.Method {
 	case http.MethodPost:
 		r.handler.PlaceOrder(w, req)
+	case http.MethodDelete:
+		r.handler.MassCancelOrders(w, req)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// routeOrderBatch handles /v1/orders/batch endpoint
+func (r *Router) routeOrderBatch(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodPost:
+		r.handler.PlaceOrderBatch(w, req)
 	default:
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 	}
@@ -56,6 +84,107 @@ func (r *Router) routeOrderByID(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+// routeDeadManSwitch handles /v1/dead-man-switch endpoint
+func (r *Router) routeDeadManSwitch(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodPost:
+		r.handler.ArmDeadManSwitch(w, req)
+	case http.MethodDelete:
+		r.handler.DisarmDeadManSwitch(w, req)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// routeDeadManSwitchHeartbeat handles /v1/dead-man-switch/heartbeat endpoint
+func (r *Router) routeDeadManSwitchHeartbeat(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodPost:
+		r.handler.HeartbeatDeadManSwitch(w, req)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// routeDepth handles /v1/depth endpoint
+func (r *Router) routeDepth(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		r.handler.QueryDepth(w, req)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// routeMarkets handles /v1/markets endpoint
+func (r *Router) routeMarkets(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		r.handler.ListMarkets(w, req)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// routeShards handles /v1/admin/shards endpoint
+func (r *Router) routeShards(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		r.handler.ListShards(w, req)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// routeMoveSymbol handles /v1/admin/shards/move endpoint
+func (r *Router) routeMoveSymbol(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodPost:
+		r.handler.MoveSymbol(w, req)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// routeAdminOrders handles /v1/admin/orders endpoint
+func (r *Router) routeAdminOrders(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodDelete:
+		r.handler.AdminMassCancelOrders(w, req)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// routeSymbols handles /v1/admin/symbols endpoint
+func (r *Router) routeSymbols(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		r.handler.ListSymbolSpecs(w, req)
+	case http.MethodPost:
+		r.handler.CreateSymbol(w, req)
+	case http.MethodPut:
+		r.handler.UpdateSymbol(w, req)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// routeSymbolStatus handles /v1/admin/symbols/status endpoint
+func (r *Router) routeSymbolStatus(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodPost:
+		r.handler.SetSymbolStatus(w, req)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// SetAPIKeySecret sets the secret API key IDs are derived with
+func (r *Router) SetAPIKeySecret(secret []byte) {
+	r.handler.SetAPIKeySecret(secret)
+}
+
 // ServeHTTP implements http.Handler interface
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	r.mux.ServeHTTP(w, req)
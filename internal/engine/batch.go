@@ -0,0 +1,342 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Future is the pending result of a submitted command
+type Future struct {
+	done   chan struct{}
+	result *CommandExecResult
+}
+
+func newFuture() *Future {
+	return &Future{done: make(chan struct{})}
+}
+
+// resolvedFuture returns a future that already holds result
+func resolvedFuture(result *CommandExecResult) *Future {
+	future := newFuture()
+	future.resolve(result)
+	return future
+}
+
+func (f *Future) resolve(result *CommandExecResult) {
+	f.result = result
+	close(f.done)
+}
+
+// Done returns a channel that is closed once the result is available
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Result blocks until the command has executed and returns its result
+func (f *Future) Result() *CommandExecResult {
+	<-f.done
+	return f.result
+}
+
+// Wait returns the result, or gives up with ErrorCodeTimeout when ctx is done first.
+// A command that was queued still executes after Wait gives up.
+func (f *Future) Wait(ctx context.Context) *CommandExecResult {
+	select {
+	case <-f.done:
+		return f.result
+	default:
+	}
+	select {
+	case <-f.done:
+		return f.result
+	case <-ctx.Done():
+		return &CommandExecResult{
+			Result:    nil,
+			ErrorCode: ErrorCodeTimeout,
+			Err:       fmt.Errorf("gave up waiting for the result, the command may still execute: %w", ctx.Err()),
+		}
+	}
+}
+
+// processRequest executes a queue entry and resolves its futures
+func (s *Shard) processRequest(req *commandRequest) {
+	if req.task != nil {
+		req.task()
+		return
+	}
+	if !req.atomic {
+		for i, envelope := range req.envelopes {
+			req.futures[i].resolve(s.processCommand(envelope))
+		}
+		return
+	}
+
+	// Group the commands by symbol, keeping their order within each symbol
+	groups := make(map[string][]int)
+	var symbols []string
+	for i, envelope := range req.envelopes {
+		if envelope == nil {
+			req.futures[i].resolve(s.processCommand(envelope))
+			continue
+		}
+		if _, ok := groups[envelope.Symbol]; !ok {
+			symbols = append(symbols, envelope.Symbol)
+		}
+		groups[envelope.Symbol] = append(groups[envelope.Symbol], i)
+	}
+	for _, symbol := range symbols {
+		indexes := groups[symbol]
+		envelopes := make([]*CommandEnvelope, len(indexes))
+		for i, index := range indexes {
+			envelopes[i] = req.envelopes[index]
+		}
+		for i, result := range s.processAtomic(symbol, envelopes) {
+			req.futures[indexes[i]].resolve(result)
+		}
+	}
+}
+
+// atomicCommand is a command of an all-or-nothing batch waiting for the batch to commit
+type atomicCommand struct {
+	envelope *CommandEnvelope
+	key      IdempotencyKey
+	now      time.Time
+	bookSeq  int64
+	executed bool // False for duplicates answered from the idempotency cache
+}
+
+// processAtomic executes the commands of one symbol so that all of them take effect or none do.
+// They run against a copy of the order book with event persistence and circuit breaker trips
+// held back until the batch commits; the first failure discards the copy and fails the other
+// commands with ErrorCodeBatchAborted.
+// Nothing is journaled or cached for an aborted batch, so it can be retried as a whole.
+func (s *Shard) processAtomic(symbol string, envelopes []*CommandEnvelope) []*CommandExecResult {
+	results := make([]*CommandExecResult, len(envelopes))
+	live, existed := s.books[symbol]
+	if existed {
+		// Known cost: the copy is a deep one, so every atomic batch pays time and garbage in
+		// proportion to the whole book, not to the orders it touches. Undoing an aborted batch
+		// from its events or copy-on-write levels would avoid it.
+		working := s.newBook(symbol)
+		if err := working.ImportState(live.ExportState()); err != nil {
+			return abortBatch(results, -1, &CommandExecResult{
+				Result:    nil,
+				ErrorCode: ErrorCodeInternalError,
+				Err:       fmt.Errorf("failed to copy order book: %w", err),
+			})
+		}
+		s.books[symbol] = working
+	}
+	rollback := func() {
+		if existed {
+			s.books[symbol] = live
+		} else {
+			delete(s.books, symbol)
+		}
+	}
+
+	s.deferring = true
+	s.deferredEvents = nil
+	s.deferredTrips = nil
+	defer func() {
+		s.deferring = false
+		s.deferredEvents = nil
+		s.deferredTrips = nil
+	}()
+
+	commands := make([]atomicCommand, len(envelopes))
+	seen := make(map[IdempotencyKey]int)
+	for i, envelope := range envelopes {
+		if envelope.CommandType != CommandTypePlace && envelope.CommandType != CommandTypeCancel {
+			rollback()
+			return abortBatch(results, i, &CommandExecResult{
+				Result:    nil,
+				ErrorCode: ErrorCodeInvalidArgument,
+				Err:       fmt.Errorf("%s commands cannot be batched atomically", envelope.CommandType),
+			})
+		}
+
+		key := idempotencyKeyOf(envelope)
+		commands[i] = atomicCommand{envelope: envelope, key: key}
+		// A key repeated within the batch is not in the cache yet
+		if prev, ok := seen[key]; ok {
+			if envelopes[prev].PayloadHash != envelope.PayloadHash {
+				rollback()
+				return abortBatch(results, i, &CommandExecResult{
+					Result:    nil,
+					ErrorCode: ErrorCodeDuplicateRequest,
+					Err:       fmt.Errorf("idempotency key %s is reused with a different payload", envelope.IdempotencyKey),
+				})
+			}
+			results[i] = results[prev]
+			continue
+		}
+		seen[key] = i
+		if cached := s.checkIdempotency(key, envelope); cached != nil {
+			if cached.ErrorCode != ErrorCodeNone {
+				rollback()
+				return abortBatch(results, i, cached)
+			}
+			results[i] = cached
+			continue
+		}
+
+		now := s.commandTime(envelope)
+		s.bookClock.Set(now)
+		bookSeq := s.bookSequence(symbol)
+		result := s.execute(envelope)
+		if result.ErrorCode != ErrorCodeNone {
+			rollback()
+			return abortBatch(results, i, result)
+		}
+		results[i] = result
+		commands[i].now = now
+		commands[i].bookSeq = bookSeq
+		commands[i].executed = true
+	}
+
+	// Commit: persist every event of the batch together, then journal and cache the commands
+	s.deferring = false
+	if err := s.persistEvents(symbol, s.deferredEvents); err != nil {
+		rollback()
+		return abortBatch(results, -1, &CommandExecResult{
+			Result:    nil,
+			ErrorCode: ErrorCodeInternalError,
+			Err:       fmt.Errorf("failed to persist event: %w", err),
+		})
+	}
+	for i, command := range commands {
+		if !command.executed {
+			continue
+		}
+		s.journalCommand(command.envelope, command.now, command.bookSeq)
+		s.storeResult(command.key, command.envelope, results[i])
+	}
+	for _, symbol := range s.deferredTrips {
+		s.breakerTripped(symbol)
+	}
+	return results
+}
+
+// abortBatch gives the failed command its own result and every other command ErrorCodeBatchAborted.
+// A failed index of -1 fails the whole batch with result.
+func abortBatch(results []*CommandExecResult, failed int, result *CommandExecResult) []*CommandExecResult {
+	for i := range results {
+		switch {
+		case i == failed:
+			results[i] = result
+		case failed < 0:
+			copied := *result
+			results[i] = &copied
+		default:
+			results[i] = &CommandExecResult{
+				Result:    nil,
+				ErrorCode: ErrorCodeBatchAborted,
+				Err:       fmt.Errorf("batch aborted: another command for the symbol failed with %s", result.ErrorCode),
+			}
+		}
+	}
+	return results
+}
+
+// SubmitAsync routes a command to its shard and returns a future for its result.
+// Commands that are rejected before queueing resolve at once.
+// A mass cancel without a symbol goes to every shard.
+func (e *Engine) SubmitAsync(ctx context.Context, envelope *CommandEnvelope) *Future {
+	// An admin status change takes over from a pending circuit breaker reopening
+	if envelope != nil && envelope.CommandType == CommandTypeSetSymbolStatus {
+		e.disarmReopen(envelope.Symbol)
+	}
+	return e.submitAsync(ctx, envelope)
+}
+
+// submitAsync is SubmitAsync without the status change bookkeeping
+func (e *Engine) submitAsync(ctx context.Context, envelope *CommandEnvelope) *Future {
+	if envelope != nil && envelope.CommandType == CommandTypeMassCancel && envelope.Symbol == "" {
+		return e.submitToAllShards(ctx, envelope)
+	}
+	var symbols []string
+	if envelope != nil {
+		symbols = []string{envelope.Symbol}
+	}
+	if err := e.lockRouting(ctx, symbols); err != nil {
+		return resolvedFuture(notQueuedResult(err))
+	}
+	defer e.routeMu.RUnlock()
+
+	shard, rejected := e.admit(envelope)
+	if rejected != nil {
+		return resolvedFuture(rejected)
+	}
+	return shard.SubmitAsync(ctx, envelope)
+}
+
+// SubmitBatch submits commands and waits for their results, returned in input order.
+// Each shard receives its commands as one queue entry and runs them back to back.
+// With atomic, the commands of each symbol all take effect or none do.
+func (e *Engine) SubmitBatch(ctx context.Context, envelopes []*CommandEnvelope, atomic bool) []*CommandExecResult {
+	futures := e.SubmitBatchAsync(ctx, envelopes, atomic)
+	results := make([]*CommandExecResult, len(futures))
+	for i, future := range futures {
+		results[i] = future.Wait(ctx)
+	}
+	return results
+}
+
+// SubmitBatchAsync is SubmitBatch without waiting; it returns one future per command
+func (e *Engine) SubmitBatchAsync(ctx context.Context, envelopes []*CommandEnvelope, atomic bool) []*Future {
+	futures := make([]*Future, len(envelopes))
+	var symbols []string
+	for _, envelope := range envelopes {
+		if envelope != nil {
+			symbols = append(symbols, envelope.Symbol)
+		}
+	}
+	if err := e.lockRouting(ctx, symbols); err != nil {
+		for i := range futures {
+			futures[i] = resolvedFuture(notQueuedResult(err))
+		}
+		return futures
+	}
+	defer e.routeMu.RUnlock()
+
+	byShard := make(map[*Shard][]int)
+	var shards []*Shard
+	rejectedSymbols := make(map[string]ErrorCode)
+	for i, envelope := range envelopes {
+		shard, rejected := e.admit(envelope)
+		if rejected != nil {
+			futures[i] = resolvedFuture(rejected)
+			if envelope != nil {
+				rejectedSymbols[envelope.Symbol] = rejected.ErrorCode
+			}
+			continue
+		}
+		if _, ok := byShard[shard]; !ok {
+			shards = append(shards, shard)
+		}
+		byShard[shard] = append(byShard[shard], i)
+	}
+
+	for _, shard := range shards {
+		var batch []*CommandEnvelope
+		var indexes []int
+		for _, i := range byShard[shard] {
+			if code, ok := rejectedSymbols[envelopes[i].Symbol]; ok && atomic {
+				futures[i] = resolvedFuture(&CommandExecResult{
+					Result:    nil,
+					ErrorCode: ErrorCodeBatchAborted,
+					Err:       fmt.Errorf("batch aborted: another command for the symbol failed with %s", code),
+				})
+				continue
+			}
+			batch = append(batch, envelopes[i])
+			indexes = append(indexes, i)
+		}
+		for j, future := range shard.SubmitBatch(ctx, batch, atomic) {
+			futures[indexes[j]] = future
+		}
+	}
+	return futures
+}
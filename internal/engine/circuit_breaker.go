@@ -0,0 +1,140 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"matching-engine/internal/matching"
+	"matching-engine/internal/symbolspec"
+)
+
+// BreakerReopenHandler is called with the result of reopening a symbol after its cooling-off period
+type BreakerReopenHandler func(symbol string, result *CommandExecResult)
+
+// circuitBreakers holds the pending reopenings of symbols whose breaker tripped
+type circuitBreakers struct {
+	mu       sync.Mutex
+	reopens  map[string]*time.Timer
+	onReopen BreakerReopenHandler
+	stopped  bool
+	wg       sync.WaitGroup // In-flight reopenings
+}
+
+// SetBreakerReopenHandler sets the function told about the auction trades of a symbol
+// reopened after a circuit breaker, so the caller can settle them.
+// This should be called before the engine starts processing commands.
+func (e *Engine) SetBreakerReopenHandler(handler BreakerReopenHandler) {
+	e.breakers.mu.Lock()
+	defer e.breakers.mu.Unlock()
+	e.breakers.onReopen = handler
+}
+
+// priceBands returns the price bands configured in the symbol's spec; unknown symbols have none
+func priceBands(symbol string) matching.PriceBands {
+	spec, err := symbolspec.Get(symbol)
+	if err != nil {
+		return matching.PriceBands{}
+	}
+	bands := matching.PriceBands{
+		LimitBps:      spec.PriceBandBps,
+		TradeBps:      spec.TradeBandBps,
+		BreakerStatus: matching.SymbolStatusHalted,
+	}
+	if spec.BreakerAuction {
+		bands.BreakerStatus = matching.SymbolStatusPreOpen
+	}
+	return bands
+}
+
+// tripped schedules the reopening of a symbol whose breaker tripped, after the spec's cooling-off period.
+// Without a cooling-off period the symbol stays halted or in auction until an admin reopens it.
+// It is called on the shard's event loop and must not block.
+func (e *Engine) tripped(symbol string) {
+	spec, err := symbolspec.Get(symbol)
+	if err != nil || spec.BreakerCoolingOff <= 0 {
+		return
+	}
+
+	b := &e.breakers
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.stopped {
+		return
+	}
+	if previous, ok := b.reopens[symbol]; ok {
+		previous.Stop()
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(spec.BreakerCoolingOff, func() { e.reopen(symbol, timer) })
+	b.reopens[symbol] = timer
+}
+
+// disarmReopen drops a symbol's pending reopening; an admin status change takes over from it
+func (e *Engine) disarmReopen(symbol string) {
+	b := &e.breakers
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if timer, ok := b.reopens[symbol]; ok {
+		timer.Stop()
+		delete(b.reopens, symbol)
+	}
+}
+
+// reopen moves a symbol back to TRADING once its cooling-off period is over.
+// A crossed book, from the breaching order or an auction, uncrosses as it reopens.
+func (e *Engine) reopen(symbol string, timer *time.Timer) {
+	b := &e.breakers
+	b.mu.Lock()
+	if b.reopens[symbol] != timer || b.stopped {
+		// Re-tripped, taken over by an admin, or shutting down
+		b.mu.Unlock()
+		return
+	}
+	delete(b.reopens, symbol)
+	onReopen := b.onReopen
+	b.wg.Add(1)
+	b.mu.Unlock()
+	defer b.wg.Done()
+
+	req := &matching.SetSymbolStatusRequest{
+		Symbol: symbol,
+		Status: matching.SymbolStatusTrading,
+		Reason: "circuit breaker cooling-off ended",
+	}
+	payloadHash, err := ComputePayloadHash(req)
+	if err != nil {
+		fmt.Printf("Warning: failed to hash circuit breaker reopening for %s: %v\n", symbol, err)
+		return
+	}
+	commandID := fmt.Sprintf("breaker_%s_%d", symbol, time.Now().UnixNano())
+	ctx := context.Background()
+	result := e.submitAsync(ctx, &CommandEnvelope{
+		CommandID:      commandID,
+		CommandType:    CommandTypeSetSymbolStatus,
+		IdempotencyKey: commandID,
+		Symbol:         symbol,
+		PayloadHash:    payloadHash,
+		Payload:        req,
+		CreatedAt:      time.Now(),
+	}).Wait(ctx)
+	if result.ErrorCode != ErrorCodeNone {
+		fmt.Printf("Warning: circuit breaker reopening of %s failed: %v\n", symbol, result.Err)
+	}
+	if onReopen != nil {
+		onReopen(symbol, result)
+	}
+}
+
+// stop stops every pending reopening and waits for those already running.
+// Symbols tripped at shutdown stay halted or in auction after a restart until an admin reopens them.
+func (b *circuitBreakers) stop() {
+	b.mu.Lock()
+	b.stopped = true
+	for _, timer := range b.reopens {
+		timer.Stop()
+	}
+	b.mu.Unlock()
+	b.wg.Wait()
+}
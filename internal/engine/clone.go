@@ -71,6 +71,24 @@ func cloneEvent(evt matching.Event) matching.Event {
 		}
 		cp := *e
 		return &cp
+	case *matching.SymbolStatusChangedEvent:
+		if e == nil {
+			return nil
+		}
+		cp := *e
+		return &cp
+	case *matching.PriceBandBreachedEvent:
+		if e == nil {
+			return nil
+		}
+		cp := *e
+		return &cp
+	case *matching.SymbolSpecChangedEvent:
+		if e == nil {
+			return nil
+		}
+		cp := *e
+		return &cp
 	default:
 		return evt
 	}
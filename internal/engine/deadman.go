@@ -0,0 +1,286 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"matching-engine/internal/matching"
+)
+
+// MinDeadManTimeout is the shortest timeout a dead-man's switch can be armed with
+const MinDeadManTimeout = time.Second
+
+// Backoff between attempts to cancel the orders of an expired switch, doubling up to the maximum
+const (
+	deadManRetryDelay    = 100 * time.Millisecond
+	deadManMaxRetryDelay = 5 * time.Second
+)
+
+// DeadManSwitchStore persists the timeouts of the armed dead-man's switches by account (optional).
+// Without one, switches are disarmed by a restart.
+type DeadManSwitchStore interface {
+	SaveDeadManSwitches(ctx context.Context, timeouts map[string]time.Duration) error
+}
+
+// DeadManSwitch is an account's cancel-on-disconnect timer.
+// Unless the account heartbeats before Deadline, the engine cancels all its orders.
+type DeadManSwitch struct {
+	AccountID string
+	Timeout   time.Duration
+	Deadline  time.Time
+}
+
+// DeadManExpiryHandler is called with the result of the mass cancel of an expired switch
+type DeadManExpiryHandler func(accountID string, result *CommandExecResult)
+
+// deadManSwitches holds the armed switches of every account, across all shards
+type deadManSwitches struct {
+	mu       sync.Mutex
+	switches map[string]*armedSwitch
+	store    DeadManSwitchStore
+	onExpiry DeadManExpiryHandler
+	wg       sync.WaitGroup // In-flight expiries
+}
+
+// armedSwitch is a switch and the timer that fires it
+type armedSwitch struct {
+	DeadManSwitch
+	timer    *time.Timer
+	attempts int // Failed cancels since the switch expired
+}
+
+// SetDeadManSwitchStore sets the store that persists armed dead-man's switches (optional).
+// This should be called before the engine starts processing commands.
+func (e *Engine) SetDeadManSwitchStore(store DeadManSwitchStore) {
+	e.deadMan.mu.Lock()
+	defer e.deadMan.mu.Unlock()
+	e.deadMan.store = store
+}
+
+// SetDeadManExpiryHandler sets the function told about the orders an expired switch canceled,
+// so the caller can release their funds.
+// This should be called before any switch is armed or restored.
+func (e *Engine) SetDeadManExpiryHandler(handler DeadManExpiryHandler) {
+	e.deadMan.mu.Lock()
+	defer e.deadMan.mu.Unlock()
+	e.deadMan.onExpiry = handler
+}
+
+// ArmDeadManSwitch arms, or re-arms with a new timeout, an account's dead-man's switch
+func (e *Engine) ArmDeadManSwitch(accountID string, timeout time.Duration) (DeadManSwitch, error) {
+	if accountID == "" {
+		return DeadManSwitch{}, fmt.Errorf("account_id required")
+	}
+	if timeout < MinDeadManTimeout {
+		return DeadManSwitch{}, fmt.Errorf("timeout must be at least %s", MinDeadManTimeout)
+	}
+	if e.closed.Load() {
+		return DeadManSwitch{}, fmt.Errorf("engine is closed")
+	}
+
+	d := &e.deadMan
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	previous, rearmed := d.switches[accountID]
+	if rearmed {
+		previous.timer.Stop()
+	}
+	armed := e.armLocked(DeadManSwitch{AccountID: accountID, Timeout: timeout})
+	if err := d.saveLocked(); err != nil {
+		armed.timer.Stop()
+		if rearmed {
+			d.switches[accountID] = previous
+			previous.timer.Reset(time.Until(previous.Deadline))
+		} else {
+			delete(d.switches, accountID)
+		}
+		return DeadManSwitch{}, err
+	}
+	return armed.DeadManSwitch, nil
+}
+
+// HeartbeatDeadManSwitch pushes an armed switch's deadline one timeout into the future
+func (e *Engine) HeartbeatDeadManSwitch(accountID string) (DeadManSwitch, error) {
+	d := &e.deadMan
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	armed, ok := d.switches[accountID]
+	if !ok {
+		return DeadManSwitch{}, fmt.Errorf("no dead-man's switch is armed for account %s", accountID)
+	}
+	// A timer that already fired is expiring; the expiry sees the new deadline and stands down
+	armed.Deadline = time.Now().Add(armed.Timeout)
+	armed.attempts = 0
+	armed.timer.Reset(armed.Timeout)
+	return armed.DeadManSwitch, nil
+}
+
+// DisarmDeadManSwitch disarms an account's switch; disarming an unarmed account is a no-op
+func (e *Engine) DisarmDeadManSwitch(accountID string) error {
+	d := &e.deadMan
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	armed, ok := d.switches[accountID]
+	if !ok {
+		return nil
+	}
+	armed.timer.Stop()
+	delete(d.switches, accountID)
+	if err := d.saveLocked(); err != nil {
+		d.switches[accountID] = armed
+		armed.timer.Reset(time.Until(armed.Deadline))
+		return err
+	}
+	return nil
+}
+
+// DeadManSwitches returns the armed switches, sorted by account
+func (e *Engine) DeadManSwitches() []DeadManSwitch {
+	e.deadMan.mu.Lock()
+	defer e.deadMan.mu.Unlock()
+	return e.deadMan.listLocked()
+}
+
+// RestoreDeadManSwitches re-arms persisted switches from their timeouts by account.
+// Each gets a full timeout from now, since accounts could not heartbeat while the engine was down.
+// This should be called after recovery, once the expiry handler is set.
+func (e *Engine) RestoreDeadManSwitches(timeouts map[string]time.Duration) error {
+	for accountID, timeout := range timeouts {
+		if accountID == "" || timeout < MinDeadManTimeout {
+			return fmt.Errorf("invalid dead-man's switch for account %q with timeout %s", accountID, timeout)
+		}
+	}
+
+	d := &e.deadMan
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for accountID, timeout := range timeouts {
+		if previous, ok := d.switches[accountID]; ok {
+			previous.timer.Stop()
+		}
+		e.armLocked(DeadManSwitch{AccountID: accountID, Timeout: timeout})
+	}
+	return nil
+}
+
+// armLocked starts a switch's timer; the caller holds d.mu
+func (e *Engine) armLocked(sw DeadManSwitch) *armedSwitch {
+	sw.Deadline = time.Now().Add(sw.Timeout)
+	armed := &armedSwitch{DeadManSwitch: sw}
+	armed.timer = time.AfterFunc(sw.Timeout, func() { e.expireDeadManSwitch(armed) })
+	e.deadMan.switches[sw.AccountID] = armed
+	return armed
+}
+
+// expireDeadManSwitch cancels all the orders of an account whose switch's deadline passed.
+// The switch stays armed until the cancel succeeds; a failed cancel, say on an overloaded
+// shard or a failed event write, is retried with backoff unless the account heartbeats first.
+func (e *Engine) expireDeadManSwitch(armed *armedSwitch) {
+	d := &e.deadMan
+	d.mu.Lock()
+	if d.switches[armed.AccountID] != armed || time.Now().Before(armed.Deadline) || e.closed.Load() {
+		// Re-armed, disarmed, heartbeaten since the timer fired, or shutting down
+		d.mu.Unlock()
+		return
+	}
+	attempt := armed.attempts
+	onExpiry := d.onExpiry
+	d.wg.Add(1)
+	d.mu.Unlock()
+	defer d.wg.Done()
+
+	req := &matching.MassCancelRequest{
+		AccountID: armed.AccountID,
+		Reason:    matching.CancelReasonSystem,
+	}
+	payloadHash, err := ComputePayloadHash(req)
+	if err != nil {
+		d.settleExpiry(armed, attempt, &CommandExecResult{
+			ErrorCode: ErrorCodeInternalError,
+			Err:       fmt.Errorf("failed to hash dead-man's switch cancel: %w", err),
+		})
+		return
+	}
+	// Each attempt is a new command, so a retry is not answered from the idempotency cache
+	commandID := fmt.Sprintf("deadman_%s_%d_%d", armed.AccountID, armed.Deadline.UnixNano(), attempt)
+	result := e.Submit(&CommandEnvelope{
+		CommandID:      commandID,
+		CommandType:    CommandTypeMassCancel,
+		IdempotencyKey: commandID,
+		AccountID:      armed.AccountID,
+		PayloadHash:    payloadHash,
+		Payload:        req,
+		CreatedAt:      time.Now(),
+	})
+	d.settleExpiry(armed, attempt, result)
+
+	// Orders canceled before a shard failed still need their funds released
+	if onExpiry != nil {
+		onExpiry(armed.AccountID, result)
+	}
+}
+
+// settleExpiry disarms a switch whose cancel succeeded, or schedules the next attempt
+func (d *deadManSwitches) settleExpiry(armed *armedSwitch, attempt int, result *CommandExecResult) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.switches[armed.AccountID] != armed || time.Now().Before(armed.Deadline) {
+		// Re-armed, disarmed or heartbeaten while the cancel ran; a heartbeat keeps the switch
+		// armed on its new deadline
+		return
+	}
+	if result.ErrorCode != ErrorCodeNone {
+		armed.attempts++
+		delay := min(deadManRetryDelay<<min(attempt, 6), deadManMaxRetryDelay)
+		log.Printf("WARNING: dead-man's switch cancel for %s failed, retrying in %s: %v", armed.AccountID, delay, result.Err)
+		armed.timer.Reset(delay)
+		return
+	}
+	delete(d.switches, armed.AccountID)
+	if err := d.saveLocked(); err != nil {
+		log.Printf("WARNING: %v", err)
+	}
+}
+
+// stop stops every timer and waits for expiries already running, keeping the
+// switches persisted so a restart re-arms them
+func (d *deadManSwitches) stop() {
+	d.mu.Lock()
+	for _, armed := range d.switches {
+		armed.timer.Stop()
+	}
+	d.mu.Unlock()
+	d.wg.Wait()
+}
+
+// listLocked returns the armed switches sorted by account; the caller holds d.mu
+func (d *deadManSwitches) listLocked() []DeadManSwitch {
+	switches := make([]DeadManSwitch, 0, len(d.switches))
+	for _, armed := range d.switches {
+		switches = append(switches, armed.DeadManSwitch)
+	}
+	sort.Slice(switches, func(i, j int) bool { return switches[i].AccountID < switches[j].AccountID })
+	return switches
+}
+
+// saveLocked persists the armed switches; the caller holds d.mu
+func (d *deadManSwitches) saveLocked() error {
+	if d.store == nil {
+		return nil
+	}
+	timeouts := make(map[string]time.Duration, len(d.switches))
+	for accountID, armed := range d.switches {
+		timeouts[accountID] = armed.Timeout
+	}
+	if err := d.store.SaveDeadManSwitches(context.Background(), timeouts); err != nil {
+		return fmt.Errorf("failed to persist dead-man's switches: %w", err)
+	}
+	return nil
+}
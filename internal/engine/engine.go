@@ -15,6 +15,12 @@ type EventStore interface {
 	Append(ctx context.Context, symbol string, event matching.Event) error
 }
 
+// BatchEventStore is an optional EventStore extension that persists
+// all events of one command with a single durable write
+type BatchEventStore interface {
+	AppendBatch(ctx context.Context, symbol string, events []matching.Event) error
+}
+
 // SnapshotStore defines the minimal interface needed for snapshot persistence
 type SnapshotStore interface {
 	Save(ctx context.Context, snapshot any) error
@@ -22,17 +28,30 @@ type SnapshotStore interface {
 
 // Engine manages multiple shards and routes commands to them
 type Engine struct {
-	router    *Router
-	shards    []*Shard
-	closed    atomic.Bool
-	closeOnce sync.Once
+	router          *Router
+	shards          []*Shard
+	readOnly        bool
+	closed          atomic.Bool
+	closeOnce       sync.Once
+	assignmentStore ShardAssignmentStore // Optional: if nil, shard assignments are memory-only
+
+	// Symbol migration: submitters read-lock routing while they queue; moving symbols wait on a channel
+	routeMu sync.RWMutex
+	moves   map[string]chan struct{}
+	moveMu  sync.Mutex // Serializes migrations
+
+	deadMan  deadManSwitches // Per-account cancel-on-disconnect timers
+	breakers circuitBreakers // Reopenings of symbols whose circuit breaker tripped
 }
 
 // EngineConfig holds configuration for the engine
 type EngineConfig struct {
-	ShardCount     int           // Number of shards (default: 8)
-	QueueSize      int           // Command queue size per shard (default: 1000)
-	IdempotencyTTL time.Duration // Idempotency record TTL (default: 24h)
+	ShardCount     int            // Number of shards (default: 8)
+	QueueSize      int            // Command queue size per shard (default: 1000)
+	QueueHighWater int            // Queue depth at which non-cancel commands are shed (default: 80% of QueueSize)
+	IdempotencyTTL time.Duration  // Idempotency record TTL (default: 24h)
+	ReadOnly       bool           // Serve queries only and reject place/cancel (time-travel mode)
+	Clock          matching.Clock // Stamps commands submitted without CreatedAt (default: wall clock)
 }
 
 // DefaultEngineConfig returns default engine configuration
@@ -51,49 +70,91 @@ func NewEngine(config *EngineConfig) *Engine {
 	// Create router
 	router := NewRouter(cfg.ShardCount)
 
-	// Create shards
-	shards := make([]*Shard, cfg.ShardCount)
-	for i := 0; i < cfg.ShardCount; i++ {
-		shards[i] = NewShard(i, cfg.QueueSize, cfg.IdempotencyTTL)
-		shards[i].Start()
+	e := &Engine{
+		router:   router,
+		shards:   make([]*Shard, cfg.ShardCount),
+		readOnly: cfg.ReadOnly,
+		moves:    make(map[string]chan struct{}),
+		deadMan:  deadManSwitches{switches: make(map[string]*armedSwitch)},
+		breakers: circuitBreakers{reopens: make(map[string]*time.Timer)},
 	}
 
-	return &Engine{
-		router: router,
-		shards: shards,
+	// Create shards
+	for i := 0; i < cfg.ShardCount; i++ {
+		e.shards[i] = NewShard(i, cfg.QueueSize, cfg.IdempotencyTTL)
+		e.shards[i].SetClock(cfg.Clock)
+		e.shards[i].SetQueueHighWater(cfg.QueueHighWater)
+		e.shards[i].onBreakerTrip = e.tripped
+		e.shards[i].Start()
 	}
+	return e
 }
 
 // Submit submits a command to the appropriate shard and returns the result
 func (e *Engine) Submit(envelope *CommandEnvelope) *CommandExecResult {
+	return e.SubmitContext(context.Background(), envelope)
+}
+
+// SubmitContext submits a command to the appropriate shard and returns the result.
+// It fails fast with ErrorCodeOverloaded when the shard sheds the command,
+// and gives up with ErrorCodeTimeout when ctx is done before the result arrives.
+func (e *Engine) SubmitContext(ctx context.Context, envelope *CommandEnvelope) *CommandExecResult {
+	return e.SubmitAsync(ctx, envelope).Wait(ctx)
+}
+
+// admit checks a command before it is queued and returns the shard that owns it,
+// or the result of a command that is rejected outright
+func (e *Engine) admit(envelope *CommandEnvelope) (*Shard, *CommandExecResult) {
 	if envelope == nil {
-		return &CommandExecResult{
+		return nil, &CommandExecResult{
 			ErrorCode: ErrorCodeInvalidArgument,
 			Err:       fmt.Errorf("command envelope is nil"),
 		}
 	}
 	if e.closed.Load() {
-		return &CommandExecResult{
+		return nil, &CommandExecResult{
 			ErrorCode: ErrorCodeInvalidArgument,
 			Err:       fmt.Errorf("engine is closed"),
 		}
 	}
+	if e.readOnly && !envelope.CommandType.isReadOnly() {
+		return nil, &CommandExecResult{
+			ErrorCode: ErrorCodeReadOnly,
+			Err:       fmt.Errorf("engine is read-only, %s commands are not accepted", envelope.CommandType),
+		}
+	}
 
 	// Route to shard
 	shardID := e.router.Route(envelope.Symbol)
 	if shardID < 0 || shardID >= len(e.shards) {
-		return &CommandExecResult{
+		return nil, &CommandExecResult{
 			ErrorCode: ErrorCodeInvalidArgument,
 			Err:       fmt.Errorf("invalid shard id: %d", shardID),
 		}
 	}
-	shard := e.shards[shardID]
+	return e.shards[shardID], nil
+}
+
+// ReadOnly reports whether the engine rejects state-changing commands
+func (e *Engine) ReadOnly() bool {
+	return e.readOnly
+}
+
+// QueueStats returns the queue state of every shard, indexed by shard ID
+func (e *Engine) QueueStats() []QueueStats {
+	stats := make([]QueueStats, len(e.shards))
+	for i, shard := range e.shards {
+		stats[i] = shard.QueueStats()
+	}
+	return stats
+}
 
-	// Submit to shard
-	return shard.Submit(envelope)
+// SymbolQueueStats returns the queue state of the shard that owns symbol
+func (e *Engine) SymbolQueueStats(symbol string) QueueStats {
+	return e.shards[e.router.Route(symbol)].QueueStats()
 }
 
-// GetShardID returns the shard ID for a given symbol (for testing)
+// GetShardID returns the shard ID a symbol routes to
 func (e *Engine) GetShardID(symbol string) int {
 	return e.router.Route(symbol)
 }
@@ -102,6 +163,8 @@ func (e *Engine) GetShardID(symbol string) int {
 func (e *Engine) Close() {
 	e.closeOnce.Do(func() {
 		e.closed.Store(true)
+		e.deadMan.stop()
+		e.breakers.stop()
 		for _, shard := range e.shards {
 			shard.Stop()
 		}
@@ -157,6 +220,41 @@ func (e *Engine) SetSnapshotStore(snapshotStore SnapshotStore) {
 	}
 }
 
+// SetIdempotencyRecordStore sets the idempotency record store for all shards
+// This should be called before the engine starts processing commands
+func (e *Engine) SetIdempotencyRecordStore(store IdempotencyRecordStore) {
+	for _, shard := range e.shards {
+		shard.SetIdempotencyRecordStore(store)
+	}
+}
+
+// SetCommandJournal sets the command journal for all shards
+// This should be called before the engine starts processing commands
+func (e *Engine) SetCommandJournal(journal CommandJournal) {
+	for _, shard := range e.shards {
+		shard.SetCommandJournal(journal)
+	}
+}
+
+// RestoreIdempotencyRecords restores persisted idempotency records into their symbols' shards
+// This should be called before the engine starts processing new commands
+func (e *Engine) RestoreIdempotencyRecords(records []*PersistedIdempotencyRecord) error {
+	if e.closed.Load() {
+		return fmt.Errorf("engine is closed")
+	}
+
+	for _, record := range records {
+		shardID := e.router.Route(record.Symbol)
+		if shardID < 0 || shardID >= len(e.shards) {
+			return fmt.Errorf("invalid shard id: %d", shardID)
+		}
+		if err := e.shards[shardID].RestoreIdempotencyRecord(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func normalizeEngineConfig(config *EngineConfig) EngineConfig {
 	defaults := DefaultEngineConfig()
 	if config == nil {
@@ -1,12 +1,17 @@
 package engine
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"reflect"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"matching-engine/internal/matching"
+	"matching-engine/internal/symbolspec"
 )
 
 // Helper function to extract CommandResult from Result field
@@ -710,3 +715,1234 @@ func TestCachedResultIsImmutableToCallerMutation(t *testing.T) {
 		t.Fatalf("cached result should not be polluted by caller mutation, got %d events", len(getCommandResult(t, second).Events))
 	}
 }
+
+func TestSubmitContext_TimesOutBeforeQueueingAndWaiting(t *testing.T) {
+	shard := NewShard(0, 1, time.Hour)
+	place := func(orderID string) *CommandEnvelope {
+		return &CommandEnvelope{
+			CommandType:    CommandTypePlace,
+			IdempotencyKey: orderID,
+			Symbol:         "BTC-USDT",
+			AccountID:      "acc1",
+			Payload: &matching.PlaceOrderRequest{
+				OrderID: orderID, ClientOrderID: "c-" + orderID, AccountID: "acc1", Symbol: "BTC-USDT",
+				Side: matching.SideBuy, PriceInt: 43000, QuantityInt: 100,
+			},
+		}
+	}
+
+	// The shard is not running: the first command is queued, then the wait times out
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	waited := shard.SubmitContext(ctx, place("order1"))
+	if waited.ErrorCode != ErrorCodeTimeout || errors.Is(waited.Err, ErrCommandNotQueued) {
+		t.Fatalf("expected a timeout after queueing, got %q: %v", waited.ErrorCode, waited.Err)
+	}
+
+	// A canceled context never queues the command
+	canceled, cancel2 := context.WithCancel(context.Background())
+	cancel2()
+	queued := shard.SubmitContext(canceled, place("order2"))
+	if queued.ErrorCode != ErrorCodeTimeout || !errors.Is(queued.Err, ErrCommandNotQueued) || !errors.Is(queued.Err, context.Canceled) {
+		t.Fatalf("expected a timeout before queueing, got %q: %v", queued.ErrorCode, queued.Err)
+	}
+
+	// The queued command still executes once the shard runs; the unqueued one does not
+	shard.Start()
+	defer shard.Stop()
+	for shard.QueueStats().Depth > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if retry := shard.Submit(place("order1")); retry.ErrorCode != ErrorCodeNone {
+		t.Fatalf("expected the cached result of order1, got %q: %v", retry.ErrorCode, retry.Err)
+	}
+	query := shard.Submit(&CommandEnvelope{
+		CommandType:    CommandTypeQuery,
+		IdempotencyKey: "query_order2",
+		Symbol:         "BTC-USDT",
+		AccountID:      "acc1",
+		Payload:        &matching.QueryOrderRequest{OrderID: "order2", AccountID: "acc1", Symbol: "BTC-USDT"},
+	})
+	if query.ErrorCode != ErrorCodeOrderNotFound {
+		t.Fatalf("expected order2 not to exist, got %q: %v", query.ErrorCode, query.Err)
+	}
+}
+
+func TestAdmissionControl_ShedsPlacesBeforeCancels(t *testing.T) {
+	shard := NewShard(3, 4, time.Hour)
+	shard.SetQueueHighWater(2)
+	envelope := func(commandType CommandType, key string) *CommandEnvelope {
+		return &CommandEnvelope{CommandType: commandType, IdempotencyKey: key, Symbol: "BTC-USDT", AccountID: "acc1"}
+	}
+
+	// The shard is not running, so queued commands stay queued
+	for i := 0; i < 2; i++ {
+		before := shard.QueueStats().Depth
+		go shard.Submit(envelope(CommandTypePlace, fmt.Sprintf("place%d", i)))
+		waitForQueueDepth(t, shard, before+1)
+	}
+
+	shed := shard.Submit(envelope(CommandTypePlace, "place_shed"))
+	var overload *OverloadError
+	if shed.ErrorCode != ErrorCodeOverloaded || !errors.As(shed.Err, &overload) || overload.Full || overload.ShardID != 3 || overload.Depth != 2 {
+		t.Fatalf("expected the place to be shed at the high-water mark, got %q: %v", shed.ErrorCode, shed.Err)
+	}
+
+	// Cancels use the headroom above the high-water mark until the queue is full
+	for i := 0; i < 2; i++ {
+		go shard.Submit(envelope(CommandTypeCancel, fmt.Sprintf("cancel%d", i)))
+		waitForQueueDepth(t, shard, 3+i)
+	}
+	full := shard.Submit(envelope(CommandTypeCancel, "cancel_full"))
+	if full.ErrorCode != ErrorCodeOverloaded || !errors.As(full.Err, &overload) || !overload.Full {
+		t.Fatalf("expected the cancel to be rejected by a full queue, got %q: %v", full.ErrorCode, full.Err)
+	}
+
+	if stats := shard.QueueStats(); stats != (QueueStats{ShardID: 3, Depth: 4, HighWater: 2, Capacity: 4}) {
+		t.Fatalf("unexpected queue stats %+v", stats)
+	}
+	shard.Start()
+	shard.Stop()
+}
+
+func waitForQueueDepth(t *testing.T, shard *Shard, depth int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for shard.QueueStats().Depth < depth {
+		if time.Now().After(deadline) {
+			t.Fatalf("queue depth stuck at %d, want %d", shard.QueueStats().Depth, depth)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSubmitBatch_RunsAsOneQueueEntry(t *testing.T) {
+	shard := NewShard(0, 4, time.Hour)
+	place := func(orderID string, side matching.Side) *CommandEnvelope {
+		req := &matching.PlaceOrderRequest{
+			OrderID: orderID, ClientOrderID: "c_" + orderID, AccountID: "acc1", Symbol: "BTC-USDT",
+			Side: side, PriceInt: 43000, QuantityInt: 100,
+		}
+		hash, _ := ComputePayloadHash(req)
+		return &CommandEnvelope{
+			CommandType: CommandTypePlace, IdempotencyKey: "idem_" + orderID, Symbol: "BTC-USDT",
+			AccountID: "acc1", PayloadHash: hash, Payload: req,
+		}
+	}
+
+	// The shard is not running, so the batch stays queued
+	futures := shard.SubmitBatch(context.Background(), []*CommandEnvelope{
+		place("order1", matching.SideBuy),
+		place("order2", matching.SideSell),
+	}, false)
+	if depth := shard.QueueStats().Depth; depth != 1 {
+		t.Fatalf("expected the batch to take one queue slot, got depth %d", depth)
+	}
+	for _, future := range futures {
+		select {
+		case <-future.Done():
+			t.Fatalf("future resolved before the shard ran")
+		default:
+		}
+	}
+
+	shard.Start()
+	defer shard.Stop()
+	if result := futures[0].Result(); result.ErrorCode != ErrorCodeNone {
+		t.Fatalf("first place failed: %v", result.Err)
+	}
+	matched := getCommandResult(t, futures[1].Result())
+	if matched == nil || len(matched.Trades) != 1 {
+		t.Fatalf("expected the second place to match the first, got %+v", futures[1].Result())
+	}
+}
+
+// recordingEventStore keeps appended events in memory
+type recordingEventStore struct {
+	events []matching.Event
+}
+
+func (s *recordingEventStore) Append(ctx context.Context, symbol string, event matching.Event) error {
+	s.events = append(s.events, event)
+	return nil
+}
+
+func TestSubmitBatch_AtomicRollsBackSymbolOnFailure(t *testing.T) {
+	engine := NewEngine(DefaultEngineConfig())
+	defer engine.Close()
+	store := &recordingEventStore{}
+	engine.SetEventStore(store)
+
+	place := func(symbol, orderID string) *CommandEnvelope {
+		req := &matching.PlaceOrderRequest{
+			OrderID: orderID, ClientOrderID: "c_" + orderID, AccountID: "acc1", Symbol: symbol,
+			Side: matching.SideBuy, PriceInt: 43000, QuantityInt: 100,
+		}
+		hash, _ := ComputePayloadHash(req)
+		return &CommandEnvelope{
+			CommandType: CommandTypePlace, IdempotencyKey: "idem_" + orderID, Symbol: symbol,
+			AccountID: "acc1", PayloadHash: hash, Payload: req,
+		}
+	}
+	cancel := func(symbol, orderID string) *CommandEnvelope {
+		req := &matching.CancelOrderRequest{OrderID: orderID, AccountID: "acc1", Symbol: symbol}
+		hash, _ := ComputePayloadHash(req)
+		return &CommandEnvelope{
+			CommandType: CommandTypeCancel, IdempotencyKey: "idem_cancel_" + orderID, Symbol: symbol,
+			AccountID: "acc1", PayloadHash: hash, Payload: req,
+		}
+	}
+
+	if result := engine.Submit(place("BTC-USDT", "resting")); result.ErrorCode != ErrorCodeNone {
+		t.Fatalf("place failed: %v", result.Err)
+	}
+	storedBefore := len(store.events)
+
+	results := engine.SubmitBatch(context.Background(), []*CommandEnvelope{
+		place("BTC-USDT", "order1"),
+		place("ETH-USDT", "order2"),
+		cancel("BTC-USDT", "missing"),
+	}, true)
+	if results[0].ErrorCode != ErrorCodeBatchAborted {
+		t.Fatalf("expected the BTC place to be aborted, got %q: %v", results[0].ErrorCode, results[0].Err)
+	}
+	if results[1].ErrorCode != ErrorCodeNone {
+		t.Fatalf("expected the ETH place to succeed, got %q: %v", results[1].ErrorCode, results[1].Err)
+	}
+	if results[2].ErrorCode != ErrorCodeOrderNotFound {
+		t.Fatalf("expected the cancel to fail, got %q", results[2].ErrorCode)
+	}
+
+	// Only the ETH place reached the book and the event log
+	book := engine.shards[engine.GetShardID("BTC-USDT")].books["BTC-USDT"]
+	if _, ok := book.Orders["order1"]; ok || len(book.Orders) != 1 {
+		t.Fatalf("aborted place is on the book: %d orders", len(book.Orders))
+	}
+	for _, event := range store.events[storedBefore:] {
+		if event.Symbol() != "ETH-USDT" {
+			t.Fatalf("aborted batch persisted a %s event", event.Symbol())
+		}
+	}
+
+	// Nothing was cached for the aborted commands, so the retry executes
+	if retry := engine.Submit(place("BTC-USDT", "order1")); retry.ErrorCode != ErrorCodeNone || getCommandResult(t, retry) == nil {
+		t.Fatalf("retry after abort failed: %v", retry.Err)
+	}
+}
+
+func TestSubmitBatch_AtomicTripsBreakerOnlyOnCommit(t *testing.T) {
+	engine := NewEngine(&EngineConfig{ShardCount: 1, QueueSize: 100, IdempotencyTTL: time.Hour})
+	defer engine.Close()
+	engine.SetEventStore(&recordingEventStore{})
+
+	const symbol = "NEAR-USDT"
+	envelope := func(commandType CommandType, key string, payload any) *CommandEnvelope {
+		hash, _ := ComputePayloadHash(payload)
+		return &CommandEnvelope{
+			CommandType: commandType, IdempotencyKey: key, Symbol: symbol,
+			AccountID: "acc1", PayloadHash: hash, Payload: payload,
+		}
+	}
+	place := func(orderID string, side matching.Side, price int64) *CommandEnvelope {
+		return envelope(CommandTypePlace, "idem_"+orderID, &matching.PlaceOrderRequest{
+			OrderID: orderID, ClientOrderID: "c_" + orderID, AccountID: "acc1", Symbol: symbol,
+			Side: side, PriceInt: price, QuantityInt: 1,
+		})
+	}
+	spec := symbolspec.Spec{
+		Symbol: symbol, PriceScale: 2, QuantityScale: 0, PriceTickInt: 1, QtyStepInt: 1,
+		PriceBandBps: 1000, TradeBandBps: 500, BreakerCoolingOff: 5 * time.Minute,
+	}
+	if result := engine.Submit(envelope(CommandTypeSetSymbolSpec, "spec", &spec)); result.ErrorCode != ErrorCodeNone {
+		t.Fatalf("create failed: %v", result.Err)
+	}
+	engine.Submit(place("s0", matching.SideSell, 1000))
+	engine.Submit(place("b0", matching.SideBuy, 1000))
+	pending := func() bool {
+		engine.breakers.mu.Lock()
+		defer engine.breakers.mu.Unlock()
+		_, ok := engine.breakers.reopens[symbol]
+		return ok
+	}
+
+	// b1 trips the breaker, but the cancel after it fails and aborts the batch
+	missing := envelope(CommandTypeCancel, "idem_cancel", &matching.CancelOrderRequest{OrderID: "missing", AccountID: "acc1", Symbol: symbol})
+	results := engine.SubmitBatch(context.Background(), []*CommandEnvelope{
+		place("s1", matching.SideSell, 1060), place("b1", matching.SideBuy, 1080), missing,
+	}, true)
+	if results[1].ErrorCode != ErrorCodeBatchAborted || results[2].ErrorCode == ErrorCodeNone {
+		t.Fatalf("expected the batch aborted, got %q and %q", results[1].ErrorCode, results[2].ErrorCode)
+	}
+	if book := engine.shards[0].books[symbol]; pending() || book.Status() != matching.SymbolStatusTrading {
+		t.Fatalf("expected no trip from the aborted batch, got %s with a reopening pending %v", book.Status(), pending())
+	}
+
+	// Committed, the same trip schedules the reopening
+	engine.SubmitBatch(context.Background(), []*CommandEnvelope{
+		place("s1", matching.SideSell, 1060), place("b1", matching.SideBuy, 1080),
+	}, true)
+	if book := engine.shards[0].books[symbol]; !pending() || book.Status() != matching.SymbolStatusHalted {
+		t.Fatalf("expected the committed trip to halt and schedule a reopening, got %s", book.Status())
+	}
+}
+
+// recordingAssignmentStore keeps the last saved assignment table
+type recordingAssignmentStore struct {
+	mu          sync.Mutex
+	assignments map[string]int
+}
+
+func (s *recordingAssignmentStore) SaveShardAssignments(ctx context.Context, assignments map[string]int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.assignments = assignments
+	return nil
+}
+
+func TestMoveSymbol_MigratesStateWithoutLosingCommands(t *testing.T) {
+	engine := NewEngine(&EngineConfig{ShardCount: 4, QueueSize: 1000, IdempotencyTTL: time.Hour})
+	defer engine.Close()
+	store := &recordingAssignmentStore{}
+	engine.SetShardAssignmentStore(store)
+	events := &recordingEventStore{}
+	engine.SetEventStore(events)
+
+	const symbol = "BTC-USDT"
+	place := func(orderID string, side matching.Side) *CommandEnvelope {
+		req := &matching.PlaceOrderRequest{
+			OrderID: orderID, ClientOrderID: "c_" + orderID, AccountID: "acc1", Symbol: symbol,
+			Side: side, PriceInt: 43000, QuantityInt: 1,
+		}
+		hash, _ := ComputePayloadHash(req)
+		return &CommandEnvelope{
+			CommandType: CommandTypePlace, IdempotencyKey: "idem_" + orderID, Symbol: symbol,
+			AccountID: "acc1", PayloadHash: hash, Payload: req,
+		}
+	}
+
+	first := engine.Submit(place("order0", matching.SideBuy))
+	if first.ErrorCode != ErrorCodeNone {
+		t.Fatalf("place failed: %v", first.Err)
+	}
+
+	// Keep placing while the symbol moves around every shard
+	const orders = 200
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 1; i <= orders; i++ {
+			if result := engine.Submit(place(fmt.Sprintf("order%d", i), matching.SideBuy)); result.ErrorCode != ErrorCodeNone {
+				t.Errorf("place %d failed: %v", i, result.Err)
+				return
+			}
+		}
+	}()
+	source := engine.GetShardID(symbol)
+	for i := 1; i <= 4; i++ {
+		target := (source + i) % 4
+		if err := engine.MoveSymbol(context.Background(), symbol, target); err != nil {
+			t.Fatalf("MoveSymbol to %d failed: %v", target, err)
+		}
+		if got := engine.GetShardID(symbol); got != target {
+			t.Fatalf("expected %s to route to shard %d, got %d", symbol, target, got)
+		}
+	}
+	wg.Wait()
+
+	// Every command landed on one book, in order, with contiguous event sequences
+	book := engine.shards[engine.GetShardID(symbol)].books[symbol]
+	if len(book.Orders) != orders+1 {
+		t.Fatalf("expected %d resting orders, got %d", orders+1, len(book.Orders))
+	}
+	for i, event := range events.events {
+		if event.Sequence() != int64(i+1) {
+			t.Fatalf("event %d has sequence %d", i, event.Sequence())
+		}
+	}
+	for shardID, shard := range engine.shards {
+		if _, ok := shard.books[symbol]; ok && shardID != engine.GetShardID(symbol) {
+			t.Fatalf("shard %d still holds a book for %s", shardID, symbol)
+		}
+	}
+	if store.assignments[symbol] != source {
+		t.Fatalf("expected the persisted assignment to be shard %d, got %+v", source, store.assignments)
+	}
+
+	// Idempotency records moved with the symbol
+	retry := engine.Submit(place("order0", matching.SideBuy))
+	if retry.ErrorCode != ErrorCodeNone || len(book.Orders) != orders+1 {
+		t.Fatalf("retry after the move executed again: %v", retry.Err)
+	}
+
+	// The moved book still matches
+	matched := getCommandResult(t, engine.Submit(place("sell", matching.SideSell)))
+	if matched == nil || len(matched.Trades) != 1 || matched.Trades[0].MakerOrderID != "order0" {
+		t.Fatalf("expected the sell to match order0 first, got %+v", matched)
+	}
+}
+
+func TestRestoreShardAssignments_RejectsUnknownShard(t *testing.T) {
+	engine := NewEngine(&EngineConfig{ShardCount: 2, QueueSize: 10, IdempotencyTTL: time.Hour})
+	defer engine.Close()
+
+	if err := engine.RestoreShardAssignments(map[string]int{"BTC-USDT": 5}); err == nil {
+		t.Fatalf("expected an assignment to a missing shard to be rejected")
+	}
+	if err := engine.RestoreShardAssignments(map[string]int{"BTC-USDT": 1, "ETH-USDT": 1}); err != nil {
+		t.Fatalf("RestoreShardAssignments failed: %v", err)
+	}
+	if engine.GetShardID("BTC-USDT") != 1 || engine.GetShardID("ETH-USDT") != 1 {
+		t.Fatalf("assignments not applied: %+v", engine.ShardAssignments())
+	}
+}
+
+type recordingJournal struct {
+	mu       sync.Mutex
+	commands []*JournaledCommand
+}
+
+func (j *recordingJournal) Append(ctx context.Context, shardID int, command any) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.commands = append(j.commands, command.(*JournaledCommand))
+	return nil
+}
+
+func TestMassCancel_FansOutAcrossShardsAndJournalsPerSymbol(t *testing.T) {
+	engine := NewEngine(&EngineConfig{ShardCount: 2, QueueSize: 100, IdempotencyTTL: time.Hour})
+	defer engine.Close()
+	if err := engine.RestoreShardAssignments(map[string]int{"BTC-USDT": 0, "ETH-USDT": 1, "SOL-USDT": 1}); err != nil {
+		t.Fatalf("RestoreShardAssignments failed: %v", err)
+	}
+	journal := &recordingJournal{}
+	engine.SetCommandJournal(journal)
+
+	place := func(orderID, accountID, symbol string) {
+		req := &matching.PlaceOrderRequest{
+			OrderID: orderID, ClientOrderID: "c_" + orderID, AccountID: accountID, Symbol: symbol,
+			Side: matching.SideBuy, PriceInt: 100, QuantityInt: 1,
+		}
+		hash, _ := ComputePayloadHash(req)
+		result := engine.Submit(&CommandEnvelope{
+			CommandType: CommandTypePlace, IdempotencyKey: "idem_" + orderID, Symbol: symbol,
+			AccountID: accountID, PayloadHash: hash, Payload: req,
+		})
+		if result.ErrorCode != ErrorCodeNone {
+			t.Fatalf("place %s failed: %v", orderID, result.Err)
+		}
+	}
+	place("btc1", "acc1", "BTC-USDT")
+	place("btc2", "acc2", "BTC-USDT")
+	place("eth1", "acc1", "ETH-USDT")
+	place("sol1", "acc1", "SOL-USDT")
+
+	req := &matching.MassCancelRequest{AccountID: "acc1"}
+	hash, _ := ComputePayloadHash(req)
+	envelope := &CommandEnvelope{
+		CommandType: CommandTypeMassCancel, IdempotencyKey: "mass1",
+		AccountID: "acc1", PayloadHash: hash, Payload: req,
+	}
+	result := getCommandResult(t, engine.Submit(envelope))
+
+	var canceled []string
+	for _, event := range result.Events {
+		canceled = append(canceled, event.(*matching.OrderCanceledEvent).OrderID)
+	}
+	// Shard order, then symbol order within a shard
+	if fmt.Sprint(canceled) != "[btc1 eth1 sol1]" {
+		t.Fatalf("expected btc1, eth1, sol1 canceled, got %v", canceled)
+	}
+	if _, ok := engine.shards[0].books["BTC-USDT"].Orders["btc2"]; !ok {
+		t.Fatalf("expected acc2's order to keep resting")
+	}
+
+	// A retry is answered from each shard's cache
+	retry := getCommandResult(t, engine.Submit(envelope))
+	if len(retry.Events) != len(result.Events) {
+		t.Fatalf("expected the retry to return the cached cancels, got %d events", len(retry.Events))
+	}
+
+	// One journaled command per book with cancels, each replaying its own book
+	var massCancels []*JournaledCommand
+	for _, command := range journal.commands {
+		if command.CommandType == CommandTypeMassCancel {
+			massCancels = append(massCancels, command)
+		}
+	}
+	if len(massCancels) != 3 {
+		t.Fatalf("expected 3 journaled mass cancels, got %d", len(massCancels))
+	}
+	replayer := NewJournalReplayer()
+	for _, command := range journal.commands {
+		if _, err := replayer.Apply(command); err != nil {
+			t.Fatalf("Apply failed: %v", err)
+		}
+	}
+	for _, symbol := range []string{"BTC-USDT", "ETH-USDT", "SOL-USDT"} {
+		live := engine.shards[engine.GetShardID(symbol)].books[symbol]
+		replayed := replayer.shard.books[symbol]
+		if len(live.Orders) != len(replayed.Orders) || live.GetEventSequence() != replayed.GetEventSequence() {
+			t.Fatalf("%s: replay has %d orders at sequence %d, live has %d at %d", symbol,
+				len(replayed.Orders), replayed.GetEventSequence(), len(live.Orders), live.GetEventSequence())
+		}
+	}
+}
+
+type recordingDeadManStore struct {
+	mu    sync.Mutex
+	saved []map[string]time.Duration
+}
+
+func (s *recordingDeadManStore) SaveDeadManSwitches(ctx context.Context, timeouts map[string]time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saved = append(s.saved, timeouts)
+	return nil
+}
+
+func (s *recordingDeadManStore) last() map[string]time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.saved[len(s.saved)-1]
+}
+
+func TestDeadManSwitch_HeartbeatDefersAndExpiryCancelsAllOrders(t *testing.T) {
+	engine := NewEngine(&EngineConfig{ShardCount: 2, QueueSize: 100, IdempotencyTTL: time.Hour})
+	defer engine.Close()
+	if err := engine.RestoreShardAssignments(map[string]int{"BTC-USDT": 0, "ETH-USDT": 1}); err != nil {
+		t.Fatalf("RestoreShardAssignments failed: %v", err)
+	}
+	store := &recordingDeadManStore{}
+	engine.SetDeadManSwitchStore(store)
+	expired := make(chan *CommandExecResult, 1)
+	engine.SetDeadManExpiryHandler(func(accountID string, result *CommandExecResult) {
+		if accountID == "mm1" {
+			expired <- result
+		}
+	})
+
+	for i, symbol := range []string{"BTC-USDT", "ETH-USDT"} {
+		req := &matching.PlaceOrderRequest{
+			OrderID: fmt.Sprintf("order%d", i), ClientOrderID: fmt.Sprintf("c%d", i), AccountID: "mm1",
+			Symbol: symbol, Side: matching.SideSell, PriceInt: 100, QuantityInt: 1,
+		}
+		hash, _ := ComputePayloadHash(req)
+		result := engine.Submit(&CommandEnvelope{
+			CommandType: CommandTypePlace, IdempotencyKey: req.OrderID, Symbol: symbol,
+			AccountID: "mm1", PayloadHash: hash, Payload: req,
+		})
+		if result.ErrorCode != ErrorCodeNone {
+			t.Fatalf("place failed: %v", result.Err)
+		}
+	}
+
+	if _, err := engine.ArmDeadManSwitch("mm1", 100*time.Millisecond); err == nil {
+		t.Fatalf("expected a timeout below the minimum to be rejected")
+	}
+	if _, err := engine.ArmDeadManSwitch("mm1", time.Second); err != nil {
+		t.Fatalf("ArmDeadManSwitch failed: %v", err)
+	}
+	if got := store.last(); got["mm1"] != time.Second {
+		t.Fatalf("expected the armed switch to be persisted, got %v", got)
+	}
+
+	time.Sleep(600 * time.Millisecond)
+	if _, err := engine.HeartbeatDeadManSwitch("mm1"); err != nil {
+		t.Fatalf("HeartbeatDeadManSwitch failed: %v", err)
+	}
+	time.Sleep(600 * time.Millisecond)
+	select {
+	case <-expired:
+		t.Fatalf("switch expired despite the heartbeat")
+	default:
+	}
+
+	var result *CommandExecResult
+	select {
+	case result = <-expired:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("switch did not expire")
+	}
+	cmdResult := getCommandResult(t, result)
+	if len(cmdResult.Events) != 2 {
+		t.Fatalf("expected both orders canceled, got %d events", len(cmdResult.Events))
+	}
+	for _, event := range cmdResult.Events {
+		if reason := event.(*matching.OrderCanceledEvent).CanceledBy; reason != matching.CancelReasonSystem {
+			t.Fatalf("expected SYSTEM cancels, got %s", reason)
+		}
+	}
+	if len(engine.DeadManSwitches()) != 0 || len(store.last()) != 0 {
+		t.Fatalf("expected the expired switch to be disarmed")
+	}
+	if _, err := engine.HeartbeatDeadManSwitch("mm1"); err == nil {
+		t.Fatalf("expected a heartbeat after expiry to fail")
+	}
+
+	// A restart re-arms persisted switches with a full timeout
+	if err := engine.RestoreDeadManSwitches(map[string]time.Duration{"mm2": 5 * time.Second}); err != nil {
+		t.Fatalf("RestoreDeadManSwitches failed: %v", err)
+	}
+	switches := engine.DeadManSwitches()
+	if len(switches) != 1 || switches[0].AccountID != "mm2" || time.Until(switches[0].Deadline) < 4*time.Second {
+		t.Fatalf("unexpected restored switches %+v", switches)
+	}
+	if err := engine.DisarmDeadManSwitch("mm2"); err != nil {
+		t.Fatalf("DisarmDeadManSwitch failed: %v", err)
+	}
+	if len(engine.DeadManSwitches()) != 0 {
+		t.Fatalf("expected no armed switches after disarm")
+	}
+}
+
+// failingEventStore fails every append while failing is set, or only the appends of symbol
+type failingEventStore struct {
+	failing atomic.Bool
+	symbol  string
+}
+
+func (s *failingEventStore) Append(ctx context.Context, symbol string, event matching.Event) error {
+	if s.failing.Load() && (s.symbol == "" || s.symbol == symbol) {
+		return errors.New("disk full")
+	}
+	return nil
+}
+
+func TestMassCancel_FailedPersistKeepsEarlierCancelsInResult(t *testing.T) {
+	engine := NewEngine(&EngineConfig{ShardCount: 1, QueueSize: 100, IdempotencyTTL: time.Hour})
+	defer engine.Close()
+	events := &failingEventStore{symbol: "ETH-USDT"}
+	engine.SetEventStore(events)
+
+	for _, symbol := range []string{"BTC-USDT", "ETH-USDT"} {
+		req := &matching.PlaceOrderRequest{
+			OrderID: "order_" + symbol, ClientOrderID: "c_" + symbol, AccountID: "acc1",
+			Symbol: symbol, Side: matching.SideSell, PriceInt: 100, QuantityInt: 1,
+		}
+		hash, _ := ComputePayloadHash(req)
+		engine.Submit(&CommandEnvelope{
+			CommandType: CommandTypePlace, IdempotencyKey: req.OrderID, Symbol: symbol,
+			AccountID: "acc1", PayloadHash: hash, Payload: req,
+		})
+	}
+	events.failing.Store(true)
+
+	// BTC-USDT is canceled first; ETH-USDT's events fail to persist after its book canceled
+	req := &matching.MassCancelRequest{AccountID: "acc1"}
+	hash, _ := ComputePayloadHash(req)
+	result := engine.Submit(&CommandEnvelope{
+		CommandType: CommandTypeMassCancel, IdempotencyKey: "sweep", AccountID: "acc1", PayloadHash: hash, Payload: req,
+	})
+	if result.ErrorCode != ErrorCodeInternalError {
+		t.Fatalf("expected the failed persist to be reported, got %q", result.ErrorCode)
+	}
+	var canceled []string
+	for _, event := range getCommandResult(t, result).Events {
+		canceled = append(canceled, event.(*matching.OrderCanceledEvent).OrderID)
+	}
+	if want := []string{"order_BTC-USDT", "order_ETH-USDT"}; !reflect.DeepEqual(canceled, want) {
+		t.Fatalf("expected %v in the result so their funds are released, got %v", want, canceled)
+	}
+}
+
+func TestDeadManSwitch_FailedExpiryStaysArmedAndRetries(t *testing.T) {
+	engine := NewEngine(&EngineConfig{ShardCount: 1, QueueSize: 100, IdempotencyTTL: time.Hour})
+	defer engine.Close()
+	events := &failingEventStore{}
+	engine.SetEventStore(events)
+	store := &recordingDeadManStore{}
+	engine.SetDeadManSwitchStore(store)
+	expired := make(chan *CommandExecResult, 4)
+	engine.SetDeadManExpiryHandler(func(accountID string, result *CommandExecResult) {
+		expired <- result
+	})
+
+	const symbol = "ATOM-USDT"
+	submit := func(commandType CommandType, key string, payload any) *CommandExecResult {
+		hash, _ := ComputePayloadHash(payload)
+		return engine.Submit(&CommandEnvelope{
+			CommandType: commandType, IdempotencyKey: key, Symbol: symbol,
+			AccountID: "mm1", PayloadHash: hash, Payload: payload,
+		})
+	}
+	submit(CommandTypePlace, "place", &matching.PlaceOrderRequest{
+		OrderID: "order1", ClientOrderID: "c1", AccountID: "mm1", Symbol: symbol,
+		Side: matching.SideSell, PriceInt: 100, QuantityInt: 1,
+	})
+	events.failing.Store(true)
+	if _, err := engine.ArmDeadManSwitch("mm1", time.Second); err != nil {
+		t.Fatalf("ArmDeadManSwitch failed: %v", err)
+	}
+
+	// The cancel fails to persist, so the switch stays armed and persisted
+	select {
+	case result := <-expired:
+		if result.ErrorCode == ErrorCodeNone {
+			t.Fatalf("expected the cancel to fail")
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("switch did not expire")
+	}
+	if len(engine.DeadManSwitches()) != 1 || store.last()["mm1"] != time.Second {
+		t.Fatalf("expected the switch to stay armed after a failed cancel")
+	}
+
+	// Once the store recovers, a retry succeeds and disarms the switch
+	events.failing.Store(false)
+	deadline := time.After(3 * time.Second)
+	for {
+		select {
+		case result := <-expired:
+			if result.ErrorCode != ErrorCodeNone {
+				continue
+			}
+			if _, ok := engine.shards[0].books[symbol].Orders["order1"]; ok {
+				t.Fatalf("expected the order canceled")
+			}
+			if len(engine.DeadManSwitches()) != 0 || len(store.last()) != 0 {
+				t.Fatalf("expected the switch disarmed after the cancel succeeded")
+			}
+			return
+		case <-deadline:
+			t.Fatalf("switch cancel was not retried")
+		}
+	}
+}
+
+func TestSymbolStatus_GatesCommandsAndReplays(t *testing.T) {
+	engine := NewEngine(&EngineConfig{ShardCount: 1, QueueSize: 100, IdempotencyTTL: time.Hour})
+	defer engine.Close()
+	events := &recordingEventStore{}
+	engine.SetEventStore(events)
+
+	const symbol = "BTC-USDT"
+	seq := 0
+	submit := func(commandType CommandType, payload any) *CommandExecResult {
+		seq++
+		hash, _ := ComputePayloadHash(payload)
+		return engine.Submit(&CommandEnvelope{
+			CommandType: commandType, IdempotencyKey: fmt.Sprintf("idem_%d", seq), Symbol: symbol,
+			AccountID: "acc1", PayloadHash: hash, Payload: payload,
+		})
+	}
+	place := func(orderID string) *CommandExecResult {
+		return submit(CommandTypePlace, &matching.PlaceOrderRequest{
+			OrderID: orderID, ClientOrderID: "c_" + orderID, AccountID: "acc1", Symbol: symbol,
+			Side: matching.SideBuy, PriceInt: 100, QuantityInt: 1,
+		})
+	}
+	cancel := func(orderID string) *CommandExecResult {
+		return submit(CommandTypeCancel, &matching.CancelOrderRequest{OrderID: orderID, AccountID: "acc1", Symbol: symbol})
+	}
+	setStatus := func(status matching.SymbolStatus) {
+		t.Helper()
+		result := submit(CommandTypeSetSymbolStatus, &matching.SetSymbolStatusRequest{Symbol: symbol, Status: status, Reason: "test"})
+		if result.ErrorCode != ErrorCodeNone {
+			t.Fatalf("set status %s failed: %v", status, result.Err)
+		}
+	}
+	expect := func(result *CommandExecResult, code ErrorCode) {
+		t.Helper()
+		if result.ErrorCode != code {
+			t.Fatalf("expected %q, got %q: %v", code, result.ErrorCode, result.Err)
+		}
+	}
+
+	// A symbol can be halted before its first order
+	setStatus(matching.SymbolStatusHalted)
+	expect(place("o1"), ErrorCodeSymbolHalted)
+
+	setStatus(matching.SymbolStatusTrading)
+	expect(place("o1"), ErrorCodeNone)
+	expect(place("o2"), ErrorCodeNone)
+
+	setStatus(matching.SymbolStatusCancelOnly)
+	expect(place("o3"), ErrorCodeSymbolCancelOnly)
+	expect(cancel("o1"), ErrorCodeNone)
+
+	setStatus(matching.SymbolStatusPreOpen)
+	expect(place("o3"), ErrorCodeNone)
+
+	setStatus(matching.SymbolStatusHalted)
+	expect(cancel("o2"), ErrorCodeSymbolHalted)
+	mass := &matching.MassCancelRequest{AccountID: "acc1"}
+	hash, _ := ComputePayloadHash(mass)
+	sweep := engine.Submit(&CommandEnvelope{
+		CommandType: CommandTypeMassCancel, IdempotencyKey: "sweep", AccountID: "acc1", PayloadHash: hash, Payload: mass,
+	})
+	if result := getCommandResult(t, sweep); len(result.Events) != 0 {
+		t.Fatalf("expected a mass cancel across symbols to skip the halted book, got %d events", len(result.Events))
+	}
+
+	// Setting the current status records nothing
+	before := len(events.events)
+	setStatus(matching.SymbolStatusHalted)
+	if len(events.events) != before {
+		t.Fatalf("expected no event for an unchanged status")
+	}
+
+	// Replay restores the status and the resting orders
+	replayed := matching.NewOrderBook(symbol)
+	if _, err := ReplayBook(replayed, events.events); err != nil {
+		t.Fatalf("ReplayBook failed: %v", err)
+	}
+	live := engine.shards[0].books[symbol]
+	if replayed.Status() != matching.SymbolStatusHalted || len(replayed.Orders) != 2 {
+		t.Fatalf("replay has status %s and %d orders, expected HALTED and 2", replayed.Status(), len(replayed.Orders))
+	}
+	if replayed.GetEventSequence() != live.GetEventSequence() {
+		t.Fatalf("replay ends at sequence %d, live book at %d", replayed.GetEventSequence(), live.GetEventSequence())
+	}
+	if state := live.ExportState(); state.Status != matching.SymbolStatusHalted {
+		t.Fatalf("expected snapshots to carry the status, got %q", state.Status)
+	}
+
+	// A system mass cancel, as a dead-man's switch sends, clears the halted book too
+	system := &matching.MassCancelRequest{AccountID: "acc1", Reason: matching.CancelReasonSystem}
+	hash, _ = ComputePayloadHash(system)
+	sweep = engine.Submit(&CommandEnvelope{
+		CommandType: CommandTypeMassCancel, IdempotencyKey: "system_sweep", AccountID: "acc1", PayloadHash: hash, Payload: system,
+	})
+	if result := getCommandResult(t, sweep); len(result.Events) != 2 || len(live.Orders) != 0 {
+		t.Fatalf("expected the system mass cancel to clear the halted book, got %d events", len(result.Events))
+	}
+	if _, err := ReplayBook(matching.NewOrderBook(symbol), events.events); err != nil {
+		t.Fatalf("ReplayBook failed: %v", err)
+	}
+}
+
+func TestCallAuction_UncrossReplaysToTheSameBook(t *testing.T) {
+	engine := NewEngine(&EngineConfig{ShardCount: 1, QueueSize: 100, IdempotencyTTL: time.Hour})
+	defer engine.Close()
+	events := &recordingEventStore{}
+	engine.SetEventStore(events)
+
+	const symbol = "BTC-USDT"
+	seq := 0
+	submit := func(commandType CommandType, payload any) *CommandExecResult {
+		t.Helper()
+		seq++
+		hash, _ := ComputePayloadHash(payload)
+		result := engine.Submit(&CommandEnvelope{
+			CommandType: commandType, IdempotencyKey: fmt.Sprintf("idem_%d", seq), Symbol: symbol,
+			AccountID: "acc1", PayloadHash: hash, Payload: payload,
+		})
+		if result.ErrorCode != ErrorCodeNone {
+			t.Fatalf("%s failed: %v", commandType, result.Err)
+		}
+		return result
+	}
+	place := func(orderID string, side matching.Side, price int64) {
+		submit(CommandTypePlace, &matching.PlaceOrderRequest{
+			OrderID: orderID, ClientOrderID: "c_" + orderID, AccountID: "acc1", Symbol: symbol,
+			Side: side, PriceInt: price, QuantityInt: 2,
+		})
+	}
+
+	submit(CommandTypeSetSymbolStatus, &matching.SetSymbolStatusRequest{Symbol: symbol, Status: matching.SymbolStatusPreOpen})
+	place("b1", matching.SideBuy, 102)
+	place("s1", matching.SideSell, 100)
+	place("s2", matching.SideSell, 101)
+	uncross := submit(CommandTypeSetSymbolStatus, &matching.SetSymbolStatusRequest{Symbol: symbol, Status: matching.SymbolStatusTrading})
+	if trades := getCommandResult(t, uncross).Trades; len(trades) != 1 || trades[0].Price != 100 || trades[0].Quantity != 2 {
+		t.Fatalf("expected one trade of 2 at 100, got %+v", trades)
+	}
+	place("b2", matching.SideBuy, 101)
+
+	replayed := matching.NewOrderBook(symbol)
+	produced, err := ReplayBook(replayed, events.events)
+	if err != nil {
+		t.Fatalf("ReplayBook failed: %v", err)
+	}
+	if len(produced) != len(events.events) {
+		t.Fatalf("replay produced %d events, recorded %d", len(produced), len(events.events))
+	}
+	for i, event := range produced {
+		if event.EventType() != events.events[i].EventType() || event.Sequence() != events.events[i].Sequence() {
+			t.Fatalf("event %d replayed as %s(seq=%d), recorded %s(seq=%d)", i,
+				event.EventType(), event.Sequence(), events.events[i].EventType(), events.events[i].Sequence())
+		}
+	}
+	live := engine.shards[0].books[symbol].ExportState()
+	rebuilt := replayed.ExportState()
+	byID := func(orders []matching.OrderState) map[string]matching.OrderState {
+		m := make(map[string]matching.OrderState, len(orders))
+		for _, order := range orders {
+			m[order.OrderID] = order
+		}
+		return m
+	}
+	if !reflect.DeepEqual(byID(rebuilt.Orders), byID(live.Orders)) || !reflect.DeepEqual(rebuilt.ClosedOrders, live.ClosedOrders) ||
+		rebuilt.LastPrice != live.LastPrice || rebuilt.TradeSeq != live.TradeSeq {
+		t.Fatalf("replayed book differs from the live book:\nreplayed %+v\nlive     %+v", rebuilt, live)
+	}
+}
+
+func TestCircuitBreaker_TripHaltsAndReopenUncrossesAndReplays(t *testing.T) {
+	engine := NewEngine(&EngineConfig{ShardCount: 1, QueueSize: 100, IdempotencyTTL: time.Hour})
+	defer engine.Close()
+	events := &recordingEventStore{}
+	engine.SetEventStore(events)
+
+	const symbol = "LINK-USDT"
+	seq := 0
+	submit := func(commandType CommandType, payload any) *CommandExecResult {
+		seq++
+		hash, _ := ComputePayloadHash(payload)
+		return engine.Submit(&CommandEnvelope{
+			CommandType: commandType, IdempotencyKey: fmt.Sprintf("idem_%d", seq), Symbol: symbol,
+			AccountID: "acc1", PayloadHash: hash, Payload: payload,
+		})
+	}
+	place := func(orderID string, side matching.Side, price, qty int64) *CommandExecResult {
+		return submit(CommandTypePlace, &matching.PlaceOrderRequest{
+			OrderID: orderID, ClientOrderID: "c_" + orderID, AccountID: "acc1", Symbol: symbol,
+			Side: side, PriceInt: price, QuantityInt: qty,
+		})
+	}
+	// Bands of 10% for limits and 5% for trades
+	spec := symbolspec.Spec{
+		Symbol: symbol, PriceScale: 2, QuantityScale: 0, PriceTickInt: 1, QtyStepInt: 1,
+		PriceBandBps: 1000, TradeBandBps: 500, BreakerCoolingOff: 5 * time.Minute,
+	}
+	if result := submit(CommandTypeSetSymbolSpec, &spec); result.ErrorCode != ErrorCodeNone {
+		t.Fatalf("create failed: %v", result.Err)
+	}
+	place("s0", matching.SideSell, 1000, 1)
+	place("b0", matching.SideBuy, 1000, 1)
+
+	if result := place("far", matching.SideSell, 899, 1); result.ErrorCode != ErrorCodePriceOutOfBand {
+		t.Fatalf("expected PRICE_OUT_OF_BAND, got %q: %v", result.ErrorCode, result.Err)
+	}
+	place("s1", matching.SideSell, 1060, 1)
+	if result := place("b1", matching.SideBuy, 1080, 1); len(getCommandResult(t, result).Trades) != 0 {
+		t.Fatalf("expected the breaker to stop b1 before trading")
+	}
+	if result := place("b2", matching.SideBuy, 1000, 1); result.ErrorCode != ErrorCodeSymbolHalted {
+		t.Fatalf("expected the tripped symbol to be halted, got %q", result.ErrorCode)
+	}
+
+	engine.breakers.mu.Lock()
+	timer, pending := engine.breakers.reopens[symbol]
+	engine.breakers.mu.Unlock()
+	if !pending {
+		t.Fatalf("expected a reopening to be scheduled")
+	}
+	timer.Stop()
+	engine.reopen(symbol, timer)
+	live := engine.shards[0].books[symbol]
+	if live.Status() != matching.SymbolStatusTrading || len(live.Orders) != 0 {
+		t.Fatalf("expected the reopening to trade and uncross, got %s with %d orders", live.Status(), len(live.Orders))
+	}
+
+	// Replay re-derives the trip from the log, whatever bands the replaying book has
+	replayed := matching.NewOrderBook(symbol)
+	produced, err := ReplayBook(replayed, events.events)
+	if err != nil {
+		t.Fatalf("ReplayBook failed: %v", err)
+	}
+	if len(produced) != len(events.events) {
+		t.Fatalf("replay produced %d events, recorded %d", len(produced), len(events.events))
+	}
+	if replayed.Status() != live.Status() || replayed.GetEventSequence() != live.GetEventSequence() || len(replayed.Orders) != 0 {
+		t.Fatalf("replayed book differs: %s at %d with %d orders", replayed.Status(), replayed.GetEventSequence(), len(replayed.Orders))
+	}
+
+	// An admin status change takes over from a pending reopening
+	place("b3", matching.SideBuy, 1150, 1)
+	place("s3", matching.SideSell, 1120, 1)
+	if live.Status() != matching.SymbolStatusHalted {
+		t.Fatalf("expected the second breach to halt the symbol")
+	}
+	hash, _ := ComputePayloadHash(&matching.SetSymbolStatusRequest{Symbol: symbol, Status: matching.SymbolStatusHalted})
+	engine.Submit(&CommandEnvelope{
+		CommandType: CommandTypeSetSymbolStatus, IdempotencyKey: "admin", Symbol: symbol, PayloadHash: hash,
+		Payload: &matching.SetSymbolStatusRequest{Symbol: symbol, Status: matching.SymbolStatusHalted},
+	})
+	engine.breakers.mu.Lock()
+	_, pending = engine.breakers.reopens[symbol]
+	engine.breakers.mu.Unlock()
+	if pending {
+		t.Fatalf("expected the admin status change to drop the pending reopening")
+	}
+}
+
+func TestSymbolSpec_CreateUpdateRejectsConflictsAndReplays(t *testing.T) {
+	engine := NewEngine(&EngineConfig{ShardCount: 1, QueueSize: 100, IdempotencyTTL: time.Hour})
+	defer engine.Close()
+	events := &recordingEventStore{}
+	engine.SetEventStore(events)
+
+	const symbol = "DOGE-USDT"
+	seq := 0
+	submit := func(commandType CommandType, payload any) *CommandExecResult {
+		seq++
+		hash, _ := ComputePayloadHash(payload)
+		return engine.Submit(&CommandEnvelope{
+			CommandType: commandType, IdempotencyKey: fmt.Sprintf("idem_%d", seq), Symbol: symbol,
+			AccountID: "acc1", PayloadHash: hash, Payload: payload,
+		})
+	}
+	spec := symbolspec.Spec{Symbol: symbol, PriceScale: 4, QuantityScale: 2, PriceTickInt: 5, QtyStepInt: 10}
+	if result := submit(CommandTypeSetSymbolSpec, &spec); result.ErrorCode != ErrorCodeNone {
+		t.Fatalf("create failed: %v", result.Err)
+	}
+	if got, err := symbolspec.Get(symbol); err != nil || got != spec {
+		t.Fatalf("expected the created spec to be registered, got %+v (%v)", got, err)
+	}
+	submit(CommandTypePlace, &matching.PlaceOrderRequest{
+		OrderID: "o1", ClientOrderID: "c1", AccountID: "acc1", Symbol: symbol,
+		Side: matching.SideBuy, PriceInt: 1000, QuantityInt: 50,
+	})
+
+	// The resting order is off a tick of 3 and can't change scale
+	for _, conflicting := range []symbolspec.Spec{
+		{Symbol: symbol, PriceScale: 4, QuantityScale: 2, PriceTickInt: 3, QtyStepInt: 10},
+		{Symbol: symbol, PriceScale: 4, QuantityScale: 2, PriceTickInt: 5, QtyStepInt: 20},
+		{Symbol: symbol, PriceScale: 5, QuantityScale: 2, PriceTickInt: 5, QtyStepInt: 10},
+	} {
+		if result := submit(CommandTypeSetSymbolSpec, &conflicting); result.ErrorCode != ErrorCodeSpecConflict {
+			t.Fatalf("expected SPEC_CONFLICT for %+v, got %q: %v", conflicting, result.ErrorCode, result.Err)
+		}
+	}
+	if got, _ := symbolspec.Get(symbol); got != spec {
+		t.Fatalf("expected rejected changes to leave the spec alone, got %+v", got)
+	}
+	invalid := symbolspec.Spec{Symbol: symbol, PriceScale: 4, QuantityScale: 2, QtyStepInt: 10}
+	if result := submit(CommandTypeSetSymbolSpec, &invalid); result.ErrorCode != ErrorCodeInvalidArgument {
+		t.Fatalf("expected INVALID_ARGUMENT for a zero tick, got %q", result.ErrorCode)
+	}
+
+	updated := symbolspec.Spec{Symbol: symbol, PriceScale: 4, QuantityScale: 2, PriceTickInt: 10, QtyStepInt: 5, PriceBandBps: 1000}
+	if result := submit(CommandTypeSetSymbolSpec, &updated); result.ErrorCode != ErrorCodeNone {
+		t.Fatalf("update failed: %v", result.Err)
+	}
+	if got, _ := symbolspec.Get(symbol); got != updated {
+		t.Fatalf("expected the updated spec to be registered, got %+v", got)
+	}
+
+	var recorded []symbolspec.Spec
+	for _, event := range events.events {
+		if changed, ok := event.(*matching.SymbolSpecChangedEvent); ok {
+			recorded = append(recorded, changed.Spec)
+		}
+	}
+	if !reflect.DeepEqual(recorded, []symbolspec.Spec{spec, updated}) {
+		t.Fatalf("expected the log to record both specs in order, got %+v", recorded)
+	}
+
+	replayed := matching.NewOrderBook(symbol)
+	produced, err := ReplayBook(replayed, events.events)
+	if err != nil {
+		t.Fatalf("ReplayBook failed: %v", err)
+	}
+	live := engine.shards[0].books[symbol]
+	if len(produced) != len(events.events) || replayed.GetEventSequence() != live.GetEventSequence() || len(replayed.Orders) != 1 {
+		t.Fatalf("replayed book differs: %d events at %d with %d orders", len(produced), replayed.GetEventSequence(), len(replayed.Orders))
+	}
+}
+
+func TestOrderLimits_EnforcedByTheEngineButNotOnReplay(t *testing.T) {
+	engine := NewEngine(&EngineConfig{ShardCount: 1, QueueSize: 100, IdempotencyTTL: time.Hour})
+	defer engine.Close()
+	events := &recordingEventStore{}
+	engine.SetEventStore(events)
+
+	const symbol = "LTC-USDT"
+	seq := 0
+	submit := func(commandType CommandType, payload any) *CommandExecResult {
+		seq++
+		hash, _ := ComputePayloadHash(payload)
+		return engine.Submit(&CommandEnvelope{
+			CommandType: commandType, IdempotencyKey: fmt.Sprintf("idem_%d", seq), Symbol: symbol,
+			AccountID: "acc1", PayloadHash: hash, Payload: payload,
+		})
+	}
+	place := func(orderID string, price, qty int64) *CommandExecResult {
+		return submit(CommandTypePlace, &matching.PlaceOrderRequest{
+			OrderID: orderID, ClientOrderID: "c_" + orderID, AccountID: "acc1", Symbol: symbol,
+			Side: matching.SideBuy, PriceInt: price, QuantityInt: qty,
+		})
+	}
+	spec := symbolspec.Spec{Symbol: symbol, PriceScale: 2, QuantityScale: 2, PriceTickInt: 1, QtyStepInt: 1, MaxQtyInt: 1000, MinNotionalInt: 1000}
+	if result := submit(CommandTypeSetSymbolSpec, &spec); result.ErrorCode != ErrorCodeNone {
+		t.Fatalf("create failed: %v", result.Err)
+	}
+
+	if result := place("dust", 999, 100); result.ErrorCode != ErrorCodeMinNotional {
+		t.Fatalf("expected MIN_NOTIONAL, got %q: %v", result.ErrorCode, result.Err)
+	}
+	if result := place("whale", 1000, 1001); result.ErrorCode != ErrorCodeQtyTooLarge {
+		t.Fatalf("expected QTY_TOO_LARGE, got %q: %v", result.ErrorCode, result.Err)
+	}
+	if result := place("o1", 1000, 100); result.ErrorCode != ErrorCodeNone {
+		t.Fatalf("place failed: %v", result.Err)
+	}
+
+	// Raising the minimum quantity leaves the resting order alone but applies to new ones
+	raised := spec
+	raised.MinQtyInt = 200
+	if result := submit(CommandTypeSetSymbolSpec, &raised); result.ErrorCode != ErrorCodeNone {
+		t.Fatalf("update failed: %v", result.Err)
+	}
+	if result := place("o2", 1000, 100); result.ErrorCode != ErrorCodeQtyTooSmall {
+		t.Fatalf("expected QTY_TOO_SMALL, got %q: %v", result.ErrorCode, result.Err)
+	}
+
+	// The log replays under today's limits, which the first order no longer meets
+	replayed := matching.NewOrderBook(symbol)
+	replayed.SetOrderLimits(raised)
+	if _, err := ReplayBook(replayed, events.events); err != nil {
+		t.Fatalf("ReplayBook failed: %v", err)
+	}
+	if _, ok := replayed.Orders["o1"]; !ok || replayed.OrderLimits() != raised {
+		t.Fatalf("expected replay to restore o1 and keep the book's limits")
+	}
+}
+
+func TestAllocation_SwitchedBySpecAndReproducedOnReplay(t *testing.T) {
+	engine := NewEngine(&EngineConfig{ShardCount: 1, QueueSize: 100, IdempotencyTTL: time.Hour})
+	defer engine.Close()
+	events := &recordingEventStore{}
+	engine.SetEventStore(events)
+
+	const symbol = "SOL-USDT"
+	seq := 0
+	submit := func(commandType CommandType, accountID string, payload any) *CommandExecResult {
+		seq++
+		hash, _ := ComputePayloadHash(payload)
+		return engine.Submit(&CommandEnvelope{
+			CommandType: commandType, IdempotencyKey: fmt.Sprintf("idem_%d", seq), Symbol: symbol,
+			AccountID: accountID, PayloadHash: hash, Payload: payload,
+		})
+	}
+	place := func(orderID, accountID string, side matching.Side, qty int64) *CommandExecResult {
+		result := submit(CommandTypePlace, accountID, &matching.PlaceOrderRequest{
+			OrderID: orderID, ClientOrderID: "c_" + orderID, AccountID: accountID, Symbol: symbol,
+			Side: side, PriceInt: 1000, QuantityInt: qty,
+		})
+		if result.ErrorCode != ErrorCodeNone {
+			t.Fatalf("place %s failed: %v", orderID, result.Err)
+		}
+		return result
+	}
+	spec := symbolspec.Spec{Symbol: symbol, PriceScale: 2, QuantityScale: 0, PriceTickInt: 1, QtyStepInt: 1}
+	if result := submit(CommandTypeSetSymbolSpec, "admin", &spec); result.ErrorCode != ErrorCodeNone {
+		t.Fatalf("create failed: %v", result.Err)
+	}
+	place("s1", "acc1", matching.SideSell, 10)
+	place("s2", "acc2", matching.SideSell, 20)
+	place("b1", "acc3", matching.SideBuy, 6) // FIFO: all from s1
+
+	proRata := spec
+	proRata.Allocation = symbolspec.AllocationProRata
+	if result := submit(CommandTypeSetSymbolSpec, "admin", &proRata); result.ErrorCode != ErrorCodeNone {
+		t.Fatalf("update failed: %v", result.Err)
+	}
+	place("b2", "acc3", matching.SideBuy, 7) // Pro-rata over 4 and 20: 1 and 5, the 1 left to s1
+
+	var matched []*matching.OrderMatchedEvent
+	for _, event := range events.events {
+		if e, ok := event.(*matching.OrderMatchedEvent); ok {
+			matched = append(matched, e)
+		}
+	}
+	var fills []string
+	for _, e := range matched {
+		fills = append(fills, fmt.Sprintf("%s:%d", e.MakerOrderID, e.Quantity))
+	}
+	if want := []string{"s1:6", "s1:2", "s2:5"}; !reflect.DeepEqual(fills, want) {
+		t.Fatalf("expected fills %v, got %v", want, fills)
+	}
+
+	// Replay switches the allocation when it reaches the logged spec change and produces the same trades
+	replayed := matching.NewOrderBook(symbol)
+	produced, err := ReplayBook(replayed, events.events)
+	if err != nil {
+		t.Fatalf("ReplayBook failed: %v", err)
+	}
+	var replayedMatches []*matching.OrderMatchedEvent
+	for _, event := range produced {
+		if e, ok := event.(*matching.OrderMatchedEvent); ok {
+			replayedMatches = append(replayedMatches, e)
+		}
+	}
+	if !reflect.DeepEqual(replayedMatches, matched) {
+		t.Fatalf("expected replay to reproduce the trades")
+	}
+	live := engine.shards[0].books[symbol]
+	if replayed.Allocation() != live.Allocation() || replayed.Allocation().Algorithm != symbolspec.AllocationProRata {
+		t.Fatalf("expected the replayed book to allocate pro-rata, got %+v", replayed.Allocation())
+	}
+}
+
+func TestOrderGroup_CancelsRecordedAndReproducedOnReplay(t *testing.T) {
+	engine := NewEngine(&EngineConfig{ShardCount: 1, QueueSize: 100, IdempotencyTTL: time.Hour})
+	defer engine.Close()
+	events := &recordingEventStore{}
+	engine.SetEventStore(events)
+
+	const symbol = "AVAX-USDT"
+	seq := 0
+	submit := func(commandType CommandType, accountID string, payload any) *CommandExecResult {
+		seq++
+		hash, _ := ComputePayloadHash(payload)
+		return engine.Submit(&CommandEnvelope{
+			CommandType: commandType, IdempotencyKey: fmt.Sprintf("idem_%d", seq), Symbol: symbol,
+			AccountID: accountID, PayloadHash: hash, Payload: payload,
+		})
+	}
+	place := func(orderID, accountID string, side matching.Side, price int64, groupID string) *CommandExecResult {
+		result := submit(CommandTypePlace, accountID, &matching.PlaceOrderRequest{
+			OrderID: orderID, ClientOrderID: "c_" + orderID, AccountID: accountID, Symbol: symbol,
+			Side: side, PriceInt: price, QuantityInt: 10, GroupID: groupID,
+		})
+		if result.ErrorCode != ErrorCodeNone {
+			t.Fatalf("place %s failed: %v", orderID, result.Err)
+		}
+		return result
+	}
+	spec := symbolspec.Spec{Symbol: symbol, PriceScale: 2, QuantityScale: 0, PriceTickInt: 1, QtyStepInt: 1}
+	if result := submit(CommandTypeSetSymbolSpec, "admin", &spec); result.ErrorCode != ErrorCodeNone {
+		t.Fatalf("create failed: %v", result.Err)
+	}
+	place("tp", "acc1", matching.SideSell, 45000, "oco")
+	place("exit", "acc1", matching.SideSell, 46000, "oco")
+	place("a", "acc1", matching.SideBuy, 40000, "oco2")
+	place("b", "acc1", matching.SideBuy, 39000, "oco2")
+
+	// The taker's fill of tp cancels exit within the same command
+	result := place("taker", "acc2", matching.SideBuy, 45000, "")
+	var canceled []string
+	for _, event := range result.Result.(*matching.CommandResult).Events {
+		if e, ok := event.(*matching.OrderCanceledEvent); ok {
+			canceled = append(canceled, e.OrderID+":"+string(e.CanceledBy))
+		}
+	}
+	if want := []string{"exit:OCO"}; !reflect.DeepEqual(canceled, want) {
+		t.Fatalf("expected %v, got %v", want, canceled)
+	}
+	if result := submit(CommandTypeCancel, "acc1", &matching.CancelOrderRequest{OrderID: "a", AccountID: "acc1", Symbol: symbol}); result.ErrorCode != ErrorCodeNone {
+		t.Fatalf("cancel failed: %v", result.Err)
+	}
+
+	// Replay re-derives each group cancel from the fill or cancel that caused it
+	replayed := matching.NewOrderBook(symbol)
+	produced, err := ReplayBook(replayed, events.events)
+	if err != nil {
+		t.Fatalf("ReplayBook failed: %v", err)
+	}
+	live := engine.shards[0].books[symbol]
+	if len(produced) != len(events.events) || replayed.GetEventSequence() != live.GetEventSequence() {
+		t.Fatalf("expected replay to produce the %d logged events, got %d", len(events.events), len(produced))
+	}
+	for i, event := range produced {
+		if event.EventType() != events.events[i].EventType() || event.Sequence() != events.events[i].Sequence() {
+			t.Fatalf("event %d: expected %s at %d, got %s at %d", i, events.events[i].EventType(), events.events[i].Sequence(), event.EventType(), event.Sequence())
+		}
+	}
+	if len(replayed.Orders) != 0 {
+		t.Fatalf("expected every leg to be closed after replay, got %d open", len(replayed.Orders))
+	}
+}
@@ -29,14 +29,14 @@ type IdempotencyRecord struct {
 // IdempotencyStore manages idempotency records
 type IdempotencyStore struct {
 	mu      sync.RWMutex
-	records map[string]*IdempotencyRecord
+	records map[IdempotencyKey]*IdempotencyRecord
 	ttl     time.Duration
 }
 
 // NewIdempotencyStore creates a new idempotency store
 func NewIdempotencyStore(ttl time.Duration) *IdempotencyStore {
 	return &IdempotencyStore{
-		records: make(map[string]*IdempotencyRecord),
+		records: make(map[IdempotencyKey]*IdempotencyRecord),
 		ttl:     ttl,
 	}
 }
@@ -50,8 +50,7 @@ func (s *IdempotencyStore) Check(key IdempotencyKey, payloadHash string) (*Comma
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	keyStr := key.String()
-	record, exists := s.records[keyStr]
+	record, exists := s.records[key]
 	if !exists {
 		// Not seen before, should execute
 		return nil, nil
@@ -60,7 +59,7 @@ func (s *IdempotencyStore) Check(key IdempotencyKey, payloadHash string) (*Comma
 	// Check if expired
 	if time.Now().After(record.ExpiresAt) {
 		// Expired, delete stale record and treat as not seen
-		delete(s.records, keyStr)
+		delete(s.records, key)
 		return nil, nil
 	}
 
@@ -74,17 +73,45 @@ func (s *IdempotencyStore) Check(key IdempotencyKey, payloadHash string) (*Comma
 	return cloneCommandExecResult(record.Result), nil
 }
 
-// Store stores the execution result for future idempotency checks
-func (s *IdempotencyStore) Store(key IdempotencyKey, payloadHash string, result *CommandExecResult) {
+// Store stores the execution result for future idempotency checks and returns the stored record
+func (s *IdempotencyStore) Store(key IdempotencyKey, payloadHash string, result *CommandExecResult) *IdempotencyRecord {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	keyStr := key.String()
-	s.records[keyStr] = &IdempotencyRecord{
+	record := &IdempotencyRecord{
 		PayloadHash: payloadHash,
 		Result:      cloneCommandExecResult(result),
 		ExpiresAt:   time.Now().Add(s.ttl),
 	}
+	s.records[key] = record
+	return record
+}
+
+// Restore puts back a record loaded from persistence, keeping its original expiry.
+// Expired records are ignored.
+func (s *IdempotencyStore) Restore(key IdempotencyKey, record *IdempotencyRecord) {
+	if record == nil || time.Now().After(record.ExpiresAt) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[key] = record
+}
+
+// Extract removes and returns the records of a symbol, so they can follow it to another shard
+func (s *IdempotencyStore) Extract(symbol string) map[IdempotencyKey]*IdempotencyRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	extracted := make(map[IdempotencyKey]*IdempotencyRecord)
+	for key, record := range s.records {
+		if key.Symbol == symbol {
+			extracted[key] = record
+			delete(s.records, key)
+		}
+	}
+	return extracted
 }
 
 // Cleanup removes expired records
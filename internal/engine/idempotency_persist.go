@@ -0,0 +1,136 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"matching-engine/internal/matching"
+)
+
+// IdempotencyRecordStore persists idempotency records so a retried command
+// gets its original result after a restart (optional)
+type IdempotencyRecordStore interface {
+	Save(ctx context.Context, record any) error
+}
+
+// PersistedIdempotencyRecord is the serializable form of an idempotency record.
+// Only place and cancel results are persisted; queries use one-off keys.
+type PersistedIdempotencyRecord struct {
+	AccountID      string                  `json:"account_id"`
+	Symbol         string                  `json:"symbol"`
+	CommandType    CommandType             `json:"command_type"`
+	IdempotencyKey string                  `json:"idempotency_key"`
+	PayloadHash    string                  `json:"payload_hash"`
+	ExpiresAt      time.Time               `json:"expires_at"`
+	ErrorCode      ErrorCode               `json:"error_code,omitempty"`
+	Error          string                  `json:"error,omitempty"`
+	Result         *persistedCommandResult `json:"result,omitempty"`
+}
+
+// persistedCommandResult is a matching.CommandResult with type-tagged events
+type persistedCommandResult struct {
+	OrderStatusChanges []matching.OrderStatusChange `json:"order_status_changes,omitempty"`
+	Trades             []matching.Trade             `json:"trades,omitempty"`
+	Events             []persistedEvent             `json:"events,omitempty"`
+}
+
+type persistedEvent struct {
+	Type  string          `json:"type"`
+	Event json.RawMessage `json:"event"`
+}
+
+// Key returns the idempotency key the record belongs to
+func (r *PersistedIdempotencyRecord) Key() IdempotencyKey {
+	return IdempotencyKey{
+		AccountID:      r.AccountID,
+		Symbol:         r.Symbol,
+		CommandType:    r.CommandType,
+		IdempotencyKey: r.IdempotencyKey,
+	}
+}
+
+// newPersistedIdempotencyRecord converts a cached record for persistence
+func newPersistedIdempotencyRecord(key IdempotencyKey, record *IdempotencyRecord) (*PersistedIdempotencyRecord, error) {
+	out := &PersistedIdempotencyRecord{
+		AccountID:      key.AccountID,
+		Symbol:         key.Symbol,
+		CommandType:    key.CommandType,
+		IdempotencyKey: key.IdempotencyKey,
+		PayloadHash:    record.PayloadHash,
+		ExpiresAt:      record.ExpiresAt,
+	}
+	if record.Result == nil {
+		return out, nil
+	}
+
+	out.ErrorCode = record.Result.ErrorCode
+	if record.Result.Err != nil {
+		out.Error = record.Result.Err.Error()
+	}
+	switch result := record.Result.Result.(type) {
+	case nil:
+	case *matching.CommandResult:
+		persisted := &persistedCommandResult{
+			OrderStatusChanges: result.OrderStatusChanges,
+			Trades:             result.Trades,
+		}
+		for _, event := range result.Events {
+			data, err := json.Marshal(event)
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal %s event: %w", event.EventType(), err)
+			}
+			persisted.Events = append(persisted.Events, persistedEvent{Type: event.EventType(), Event: data})
+		}
+		out.Result = persisted
+	default:
+		return nil, fmt.Errorf("unsupported result type for persistence: %T", result)
+	}
+	return out, nil
+}
+
+// record converts a persisted record back into a cached one
+func (r *PersistedIdempotencyRecord) record() (*IdempotencyRecord, error) {
+	result := &CommandExecResult{ErrorCode: r.ErrorCode}
+	if r.Error != "" {
+		result.Err = errors.New(r.Error)
+	}
+	if r.Result != nil {
+		commandResult := &matching.CommandResult{
+			OrderStatusChanges: r.Result.OrderStatusChanges,
+			Trades:             r.Result.Trades,
+		}
+		for _, persisted := range r.Result.Events {
+			var event matching.Event
+			switch persisted.Type {
+			case "OrderAccepted":
+				event = &matching.OrderAcceptedEvent{}
+			case "OrderMatched":
+				event = &matching.OrderMatchedEvent{}
+			case "OrderCanceled":
+				event = &matching.OrderCanceledEvent{}
+			case "SymbolStatusChanged":
+				event = &matching.SymbolStatusChangedEvent{}
+			case "PriceBandBreached":
+				event = &matching.PriceBandBreachedEvent{}
+			case "SymbolSpecChanged":
+				event = &matching.SymbolSpecChangedEvent{}
+			default:
+				return nil, fmt.Errorf("unknown event type: %s", persisted.Type)
+			}
+			if err := json.Unmarshal(persisted.Event, event); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal %s event: %w", persisted.Type, err)
+			}
+			commandResult.Events = append(commandResult.Events, event)
+		}
+		result.Result = commandResult
+	}
+
+	return &IdempotencyRecord{
+		PayloadHash: r.PayloadHash,
+		Result:      result,
+		ExpiresAt:   r.ExpiresAt,
+	}, nil
+}
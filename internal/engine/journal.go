@@ -0,0 +1,120 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"matching-engine/internal/matching"
+	"matching-engine/internal/symbolspec"
+)
+
+// CommandJournal records the state-changing commands each shard executes, in execution order (optional).
+// Replaying the journal through a JournalReplayer must reproduce the event log.
+type CommandJournal interface {
+	Append(ctx context.Context, shardID int, command any) error
+}
+
+// JournaledCommand is the serializable form of a command envelope.
+// CreatedAt is the timestamp the shard executed the command at, so replay stamps the same times.
+// BookSeq is the symbol's event sequence before the command, which orders the commands of a
+// symbol that moved between shards.
+type JournaledCommand struct {
+	CommandID      string          `json:"command_id,omitempty"`
+	CommandType    CommandType     `json:"command_type"`
+	IdempotencyKey string          `json:"idempotency_key"`
+	Symbol         string          `json:"symbol"`
+	AccountID      string          `json:"account_id"`
+	PayloadHash    string          `json:"payload_hash,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	BookSeq        int64           `json:"book_seq,omitempty"`
+	Payload        json.RawMessage `json:"payload"`
+}
+
+// newJournaledCommand converts an envelope executed at createdAt against a book at bookSeq for the journal
+func newJournaledCommand(envelope *CommandEnvelope, createdAt time.Time, bookSeq int64) (*JournaledCommand, error) {
+	payload, err := json.Marshal(envelope.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s payload: %w", envelope.CommandType, err)
+	}
+	return &JournaledCommand{
+		CommandID:      envelope.CommandID,
+		CommandType:    envelope.CommandType,
+		IdempotencyKey: envelope.IdempotencyKey,
+		Symbol:         envelope.Symbol,
+		AccountID:      envelope.AccountID,
+		PayloadHash:    envelope.PayloadHash,
+		CreatedAt:      createdAt,
+		BookSeq:        bookSeq,
+		Payload:        payload,
+	}, nil
+}
+
+// Envelope converts a journaled command back into a command envelope
+func (c *JournaledCommand) Envelope() (*CommandEnvelope, error) {
+	var payload any
+	switch c.CommandType {
+	case CommandTypePlace:
+		payload = &matching.PlaceOrderRequest{}
+	case CommandTypeCancel:
+		payload = &matching.CancelOrderRequest{}
+	case CommandTypeMassCancel:
+		payload = &matching.MassCancelRequest{}
+	case CommandTypeSetSymbolStatus:
+		payload = &matching.SetSymbolStatusRequest{}
+	case CommandTypeSetSymbolSpec:
+		payload = &symbolspec.Spec{}
+	default:
+		return nil, fmt.Errorf("unsupported journaled command type: %s", c.CommandType)
+	}
+	if err := json.Unmarshal(c.Payload, payload); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s payload: %w", c.CommandType, err)
+	}
+
+	return &CommandEnvelope{
+		CommandID:      c.CommandID,
+		CommandType:    c.CommandType,
+		IdempotencyKey: c.IdempotencyKey,
+		Symbol:         c.Symbol,
+		AccountID:      c.AccountID,
+		PayloadHash:    c.PayloadHash,
+		Payload:        payload,
+		CreatedAt:      c.CreatedAt,
+	}, nil
+}
+
+// JournalReplayer executes journaled commands against fresh order books, as a shard would.
+// Idempotency is not consulted: the journal only holds commands that were executed.
+type JournalReplayer struct {
+	shard  *Shard
+	events map[string][]matching.Event
+}
+
+// NewJournalReplayer creates a replayer with empty order books
+func NewJournalReplayer() *JournalReplayer {
+	return &JournalReplayer{
+		shard:  NewShard(0, 1, time.Hour),
+		events: make(map[string][]matching.Event),
+	}
+}
+
+// Apply executes one journaled command and returns its result.
+// Commands of one symbol must be applied in journal order.
+func (r *JournalReplayer) Apply(command *JournaledCommand) (*CommandExecResult, error) {
+	envelope, err := command.Envelope()
+	if err != nil {
+		return nil, err
+	}
+	r.shard.bookClock.Set(r.shard.commandTime(envelope))
+	result := r.shard.execute(envelope)
+	if cmdResult, ok := result.Result.(*matching.CommandResult); ok {
+		r.events[envelope.Symbol] = append(r.events[envelope.Symbol], cmdResult.Events...)
+	}
+	return result, nil
+}
+
+// Events returns the events produced for each symbol so far
+func (r *JournalReplayer) Events() map[string][]matching.Event {
+	return r.events
+}
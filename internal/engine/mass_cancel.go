@@ -0,0 +1,87 @@
+package engine
+
+import (
+	"context"
+
+	"matching-engine/internal/matching"
+)
+
+// submitToAllShards queues a mass cancel without a symbol on every shard and merges
+// their results in shard order. Each shard caches its result under the command's
+// idempotency key, so a retry replays the cancels shard by shard.
+func (e *Engine) submitToAllShards(ctx context.Context, envelope *CommandEnvelope) *Future {
+	if err := e.lockAllRouting(ctx); err != nil {
+		return resolvedFuture(notQueuedResult(err))
+	}
+	defer e.routeMu.RUnlock()
+
+	if _, rejected := e.admit(envelope); rejected != nil {
+		return resolvedFuture(rejected)
+	}
+	futures := make([]*Future, len(e.shards))
+	for i, shard := range e.shards {
+		futures[i] = shard.SubmitAsync(ctx, envelope)
+	}
+
+	merged := newFuture()
+	go func() {
+		results := make([]*CommandExecResult, len(futures))
+		for i, future := range futures {
+			results[i] = future.Result()
+		}
+		merged.resolve(mergeResults(results))
+	}()
+	return merged
+}
+
+// mergeResults combines the per-shard results of a fanned-out command.
+// The first failure decides the error, but the orders canceled by other shards
+// stay in the result so callers can still release their funds.
+func mergeResults(results []*CommandExecResult) *CommandExecResult {
+	combined := &matching.CommandResult{
+		OrderStatusChanges: []matching.OrderStatusChange{},
+		Trades:             []matching.Trade{},
+		Events:             []matching.Event{},
+	}
+	merged := &CommandExecResult{
+		Result:    combined,
+		ErrorCode: ErrorCodeNone,
+	}
+	for _, result := range results {
+		if result.ErrorCode != ErrorCodeNone && merged.ErrorCode == ErrorCodeNone {
+			merged.ErrorCode = result.ErrorCode
+			merged.Err = result.Err
+		}
+		shardResult, ok := result.Result.(*matching.CommandResult)
+		if !ok || shardResult == nil {
+			continue
+		}
+		combined.OrderStatusChanges = append(combined.OrderStatusChanges, shardResult.OrderStatusChanges...)
+		combined.Trades = append(combined.Trades, shardResult.Trades...)
+		combined.Events = append(combined.Events, shardResult.Events...)
+	}
+	return merged
+}
+
+// lockAllRouting waits until no symbol is moving and read-locks routing,
+// so a command sent to every shard cannot miss a book in transit
+func (e *Engine) lockAllRouting(ctx context.Context) error {
+	for {
+		e.routeMu.RLock()
+		var moving chan struct{}
+		for _, done := range e.moves {
+			moving = done
+			break
+		}
+		if moving == nil {
+			return nil
+		}
+		e.routeMu.RUnlock()
+
+		select {
+		case <-moving:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
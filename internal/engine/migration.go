@@ -0,0 +1,225 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+
+	"matching-engine/internal/matching"
+)
+
+// ShardAssignmentStore persists the symbol→shard assignment table (optional).
+// Without one, assignments last until the process exits.
+type ShardAssignmentStore interface {
+	SaveShardAssignments(ctx context.Context, assignments map[string]int) error
+}
+
+// symbolState is everything a shard holds for one symbol, in transit to another shard
+type symbolState struct {
+	book        *matching.OrderBookState // Nil when the shard has no book for the symbol
+	eventCount  int64                    // Events since the last snapshot
+	idempotency map[IdempotencyKey]*IdempotencyRecord
+}
+
+// runTask runs fn on the event loop after every request queued before it and waits for it.
+// Tasks bypass admission control; ctx only bounds the wait to queue the task.
+func (s *Shard) runTask(ctx context.Context, fn func()) error {
+	done := make(chan struct{})
+	req := &commandRequest{task: func() {
+		fn()
+		close(done)
+	}}
+
+	s.submitMu.RLock()
+	if s.stopped {
+		s.submitMu.RUnlock()
+		return fmt.Errorf("shard is stopped")
+	}
+	select {
+	case s.cmdQueue <- req:
+	case <-ctx.Done():
+		s.submitMu.RUnlock()
+		return fmt.Errorf("%w: %w", ErrCommandNotQueued, ctx.Err())
+	}
+	s.submitMu.RUnlock()
+
+	// A queued task runs even if the shard stops: the event loop drains the queue
+	<-done
+	return nil
+}
+
+// exportSymbol removes a symbol from the shard and returns its state
+func (s *Shard) exportSymbol(symbol string) *symbolState {
+	state := &symbolState{
+		eventCount:  s.eventCounters[symbol],
+		idempotency: s.idemStore.Extract(symbol),
+	}
+	if book, ok := s.books[symbol]; ok {
+		state.book = book.ExportState()
+		delete(s.books, symbol)
+	}
+	delete(s.eventCounters, symbol)
+	return state
+}
+
+// importSymbol installs the state of a symbol exported by another shard
+func (s *Shard) importSymbol(symbol string, state *symbolState) error {
+	if _, exists := s.books[symbol]; exists {
+		return fmt.Errorf("shard %d already has an order book for %s", s.id, symbol)
+	}
+	if state.book != nil {
+		book := s.newBook(symbol)
+		if err := book.ImportState(state.book); err != nil {
+			return fmt.Errorf("failed to import order book for %s: %w", symbol, err)
+		}
+		s.books[symbol] = book
+	}
+	if state.eventCount > 0 {
+		s.eventCounters[symbol] = state.eventCount
+	}
+	for key, record := range state.idempotency {
+		s.idemStore.Restore(key, record)
+	}
+	return nil
+}
+
+// SetShardAssignmentStore sets the store that persists symbol→shard assignments (optional).
+// This should be called before the engine starts processing commands.
+func (e *Engine) SetShardAssignmentStore(store ShardAssignmentStore) {
+	e.assignmentStore = store
+}
+
+// RestoreShardAssignments loads a persisted assignment table.
+// This should be called before the engine starts processing commands, and before recovery,
+// so books are rebuilt on the shards their symbols are assigned to.
+func (e *Engine) RestoreShardAssignments(assignments map[string]int) error {
+	for symbol, shardID := range assignments {
+		if shardID < 0 || shardID >= len(e.shards) {
+			return fmt.Errorf("symbol %s is assigned to shard %d, but the engine has %d shards", symbol, shardID, len(e.shards))
+		}
+	}
+	for symbol, shardID := range assignments {
+		e.router.Assign(symbol, shardID)
+	}
+	return nil
+}
+
+// ShardAssignments returns the explicit symbol→shard assignments; other symbols are hashed
+func (e *Engine) ShardAssignments() map[string]int {
+	return e.router.Assignments()
+}
+
+// MoveSymbol assigns a symbol to a shard, migrating its state without losing or reordering commands.
+// New commands for the symbol wait while it moves. The source shard runs the commands already
+// queued for it, then exports the book, snapshot counter and idempotency records; the target
+// imports them, the assignment is persisted, and routing switches to the target.
+// ctx bounds the wait to start the migration; once the source shard is draining it runs to completion.
+func (e *Engine) MoveSymbol(ctx context.Context, symbol string, shardID int) error {
+	if symbol == "" {
+		return fmt.Errorf("symbol required")
+	}
+	if shardID < 0 || shardID >= len(e.shards) {
+		return fmt.Errorf("invalid shard id: %d", shardID)
+	}
+	if e.closed.Load() {
+		return fmt.Errorf("engine is closed")
+	}
+
+	e.moveMu.Lock()
+	defer e.moveMu.Unlock()
+
+	assignments := e.router.Assignments()
+	assignments[symbol] = shardID
+	source := e.router.Route(symbol)
+	if source == shardID {
+		// Already there: pin it so a change of ShardCount does not move it
+		if err := e.saveShardAssignments(assignments); err != nil {
+			return err
+		}
+		e.router.Assign(symbol, shardID)
+		return nil
+	}
+
+	// Hold new commands for the symbol. Commands routed before this point are already queued.
+	done := make(chan struct{})
+	e.routeMu.Lock()
+	e.moves[symbol] = done
+	e.routeMu.Unlock()
+	defer func() {
+		e.routeMu.Lock()
+		delete(e.moves, symbol)
+		e.routeMu.Unlock()
+		close(done)
+	}()
+
+	// The export runs after every command queued before it, which drains the symbol
+	var state *symbolState
+	if err := e.shards[source].runTask(ctx, func() { state = e.shards[source].exportSymbol(symbol) }); err != nil {
+		return fmt.Errorf("failed to drain %s on shard %d: %w", symbol, source, err)
+	}
+
+	if err := e.saveShardAssignments(assignments); err != nil {
+		return e.restoreSymbol(source, symbol, state, err)
+	}
+	var importErr error
+	if err := e.shards[shardID].runTask(context.Background(), func() { importErr = e.shards[shardID].importSymbol(symbol, state) }); err != nil {
+		importErr = err
+	}
+	if importErr != nil {
+		cause := fmt.Errorf("failed to move %s to shard %d: %w", symbol, shardID, importErr)
+		if err := e.saveShardAssignments(e.router.Assignments()); err != nil {
+			cause = fmt.Errorf("%w; reverting the persisted assignment also failed: %v", cause, err)
+		}
+		return e.restoreSymbol(source, symbol, state, cause)
+	}
+
+	e.router.Assign(symbol, shardID)
+	return nil
+}
+
+// restoreSymbol puts a symbol back on the shard it was exported from after a failed move
+func (e *Engine) restoreSymbol(shardID int, symbol string, state *symbolState, cause error) error {
+	var importErr error
+	if err := e.shards[shardID].runTask(context.Background(), func() { importErr = e.shards[shardID].importSymbol(symbol, state) }); err != nil {
+		importErr = err
+	}
+	if importErr != nil {
+		return fmt.Errorf("%w; restoring %s on shard %d also failed: %v", cause, symbol, shardID, importErr)
+	}
+	return cause
+}
+
+func (e *Engine) saveShardAssignments(assignments map[string]int) error {
+	if e.assignmentStore == nil {
+		return nil
+	}
+	if err := e.assignmentStore.SaveShardAssignments(context.Background(), assignments); err != nil {
+		return fmt.Errorf("failed to persist shard assignments: %w", err)
+	}
+	return nil
+}
+
+// lockRouting waits until none of symbols is moving and read-locks routing.
+// The caller releases e.routeMu once its commands are queued, so a symbol cannot
+// move between routing a command and queueing it on the source shard.
+func (e *Engine) lockRouting(ctx context.Context, symbols []string) error {
+	for {
+		e.routeMu.RLock()
+		var moving chan struct{}
+		for _, symbol := range symbols {
+			if done, ok := e.moves[symbol]; ok {
+				moving = done
+				break
+			}
+		}
+		if moving == nil {
+			return nil
+		}
+		e.routeMu.RUnlock()
+
+		select {
+		case <-moving:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
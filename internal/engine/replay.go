@@ -0,0 +1,163 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"matching-engine/internal/matching"
+	"matching-engine/internal/symbolspec"
+)
+
+// ReplayBook applies logged events to an order book and returns the events the replay produced.
+// OrderMatched events are not applied: matches are re-derived by replaying OrderAccepted, and
+// auction uncrosses by replaying SymbolStatusChanged, through deterministic matching. The book's event sequence ends at the highest replayed sequence.
+// Each event is replayed at its OccurredAt, so the rebuilt book carries the original timestamps.
+// Cancels of group legs are re-derived from the fill or cancel that caused them; their logged
+// OrderCanceled events then find the leg already canceled.
+func ReplayBook(book *matching.OrderBook, events []matching.Event) ([]matching.Event, error) {
+	if len(events) == 0 {
+		return nil, nil
+	}
+
+	clock := matching.NewFixedClock(time.Time{})
+	previous := book.Clock()
+	book.SetClock(clock)
+	defer book.SetClock(previous)
+
+	// Logged orders were accepted whatever the bands and limits are now: replay without them, and
+	// re-apply the dynamic band only to the orders that tripped a breaker live
+	bands, limits := book.PriceBands(), book.OrderLimits()
+	book.SetPriceBands(matching.PriceBands{})
+	book.SetOrderLimits(symbolspec.Spec{})
+	defer book.SetPriceBands(bands)
+	defer book.SetOrderLimits(limits)
+	trips := breakerTrips(events)
+
+	// Track the maximum sequence number
+	var maxSeq int64
+	var produced []matching.Event
+
+	// Replay each event
+	for _, event := range events {
+		if event.Sequence() > maxSeq {
+			maxSeq = event.Sequence()
+		}
+
+		// Apply event based on type
+		clock.Set(event.OccurredAt())
+		var result *matching.CommandResult
+		var err error
+		switch e := event.(type) {
+		case *matching.OrderAcceptedEvent:
+			if trip, ok := trips[e.OrderID]; ok {
+				book.SetPriceBands(trip)
+			}
+			result, err = replayOrderAccepted(book, e)
+			book.SetPriceBands(matching.PriceBands{})
+			if err != nil {
+				return nil, fmt.Errorf("failed to replay OrderAccepted(seq=%d): %w", e.Sequence(), err)
+			}
+		case *matching.OrderMatchedEvent, *matching.PriceBandBreachedEvent:
+			// OrderMatched and PriceBandBreached are derived from OrderAccepted replay via deterministic matching.
+			// We still advance maxSeq to keep sequence monotonic.
+			continue
+		case *matching.SymbolSpecChangedEvent:
+			// The change was checked against resting orders when it was made; replay only records it.
+			// Recovery registers the spec while replaying account events.
+			result, err = book.ChangeSpec(e.Spec, e.Spec)
+			if err != nil {
+				return nil, fmt.Errorf("failed to replay SymbolSpecChanged(seq=%d): %w", e.Sequence(), err)
+			}
+		case *matching.OrderCanceledEvent:
+			result, err = replayOrderCanceled(book, e)
+			if err != nil {
+				return nil, fmt.Errorf("failed to replay OrderCanceled(seq=%d): %w", e.Sequence(), err)
+			}
+		case *matching.SymbolStatusChangedEvent:
+			result, err = book.SetStatus(&matching.SetSymbolStatusRequest{
+				Symbol: e.Symbol(),
+				Status: e.NewStatus,
+				Reason: e.Reason,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to replay SymbolStatusChanged(seq=%d): %w", e.Sequence(), err)
+			}
+		default:
+			return nil, fmt.Errorf("unknown event type: %T", event)
+		}
+		if result != nil {
+			produced = append(produced, result.Events...)
+		}
+	}
+
+	// Set the orderbook's event sequence to the maximum sequence from replayed events
+	// This ensures the next event will have the correct sequence number
+	book.SetEventSequence(maxSeq)
+
+	return produced, nil
+}
+
+// breakerTrips returns, by order ID, the bands that make each order that tripped a circuit breaker
+// stop matching where it did live: the breached band, and the status the symbol moved to
+func breakerTrips(events []matching.Event) map[string]matching.PriceBands {
+	trips := make(map[string]matching.PriceBands)
+	for i, event := range events {
+		breached, ok := event.(*matching.PriceBandBreachedEvent)
+		if !ok {
+			continue
+		}
+		trip := matching.PriceBands{TradeBps: breached.BandBps}
+		if i+1 < len(events) {
+			if changed, ok := events[i+1].(*matching.SymbolStatusChangedEvent); ok {
+				trip.BreakerStatus = changed.NewStatus
+			}
+		}
+		trips[breached.OrderID] = trip
+	}
+	return trips
+}
+
+// replayOrderAccepted replays an OrderAccepted event
+func replayOrderAccepted(book *matching.OrderBook, event *matching.OrderAcceptedEvent) (*matching.CommandResult, error) {
+	// Reconstruct the place order request
+	req := &matching.PlaceOrderRequest{
+		OrderID:       event.OrderID,
+		ClientOrderID: event.ClientOrderID,
+		AccountID:     event.AccountID,
+		Symbol:        event.Symbol(),
+		Side:          event.Side,
+		PriceInt:      event.Price,
+		QuantityInt:   event.Quantity,
+		APIKeyID:      event.APIKeyID,
+		GroupID:       event.GroupID,
+	}
+
+	// Execute place order; the events it generates are returned to the caller
+	return book.PlaceLimit(req)
+}
+
+// replayOrderCanceled replays an OrderCanceled event
+func replayOrderCanceled(book *matching.OrderBook, event *matching.OrderCanceledEvent) (*matching.CommandResult, error) {
+	// Reconstruct the cancel order request
+	req := &matching.CancelOrderRequest{
+		OrderID:   event.OrderID,
+		AccountID: event.AccountID,
+		Symbol:    event.Symbol(),
+		Reason:    event.CanceledBy,
+	}
+
+	// Execute cancel order
+	result, err := book.Cancel(req)
+	if err != nil {
+		// During replay, order might already be filled/canceled
+		// This is expected, so we can ignore certain errors
+		errMsg := strings.ToLower(err.Error())
+		if strings.Contains(errMsg, "not found") ||
+			strings.Contains(errMsg, "already") {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return result, nil
+}
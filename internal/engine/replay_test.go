@@ -0,0 +1,90 @@
+package engine
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"matching-engine/internal/matching"
+)
+
+// TestReplayBook_ReproducesLiveState replays the events of a live engine and expects
+// the rebuilt book, timestamps included, to equal the live one exactly
+func TestReplayBook_ReproducesLiveState(t *testing.T) {
+	clock := matching.NewFixedClock(time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC))
+	eng := NewEngine(&EngineConfig{ShardCount: 1, QueueSize: 10, IdempotencyTTL: time.Hour, Clock: clock})
+
+	base := time.Now().In(time.FixedZone("UTC+8", 8*3600))
+	commands := []struct {
+		createdAt time.Time
+		payload   any
+	}{
+		{base, &matching.PlaceOrderRequest{OrderID: "b2", ClientOrderID: "c1", AccountID: "acc1", Side: matching.SideBuy, PriceInt: 100, QuantityInt: 10}},
+		{base, &matching.PlaceOrderRequest{OrderID: "b1", ClientOrderID: "c2", AccountID: "acc2", Side: matching.SideBuy, PriceInt: 100, QuantityInt: 10}},
+		{time.Time{}, &matching.PlaceOrderRequest{OrderID: "b3", ClientOrderID: "c3", AccountID: "acc3", Side: matching.SideBuy, PriceInt: 99, QuantityInt: 5}},
+		{base.Add(time.Second), &matching.PlaceOrderRequest{OrderID: "s1", ClientOrderID: "c4", AccountID: "acc4", Side: matching.SideSell, PriceInt: 100, QuantityInt: 12}},
+		{base.Add(2 * time.Second), &matching.CancelOrderRequest{OrderID: "b3", AccountID: "acc3"}},
+	}
+
+	var events []matching.Event
+	for i, cmd := range commands {
+		envelope := &CommandEnvelope{
+			IdempotencyKey: string(rune('a' + i)),
+			Symbol:         "BTC-USDT",
+			Payload:        cmd.payload,
+			CreatedAt:      cmd.createdAt,
+		}
+		switch req := cmd.payload.(type) {
+		case *matching.PlaceOrderRequest:
+			req.Symbol = envelope.Symbol
+			envelope.CommandType = CommandTypePlace
+			envelope.AccountID = req.AccountID
+		case *matching.CancelOrderRequest:
+			req.Symbol = envelope.Symbol
+			envelope.CommandType = CommandTypeCancel
+			envelope.AccountID = req.AccountID
+		}
+		result := eng.Submit(envelope)
+		if result.ErrorCode != ErrorCodeNone {
+			t.Fatalf("command %d failed: %v", i, result.Err)
+		}
+		events = append(events, getCommandResult(t, result).Events...)
+	}
+	eng.Close()
+	live := eng.shards[0].books["BTC-USDT"]
+
+	// Commands without a timestamp take the engine clock's
+	if got := events[2].OccurredAt(); !got.Equal(clock.Now()) {
+		t.Fatalf("expected the engine clock's time, got %v", got)
+	}
+
+	replayed := matching.NewOrderBook("BTC-USDT")
+	produced, err := ReplayBook(replayed, events)
+	if err != nil {
+		t.Fatalf("ReplayBook failed: %v", err)
+	}
+	if !reflect.DeepEqual(produced, events) {
+		t.Fatalf("replay produced different events:\n got %+v\nwant %+v", produced, events)
+	}
+	if got, want := sortedState(replayed), sortedState(live); !reflect.DeepEqual(got, want) {
+		t.Fatalf("replayed state differs:\n got %+v\nwant %+v", got, want)
+	}
+
+	// A snapshot of the live book imports to the same state
+	imported := matching.NewOrderBook("BTC-USDT")
+	if err := imported.ImportState(live.ExportState()); err != nil {
+		t.Fatalf("ImportState failed: %v", err)
+	}
+	if got, want := sortedState(imported), sortedState(live); !reflect.DeepEqual(got, want) {
+		t.Fatalf("imported state differs:\n got %+v\nwant %+v", got, want)
+	}
+}
+
+func sortedState(book *matching.OrderBook) *matching.OrderBookState {
+	state := book.ExportState()
+	sort.Slice(state.Orders, func(i, j int) bool {
+		return state.Orders[i].OrderID < state.Orders[j].OrderID
+	})
+	return state
+}
@@ -2,11 +2,15 @@ package engine
 
 import (
 	"hash/fnv"
+	"sync"
 )
 
-// Router routes commands to shards based on symbol
+// Router routes commands to shards based on symbol.
+// Symbols in the assignment table go to their assigned shard; the rest are hashed.
 type Router struct {
-	shardCount int
+	shardCount  int
+	mu          sync.RWMutex
+	assignments map[string]int // symbol -> shard ID
 }
 
 // NewRouter creates a new router with the specified shard count
@@ -15,13 +19,25 @@ func NewRouter(shardCount int) *Router {
 		shardCount = 1
 	}
 	return &Router{
-		shardCount: shardCount,
+		shardCount:  shardCount,
+		assignments: make(map[string]int),
 	}
 }
 
 // Route calculates the shard ID for a given symbol
 // Uses FNV-1a hash for stable, deterministic routing
 func (r *Router) Route(symbol string) int {
+	r.mu.RLock()
+	shardID, ok := r.assignments[symbol]
+	r.mu.RUnlock()
+	if ok {
+		return shardID
+	}
+	return r.hash(symbol)
+}
+
+// hash returns the shard a symbol routes to without an assignment
+func (r *Router) hash(symbol string) int {
 	if r.shardCount <= 0 {
 		return 0
 	}
@@ -29,3 +45,26 @@ func (r *Router) Route(symbol string) int {
 	_, _ = h.Write([]byte(symbol))
 	return int(h.Sum32()) % r.shardCount
 }
+
+// Assign pins a symbol to a shard
+func (r *Router) Assign(symbol string, shardID int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.assignments[symbol] = shardID
+}
+
+// Assignments returns a copy of the assignment table
+func (r *Router) Assignments() map[string]int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	assignments := make(map[string]int, len(r.assignments))
+	for symbol, shardID := range r.assignments {
+		assignments[symbol] = shardID
+	}
+	return assignments
+}
+
+// ShardCount returns the number of shards the router routes to
+func (r *Router) ShardCount() int {
+	return r.shardCount
+}
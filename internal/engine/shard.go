@@ -4,12 +4,15 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"matching-engine/internal/matching"
+	"matching-engine/internal/symbolspec"
 )
 
 const defaultIdempotencyCleanupInterval = time.Minute
@@ -19,10 +22,21 @@ const defaultSnapshotInterval = 100 // Create snapshot every N events
 type Shard struct {
 	id            int
 	cmdQueue      chan *commandRequest
+	highWater     int // Queue depth at which non-cancel commands are shed
 	books         map[string]*matching.OrderBook
 	idemStore     *IdempotencyStore
-	eventStore    EventStore    // Optional: if nil, events are not persisted
-	snapshotStore SnapshotStore // Optional: if nil, snapshots are not created
+	eventStore    EventStore             // Optional: if nil, events are not persisted
+	snapshotStore SnapshotStore          // Optional: if nil, snapshots are not created
+	idemRecords   IdempotencyRecordStore // Optional: if nil, idempotency records are memory-only
+	journal       CommandJournal         // Optional: if nil, executed commands are not journaled
+	clock         matching.Clock         // Stamps commands that arrive without CreatedAt
+	bookClock     *matching.FixedClock   // Set to the current command's timestamp; read by every book
+	onBreakerTrip func(symbol string)    // Optional: told when a place trips a symbol's circuit breaker
+
+	// Events and breaker trips held back while an all-or-nothing batch executes
+	deferring      bool
+	deferredEvents []matching.Event
+	deferredTrips  []string
 
 	// Snapshot tracking per symbol
 	eventCounters    map[string]int64 // symbol -> event count since last snapshot
@@ -33,10 +47,22 @@ type Shard struct {
 	wg       sync.WaitGroup
 }
 
-// commandRequest wraps a command with a response channel
+// commandRequest is one queue entry: a single command or a batch run back to back in one event-loop turn
 type commandRequest struct {
-	envelope *CommandEnvelope
-	respChan chan *CommandExecResult
+	envelopes []*CommandEnvelope
+	futures   []*Future // One per envelope
+	atomic    bool      // The commands of each symbol all take effect or none do
+	task      func()    // Internal work run on the event loop instead of commands
+}
+
+// urgentOnly reports whether every command of the request is admitted past the high-water mark
+func (r *commandRequest) urgentOnly() bool {
+	for _, envelope := range r.envelopes {
+		if envelope == nil || !envelope.CommandType.isUrgent() {
+			return false
+		}
+	}
+	return true
 }
 
 // NewShard creates a new shard
@@ -44,8 +70,11 @@ func NewShard(id int, queueSize int, idemTTL time.Duration) *Shard {
 	return &Shard{
 		id:               id,
 		cmdQueue:         make(chan *commandRequest, queueSize),
+		highWater:        defaultQueueHighWater(queueSize),
 		books:            make(map[string]*matching.OrderBook),
 		idemStore:        NewIdempotencyStore(idemTTL),
+		clock:            matching.SystemClock{},
+		bookClock:        matching.NewFixedClock(time.Time{}),
 		eventCounters:    make(map[string]int64),
 		snapshotInterval: defaultSnapshotInterval,
 	}
@@ -61,6 +90,52 @@ func (s *Shard) SetSnapshotStore(snapshotStore SnapshotStore) {
 	s.snapshotStore = snapshotStore
 }
 
+// SetIdempotencyRecordStore sets the store idempotency records are persisted to (optional)
+func (s *Shard) SetIdempotencyRecordStore(store IdempotencyRecordStore) {
+	s.idemRecords = store
+}
+
+// SetCommandJournal sets the journal executed commands are recorded in (optional)
+func (s *Shard) SetCommandJournal(journal CommandJournal) {
+	s.journal = journal
+}
+
+// SetClock sets the clock that stamps commands submitted without CreatedAt
+func (s *Shard) SetClock(clock matching.Clock) {
+	if clock == nil {
+		clock = matching.SystemClock{}
+	}
+	s.clock = clock
+}
+
+// SetQueueHighWater sets the queue depth at which new non-cancel commands are shed.
+// Cancels are admitted until the queue is full, so they can still free resources under load.
+// Out of range values fall back to the default of 80% of the queue size.
+func (s *Shard) SetQueueHighWater(highWater int) {
+	if highWater <= 0 || highWater > cap(s.cmdQueue) {
+		highWater = defaultQueueHighWater(cap(s.cmdQueue))
+	}
+	s.highWater = highWater
+}
+
+// QueueStats returns the shard's current queue depth and limits
+func (s *Shard) QueueStats() QueueStats {
+	return QueueStats{
+		ShardID:   s.id,
+		Depth:     len(s.cmdQueue),
+		HighWater: s.highWater,
+		Capacity:  cap(s.cmdQueue),
+	}
+}
+
+func defaultQueueHighWater(queueSize int) int {
+	highWater := queueSize * 8 / 10
+	if highWater < 1 {
+		highWater = queueSize
+	}
+	return highWater
+}
+
 // SetSnapshotInterval sets the number of events between snapshots
 func (s *Shard) SetSnapshotInterval(interval int64) {
 	if interval > 0 {
@@ -90,32 +165,117 @@ func (s *Shard) Stop() {
 
 // Submit submits a command to the shard and waits for the result
 func (s *Shard) Submit(envelope *CommandEnvelope) *CommandExecResult {
+	return s.SubmitContext(context.Background(), envelope)
+}
+
+// SubmitContext submits a command to the shard and waits for the result until ctx is done.
+// A command the queue cannot admit fails at once with ErrorCodeOverloaded.
+// A command already queued when ctx ends still executes; see ErrCommandNotQueued.
+func (s *Shard) SubmitContext(ctx context.Context, envelope *CommandEnvelope) *CommandExecResult {
+	return s.SubmitAsync(ctx, envelope).Wait(ctx)
+}
+
+// SubmitAsync queues a command and returns a future for its result
+func (s *Shard) SubmitAsync(ctx context.Context, envelope *CommandEnvelope) *Future {
 	if envelope == nil {
-		return &CommandExecResult{
+		return resolvedFuture(&CommandExecResult{
 			Result:    nil,
 			ErrorCode: ErrorCodeInvalidArgument,
 			Err:       fmt.Errorf("command envelope is nil"),
-		}
+		})
 	}
+	return s.submit(ctx, []*CommandEnvelope{envelope}, false)[0]
+}
 
-	respChan := make(chan *CommandExecResult, 1)
+// SubmitBatch queues commands as one queue entry, so they run back to back in one event-loop turn.
+// With atomic, the commands of each symbol all take effect or none do.
+func (s *Shard) SubmitBatch(ctx context.Context, envelopes []*CommandEnvelope, atomic bool) []*Future {
+	if len(envelopes) == 0 {
+		return nil
+	}
+	return s.submit(ctx, envelopes, atomic)
+}
+
+// submit queues a request and returns its futures, resolved at once if the request is not admitted
+func (s *Shard) submit(ctx context.Context, envelopes []*CommandEnvelope, atomic bool) []*Future {
 	req := &commandRequest{
-		envelope: envelope,
-		respChan: respChan,
+		envelopes: envelopes,
+		futures:   make([]*Future, len(envelopes)),
+		atomic:    atomic,
+	}
+	for i := range req.futures {
+		req.futures[i] = newFuture()
+	}
+
+	if err := ctx.Err(); err != nil {
+		return req.reject(notQueuedResult(err))
 	}
 
 	s.submitMu.RLock()
+	defer s.submitMu.RUnlock()
 	if s.stopped {
-		s.submitMu.RUnlock()
-		return &CommandExecResult{
+		return req.reject(&CommandExecResult{
 			Result:    nil,
 			ErrorCode: ErrorCodeInvalidArgument,
 			Err:       fmt.Errorf("shard is stopped"),
+		})
+	}
+	if rejected := s.enqueue(ctx, req); rejected != nil {
+		return req.reject(rejected)
+	}
+	return req.futures
+}
+
+// reject resolves every future of a request that was not queued with a copy of result
+func (r *commandRequest) reject(result *CommandExecResult) []*Future {
+	for _, future := range r.futures {
+		copied := *result
+		future.resolve(&copied)
+	}
+	return r.futures
+}
+
+// enqueue admits a request to the queue without blocking. Requests with non-cancel commands are shed at the
+// high-water mark and cancels once the queue is full. Cancels are not reordered ahead of queued
+// places: a cancel overtaking the place of its own order would miss it.
+// An unbuffered queue has no depth to measure and hands off under ctx instead.
+func (s *Shard) enqueue(ctx context.Context, req *commandRequest) *CommandExecResult {
+	capacity := cap(s.cmdQueue)
+	if capacity == 0 {
+		select {
+		case s.cmdQueue <- req:
+			return nil
+		case <-ctx.Done():
+			return notQueuedResult(ctx.Err())
 		}
 	}
-	s.cmdQueue <- req
-	s.submitMu.RUnlock()
-	return <-respChan
+
+	if depth := len(s.cmdQueue); !req.urgentOnly() && depth >= s.highWater {
+		return s.overloadedResult(depth, false)
+	}
+	select {
+	case s.cmdQueue <- req:
+		return nil
+	default:
+		return s.overloadedResult(capacity, true)
+	}
+}
+
+func (s *Shard) overloadedResult(depth int, full bool) *CommandExecResult {
+	return &CommandExecResult{
+		Result:    nil,
+		ErrorCode: ErrorCodeOverloaded,
+		Err:       &OverloadError{ShardID: s.id, Depth: depth, Capacity: cap(s.cmdQueue), Full: full},
+	}
+}
+
+// notQueuedResult is the result of a command whose context ended before it was queued
+func notQueuedResult(err error) *CommandExecResult {
+	return &CommandExecResult{
+		Result:    nil,
+		ErrorCode: ErrorCodeTimeout,
+		Err:       fmt.Errorf("%w: %w", ErrCommandNotQueued, err),
+	}
 }
 
 // eventLoop is the main event loop that processes commands serially
@@ -134,8 +294,7 @@ func (s *Shard) eventLoop() {
 			if req == nil {
 				continue
 			}
-			result := s.processCommand(req.envelope)
-			req.respChan <- result
+			s.processRequest(req)
 		case <-ticker.C:
 			s.idemStore.Cleanup()
 		}
@@ -152,16 +311,38 @@ func (s *Shard) processCommand(envelope *CommandEnvelope) *CommandExecResult {
 		}
 	}
 
-	// Build idempotency key
-	idemKey := IdempotencyKey{
+	idemKey := idempotencyKeyOf(envelope)
+	if result := s.checkIdempotency(idemKey, envelope); result != nil {
+		return result
+	}
+
+	// Not seen before, execute command at its own timestamp
+	now := s.commandTime(envelope)
+	s.bookClock.Set(now)
+	// A mass cancel journals one command per book it touches; see executeMassCancel
+	if !envelope.CommandType.isReadOnly() && envelope.CommandType != CommandTypeMassCancel {
+		s.journalCommand(envelope, now, s.bookSequence(envelope.Symbol))
+	}
+	result := s.execute(envelope)
+	s.storeResult(idemKey, envelope, result)
+
+	return result
+}
+
+// idempotencyKeyOf builds the idempotency key of a command
+func idempotencyKeyOf(envelope *CommandEnvelope) IdempotencyKey {
+	return IdempotencyKey{
 		AccountID:      envelope.AccountID,
 		Symbol:         envelope.Symbol,
 		CommandType:    envelope.CommandType,
 		IdempotencyKey: envelope.IdempotencyKey,
 	}
+}
 
-	// Check idempotency
-	cachedResult, err := s.idemStore.Check(idemKey, envelope.PayloadHash)
+// checkIdempotency returns the cached result of a duplicate command, a conflict result
+// when the key was used with a different payload, or nil when the command is new
+func (s *Shard) checkIdempotency(key IdempotencyKey, envelope *CommandEnvelope) *CommandExecResult {
+	cachedResult, err := s.idemStore.Check(key, envelope.PayloadHash)
 	if err != nil {
 		// Conflict: same idempotency key with different payload
 		return &CommandExecResult{
@@ -170,33 +351,108 @@ func (s *Shard) processCommand(envelope *CommandEnvelope) *CommandExecResult {
 			Err:       err,
 		}
 	}
-	if cachedResult != nil {
-		// Duplicate: return cached result
-		return cachedResult
-	}
+	return cachedResult
+}
 
-	// Not seen before, execute command
-	var result *CommandExecResult
+// storeResult caches a command's result for retries, persisting it for state-changing commands
+func (s *Shard) storeResult(key IdempotencyKey, envelope *CommandEnvelope, result *CommandExecResult) {
+	record := s.idemStore.Store(key, envelope.PayloadHash, result)
+	if !envelope.CommandType.isReadOnly() {
+		s.persistIdempotencyRecord(key, record)
+	}
+}
 
+// execute dispatches a command to its handler
+func (s *Shard) execute(envelope *CommandEnvelope) *CommandExecResult {
 	switch envelope.CommandType {
 	case CommandTypePlace:
-		result = s.executePlace(envelope)
+		return s.executePlace(envelope)
 	case CommandTypeCancel:
-		result = s.executeCancel(envelope)
+		return s.executeCancel(envelope)
+	case CommandTypeMassCancel:
+		return s.executeMassCancel(envelope)
+	case CommandTypeSetSymbolStatus:
+		return s.executeSetSymbolStatus(envelope)
+	case CommandTypeSetSymbolSpec:
+		return s.executeSetSymbolSpec(envelope)
 	case CommandTypeQuery:
-		result = s.executeQuery(envelope)
+		return s.executeQuery(envelope)
+	case CommandTypeDepth:
+		return s.executeDepth(envelope)
 	default:
-		result = &CommandExecResult{
+		return &CommandExecResult{
 			Result:    nil,
 			ErrorCode: ErrorCodeInvalidArgument,
 			Err:       fmt.Errorf("unknown command type: %s", envelope.CommandType),
 		}
 	}
+}
 
-	// Store result in idempotency cache
-	s.idemStore.Store(idemKey, envelope.PayloadHash, result)
+// journalCommand records a command before it executes against a book at bookSeq.
+// Failures are logged: the journal validates replays and is not needed for recovery.
+func (s *Shard) journalCommand(envelope *CommandEnvelope, now time.Time, bookSeq int64) {
+	if s.journal == nil {
+		return
+	}
+	command, err := newJournaledCommand(envelope, now, bookSeq)
+	if err == nil {
+		err = s.journal.Append(context.Background(), s.id, command)
+	}
+	if err != nil {
+		fmt.Printf("Warning: failed to journal command %s: %v\n", envelope.IdempotencyKey, err)
+	}
+}
 
-	return result
+// commandTime returns the timestamp books stamp a command's orders and events with.
+// Times are kept in UTC without a monotonic reading, so they survive persistence unchanged
+// and a replay from the event log reproduces the live book exactly.
+func (s *Shard) commandTime(envelope *CommandEnvelope) time.Time {
+	if envelope.CreatedAt.IsZero() {
+		return s.clock.Now().UTC()
+	}
+	return envelope.CreatedAt.UTC()
+}
+
+// bookSequence returns the last event sequence of a symbol's book, or 0 when it has none
+func (s *Shard) bookSequence(symbol string) int64 {
+	if book, ok := s.books[symbol]; ok {
+		return book.GetEventSequence()
+	}
+	return 0
+}
+
+// newBook creates an order book that reads the current command's timestamp
+func (s *Shard) newBook(symbol string) *matching.OrderBook {
+	book := matching.NewOrderBook(symbol)
+	book.SetClock(s.bookClock)
+	applySpec(book, symbol)
+	return book
+}
+
+// persistIdempotencyRecord saves a record so retries after a restart get the same result.
+// Failures are logged: the command already executed and the in-memory record still applies.
+func (s *Shard) persistIdempotencyRecord(key IdempotencyKey, record *IdempotencyRecord) {
+	if s.idemRecords == nil {
+		return
+	}
+	persisted, err := newPersistedIdempotencyRecord(key, record)
+	if err == nil {
+		err = s.idemRecords.Save(context.Background(), persisted)
+	}
+	if err != nil {
+		fmt.Printf("Warning: failed to persist idempotency record %s: %v\n", key, err)
+	}
+}
+
+// RestoreIdempotencyRecord restores a persisted idempotency record.
+// This should be called before the shard starts processing commands.
+func (s *Shard) RestoreIdempotencyRecord(record *PersistedIdempotencyRecord) error {
+	restored, err := record.record()
+	if err != nil {
+		return fmt.Errorf("failed to restore idempotency record %s: %w", record.Key(), err)
+	}
+	s.idemStore.Restore(record.Key(), restored)
+	return nil
 }
 
 // executePlace executes a place order command
@@ -210,13 +466,18 @@ func (s *Shard) executePlace(envelope *CommandEnvelope) *CommandExecResult {
 			Err:       fmt.Errorf("invalid payload type for PLACE command"),
 		}
 	}
+	if rejected := s.statusRejection(envelope.Symbol, CommandTypePlace); rejected != nil {
+		return rejected
+	}
 
 	// Get or create order book for symbol
 	book, exists := s.books[envelope.Symbol]
 	if !exists {
-		book = matching.NewOrderBook(envelope.Symbol)
+		book = s.newBook(envelope.Symbol)
 		s.books[envelope.Symbol] = book
 	}
+	// Bands and limits follow the current spec, which admin changes and recovery update
+	applySpec(book, envelope.Symbol)
 
 	// Execute place order
 	matchResult, err := book.PlaceLimit(req)
@@ -229,23 +490,20 @@ func (s *Shard) executePlace(envelope *CommandEnvelope) *CommandExecResult {
 	}
 
 	// Persist events if event store is configured
-	if s.eventStore != nil && len(matchResult.Events) > 0 {
-		ctx := context.Background()
-		for _, event := range matchResult.Events {
-			if err := s.eventStore.Append(ctx, envelope.Symbol, event); err != nil {
-				// Event persistence failed - this is a critical error
-				// In production, we should have proper error handling and rollback
-				// For MVP, we log the error but continue
-				// TODO: Implement proper transaction handling
-				return &CommandExecResult{
-					Result:    nil,
-					ErrorCode: ErrorCodeInternalError,
-					Err:       fmt.Errorf("failed to persist event: %w", err),
-				}
-			}
+	if err := s.persistEvents(envelope.Symbol, matchResult.Events); err != nil {
+		// Event persistence failed - this is a critical error
+		// In production, we should have proper error handling and rollback
+		// TODO: Implement proper transaction handling
+		return &CommandExecResult{
+			Result:    nil,
+			ErrorCode: ErrorCodeInternalError,
+			Err:       fmt.Errorf("failed to persist event: %w", err),
+		}
+	}
+	for _, event := range matchResult.Events {
+		if _, ok := event.(*matching.PriceBandBreachedEvent); ok {
+			s.breakerTripped(envelope.Symbol)
 		}
-		lastSeq := matchResult.Events[len(matchResult.Events)-1].Sequence()
-		s.checkAndCreateSnapshot(envelope.Symbol, len(matchResult.Events), lastSeq)
 	}
 
 	return &CommandExecResult{
@@ -255,6 +513,19 @@ func (s *Shard) executePlace(envelope *CommandEnvelope) *CommandExecResult {
 	}
 }
 
+// breakerTripped reports a symbol's tripped circuit breaker, or holds the report back until
+// the all-or-nothing batch being executed commits
+func (s *Shard) breakerTripped(symbol string) {
+	if s.onBreakerTrip == nil {
+		return
+	}
+	if s.deferring {
+		s.deferredTrips = append(s.deferredTrips, symbol)
+		return
+	}
+	s.onBreakerTrip(symbol)
+}
+
 // executeCancel executes a cancel order command
 func (s *Shard) executeCancel(envelope *CommandEnvelope) *CommandExecResult {
 	// Extract payload
@@ -276,6 +547,9 @@ func (s *Shard) executeCancel(envelope *CommandEnvelope) *CommandExecResult {
 			Err:       fmt.Errorf("order book not found for symbol: %s", envelope.Symbol),
 		}
 	}
+	if rejected := s.statusRejection(envelope.Symbol, CommandTypeCancel); rejected != nil {
+		return rejected
+	}
 
 	// Execute cancel order
 	matchResult, err := book.Cancel(req)
@@ -288,19 +562,12 @@ func (s *Shard) executeCancel(envelope *CommandEnvelope) *CommandExecResult {
 	}
 
 	// Persist events if event store is configured
-	if s.eventStore != nil && len(matchResult.Events) > 0 {
-		ctx := context.Background()
-		for _, event := range matchResult.Events {
-			if err := s.eventStore.Append(ctx, envelope.Symbol, event); err != nil {
-				return &CommandExecResult{
-					Result:    nil,
-					ErrorCode: ErrorCodeInternalError,
-					Err:       fmt.Errorf("failed to persist event: %w", err),
-				}
-			}
+	if err := s.persistEvents(envelope.Symbol, matchResult.Events); err != nil {
+		return &CommandExecResult{
+			Result:    nil,
+			ErrorCode: ErrorCodeInternalError,
+			Err:       fmt.Errorf("failed to persist event: %w", err),
 		}
-		lastSeq := matchResult.Events[len(matchResult.Events)-1].Sequence()
-		s.checkAndCreateSnapshot(envelope.Symbol, len(matchResult.Events), lastSeq)
 	}
 
 	return &CommandExecResult{
@@ -310,6 +577,123 @@ func (s *Shard) executeCancel(envelope *CommandEnvelope) *CommandExecResult {
 	}
 }
 
+// executeMassCancel cancels the matching orders of the envelope's symbol, or of every book
+// on the shard that is not halted when the symbol is empty, in symbol order. The result holds every book's
+// status changes and events. Each book with canceled orders is journaled as a single-symbol
+// mass cancel, so journals replay symbol by symbol.
+func (s *Shard) executeMassCancel(envelope *CommandEnvelope) *CommandExecResult {
+	req, ok := envelope.Payload.(*matching.MassCancelRequest)
+	if !ok {
+		return &CommandExecResult{
+			Result:    nil,
+			ErrorCode: ErrorCodeInvalidArgument,
+			Err:       fmt.Errorf("invalid payload type for MASS_CANCEL command"),
+		}
+	}
+	if req.Symbol != envelope.Symbol {
+		return &CommandExecResult{
+			Result:    nil,
+			ErrorCode: ErrorCodeInvalidArgument,
+			Err:       fmt.Errorf("symbol mismatch: envelope %q, request %q", envelope.Symbol, req.Symbol),
+		}
+	}
+
+	symbols := []string{req.Symbol}
+	if req.Symbol == "" {
+		symbols = make([]string, 0, len(s.books))
+		for symbol := range s.books {
+			symbols = append(symbols, symbol)
+		}
+		sort.Strings(symbols)
+	}
+
+	result := &matching.CommandResult{
+		OrderStatusChanges: []matching.OrderStatusChange{},
+		Trades:             []matching.Trade{},
+		Events:             []matching.Event{},
+	}
+	for _, symbol := range symbols {
+		book, exists := s.books[symbol]
+		if !exists {
+			continue
+		}
+		// System cancels, such as a dead-man's switch expiry, clear halted books too, so the
+		// orders can't trade when the symbol resumes
+		if rejected := s.statusRejection(symbol, CommandTypeMassCancel); rejected != nil && req.Reason != matching.CancelReasonSystem {
+			if req.Symbol != "" {
+				return rejected
+			}
+			// Across every symbol, halted books keep their users' orders
+			continue
+		}
+		bookReq := *req
+		bookReq.Symbol = symbol
+		bookSeq := book.GetEventSequence()
+		canceled, err := book.MassCancel(&bookReq)
+		if err != nil {
+			// Orders canceled on earlier books stay in the result so their funds are released
+			return &CommandExecResult{
+				Result:    result,
+				ErrorCode: s.mapErrorCode(err),
+				Err:       err,
+			}
+		}
+		if len(canceled.Events) == 0 {
+			continue
+		}
+
+		bookEnvelope := *envelope
+		bookEnvelope.Symbol = symbol
+		bookEnvelope.Payload = &bookReq
+		s.journalCommand(&bookEnvelope, s.bookClock.Now(), bookSeq)
+		// The book's orders are canceled whether or not their events persist
+		result.OrderStatusChanges = append(result.OrderStatusChanges, canceled.OrderStatusChanges...)
+		result.Events = append(result.Events, canceled.Events...)
+		if err := s.persistEvents(symbol, canceled.Events); err != nil {
+			return &CommandExecResult{
+				Result:    result,
+				ErrorCode: ErrorCodeInternalError,
+				Err:       fmt.Errorf("failed to persist event: %w", err),
+			}
+		}
+	}
+
+	return &CommandExecResult{
+		Result:    result,
+		ErrorCode: ErrorCodeNone,
+		Err:       nil,
+	}
+}
+
+// persistEvents appends a command's events to the event store and triggers snapshots.
+// All events of one command go out in a single batch when the store supports it.
+func (s *Shard) persistEvents(symbol string, events []matching.Event) error {
+	if s.eventStore == nil || len(events) == 0 {
+		return nil
+	}
+	if s.deferring {
+		s.deferredEvents = append(s.deferredEvents, events...)
+		return nil
+	}
+
+	ctx := context.Background()
+	if batchStore, ok := s.eventStore.(BatchEventStore); ok {
+		if err := batchStore.AppendBatch(ctx, symbol, events); err != nil {
+			return err
+		}
+	} else {
+		for _, event := range events {
+			if err := s.eventStore.Append(ctx, symbol, event); err != nil {
+				return err
+			}
+		}
+	}
+
+	lastSeq := events[len(events)-1].Sequence()
+	s.checkAndCreateSnapshot(symbol, len(events), lastSeq)
+	return nil
+}
+
 // executeQuery executes a query order command
 func (s *Shard) executeQuery(envelope *CommandEnvelope) *CommandExecResult {
 	// Extract payload
@@ -370,8 +754,48 @@ func (s *Shard) executeQuery(envelope *CommandEnvelope) *CommandExecResult {
 	}
 }
 
+// executeDepth executes a book depth query
+func (s *Shard) executeDepth(envelope *CommandEnvelope) *CommandExecResult {
+	req, ok := envelope.Payload.(*matching.DepthRequest)
+	if !ok {
+		return &CommandExecResult{
+			Result:    nil,
+			ErrorCode: ErrorCodeInvalidArgument,
+			Err:       fmt.Errorf("invalid payload type for DEPTH command"),
+		}
+	}
+	if err := req.Validate(); err != nil {
+		return &CommandExecResult{
+			Result:    nil,
+			ErrorCode: ErrorCodeInvalidArgument,
+			Err:       err,
+		}
+	}
+
+	// A symbol without a book has an empty depth
+	book, exists := s.books[envelope.Symbol]
+	if !exists {
+		return &CommandExecResult{Result: &matching.BookDepth{Symbol: envelope.Symbol, Status: matching.SymbolStatusTrading}}
+	}
+	return &CommandExecResult{Result: book.Depth(req.Levels)}
+}
+
 // mapErrorCode maps matching engine errors to error codes
 func (s *Shard) mapErrorCode(err error) ErrorCode {
+	// Order limit violations carry their own codes
+	switch {
+	case errors.Is(err, symbolspec.ErrPriceTooLow):
+		return ErrorCodePriceTooLow
+	case errors.Is(err, symbolspec.ErrPriceTooHigh):
+		return ErrorCodePriceTooHigh
+	case errors.Is(err, symbolspec.ErrQtyTooSmall):
+		return ErrorCodeQtyTooSmall
+	case errors.Is(err, symbolspec.ErrQtyTooLarge):
+		return ErrorCodeQtyTooLarge
+	case errors.Is(err, symbolspec.ErrMinNotional):
+		return ErrorCodeMinNotional
+	}
+
 	errMsg := strings.ToLower(err.Error())
 
 	// Check for specific error patterns
@@ -387,6 +811,12 @@ func (s *Shard) mapErrorCode(err error) ErrorCode {
 	if strings.Contains(errMsg, "already canceled") {
 		return ErrorCodeOrderAlreadyCanceled
 	}
+	if strings.Contains(errMsg, "price band") {
+		return ErrorCodePriceOutOfBand
+	}
+	if strings.Contains(errMsg, "spec conflict") {
+		return ErrorCodeSpecConflict
+	}
 
 	// Default to invalid argument
 	return ErrorCodeInvalidArgument
@@ -406,7 +836,7 @@ func ComputePayloadHash(payload any) (string, error) {
 func (s *Shard) LoadSnapshot(symbol string, state *matching.OrderBookState, lastSequence int64) error {
 	book, exists := s.books[symbol]
 	if !exists {
-		book = matching.NewOrderBook(symbol)
+		book = s.newBook(symbol)
 		s.books[symbol] = book
 	}
 
@@ -434,87 +864,14 @@ func (s *Shard) ReplayEvents(symbol string, events []matching.Event) error {
 	// Get or create order book
 	book, exists := s.books[symbol]
 	if !exists {
-		book = matching.NewOrderBook(symbol)
+		book = s.newBook(symbol)
 		s.books[symbol] = book
 	}
 
-	// Track the maximum sequence number
-	var maxSeq int64
-
-	// Replay each event
-	for _, event := range events {
-		if event.Sequence() > maxSeq {
-			maxSeq = event.Sequence()
-		}
-
-		// Apply event based on type
-		switch e := event.(type) {
-		case *matching.OrderAcceptedEvent:
-			if err := s.replayOrderAccepted(book, e); err != nil {
-				return fmt.Errorf("failed to replay OrderAccepted(seq=%d): %w", e.Sequence(), err)
-			}
-		case *matching.OrderMatchedEvent:
-			// OrderMatched is derived from OrderAccepted replay via deterministic matching.
-			// We still advance maxSeq to keep sequence monotonic.
-			continue
-		case *matching.OrderCanceledEvent:
-			if err := s.replayOrderCanceled(book, e); err != nil {
-				return fmt.Errorf("failed to replay OrderCanceled(seq=%d): %w", e.Sequence(), err)
-			}
-		default:
-			return fmt.Errorf("unknown event type: %T", event)
-		}
-	}
-
-	// Set the orderbook's event sequence to the maximum sequence from replayed events
-	// This ensures the next event will have the correct sequence number
-	book.SetEventSequence(maxSeq)
-
-	return nil
-}
-
-// replayOrderAccepted replays an OrderAccepted event
-func (s *Shard) replayOrderAccepted(book *matching.OrderBook, event *matching.OrderAcceptedEvent) error {
-	// Reconstruct the place order request
-	req := &matching.PlaceOrderRequest{
-		OrderID:       event.OrderID,
-		ClientOrderID: event.ClientOrderID,
-		AccountID:     event.AccountID,
-		Symbol:        event.Symbol(),
-		Side:          event.Side,
-		PriceInt:      event.Price,
-		QuantityInt:   event.Quantity,
-	}
-
-	// Execute place order (this will generate new events, but we ignore them during replay)
-	_, err := book.PlaceLimit(req)
+	_, err := ReplayBook(book, events)
 	return err
 }
 
-// replayOrderCanceled replays an OrderCanceled event
-func (s *Shard) replayOrderCanceled(book *matching.OrderBook, event *matching.OrderCanceledEvent) error {
-	// Reconstruct the cancel order request
-	req := &matching.CancelOrderRequest{
-		OrderID:   event.OrderID,
-		AccountID: event.AccountID,
-		Symbol:    event.Symbol(),
-	}
-
-	// Execute cancel order
-	_, err := book.Cancel(req)
-	if err != nil {
-		// During replay, order might already be filled/canceled
-		// This is expected, so we can ignore certain errors
-		errMsg := strings.ToLower(err.Error())
-		if strings.Contains(errMsg, "not found") ||
-			strings.Contains(errMsg, "already") {
-			return nil
-		}
-		return err
-	}
-	return nil
-}
-
 // checkAndCreateSnapshot checks if snapshot should be created and creates it.
 func (s *Shard) checkAndCreateSnapshot(symbol string, persistedEvents int, lastPersistedSeq int64) {
 	if s.snapshotStore == nil {
@@ -0,0 +1,83 @@
+package engine
+
+import (
+	"fmt"
+
+	"matching-engine/internal/matching"
+	"matching-engine/internal/symbolspec"
+)
+
+// applySpec sets a book's price bands, order limits and allocation policy from the symbol's current spec
+func applySpec(book *matching.OrderBook, symbol string) {
+	book.SetPriceBands(priceBands(symbol))
+	spec, _ := symbolspec.Get(symbol)
+	book.SetOrderLimits(spec)
+	book.SetAllocation(matching.NewAllocationPolicy(spec))
+}
+
+// executeSetSymbolSpec creates a symbol or changes its spec.
+// The change is persisted as a SymbolSpecChanged event before it takes effect, so recovery
+// replays every order against the spec in force when it was placed. Changes that would
+// strand a resting order off the new tick or step are rejected with SPEC_CONFLICT.
+func (s *Shard) executeSetSymbolSpec(envelope *CommandEnvelope) *CommandExecResult {
+	spec, ok := envelope.Payload.(*symbolspec.Spec)
+	if !ok {
+		return &CommandExecResult{
+			Result:    nil,
+			ErrorCode: ErrorCodeInvalidArgument,
+			Err:       fmt.Errorf("invalid payload type for SET_SYMBOL_SPEC command"),
+		}
+	}
+	if err := spec.Validate(); err != nil {
+		return &CommandExecResult{
+			Result:    nil,
+			ErrorCode: ErrorCodeInvalidArgument,
+			Err:       err,
+		}
+	}
+	if spec.Symbol != envelope.Symbol {
+		return &CommandExecResult{
+			Result:    nil,
+			ErrorCode: ErrorCodeInvalidArgument,
+			Err:       fmt.Errorf("symbol mismatch: spec %s, command %s", spec.Symbol, envelope.Symbol),
+		}
+	}
+
+	// A new symbol gets its book with its first spec
+	book, exists := s.books[envelope.Symbol]
+	if !exists {
+		book = s.newBook(envelope.Symbol)
+		s.books[envelope.Symbol] = book
+	}
+
+	previous, _ := symbolspec.Get(envelope.Symbol)
+	result, err := book.ChangeSpec(previous, *spec)
+	if err != nil {
+		return &CommandExecResult{
+			Result:    nil,
+			ErrorCode: s.mapErrorCode(err),
+			Err:       err,
+		}
+	}
+	if err := s.persistEvents(envelope.Symbol, result.Events); err != nil {
+		return &CommandExecResult{
+			Result:    nil,
+			ErrorCode: ErrorCodeInternalError,
+			Err:       fmt.Errorf("failed to persist event: %w", err),
+		}
+	}
+	if err := symbolspec.Put(*spec); err != nil {
+		return &CommandExecResult{
+			Result:    nil,
+			ErrorCode: ErrorCodeInternalError,
+			Err:       fmt.Errorf("failed to register spec: %w", err),
+		}
+	}
+	applySpec(book, envelope.Symbol)
+
+	return &CommandExecResult{
+		Result:    result,
+		ErrorCode: ErrorCodeNone,
+		Err:       nil,
+	}
+}
@@ -0,0 +1,78 @@
+package engine
+
+import (
+	"fmt"
+
+	"matching-engine/internal/matching"
+)
+
+// statusRejection returns the result of a command the symbol's trading status blocks, or nil.
+// HALTED blocks every order command and CANCEL_ONLY blocks places.
+// PRE_OPEN accepts places, which rest for the call auction.
+// Symbols without a book are TRADING.
+func (s *Shard) statusRejection(symbol string, commandType CommandType) *CommandExecResult {
+	book, exists := s.books[symbol]
+	if !exists {
+		return nil
+	}
+
+	status := book.Status()
+	var code ErrorCode
+	switch {
+	case status == matching.SymbolStatusHalted:
+		code = ErrorCodeSymbolHalted
+	case status == matching.SymbolStatusCancelOnly && commandType == CommandTypePlace:
+		code = ErrorCodeSymbolCancelOnly
+	default:
+		return nil
+	}
+	return &CommandExecResult{
+		Result:    nil,
+		ErrorCode: code,
+		Err:       fmt.Errorf("%s is %s, %s commands are not accepted", symbol, status, commandType),
+	}
+}
+
+// executeSetSymbolStatus moves a symbol to another trading status.
+// Any status can follow any other; the change is persisted as a SymbolStatusChanged event,
+// so replay restores the status along with the book. Leaving PRE_OPEN for TRADING or
+// CANCEL_ONLY uncrosses the auction, and its trades are part of the result.
+func (s *Shard) executeSetSymbolStatus(envelope *CommandEnvelope) *CommandExecResult {
+	req, ok := envelope.Payload.(*matching.SetSymbolStatusRequest)
+	if !ok {
+		return &CommandExecResult{
+			Result:    nil,
+			ErrorCode: ErrorCodeInvalidArgument,
+			Err:       fmt.Errorf("invalid payload type for SET_SYMBOL_STATUS command"),
+		}
+	}
+
+	// A symbol can be halted before its first order
+	book, exists := s.books[envelope.Symbol]
+	if !exists {
+		book = s.newBook(envelope.Symbol)
+		s.books[envelope.Symbol] = book
+	}
+
+	result, err := book.SetStatus(req)
+	if err != nil {
+		return &CommandExecResult{
+			Result:    nil,
+			ErrorCode: ErrorCodeInvalidArgument,
+			Err:       err,
+		}
+	}
+	if err := s.persistEvents(envelope.Symbol, result.Events); err != nil {
+		return &CommandExecResult{
+			Result:    nil,
+			ErrorCode: ErrorCodeInternalError,
+			Err:       fmt.Errorf("failed to persist event: %w", err),
+		}
+	}
+
+	return &CommandExecResult{
+		Result:    result,
+		ErrorCode: ErrorCodeNone,
+		Err:       nil,
+	}
+}
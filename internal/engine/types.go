@@ -1,6 +1,8 @@
 package engine
 
 import (
+	"errors"
+	"fmt"
 	"time"
 )
 
@@ -8,20 +10,35 @@ import (
 type CommandType string
 
 const (
-	CommandTypePlace  CommandType = "PLACE"
-	CommandTypeCancel CommandType = "CANCEL"
-	CommandTypeQuery  CommandType = "QUERY"
+	CommandTypePlace           CommandType = "PLACE"
+	CommandTypeCancel          CommandType = "CANCEL"
+	CommandTypeMassCancel      CommandType = "MASS_CANCEL"
+	CommandTypeSetSymbolStatus CommandType = "SET_SYMBOL_STATUS" // Admin: halt, resume, cancel-only, pre-open
+	CommandTypeSetSymbolSpec   CommandType = "SET_SYMBOL_SPEC"   // Admin: create or update a symbol's spec
+	CommandTypeQuery           CommandType = "QUERY"
+	CommandTypeDepth           CommandType = "DEPTH"
 )
 
+// isReadOnly reports whether the command only reads book state
+func (t CommandType) isReadOnly() bool {
+	return t == CommandTypeQuery || t == CommandTypeDepth
+}
+
+// isUrgent reports whether the command is admitted past the high-water mark: cancels shrink
+// the backlog, and status changes are how operators respond to an incident
+func (t CommandType) isUrgent() bool {
+	return t == CommandTypeCancel || t == CommandTypeMassCancel || t == CommandTypeSetSymbolStatus
+}
+
 // CommandEnvelope wraps a command with metadata
 type CommandEnvelope struct {
 	CommandID      string      // Unique command ID
 	CommandType    CommandType // PLACE / CANCEL
 	IdempotencyKey string      // Idempotency key for deduplication
-	Symbol         string      // Trading symbol
+	Symbol         string      // Trading symbol; empty for a mass cancel across every symbol
 	AccountID      string      // Account ID
 	PayloadHash    string      // Hash of payload for conflict detection
-	Payload        any         // Actual command payload (PlaceOrderRequest or CancelOrderRequest)
+	Payload        any         // Actual command payload (PlaceOrderRequest, CancelOrderRequest or MassCancelRequest)
 	CreatedAt      time.Time   // Command creation time
 }
 
@@ -37,11 +54,57 @@ const (
 	ErrorCodeOrderAlreadyFilled   ErrorCode = "ORDER_ALREADY_FILLED"
 	ErrorCodeOrderAlreadyCanceled ErrorCode = "ORDER_ALREADY_CANCELED"
 	ErrorCodeUnauthorized         ErrorCode = "UNAUTHORIZED"
+	ErrorCodeReadOnly             ErrorCode = "READ_ONLY"
+	ErrorCodeTimeout              ErrorCode = "TIMEOUT"
+	ErrorCodeOverloaded           ErrorCode = "OVERLOADED"
+	ErrorCodeBatchAborted         ErrorCode = "BATCH_ABORTED"
+	ErrorCodeSymbolHalted         ErrorCode = "SYMBOL_HALTED"
+	ErrorCodeSymbolCancelOnly     ErrorCode = "SYMBOL_CANCEL_ONLY"
+	ErrorCodePriceOutOfBand       ErrorCode = "PRICE_OUT_OF_BAND"
+	ErrorCodeSpecConflict         ErrorCode = "SPEC_CONFLICT"
+	ErrorCodePriceTooLow          ErrorCode = "PRICE_TOO_LOW"
+	ErrorCodePriceTooHigh         ErrorCode = "PRICE_TOO_HIGH"
+	ErrorCodeQtyTooSmall          ErrorCode = "QTY_TOO_SMALL"
+	ErrorCodeQtyTooLarge          ErrorCode = "QTY_TOO_LARGE"
+	ErrorCodeMinNotional          ErrorCode = "MIN_NOTIONAL"
 )
 
+// ErrCommandNotQueued marks a timeout that hit before the command entered a shard queue.
+// Such a command was not executed. A timeout without it came while waiting for the result:
+// the command may still execute, and retrying with the same idempotency key returns its outcome.
+var ErrCommandNotQueued = errors.New("command not queued")
+
+// OverloadError reports a command shed by a shard's admission control; the command was not executed
+type OverloadError struct {
+	ShardID  int
+	Depth    int  // Queue depth when the command was shed
+	Capacity int  // Queue capacity
+	Full     bool // No room at all; otherwise a non-cancel command hit the high-water mark
+}
+
+func (e *OverloadError) Error() string {
+	if e.Full {
+		return fmt.Sprintf("shard %d queue is full (%d/%d)", e.ShardID, e.Depth, e.Capacity)
+	}
+	return fmt.Sprintf("shard %d is overloaded (%d/%d queued), only cancels are accepted", e.ShardID, e.Depth, e.Capacity)
+}
+
+// QueueStats is the command queue state of one shard
+type QueueStats struct {
+	ShardID   int `json:"shard_id"`
+	Depth     int `json:"depth"`
+	HighWater int `json:"high_water"` // Depth at which non-cancel commands are shed
+	Capacity  int `json:"capacity"`
+}
+
+// SheddingPlaces reports whether the shard currently sheds non-cancel commands
+func (s QueueStats) SheddingPlaces() bool {
+	return s.Capacity > 0 && s.Depth >= s.HighWater
+}
+
 // CommandExecResult represents the result of command execution
 type CommandExecResult struct {
-	Result    any       // Matching engine result (CommandResult for place/cancel, OrderSnapshot for query)
+	Result    any       // Matching engine result (CommandResult for place/cancel/mass cancel, OrderSnapshot for query, BookDepth for depth)
 	ErrorCode ErrorCode // Error code if execution failed
 	Err       error     // Detailed error message
 }
@@ -0,0 +1,156 @@
+package matching
+
+import (
+	"math/bits"
+
+	"matching-engine/internal/symbolspec"
+)
+
+// AllocationPolicy decides how an incoming order's quantity is split across the orders resting
+// at a price level. Every split is deterministic: shares round down to whole lots, and the
+// remainder goes a lot at a time to the orders in time priority, so replay reproduces each trade.
+type AllocationPolicy struct {
+	Algorithm    symbolspec.Allocation `json:"algorithm,omitempty"`      // Empty means FIFO
+	Lot          int64                 `json:"lot,omitempty"`            // Shares are whole multiples of it; 0 or 1 for single units
+	LMMAccountID string                `json:"lmm_account_id,omitempty"` // Lead market maker of the LMM algorithm
+	LMMShareBps  int64                 `json:"lmm_share_bps,omitempty"`  // Share of each level fill the lead market maker gets first
+}
+
+// NewAllocationPolicy returns the allocation policy configured in a symbol's spec
+func NewAllocationPolicy(spec symbolspec.Spec) AllocationPolicy {
+	if spec.Allocation == "" || spec.Allocation == symbolspec.AllocationFIFO {
+		return AllocationPolicy{}
+	}
+	return AllocationPolicy{
+		Algorithm:    spec.Allocation,
+		Lot:          spec.QtyStepInt,
+		LMMAccountID: spec.LMMAccountID,
+		LMMShareBps:  spec.LMMShareBps,
+	}
+}
+
+// SetAllocation sets the book's allocation policy
+func (ob *OrderBook) SetAllocation(policy AllocationPolicy) {
+	ob.allocation = policy
+}
+
+// Allocation returns the book's allocation policy
+func (ob *OrderBook) Allocation() AllocationPolicy {
+	return ob.allocation
+}
+
+// levelFill is the quantity one resting order trades against the incoming order
+type levelFill struct {
+	order *Order
+	qty   int64
+}
+
+// allocate splits up to qty across the orders of a level and returns the fills in time priority
+func (p AllocationPolicy) allocate(level *PriceLevel, qty int64) []levelFill {
+	switch p.Algorithm {
+	case symbolspec.AllocationProRata, symbolspec.AllocationProRataTopOrder, symbolspec.AllocationLeadMarketMaker:
+		return p.allocateProRata(level, qty)
+	default:
+		return fifo(level, qty)
+	}
+}
+
+// allocateProRata splits qty with one of the pro-rata algorithms, which weigh every order of the level
+func (p AllocationPolicy) allocateProRata(level *PriceLevel, qty int64) []levelFill {
+	orders := make([]*Order, 0, level.Queue.Len())
+	var volume int64
+	for element := level.Queue.Front(); element != nil; element = element.Next() {
+		order := element.Value.(*Order)
+		orders = append(orders, order)
+		volume += order.RemainingQty
+	}
+	qty = min(qty, volume)
+
+	lot := max(p.Lot, 1)
+	shares := make([]int64, len(orders))
+	switch p.Algorithm {
+	case symbolspec.AllocationProRata:
+		proRata(orders, shares, qty, lot)
+	case symbolspec.AllocationProRataTopOrder:
+		if len(orders) > 0 {
+			// The top order takes whole lots; what the others can't take goes back to it
+			shares[0] = min(orders[0].RemainingQty, qty) / lot * lot
+			rest := qty - shares[0]
+			others := min(rest, volume-orders[0].RemainingQty)
+			proRata(orders[1:], shares[1:], others, lot)
+			shares[0] += rest - others
+		}
+	case symbolspec.AllocationLeadMarketMaker:
+		hi, lo := bits.Mul64(uint64(qty), uint64(p.LMMShareBps))
+		lmmQty, _ := bits.Div64(hi, lo, 10000)
+		remaining := int64(lmmQty) / lot * lot
+		allocated := int64(0)
+		for i, order := range orders {
+			if order.AccountID == p.LMMAccountID && remaining > 0 {
+				shares[i] = min(order.RemainingQty, remaining)
+				remaining -= shares[i]
+				allocated += shares[i]
+			}
+		}
+		proRata(orders, shares, qty-allocated, lot)
+	}
+
+	fills := make([]levelFill, 0, len(orders))
+	for i, order := range orders {
+		if shares[i] > 0 {
+			fills = append(fills, levelFill{order: order, qty: shares[i]})
+		}
+	}
+	return fills
+}
+
+// fifo fills the orders of a level in time priority, walking only as far as qty reaches
+func fifo(level *PriceLevel, qty int64) []levelFill {
+	var fills []levelFill
+	for element := level.Queue.Front(); element != nil && qty > 0; element = element.Next() {
+		order := element.Value.(*Order)
+		share := min(order.RemainingQty, qty)
+		if share > 0 {
+			fills = append(fills, levelFill{order: order, qty: share})
+			qty -= share
+		}
+	}
+	return fills
+}
+
+// proRata adds to each order's share a part of qty proportional to the quantity it has left
+// after its current share, rounded down to whole lots. The remainder goes a lot at a time to
+// the orders in time priority. qty must not exceed what the orders have left.
+func proRata(orders []*Order, shares []int64, qty, lot int64) {
+	if qty <= 0 {
+		return
+	}
+	var volume int64
+	for i, order := range orders {
+		volume += order.RemainingQty - shares[i]
+	}
+	if volume == 0 {
+		return
+	}
+
+	// lots × available / volume never exceeds available, so the 128-bit quotient fits
+	lots := uint64(qty / lot)
+	allocated := int64(0)
+	for i, order := range orders {
+		hi, lo := bits.Mul64(lots, uint64(order.RemainingQty-shares[i]))
+		share, _ := bits.Div64(hi, lo, uint64(volume))
+		shares[i] += int64(share) * lot
+		allocated += int64(share) * lot
+	}
+
+	for leftover := qty - allocated; leftover > 0; {
+		for i, order := range orders {
+			if leftover == 0 {
+				break
+			}
+			share := min(lot, leftover, order.RemainingQty-shares[i])
+			shares[i] += share
+			leftover -= share
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package matching
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"matching-engine/internal/symbolspec"
+)
+
+// maker is a resting sell order of a test
+type maker struct {
+	orderID, accountID string
+	qty                int64
+}
+
+// restAsks places sell orders at one price, in order
+func restAsks(t *testing.T, ob *OrderBook, price int64, makers ...maker) {
+	t.Helper()
+	for _, m := range makers {
+		mustPlaceLimit(t, ob, &PlaceOrderRequest{
+			OrderID: m.orderID, ClientOrderID: "c_" + m.orderID, AccountID: m.accountID,
+			Symbol: ob.Symbol, Side: SideSell, PriceInt: price, QuantityInt: m.qty,
+		})
+	}
+}
+
+// fillsOf returns the maker order ID and quantity of each trade, in the order they happened
+func fillsOf(result *CommandResult) []string {
+	fills := make([]string, 0, len(result.Trades))
+	for _, trade := range result.Trades {
+		fills = append(fills, fmt.Sprintf("%s:%d", trade.MakerOrderID, trade.Quantity))
+	}
+	return fills
+}
+
+func TestAllocation_SplitsALevelPerAlgorithm(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		spec   symbolspec.Spec
+		makers []maker
+		taker  int64
+		want   []string
+	}{
+		{
+			name:   "FIFO fills in time priority",
+			spec:   symbolspec.Spec{},
+			makers: []maker{{"a", "acc1", 100}, {"b", "acc2", 200}},
+			taker:  150,
+			want:   []string{"a:100", "b:50"},
+		},
+		{
+			// 100/600, 200/600 and 300/600 of 100 round down to 16, 33 and 50; the 1 left goes to a
+			name:   "pro-rata hands the remainder out in time priority",
+			spec:   symbolspec.Spec{Allocation: symbolspec.AllocationProRata, QtyStepInt: 1},
+			makers: []maker{{"a", "acc1", 100}, {"b", "acc2", 200}, {"c", "acc3", 300}},
+			taker:  100,
+			want:   []string{"a:17", "b:33", "c:50"},
+		},
+		{
+			// 10 lots split 1, 3 and 5; the lot left goes to a
+			name:   "pro-rata rounds to whole lots",
+			spec:   symbolspec.Spec{Allocation: symbolspec.AllocationProRata, QtyStepInt: 10},
+			makers: []maker{{"a", "acc1", 100}, {"b", "acc2", 200}, {"c", "acc3", 300}},
+			taker:  100,
+			want:   []string{"a:20", "b:30", "c:50"},
+		},
+		{
+			name:   "pro-rata skips orders without a share",
+			spec:   symbolspec.Spec{Allocation: symbolspec.AllocationProRata, QtyStepInt: 1},
+			makers: []maker{{"a", "acc1", 1}, {"b", "acc2", 1}, {"c", "acc3", 98}},
+			taker:  10,
+			want:   []string{"a:1", "c:9"},
+		},
+		{
+			// a is filled first; 150 split pro-rata over 200 and 300
+			name:   "top order is filled before the pro-rata split",
+			spec:   symbolspec.Spec{Allocation: symbolspec.AllocationProRataTopOrder, QtyStepInt: 1},
+			makers: []maker{{"a", "acc1", 100}, {"b", "acc2", 200}, {"c", "acc3", 300}},
+			taker:  250,
+			want:   []string{"a:100", "b:60", "c:90"},
+		},
+		{
+			// a takes 100 of its 105, and 10 lots are split 4 and 6
+			name:   "top order is filled in whole lots",
+			spec:   symbolspec.Spec{Allocation: symbolspec.AllocationProRataTopOrder, QtyStepInt: 10},
+			makers: []maker{{"a", "acc1", 105}, {"b", "acc2", 200}, {"c", "acc3", 300}},
+			taker:  200,
+			want:   []string{"a:100", "b:40", "c:60"},
+		},
+		{
+			// b can take only 10 of the 15 left after a's whole lots, so a takes the rest
+			name:   "top order takes what the pro-rata split can't",
+			spec:   symbolspec.Spec{Allocation: symbolspec.AllocationProRataTopOrder, QtyStepInt: 10},
+			makers: []maker{{"a", "acc1", 105}, {"b", "acc2", 10}},
+			taker:  115,
+			want:   []string{"a:105", "b:10"},
+		},
+		{
+			// The market maker gets 40% of 100 first; 60 is split over the 100, 160 and 300 left
+			name: "lead market maker takes its share before the pro-rata split",
+			spec: symbolspec.Spec{
+				Allocation: symbolspec.AllocationLeadMarketMaker, QtyStepInt: 1, LMMAccountID: "lmm", LMMShareBps: 4000,
+			},
+			makers: []maker{{"a", "acc1", 100}, {"m", "lmm", 200}, {"c", "acc3", 300}},
+			taker:  100,
+			want:   []string{"a:11", "m:57", "c:32"},
+		},
+		{
+			name: "lead market maker share spans its orders in time priority",
+			spec: symbolspec.Spec{
+				Allocation: symbolspec.AllocationLeadMarketMaker, QtyStepInt: 1, LMMAccountID: "lmm", LMMShareBps: 10000,
+			},
+			makers: []maker{{"a", "acc1", 100}, {"m1", "lmm", 30}, {"m2", "lmm", 50}},
+			taker:  60,
+			want:   []string{"m1:30", "m2:30"},
+		},
+		{
+			name:   "a taker larger than the level takes all of it",
+			spec:   symbolspec.Spec{Allocation: symbolspec.AllocationProRata, QtyStepInt: 1},
+			makers: []maker{{"a", "acc1", 100}, {"b", "acc2", 200}},
+			taker:  500,
+			want:   []string{"a:100", "b:200"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ob := NewOrderBook("BTC-USDT")
+			ob.SetAllocation(NewAllocationPolicy(tc.spec))
+			restAsks(t, ob, 43000, tc.makers...)
+
+			result := mustPlaceLimit(t, ob, &PlaceOrderRequest{
+				OrderID: "taker", ClientOrderID: "c_taker", AccountID: "acc9", Symbol: "BTC-USDT",
+				Side: SideBuy, PriceInt: 43000, QuantityInt: tc.taker,
+			})
+			if got := fillsOf(result); !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("expected fills %v, got %v", tc.want, got)
+			}
+
+			// The level's volume matches the orders left on it
+			var resting int64
+			for _, order := range ob.Orders {
+				if order.Side == SideSell {
+					resting += order.RemainingQty
+				}
+			}
+			level := ob.AskLevels[43000]
+			if resting == 0 && level != nil || resting > 0 && (level == nil || level.Volume != resting) {
+				t.Fatalf("expected the level to hold %d, got %+v", resting, level)
+			}
+		})
+	}
+}
+
+func TestAllocation_SweepsLevelsInPriceOrder(t *testing.T) {
+	ob := NewOrderBook("BTC-USDT")
+	ob.SetAllocation(NewAllocationPolicy(symbolspec.Spec{Allocation: symbolspec.AllocationProRata, QtyStepInt: 1}))
+	restAsks(t, ob, 43000, maker{"a", "acc1", 7}, maker{"b", "acc2", 7}, maker{"c", "acc3", 7})
+	restAsks(t, ob, 43001, maker{"d", "acc1", 5}, maker{"e", "acc2", 10})
+
+	// 21 clears the first level, and 4 is split over 5 and 10 at the next
+	result := mustPlaceLimit(t, ob, &PlaceOrderRequest{
+		OrderID: "taker", ClientOrderID: "c_taker", AccountID: "acc9", Symbol: "BTC-USDT",
+		Side: SideBuy, PriceInt: 43001, QuantityInt: 25,
+	})
+	if got, want := fillsOf(result), []string{"a:7", "b:7", "c:7", "d:2", "e:2"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected fills %v, got %v", want, got)
+	}
+	if _, ok := ob.AskLevels[43000]; ok || ob.AskLevels[43001].Volume != 11 {
+		t.Fatalf("expected the first level gone and 11 left at the next")
+	}
+}
+
+func TestAllocation_CarriedByTheBookState(t *testing.T) {
+	ob := NewOrderBook("BTC-USDT")
+	policy := NewAllocationPolicy(symbolspec.Spec{
+		Allocation: symbolspec.AllocationLeadMarketMaker, QtyStepInt: 5, LMMAccountID: "lmm", LMMShareBps: 2500,
+	})
+	ob.SetAllocation(policy)
+
+	restored := NewOrderBook("BTC-USDT")
+	if err := restored.ImportState(ob.ExportState()); err != nil {
+		t.Fatalf("ImportState failed: %v", err)
+	}
+	if restored.Allocation() != policy {
+		t.Fatalf("expected %+v after import, got %+v", policy, restored.Allocation())
+	}
+	if NewAllocationPolicy(symbolspec.Spec{Allocation: symbolspec.AllocationFIFO, QtyStepInt: 5}) != (AllocationPolicy{}) {
+		t.Fatalf("expected FIFO to be the zero policy")
+	}
+}
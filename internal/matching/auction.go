@@ -0,0 +1,167 @@
+package matching
+
+import (
+	"sort"
+	"time"
+)
+
+// AuctionIndicative is what an uncross of the book would execute right now
+type AuctionIndicative struct {
+	Price     int64 // Equilibrium price, or 0 if the book does not cross
+	Volume    int64 // Quantity that would execute at Price
+	Imbalance int64 // Unmatched quantity at Price: positive for surplus bids, negative for surplus asks
+}
+
+// IndicativeAuction computes the equilibrium price and volume of the resting orders.
+// The price maximizes executed volume; ties go to the smallest imbalance, then to market
+// pressure (the highest price when every tied price has surplus bids, the lowest when every
+// one has surplus asks), then to the price closest to the last trade price, then the lowest.
+func (ob *OrderBook) IndicativeAuction() AuctionIndicative {
+	prices := make([]int64, 0, len(ob.BidLevels)+len(ob.AskLevels))
+	for price := range ob.BidLevels {
+		prices = append(prices, price)
+	}
+	for price := range ob.AskLevels {
+		if _, ok := ob.BidLevels[price]; !ok {
+			prices = append(prices, price)
+		}
+	}
+	sort.Slice(prices, func(i, j int) bool { return prices[i] < prices[j] })
+
+	// Bids at or above each price, accumulated from the top
+	buyVolume := make([]int64, len(prices))
+	var cumulative int64
+	for i := len(prices) - 1; i >= 0; i-- {
+		if level := ob.BidLevels[prices[i]]; level != nil {
+			cumulative += level.Volume
+		}
+		buyVolume[i] = cumulative
+	}
+
+	var candidates []AuctionIndicative
+	cumulative = 0
+	for i, price := range prices {
+		if level := ob.AskLevels[price]; level != nil {
+			cumulative += level.Volume
+		}
+		volume := min(buyVolume[i], cumulative)
+		if volume == 0 {
+			continue
+		}
+		candidate := AuctionIndicative{Price: price, Volume: volume, Imbalance: buyVolume[i] - cumulative}
+		if len(candidates) > 0 {
+			best := candidates[0]
+			if volume < best.Volume || (volume == best.Volume && abs64(candidate.Imbalance) > abs64(best.Imbalance)) {
+				continue
+			}
+			if volume > best.Volume || abs64(candidate.Imbalance) < abs64(best.Imbalance) {
+				candidates = candidates[:0]
+			}
+		}
+		candidates = append(candidates, candidate)
+	}
+	if len(candidates) == 0 {
+		return AuctionIndicative{}
+	}
+
+	// Candidates are in ascending price order
+	allBuySurplus, allSellSurplus := true, true
+	for _, candidate := range candidates {
+		allBuySurplus = allBuySurplus && candidate.Imbalance > 0
+		allSellSurplus = allSellSurplus && candidate.Imbalance < 0
+	}
+	switch {
+	case allBuySurplus:
+		return candidates[len(candidates)-1]
+	case allSellSurplus || ob.lastPrice == 0:
+		return candidates[0]
+	}
+	best := candidates[0]
+	for _, candidate := range candidates[1:] {
+		if abs64(candidate.Price-ob.lastPrice) < abs64(best.Price-ob.lastPrice) {
+			best = candidate
+		}
+	}
+	return best
+}
+
+// uncross executes every crossing order at the equilibrium price.
+// Bids and asks each fill in price priority, then acceptance order, and the earlier-accepted
+// order of each pair is the maker.
+func (ob *OrderBook) uncross(now time.Time, result *CommandResult) {
+	auction := ob.IndicativeAuction()
+	if auction.Volume == 0 {
+		return
+	}
+
+	bids := auctionOrders(ob.BidLevels, func(price int64) bool { return price >= auction.Price }, true)
+	asks := auctionOrders(ob.AskLevels, func(price int64) bool { return price <= auction.Price }, false)
+	for len(bids) > 0 && len(asks) > 0 {
+		bid, ask := bids[0], asks[0]
+		// An earlier fill canceled it with its group
+		if bid.Status == OrderStatusCanceled {
+			bids = bids[1:]
+			continue
+		}
+		if ask.Status == OrderStatusCanceled {
+			asks = asks[1:]
+			continue
+		}
+		maker, taker := bid, ask
+		if ask.AcceptedSeq < bid.AcceptedSeq {
+			maker, taker = ask, bid
+		}
+
+		matchQty := ob.executeMatch(maker, taker, auction.Price, now, result)
+		for _, order := range []*Order{bid, ask} {
+			level := ob.getPriceLevel(order.Side, order.Price)
+			level.Volume -= matchQty
+			if level.Volume < 0 {
+				level.Volume = 0
+			}
+			if order.RemainingQty == 0 {
+				level.RemoveOrder(order)
+				delete(ob.Orders, order.OrderID)
+				ob.closedOrders[order.OrderID] = ob.buildOrderSnapshot(order)
+				ob.removePriceLevelIfEmpty(order.Side, order.Price)
+			}
+		}
+		if bid.RemainingQty == 0 {
+			bids = bids[1:]
+		}
+		if ask.RemainingQty == 0 {
+			asks = asks[1:]
+		}
+	}
+}
+
+// auctionOrders returns the orders of the levels whose price is eligible, best price first and FIFO within a level
+func auctionOrders(levels map[int64]*PriceLevel, eligible func(price int64) bool, descending bool) []*Order {
+	prices := make([]int64, 0, len(levels))
+	for price := range levels {
+		if eligible(price) {
+			prices = append(prices, price)
+		}
+	}
+	sort.Slice(prices, func(i, j int) bool {
+		if descending {
+			return prices[i] > prices[j]
+		}
+		return prices[i] < prices[j]
+	})
+
+	var orders []*Order
+	for _, price := range prices {
+		for element := levels[price].Queue.Front(); element != nil; element = element.Next() {
+			orders = append(orders, element.Value.(*Order))
+		}
+	}
+	return orders
+}
+
+func abs64(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,38 @@
+package matching
+
+import "time"
+
+// Clock supplies the timestamps an order book puts on orders, trades and events
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock reads the wall clock
+type SystemClock struct{}
+
+// Now returns the current time
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// FixedClock returns the time it was last set to.
+// The engine sets it to each command's timestamp and replay to each event's OccurredAt,
+// so a replayed book carries the same timestamps as the live one.
+type FixedClock struct {
+	now time.Time
+}
+
+// NewFixedClock creates a clock set to now
+func NewFixedClock(now time.Time) *FixedClock {
+	return &FixedClock{now: now}
+}
+
+// Set sets the time the clock returns
+func (c *FixedClock) Set(now time.Time) {
+	c.now = now
+}
+
+// Now returns the time the clock was last set to
+func (c *FixedClock) Now() time.Time {
+	return c.now
+}
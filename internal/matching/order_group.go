@@ -0,0 +1,116 @@
+package matching
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// groupKey identifies an order group; group IDs are scoped to the account that placed the legs
+type groupKey struct {
+	accountID string
+	groupID   string
+}
+
+// orderGroup is a one-cancels-other group: the first fill or cancel of a leg cancels the others
+type orderGroup struct {
+	side   Side     // Every leg is on the same side, so the legs can share one freeze
+	legs   []string // Live legs in acceptance order
+	closed bool     // A leg filled or was canceled; legs placed later are canceled on arrival
+}
+
+// checkGroup rejects an order that can't join its group
+func (ob *OrderBook) checkGroup(req *PlaceOrderRequest) error {
+	if req.GroupID == "" {
+		return nil
+	}
+	group, exists := ob.groups[groupKey{accountID: req.AccountID, groupID: req.GroupID}]
+	if exists && group.side != req.Side {
+		return fmt.Errorf("group mismatch: group %s holds %s orders", req.GroupID, group.side)
+	}
+	return nil
+}
+
+// joinGroup adds an accepted order to its group and reports whether the group is still open
+func (ob *OrderBook) joinGroup(order *Order) bool {
+	if order.GroupID == "" {
+		return true
+	}
+	key := groupKey{accountID: order.AccountID, groupID: order.GroupID}
+	group, exists := ob.groups[key]
+	if !exists {
+		group = &orderGroup{side: order.Side}
+		ob.groups[key] = group
+	}
+	if group.closed {
+		return false
+	}
+	group.legs = append(group.legs, order.OrderID)
+	return true
+}
+
+// closeGroup closes the group of an order that filled or was canceled and cancels its other
+// live legs, oldest first, in the same command
+func (ob *OrderBook) closeGroup(order *Order, now time.Time, result *CommandResult) {
+	if order.GroupID == "" {
+		return
+	}
+	group := ob.groups[groupKey{accountID: order.AccountID, groupID: order.GroupID}]
+	if group == nil || group.closed {
+		return
+	}
+	group.closed = true
+	legs := group.legs
+	group.legs = nil
+	for _, orderID := range legs {
+		if leg, live := ob.Orders[orderID]; live && orderID != order.OrderID {
+			ob.cancelOrder(leg, CancelReasonOCO, now, result)
+		}
+	}
+}
+
+// rebuildGroups derives the order groups of an imported book. A group is closed once a leg
+// has left the book or traded.
+func (ob *OrderBook) rebuildGroups() {
+	ob.groups = make(map[groupKey]*orderGroup)
+	group := func(accountID, groupID string, side Side) *orderGroup {
+		key := groupKey{accountID: accountID, groupID: groupID}
+		g, exists := ob.groups[key]
+		if !exists {
+			g = &orderGroup{side: side}
+			ob.groups[key] = g
+		}
+		return g
+	}
+
+	for _, snap := range ob.closedOrders {
+		if snap != nil && snap.GroupID != "" {
+			group(snap.AccountID, snap.GroupID, snap.Side).closed = true
+		}
+	}
+
+	legs := make([]*Order, 0)
+	for _, order := range ob.Orders {
+		if order.GroupID != "" {
+			legs = append(legs, order)
+		}
+	}
+	sort.Slice(legs, func(i, j int) bool {
+		if legs[i].AcceptedSeq != legs[j].AcceptedSeq {
+			return legs[i].AcceptedSeq < legs[j].AcceptedSeq
+		}
+		return legs[i].OrderID < legs[j].OrderID
+	})
+	for _, order := range legs {
+		g := group(order.AccountID, order.GroupID, order.Side)
+		if order.RemainingQty < order.Quantity {
+			g.closed = true
+		}
+		g.legs = append(g.legs, order.OrderID)
+	}
+	for _, g := range ob.groups {
+		if g.closed {
+			g.legs = nil
+		}
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"sort"
 	"time"
+
+	"matching-engine/internal/symbolspec"
 )
 
 // Order represents an order in the order book
@@ -19,6 +21,9 @@ type Order struct {
 	RemainingQty  int64
 	Status        OrderStatus
 	CreatedAt     time.Time
+	AcceptedSeq   int64         // Sequence of the OrderAccepted event; orders at a price queue by it
+	APIKeyID      string        // ID of the API key the order was placed with, if any
+	GroupID       string        // One-cancels-other group of the order, if any
 	element       *list.Element // Reference to position in price level queue
 }
 
@@ -67,6 +72,13 @@ type OrderBook struct {
 	closedOrders map[string]*OrderSnapshot // closed order_id -> terminal snapshot
 	eventSeq     int64                     // Event sequence number
 	tradeSeq     int64                     // Trade identifier sequence
+	clock        Clock                     // Timestamps orders, trades and events
+	status       SymbolStatus              // Trading status; the shard decides which commands it allows
+	lastPrice    int64                     // Last trade price, the auction and price band reference
+	bands        PriceBands                // Price protection; zero value disables it
+	limits       symbolspec.Spec           // Order limits checked on place; zero value disables them
+	allocation   AllocationPolicy          // How fills split across a price level; zero value is FIFO
+	groups       map[groupKey]*orderGroup  // One-cancels-other groups by account and group ID
 }
 
 // NewOrderBook creates a new order book
@@ -77,9 +89,25 @@ func NewOrderBook(symbol string) *OrderBook {
 		AskLevels:    make(map[int64]*PriceLevel),
 		Orders:       make(map[string]*Order),
 		closedOrders: make(map[string]*OrderSnapshot),
+		groups:       make(map[groupKey]*orderGroup),
 		eventSeq:     0,
 		tradeSeq:     0,
+		clock:        SystemClock{},
+		status:       SymbolStatusTrading,
+	}
+}
+
+// SetClock sets the clock the book reads command timestamps from; nil restores the wall clock
+func (ob *OrderBook) SetClock(clock Clock) {
+	if clock == nil {
+		clock = SystemClock{}
 	}
+	ob.clock = clock
+}
+
+// Clock returns the clock the book reads command timestamps from
+func (ob *OrderBook) Clock() Clock {
+	return ob.clock
 }
 
 func (ob *OrderBook) nextEventSequence() int64 {
@@ -157,7 +185,7 @@ func (ob *OrderBook) PlaceLimit(req *PlaceOrderRequest) (*CommandResult, error)
 	if req == nil {
 		return nil, fmt.Errorf("request is nil")
 	}
-	if err := req.Validate(); err != nil {
+	if err := req.ValidateLimits(ob.limits); err != nil {
 		return nil, err
 	}
 	if req.Symbol != ob.Symbol {
@@ -169,6 +197,16 @@ func (ob *OrderBook) PlaceLimit(req *PlaceOrderRequest) (*CommandResult, error)
 	if _, exists := ob.closedOrders[req.OrderID]; exists {
 		return nil, fmt.Errorf("duplicate order_id: %s", req.OrderID)
 	}
+	if err := ob.checkGroup(req); err != nil {
+		return nil, err
+	}
+	reference := ob.referencePrice()
+	if err := ob.checkLimitBand(req.PriceInt, reference); err != nil {
+		return nil, err
+	}
+
+	// One timestamp for the order and every trade and event of this command
+	now := ob.clock.Now()
 
 	result := &CommandResult{
 		OrderStatusChanges: []OrderStatusChange{},
@@ -187,7 +225,9 @@ func (ob *OrderBook) PlaceLimit(req *PlaceOrderRequest) (*CommandResult, error)
 		Quantity:      req.QuantityInt,
 		RemainingQty:  req.QuantityInt,
 		Status:        OrderStatusNew,
-		CreatedAt:     time.Now(),
+		CreatedAt:     now,
+		APIKeyID:      req.APIKeyID,
+		GroupID:       req.GroupID,
 	}
 
 	// Store order
@@ -195,11 +235,12 @@ func (ob *OrderBook) PlaceLimit(req *PlaceOrderRequest) (*CommandResult, error)
 
 	// Generate OrderAccepted event
 	seq := ob.nextEventSequence()
+	order.AcceptedSeq = seq
 	acceptedEvent := &OrderAcceptedEvent{
 		EventIDValue:    fmt.Sprintf("evt_%d", seq),
 		SequenceValue:   seq,
 		SymbolValue:     ob.Symbol,
-		OccurredAtValue: time.Now(),
+		OccurredAtValue: now,
 		OrderID:         order.OrderID,
 		ClientOrderID:   order.ClientOrderID,
 		AccountID:       order.AccountID,
@@ -207,14 +248,26 @@ func (ob *OrderBook) PlaceLimit(req *PlaceOrderRequest) (*CommandResult, error)
 		Price:           order.Price,
 		Quantity:        order.Quantity,
 		Status:          order.Status,
+		APIKeyID:        order.APIKeyID,
+		GroupID:         order.GroupID,
 	}
 	result.Events = append(result.Events, acceptedEvent)
 
-	// Try to match
-	if order.Side == SideBuy {
-		ob.matchBuyOrder(order, result)
-	} else {
-		ob.matchSellOrder(order, result)
+	// A leg of a group that already filled or was canceled is canceled on arrival
+	if !ob.joinGroup(order) {
+		ob.cancelOrder(order, CancelReasonOCO, now, result)
+		return result, nil
+	}
+
+	// Try to match; a trade beyond the dynamic band stops matching at breachPrice
+	var breachPrice int64
+	switch {
+	case ob.status == SymbolStatusPreOpen:
+		// Orders accumulate for the call auction
+	case order.Side == SideBuy:
+		breachPrice = ob.matchBuyOrder(order, reference, now, result)
+	default:
+		breachPrice = ob.matchSellOrder(order, reference, now, result)
 	}
 
 	// If order still has remaining quantity, add to order book
@@ -227,11 +280,17 @@ func (ob *OrderBook) PlaceLimit(req *PlaceOrderRequest) (*CommandResult, error)
 		ob.closedOrders[order.OrderID] = ob.buildOrderSnapshot(order)
 	}
 
+	// The remainder rests crossed; reopening the symbol uncrosses it
+	if breachPrice != 0 {
+		ob.tripBreaker(order, reference, breachPrice, now, result)
+	}
+
 	return result, nil
 }
 
-// matchBuyOrder matches a buy order against sell orders
-func (ob *OrderBook) matchBuyOrder(buyOrder *Order, result *CommandResult) {
+// matchBuyOrder matches a buy order against sell orders.
+// It returns the price of a trade the dynamic band stopped, or 0.
+func (ob *OrderBook) matchBuyOrder(buyOrder *Order, reference int64, now time.Time, result *CommandResult) int64 {
 	for buyOrder.RemainingQty > 0 {
 		// Get best ask (lowest sell price)
 		bestAsk := ob.getBestAsk()
@@ -246,34 +305,18 @@ func (ob *OrderBook) matchBuyOrder(buyOrder *Order, result *CommandResult) {
 			delete(ob.AskLevels, bestAsk)
 			continue
 		}
-
-		// Get first order in queue (FIFO)
-		element := askLevel.Queue.Front()
-		if element == nil {
-			break
-		}
-
-		sellOrder := element.Value.(*Order)
-
-		// Match orders
-		matchQty := ob.executeMatch(sellOrder, buyOrder, sellOrder.Price, result)
-		askLevel.Volume -= matchQty
-		if askLevel.Volume < 0 {
-			askLevel.Volume = 0
+		if outsideBand(bestAsk, reference, ob.bands.TradeBps) {
+			return bestAsk
 		}
 
-		// If sell order is fully filled, remove it
-		if sellOrder.RemainingQty == 0 {
-			askLevel.RemoveOrder(sellOrder)
-			delete(ob.Orders, sellOrder.OrderID)
-			ob.closedOrders[sellOrder.OrderID] = ob.buildOrderSnapshot(sellOrder)
-			ob.removePriceLevelIfEmpty(SideSell, bestAsk)
-		}
+		ob.matchLevel(askLevel, buyOrder, now, result)
 	}
+	return 0
 }
 
-// matchSellOrder matches a sell order against buy orders
-func (ob *OrderBook) matchSellOrder(sellOrder *Order, result *CommandResult) {
+// matchSellOrder matches a sell order against buy orders.
+// It returns the price of a trade the dynamic band stopped, or 0.
+func (ob *OrderBook) matchSellOrder(sellOrder *Order, reference int64, now time.Time, result *CommandResult) int64 {
 	for sellOrder.RemainingQty > 0 {
 		// Get best bid (highest buy price)
 		bestBid := ob.getBestBid()
@@ -288,40 +331,53 @@ func (ob *OrderBook) matchSellOrder(sellOrder *Order, result *CommandResult) {
 			delete(ob.BidLevels, bestBid)
 			continue
 		}
-
-		// Get first order in queue (FIFO)
-		element := bidLevel.Queue.Front()
-		if element == nil {
-			break
+		if outsideBand(bestBid, reference, ob.bands.TradeBps) {
+			return bestBid
 		}
 
-		buyOrder := element.Value.(*Order)
+		ob.matchLevel(bidLevel, sellOrder, now, result)
+	}
+	return 0
+}
 
-		// Match orders
-		matchQty := ob.executeMatch(buyOrder, sellOrder, buyOrder.Price, result)
-		bidLevel.Volume -= matchQty
-		if bidLevel.Volume < 0 {
-			bidLevel.Volume = 0
+// matchLevel trades an incoming order against the orders resting at one price level,
+// split by the book's allocation policy. Filled resting orders leave the book.
+func (ob *OrderBook) matchLevel(level *PriceLevel, taker *Order, now time.Time, result *CommandResult) {
+	for _, fill := range ob.allocation.allocate(level, taker.RemainingQty) {
+		maker := fill.order
+		if maker.Status == OrderStatusCanceled {
+			// An earlier fill canceled it with its group; the caller allocates the level again
+			continue
+		}
+		ob.executeFill(maker, taker, level.Price, fill.qty, now, result)
+		level.Volume -= fill.qty
+		if level.Volume < 0 {
+			level.Volume = 0
 		}
 
-		// If buy order is fully filled, remove it
-		if buyOrder.RemainingQty == 0 {
-			bidLevel.RemoveOrder(buyOrder)
-			delete(ob.Orders, buyOrder.OrderID)
-			ob.closedOrders[buyOrder.OrderID] = ob.buildOrderSnapshot(buyOrder)
-			ob.removePriceLevelIfEmpty(SideBuy, bestBid)
+		// If the resting order is fully filled, remove it
+		if maker.RemainingQty == 0 {
+			level.RemoveOrder(maker)
+			delete(ob.Orders, maker.OrderID)
+			ob.closedOrders[maker.OrderID] = ob.buildOrderSnapshot(maker)
 		}
 	}
+	restingSide := SideSell
+	if taker.Side == SideSell {
+		restingSide = SideBuy
+	}
+	ob.removePriceLevelIfEmpty(restingSide, level.Price)
 }
 
-// executeMatch executes a match between two orders
-func (ob *OrderBook) executeMatch(makerOrder, takerOrder *Order, price int64, result *CommandResult) int64 {
-	// Calculate match quantity
-	matchQty := makerOrder.RemainingQty
-	if takerOrder.RemainingQty < matchQty {
-		matchQty = takerOrder.RemainingQty
-	}
+// executeMatch executes a match between two orders for as much as both have left
+func (ob *OrderBook) executeMatch(makerOrder, takerOrder *Order, price int64, now time.Time, result *CommandResult) int64 {
+	matchQty := min(makerOrder.RemainingQty, takerOrder.RemainingQty)
+	ob.executeFill(makerOrder, takerOrder, price, matchQty, now, result)
+	return matchQty
+}
 
+// executeFill executes a match of matchQty between two orders
+func (ob *OrderBook) executeFill(makerOrder, takerOrder *Order, price, matchQty int64, now time.Time, result *CommandResult) {
 	// Update remaining quantities
 	makerOrder.RemainingQty -= matchQty
 	takerOrder.RemainingQty -= matchQty
@@ -338,9 +394,10 @@ func (ob *OrderBook) executeMatch(makerOrder, takerOrder *Order, price int64, re
 		Quantity:       matchQty,
 		MakerSide:      makerOrder.Side,
 		TakerSide:      takerOrder.Side,
-		OccurredAt:     time.Now(),
+		OccurredAt:     now,
 	}
 	result.Trades = append(result.Trades, trade)
+	ob.lastPrice = price
 
 	// Generate OrderMatched event
 	seq := ob.nextEventSequence()
@@ -348,7 +405,7 @@ func (ob *OrderBook) executeMatch(makerOrder, takerOrder *Order, price int64, re
 		EventIDValue:    fmt.Sprintf("evt_%d", seq),
 		SequenceValue:   seq,
 		SymbolValue:     ob.Symbol,
-		OccurredAtValue: time.Now(),
+		OccurredAtValue: now,
 		TradeID:         trade.TradeID,
 		MakerOrderID:    makerOrder.OrderID,
 		TakerOrderID:    takerOrder.OrderID,
@@ -363,7 +420,9 @@ func (ob *OrderBook) executeMatch(makerOrder, takerOrder *Order, price int64, re
 	ob.updateOrderStatus(makerOrder, result)
 	ob.updateOrderStatus(takerOrder, result)
 
-	return matchQty
+	// A fill of a group leg cancels the other legs
+	ob.closeGroup(makerOrder, now, result)
+	ob.closeGroup(takerOrder, now, result)
 }
 
 // updateOrderStatus updates order status based on remaining quantity
@@ -438,6 +497,63 @@ func (ob *OrderBook) Cancel(req *CancelOrderRequest) (*CommandResult, error) {
 		return nil, fmt.Errorf("order already canceled")
 	}
 
+	reason := req.Reason
+	if reason == "" {
+		reason = CancelReasonUser
+	}
+	ob.cancelOrder(order, reason, ob.clock.Now(), result)
+	return result, nil
+}
+
+// MassCancel cancels every resting order that matches the request's filters, oldest first,
+// with one OrderCanceled event per order. No matching orders is not an error.
+func (ob *OrderBook) MassCancel(req *MassCancelRequest) (*CommandResult, error) {
+	if req == nil {
+		return nil, fmt.Errorf("request is nil")
+	}
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	if req.Symbol != ob.Symbol {
+		return nil, fmt.Errorf("symbol mismatch: request %s, orderbook %s", req.Symbol, ob.Symbol)
+	}
+	reason := req.Reason
+	if reason == "" {
+		reason = CancelReasonUser
+	}
+
+	// Cancel in acceptance order so events are the same on every run
+	var orders []*Order
+	for _, order := range ob.Orders {
+		if req.matches(order) {
+			orders = append(orders, order)
+		}
+	}
+	sort.Slice(orders, func(i, j int) bool {
+		if orders[i].AcceptedSeq != orders[j].AcceptedSeq {
+			return orders[i].AcceptedSeq < orders[j].AcceptedSeq
+		}
+		return orders[i].OrderID < orders[j].OrderID
+	})
+
+	result := &CommandResult{
+		OrderStatusChanges: []OrderStatusChange{},
+		Trades:             []Trade{},
+		Events:             []Event{},
+	}
+	now := ob.clock.Now()
+	for _, order := range orders {
+		if order.Status == OrderStatusCanceled {
+			// Already canceled with its group
+			continue
+		}
+		ob.cancelOrder(order, reason, now, result)
+	}
+	return result, nil
+}
+
+// cancelOrder removes a resting order from the book and records its cancellation in result
+func (ob *OrderBook) cancelOrder(order *Order, reason CancelReason, now time.Time, result *CommandResult) {
 	// Remove from order book
 	level := ob.getPriceLevel(order.Side, order.Price)
 	if level != nil {
@@ -463,11 +579,11 @@ func (ob *OrderBook) Cancel(req *CancelOrderRequest) (*CommandResult, error) {
 		EventIDValue:    fmt.Sprintf("evt_%d", seq),
 		SequenceValue:   seq,
 		SymbolValue:     ob.Symbol,
-		OccurredAtValue: time.Now(),
+		OccurredAtValue: now,
 		OrderID:         order.OrderID,
 		AccountID:       order.AccountID,
 		RemainingQty:    order.RemainingQty,
-		CanceledBy:      CancelReasonUser,
+		CanceledBy:      reason,
 	}
 	result.Events = append(result.Events, canceledEvent)
 
@@ -475,7 +591,8 @@ func (ob *OrderBook) Cancel(req *CancelOrderRequest) (*CommandResult, error) {
 	delete(ob.Orders, order.OrderID)
 	ob.closedOrders[order.OrderID] = ob.buildOrderSnapshot(order)
 
-	return result, nil
+	// Canceling a group leg cancels the other legs
+	ob.closeGroup(order, now, result)
 }
 
 // OrderSnapshot represents a snapshot of an order's current state
@@ -491,6 +608,7 @@ type OrderSnapshot struct {
 	FilledQty     int64
 	Status        OrderStatus
 	CreatedAt     time.Time
+	GroupID       string `json:",omitempty"`
 }
 
 // GetOrderSnapshot returns a snapshot of an order's current state
@@ -526,7 +644,95 @@ func (ob *OrderBook) buildOrderSnapshot(order *Order) *OrderSnapshot {
 		FilledQty:     order.Quantity - order.RemainingQty,
 		Status:        order.Status,
 		CreatedAt:     order.CreatedAt,
+		GroupID:       order.GroupID,
+	}
+}
+
+// Depth returns the aggregated price levels of both sides, up to levels per side (0 for all).
+// Before the open it also carries the indicative auction.
+func (ob *OrderBook) Depth(levels int) *BookDepth {
+	depth := &BookDepth{
+		Symbol:   ob.Symbol,
+		Status:   ob.status,
+		Sequence: ob.eventSeq,
+		Bids:     depthLevels(ob.BidLevels, levels, true),
+		Asks:     depthLevels(ob.AskLevels, levels, false),
+	}
+	if ob.status == SymbolStatusPreOpen {
+		auction := ob.IndicativeAuction()
+		depth.Auction = &auction
+	}
+	return depth
+}
+
+func depthLevels(levels map[int64]*PriceLevel, limit int, descending bool) []DepthLevel {
+	prices := make([]int64, 0, len(levels))
+	for price := range levels {
+		prices = append(prices, price)
+	}
+	sort.Slice(prices, func(i, j int) bool {
+		if descending {
+			return prices[i] > prices[j]
+		}
+		return prices[i] < prices[j]
+	})
+	if limit > 0 && len(prices) > limit {
+		prices = prices[:limit]
 	}
+
+	depth := make([]DepthLevel, 0, len(prices))
+	for _, price := range prices {
+		level := levels[price]
+		depth = append(depth, DepthLevel{Price: price, Quantity: level.Volume, Orders: level.Queue.Len()})
+	}
+	return depth
+}
+
+// Status returns the book's trading status
+func (ob *OrderBook) Status() SymbolStatus {
+	return ob.status
+}
+
+// SetStatus changes the book's trading status and records the change as an event.
+// Opening a crossed book to TRADING or CANCEL_ONLY uncrosses it in the same command, so
+// replaying the status change re-derives the auction trades.
+// Setting the current status is a no-op without events.
+func (ob *OrderBook) SetStatus(req *SetSymbolStatusRequest) (*CommandResult, error) {
+	if req == nil {
+		return nil, fmt.Errorf("request is nil")
+	}
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	if req.Symbol != ob.Symbol {
+		return nil, fmt.Errorf("symbol mismatch: request %s, orderbook %s", req.Symbol, ob.Symbol)
+	}
+
+	result := &CommandResult{
+		OrderStatusChanges: []OrderStatusChange{},
+		Trades:             []Trade{},
+		Events:             []Event{},
+	}
+	if req.Status == ob.status {
+		return result, nil
+	}
+
+	now := ob.clock.Now()
+	seq := ob.nextEventSequence()
+	result.Events = append(result.Events, &SymbolStatusChangedEvent{
+		EventIDValue:    fmt.Sprintf("evt_%d", seq),
+		SequenceValue:   seq,
+		SymbolValue:     ob.Symbol,
+		OccurredAtValue: now,
+		OldStatus:       ob.status,
+		NewStatus:       req.Status,
+		Reason:          req.Reason,
+	})
+	ob.status = req.Status
+	if req.Status == SymbolStatusTrading || req.Status == SymbolStatusCancelOnly {
+		ob.uncross(now, result)
+	}
+	return result, nil
 }
 
 // SetEventSequence sets the event sequence number (used during recovery)
@@ -551,6 +757,9 @@ type OrderState struct {
 	RemainingQty  int64       `json:"remaining_qty"`
 	Status        OrderStatus `json:"status"`
 	CreatedAt     time.Time   `json:"created_at"`
+	AcceptedSeq   int64       `json:"accepted_seq,omitempty"`
+	APIKeyID      string      `json:"api_key_id,omitempty"`
+	GroupID       string      `json:"group_id,omitempty"`
 }
 
 // OrderBookState is a serializable representation of orderbook state.
@@ -560,6 +769,9 @@ type OrderBookState struct {
 	TradeSeq     int64                    `json:"trade_seq"`
 	Orders       []OrderState             `json:"orders"`
 	ClosedOrders map[string]OrderSnapshot `json:"closed_orders"`
+	Status       SymbolStatus             `json:"status,omitempty"` // Empty in snapshots taken before statuses existed: TRADING
+	LastPrice    int64                    `json:"last_price,omitempty"`
+	Allocation   AllocationPolicy         `json:"allocation,omitzero"` // Empty in snapshots taken before allocation policies existed: FIFO
 }
 
 // ExportState exports the current orderbook state for snapshotting.
@@ -577,6 +789,9 @@ func (ob *OrderBook) ExportState() *OrderBookState {
 			RemainingQty:  order.RemainingQty,
 			Status:        order.Status,
 			CreatedAt:     order.CreatedAt,
+			AcceptedSeq:   order.AcceptedSeq,
+			APIKeyID:      order.APIKeyID,
+			GroupID:       order.GroupID,
 		})
 	}
 
@@ -594,6 +809,9 @@ func (ob *OrderBook) ExportState() *OrderBookState {
 		TradeSeq:     ob.tradeSeq,
 		Orders:       orders,
 		ClosedOrders: closed,
+		Status:       ob.status,
+		LastPrice:    ob.lastPrice,
+		Allocation:   ob.allocation,
 	}
 }
 
@@ -605,6 +823,9 @@ func (ob *OrderBook) ImportState(state *OrderBookState) error {
 	if state.Symbol != "" && state.Symbol != ob.Symbol {
 		return fmt.Errorf("symbol mismatch: state %s, orderbook %s", state.Symbol, ob.Symbol)
 	}
+	if state.Status != "" && !state.Status.IsValid() {
+		return fmt.Errorf("invalid symbol status %q", state.Status)
+	}
 
 	ob.BidLevels = make(map[int64]*PriceLevel)
 	ob.AskLevels = make(map[int64]*PriceLevel)
@@ -627,6 +848,10 @@ func (ob *OrderBook) ImportState(state *OrderBookState) error {
 		if oi.Price != oj.Price {
 			return oi.Price < oj.Price
 		}
+		// Snapshots written before AcceptedSeq existed fall back to CreatedAt
+		if oi.AcceptedSeq != 0 && oj.AcceptedSeq != 0 && oi.AcceptedSeq != oj.AcceptedSeq {
+			return oi.AcceptedSeq < oj.AcceptedSeq
+		}
 		if !oi.CreatedAt.Equal(oj.CreatedAt) {
 			return oi.CreatedAt.Before(oj.CreatedAt)
 		}
@@ -650,13 +875,24 @@ func (ob *OrderBook) ImportState(state *OrderBookState) error {
 			RemainingQty:  os.RemainingQty,
 			Status:        os.Status,
 			CreatedAt:     os.CreatedAt,
+			AcceptedSeq:   os.AcceptedSeq,
+			APIKeyID:      os.APIKeyID,
+			GroupID:       os.GroupID,
 		}
 		ob.Orders[order.OrderID] = order
 		level := ob.getOrCreatePriceLevel(order.Side, order.Price)
 		level.AddOrder(order)
 	}
 
+	ob.rebuildGroups()
+
 	ob.eventSeq = state.EventSeq
 	ob.tradeSeq = state.TradeSeq
+	ob.lastPrice = state.LastPrice
+	ob.allocation = state.Allocation
+	ob.status = state.Status
+	if ob.status == "" {
+		ob.status = SymbolStatusTrading
+	}
 	return nil
 }
@@ -1,7 +1,14 @@
 package matching
 
 import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"matching-engine/internal/symbolspec"
 )
 
 func mustPlaceLimit(t *testing.T, ob *OrderBook, req *PlaceOrderRequest) *CommandResult {
@@ -470,3 +477,532 @@ func TestRejectDuplicateOrderIDAndWrongSymbol(t *testing.T) {
 		t.Fatalf("Expected symbol mismatch error")
 	}
 }
+
+// TestDepth tests that depth aggregates resting quantity per price, best prices first
+func TestDepth(t *testing.T) {
+	ob := NewOrderBook("BTC-USDT")
+	for i, order := range []struct {
+		side  Side
+		price int64
+		qty   int64
+	}{
+		{SideBuy, 42900, 100},
+		{SideBuy, 43000, 100},
+		{SideBuy, 43000, 50},
+		{SideSell, 43200, 70},
+		{SideSell, 43100, 30},
+		{SideSell, 43000, 20}, // Fills 20 of the first 43000 bid
+	} {
+		mustPlaceLimit(t, ob, &PlaceOrderRequest{
+			OrderID:       fmt.Sprintf("ord%d", i),
+			ClientOrderID: fmt.Sprintf("cli%d", i),
+			AccountID:     "acc1",
+			Symbol:        "BTC-USDT",
+			Side:          order.side,
+			PriceInt:      order.price,
+			QuantityInt:   order.qty,
+		})
+	}
+
+	depth := ob.Depth(0)
+	wantBids := []DepthLevel{{Price: 43000, Quantity: 130, Orders: 2}, {Price: 42900, Quantity: 100, Orders: 1}}
+	wantAsks := []DepthLevel{{Price: 43100, Quantity: 30, Orders: 1}, {Price: 43200, Quantity: 70, Orders: 1}}
+	if !reflect.DeepEqual(depth.Bids, wantBids) || !reflect.DeepEqual(depth.Asks, wantAsks) {
+		t.Fatalf("unexpected depth: %+v", depth)
+	}
+	if depth.Sequence != ob.GetEventSequence() {
+		t.Errorf("Expected depth sequence %d, got %d", ob.GetEventSequence(), depth.Sequence)
+	}
+
+	if top := ob.Depth(1); len(top.Bids) != 1 || len(top.Asks) != 1 || top.Bids[0].Price != 43000 || top.Asks[0].Price != 43100 {
+		t.Fatalf("unexpected top of book: %+v", top)
+	}
+}
+
+// TestClock_StampsCommandAndKeepsFIFOAcrossImport checks that a command's order, trades and events
+// share the clock's time, and that orders with equal timestamps keep their queue order through a snapshot
+func TestClock_StampsCommandAndKeepsFIFOAcrossImport(t *testing.T) {
+	at := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	ob := NewOrderBook("BTC-USDT")
+	ob.SetClock(NewFixedClock(at))
+
+	for _, id := range []string{"b2", "b1"} {
+		mustPlaceLimit(t, ob, &PlaceOrderRequest{
+			OrderID: id, ClientOrderID: "c-" + id, AccountID: "acc1", Symbol: "BTC-USDT",
+			Side: SideBuy, PriceInt: 100, QuantityInt: 10,
+		})
+	}
+
+	imported := NewOrderBook("BTC-USDT")
+	if err := imported.ImportState(ob.ExportState()); err != nil {
+		t.Fatalf("ImportState failed: %v", err)
+	}
+	imported.SetClock(NewFixedClock(at.Add(time.Second)))
+
+	result := mustPlaceLimit(t, imported, &PlaceOrderRequest{
+		OrderID: "s1", ClientOrderID: "c-s1", AccountID: "acc2", Symbol: "BTC-USDT",
+		Side: SideSell, PriceInt: 100, QuantityInt: 5,
+	})
+	if len(result.Trades) != 1 || result.Trades[0].MakerOrderID != "b2" {
+		t.Fatalf("expected b2 to fill first, got %+v", result.Trades)
+	}
+	if !result.Trades[0].OccurredAt.Equal(at.Add(time.Second)) {
+		t.Fatalf("unexpected trade time %v", result.Trades[0].OccurredAt)
+	}
+	for _, event := range result.Events {
+		if !event.OccurredAt().Equal(at.Add(time.Second)) {
+			t.Fatalf("unexpected %s time %v", event.EventType(), event.OccurredAt())
+		}
+	}
+	snapshot, err := imported.GetOrderSnapshot("b2")
+	if err != nil || !snapshot.CreatedAt.Equal(at) {
+		t.Fatalf("expected b2 created at %v, got %+v (%v)", at, snapshot, err)
+	}
+}
+
+func TestMassCancel_FiltersAndCancelsInAcceptanceOrder(t *testing.T) {
+	ob := NewOrderBook("BTC-USDT")
+	place := func(orderID, accountID string, side Side, price int64, apiKey string) {
+		mustPlaceLimit(t, ob, &PlaceOrderRequest{
+			OrderID:       orderID,
+			ClientOrderID: "cli_" + orderID,
+			AccountID:     accountID,
+			Symbol:        "BTC-USDT",
+			Side:          side,
+			PriceInt:      price,
+			QuantityInt:   10,
+			APIKeyID:      apiKey,
+		})
+	}
+	place("b1", "acc1", SideBuy, 100, "key1")
+	place("s1", "acc1", SideSell, 200, "key2")
+	place("b2", "acc2", SideBuy, 101, "key1")
+	place("b3", "acc1", SideBuy, 99, "key1")
+
+	canceledIDs := func(result *CommandResult) []string {
+		var ids []string
+		for _, event := range result.Events {
+			canceled, ok := event.(*OrderCanceledEvent)
+			if !ok {
+				t.Fatalf("expected OrderCanceled event, got %s", event.EventType())
+			}
+			ids = append(ids, canceled.OrderID)
+		}
+		return ids
+	}
+
+	// Account and side
+	result, err := ob.MassCancel(&MassCancelRequest{AccountID: "acc1", Symbol: "BTC-USDT", Side: SideBuy})
+	if err != nil {
+		t.Fatalf("MassCancel failed: %v", err)
+	}
+	if got := canceledIDs(result); !reflect.DeepEqual(got, []string{"b1", "b3"}) {
+		t.Fatalf("expected b1, b3 canceled in acceptance order, got %v", got)
+	}
+	if len(result.OrderStatusChanges) != 2 {
+		t.Fatalf("expected 2 status changes, got %d", len(result.OrderStatusChanges))
+	}
+
+	// API key across accounts, with the system reason
+	result, err = ob.MassCancel(&MassCancelRequest{Symbol: "BTC-USDT", APIKeyID: "key1", Reason: CancelReasonSystem})
+	if err != nil {
+		t.Fatalf("MassCancel failed: %v", err)
+	}
+	if got := canceledIDs(result); !reflect.DeepEqual(got, []string{"b2"}) {
+		t.Fatalf("expected b2 canceled, got %v", got)
+	}
+	if reason := result.Events[0].(*OrderCanceledEvent).CanceledBy; reason != CancelReasonSystem {
+		t.Fatalf("expected SYSTEM reason, got %s", reason)
+	}
+
+	if _, exists := ob.Orders["s1"]; !exists || len(ob.Orders) != 1 {
+		t.Fatalf("expected only s1 to rest, got %d orders", len(ob.Orders))
+	}
+	if len(ob.BidLevels) != 0 {
+		t.Fatalf("expected bid levels to be empty, got %d", len(ob.BidLevels))
+	}
+
+	// Nothing left to cancel is not an error
+	result, err = ob.MassCancel(&MassCancelRequest{AccountID: "acc2", Symbol: "BTC-USDT"})
+	if err != nil {
+		t.Fatalf("MassCancel failed: %v", err)
+	}
+	if len(result.Events) != 0 {
+		t.Fatalf("expected no events, got %d", len(result.Events))
+	}
+
+	if _, err := ob.MassCancel(&MassCancelRequest{AccountID: "acc1", Symbol: "ETH-USDT"}); err == nil {
+		t.Fatalf("expected symbol mismatch error")
+	}
+}
+
+func TestCallAuction_UncrossesAtMaxVolumePriceInFIFOOrder(t *testing.T) {
+	ob := NewOrderBook("BTC-USDT")
+	if _, err := ob.SetStatus(&SetSymbolStatusRequest{Symbol: "BTC-USDT", Status: SymbolStatusPreOpen}); err != nil {
+		t.Fatalf("SetStatus failed: %v", err)
+	}
+	place := func(orderID string, side Side, price, qty int64) {
+		t.Helper()
+		result, err := ob.PlaceLimit(&PlaceOrderRequest{
+			OrderID: orderID, ClientOrderID: "c_" + orderID, AccountID: "acc1", Symbol: "BTC-USDT",
+			Side: side, PriceInt: price, QuantityInt: qty,
+		})
+		if err != nil {
+			t.Fatalf("PlaceLimit failed: %v", err)
+		}
+		if len(result.Trades) != 0 {
+			t.Fatalf("expected %s to rest without matching before the open", orderID)
+		}
+	}
+	place("b1", SideBuy, 102, 3)
+	place("s1", SideSell, 99, 2)
+	place("b2", SideBuy, 101, 2)
+	place("s2", SideSell, 100, 2)
+	place("s3", SideSell, 101, 3)
+	place("b3", SideBuy, 100, 1)
+
+	// Executable volume by price: 99→2, 100→4, 101→5, 102→3
+	want := AuctionIndicative{Price: 101, Volume: 5, Imbalance: -2}
+	if got := ob.IndicativeAuction(); got != want {
+		t.Fatalf("expected indicative %+v, got %+v", want, got)
+	}
+	if depth := ob.Depth(0); depth.Auction == nil || *depth.Auction != want {
+		t.Fatalf("expected depth to publish the indicative auction, got %+v", depth.Auction)
+	}
+
+	result, err := ob.SetStatus(&SetSymbolStatusRequest{Symbol: "BTC-USDT", Status: SymbolStatusTrading})
+	if err != nil {
+		t.Fatalf("SetStatus failed: %v", err)
+	}
+	if _, ok := result.Events[0].(*SymbolStatusChangedEvent); !ok {
+		t.Fatalf("expected the status change first, got %s", result.Events[0].EventType())
+	}
+	type fill struct {
+		maker, taker string
+		qty          int64
+	}
+	var fills []fill
+	for _, event := range result.Events[1:] {
+		matched, ok := event.(*OrderMatchedEvent)
+		if !ok {
+			t.Fatalf("expected OrderMatched events, got %s", event.EventType())
+		}
+		if matched.Price != 101 {
+			t.Fatalf("expected every trade at 101, got %d", matched.Price)
+		}
+		fills = append(fills, fill{matched.MakerOrderID, matched.TakerOrderID, matched.Quantity})
+	}
+	wantFills := []fill{{"b1", "s1", 2}, {"b1", "s2", 1}, {"b2", "s2", 1}, {"b2", "s3", 1}}
+	if !reflect.DeepEqual(fills, wantFills) {
+		t.Fatalf("expected fills %v, got %v", wantFills, fills)
+	}
+
+	// s3 keeps 2 at 101 and b3 did not cross
+	if len(ob.Orders) != 2 || ob.Orders["s3"].RemainingQty != 2 || ob.Orders["b3"] == nil {
+		t.Fatalf("unexpected resting orders after the uncross: %d", len(ob.Orders))
+	}
+	if level := ob.AskLevels[101]; level == nil || level.Volume != 2 {
+		t.Fatalf("expected 2 left at the 101 ask level")
+	}
+	if len(ob.BidLevels) != 1 || ob.Depth(0).Auction != nil {
+		t.Fatalf("expected only the 100 bid level and no auction once trading")
+	}
+}
+
+func TestCallAuction_TieBreaks(t *testing.T) {
+	type order struct {
+		side       Side
+		price, qty int64
+	}
+	tests := []struct {
+		name      string
+		orders    []order
+		lastPrice int64
+		want      AuctionIndicative
+	}{
+		{
+			name:   "smallest imbalance",
+			orders: []order{{SideBuy, 101, 3}, {SideBuy, 100, 2}, {SideSell, 99, 3}, {SideSell, 101, 1}},
+			want:   AuctionIndicative{Price: 101, Volume: 3, Imbalance: -1},
+		},
+		{
+			name:   "buy pressure takes the highest price",
+			orders: []order{{SideBuy, 101, 6}, {SideSell, 100, 5}},
+			want:   AuctionIndicative{Price: 101, Volume: 5, Imbalance: 1},
+		},
+		{
+			name:   "sell pressure takes the lowest price",
+			orders: []order{{SideBuy, 101, 5}, {SideSell, 100, 6}},
+			want:   AuctionIndicative{Price: 100, Volume: 5, Imbalance: -1},
+		},
+		{
+			name:      "closest to the reference price",
+			orders:    []order{{SideBuy, 101, 5}, {SideSell, 100, 5}},
+			lastPrice: 105,
+			want:      AuctionIndicative{Price: 101, Volume: 5},
+		},
+		{
+			name:   "lowest without a reference price",
+			orders: []order{{SideBuy, 101, 5}, {SideSell, 100, 5}},
+			want:   AuctionIndicative{Price: 100, Volume: 5},
+		},
+		{
+			name:   "no cross",
+			orders: []order{{SideBuy, 99, 5}, {SideSell, 100, 5}},
+			want:   AuctionIndicative{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ob := NewOrderBook("BTC-USDT")
+			if err := ob.ImportState(&OrderBookState{Symbol: "BTC-USDT", Status: SymbolStatusPreOpen, LastPrice: tt.lastPrice}); err != nil {
+				t.Fatalf("ImportState failed: %v", err)
+			}
+			for i, o := range tt.orders {
+				if _, err := ob.PlaceLimit(&PlaceOrderRequest{
+					OrderID: fmt.Sprintf("o%d", i), ClientOrderID: fmt.Sprintf("c%d", i), AccountID: "acc1",
+					Symbol: "BTC-USDT", Side: o.side, PriceInt: o.price, QuantityInt: o.qty,
+				}); err != nil {
+					t.Fatalf("PlaceLimit failed: %v", err)
+				}
+			}
+			if got := ob.IndicativeAuction(); got != tt.want {
+				t.Fatalf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPriceBands_RejectOutlyingLimitsAndTripTheBreaker(t *testing.T) {
+	ob := NewOrderBook("BTC-USDT")
+	ob.SetPriceBands(PriceBands{LimitBps: 1000, TradeBps: 500})
+	place := func(orderID string, side Side, price, qty int64) (*CommandResult, error) {
+		return ob.PlaceLimit(&PlaceOrderRequest{
+			OrderID: orderID, ClientOrderID: "c_" + orderID, AccountID: "acc1", Symbol: "BTC-USDT",
+			Side: side, PriceInt: price, QuantityInt: qty,
+		})
+	}
+
+	// No reference price yet: anything goes
+	mustPlaceLimit(t, ob, &PlaceOrderRequest{OrderID: "s0", ClientOrderID: "c_s0", AccountID: "acc1", Symbol: "BTC-USDT", Side: SideSell, PriceInt: 1000, QuantityInt: 1})
+	mustPlaceLimit(t, ob, &PlaceOrderRequest{OrderID: "b0", ClientOrderID: "c_b0", AccountID: "acc1", Symbol: "BTC-USDT", Side: SideBuy, PriceInt: 1000, QuantityInt: 1})
+
+	// 10% around the last trade at 1000
+	if _, err := place("far", SideBuy, 1101, 1); err == nil || !strings.Contains(err.Error(), "price band") {
+		t.Fatalf("expected a price band rejection, got %v", err)
+	}
+	for _, ask := range []struct {
+		id    string
+		price int64
+	}{{"s1", 1020}, {"s2", 1040}, {"s3", 1060}} {
+		if _, err := place(ask.id, SideSell, ask.price, 1); err != nil {
+			t.Fatalf("PlaceLimit %s failed: %v", ask.id, err)
+		}
+	}
+
+	// The sweep stops before trading 1060, 5% beyond the reference
+	result, err := place("b1", SideBuy, 1080, 3)
+	if err != nil {
+		t.Fatalf("PlaceLimit failed: %v", err)
+	}
+	if len(result.Trades) != 2 || result.Trades[1].Price != 1040 {
+		t.Fatalf("expected trades at 1020 and 1040 only, got %+v", result.Trades)
+	}
+	n := len(result.Events)
+	breached, ok := result.Events[n-2].(*PriceBandBreachedEvent)
+	if !ok || breached.OrderID != "b1" || breached.ReferencePrice != 1000 || breached.Price != 1060 || breached.BandBps != 500 {
+		t.Fatalf("expected a PriceBandBreached event for b1 at 1060, got %+v", result.Events[n-2])
+	}
+	if changed, ok := result.Events[n-1].(*SymbolStatusChangedEvent); !ok || changed.NewStatus != SymbolStatusHalted {
+		t.Fatalf("expected the breaker to halt the symbol, got %+v", result.Events[n-1])
+	}
+	if ob.Status() != SymbolStatusHalted || ob.Orders["b1"].RemainingQty != 1 {
+		t.Fatalf("expected b1 to rest its remainder in a halted book")
+	}
+
+	// Reopening uncrosses the remainder against the ask it stopped at
+	result, err = ob.SetStatus(&SetSymbolStatusRequest{Symbol: "BTC-USDT", Status: SymbolStatusTrading})
+	if err != nil {
+		t.Fatalf("SetStatus failed: %v", err)
+	}
+	if len(result.Trades) != 1 || result.Trades[0].Price != 1060 || len(ob.Orders) != 0 {
+		t.Fatalf("expected the reopening to trade b1 against s3 at 1060, got %+v", result.Trades)
+	}
+}
+
+func TestOrderLimits_RejectOrdersOutsideTheSpec(t *testing.T) {
+	ob := NewOrderBook("BTC-USDT")
+	// Quantity scale 2: 0.10 to 50.00, prices 10.00 to 1000.00, at least 25.00 of notional
+	ob.SetOrderLimits(symbolspec.Spec{
+		Symbol: "BTC-USDT", PriceScale: 2, QuantityScale: 2, PriceTickInt: 1, QtyStepInt: 1,
+		MinQtyInt: 10, MaxQtyInt: 5000, MinPriceInt: 1000, MaxPriceInt: 100000, MinNotionalInt: 2500,
+	})
+	place := func(orderID string, price, qty int64) error {
+		_, err := ob.PlaceLimit(&PlaceOrderRequest{
+			OrderID: orderID, ClientOrderID: "c_" + orderID, AccountID: "acc1", Symbol: "BTC-USDT",
+			Side: SideBuy, PriceInt: price, QuantityInt: qty,
+		})
+		return err
+	}
+
+	for _, tc := range []struct {
+		price, qty int64
+		want       error
+	}{
+		{price: 999, qty: 500, want: symbolspec.ErrPriceTooLow},
+		{price: 100001, qty: 500, want: symbolspec.ErrPriceTooHigh},
+		{price: 50000, qty: 9, want: symbolspec.ErrQtyTooSmall},
+		{price: 5000, qty: 5001, want: symbolspec.ErrQtyTooLarge},
+		{price: 2499, qty: 100, want: symbolspec.ErrMinNotional}, // 24.99 × 1.00
+	} {
+		if err := place(fmt.Sprintf("o_%d_%d", tc.price, tc.qty), tc.price, tc.qty); !errors.Is(err, tc.want) {
+			t.Fatalf("price %d qty %d: expected %v, got %v", tc.price, tc.qty, tc.want, err)
+		}
+	}
+	if len(ob.Orders) != 0 || ob.GetEventSequence() != 0 {
+		t.Fatalf("expected rejected orders to leave no trace")
+	}
+
+	// Exactly at every minimum: 25.00 × 1.00
+	if err := place("edge", 2500, 100); err != nil {
+		t.Fatalf("expected an order at the limits to be accepted, got %v", err)
+	}
+}
+
+func TestOrderGroup_FillOrCancelOfALegCancelsTheOthers(t *testing.T) {
+	ob := NewOrderBook("BTC-USDT")
+	place := func(orderID, accountID string, side Side, price, qty int64, groupID string) *CommandResult {
+		t.Helper()
+		return mustPlaceLimit(t, ob, &PlaceOrderRequest{
+			OrderID: orderID, ClientOrderID: "c_" + orderID, AccountID: accountID, Symbol: "BTC-USDT",
+			Side: side, PriceInt: price, QuantityInt: qty, GroupID: groupID,
+		})
+	}
+	canceled := func(result *CommandResult) []string {
+		var orderIDs []string
+		for _, event := range result.Events {
+			if e, ok := event.(*OrderCanceledEvent); ok {
+				orderIDs = append(orderIDs, fmt.Sprintf("%s:%s", e.OrderID, e.CanceledBy))
+			}
+		}
+		return orderIDs
+	}
+
+	// Take-profit above and a second exit further up, sharing group g1
+	place("tp", "acc1", SideSell, 45000, 10, "g1")
+	place("exit", "acc1", SideSell, 46000, 10, "g1")
+	// Another account may use the same group ID for its own group
+	place("other", "acc2", SideSell, 45000, 10, "g1")
+
+	if _, err := ob.PlaceLimit(&PlaceOrderRequest{
+		OrderID: "wrong_side", ClientOrderID: "c_wrong_side", AccountID: "acc1", Symbol: "BTC-USDT",
+		Side: SideBuy, PriceInt: 40000, QuantityInt: 10, GroupID: "g1",
+	}); err == nil || !strings.Contains(err.Error(), "group mismatch") {
+		t.Fatalf("expected a leg on the other side to be rejected, got %v", err)
+	}
+
+	// A partial fill of tp cancels exit in the same command; acc2's group is untouched
+	result := place("taker", "acc3", SideBuy, 45000, 4, "")
+	if got, want := canceled(result), []string{"exit:OCO"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	if _, ok := ob.Orders["exit"]; ok {
+		t.Fatalf("expected exit to leave the book")
+	}
+	if ob.Orders["tp"].RemainingQty != 6 || ob.Orders["other"] == nil {
+		t.Fatalf("expected tp to keep resting with 6 and acc2's order to be untouched")
+	}
+
+	// A leg placed into a group that already traded is canceled on arrival
+	result = place("late", "acc1", SideSell, 47000, 10, "g1")
+	if got, want := canceled(result), []string{"late:OCO"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	// Canceling a leg cancels the others, oldest first
+	place("a", "acc1", SideBuy, 40000, 10, "g2")
+	place("b", "acc1", SideBuy, 39000, 10, "g2")
+	place("c", "acc1", SideBuy, 38000, 10, "g2")
+	result, err := ob.Cancel(&CancelOrderRequest{OrderID: "b", AccountID: "acc1", Symbol: "BTC-USDT"})
+	if err != nil {
+		t.Fatalf("Cancel failed: %v", err)
+	}
+	if got, want := canceled(result), []string{"b:USER", "a:OCO", "c:OCO"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	// A mass cancel cancels each leg once
+	place("d", "acc1", SideBuy, 40000, 10, "g3")
+	place("e", "acc1", SideBuy, 39000, 10, "g3")
+	result, err = ob.MassCancel(&MassCancelRequest{AccountID: "acc1", Symbol: "BTC-USDT", Side: SideBuy})
+	if err != nil {
+		t.Fatalf("MassCancel failed: %v", err)
+	}
+	if got, want := canceled(result), []string{"d:USER", "e:OCO"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	// An imported book knows which groups are open and which already closed
+	place("f", "acc1", SideBuy, 40000, 10, "g4")
+	restored := NewOrderBook("BTC-USDT")
+	if err := restored.ImportState(ob.ExportState()); err != nil {
+		t.Fatalf("ImportState failed: %v", err)
+	}
+	restored.SetClock(NewFixedClock(time.Unix(0, 0)))
+	result, err = restored.PlaceLimit(&PlaceOrderRequest{
+		OrderID: "g", ClientOrderID: "c_g", AccountID: "acc1", Symbol: "BTC-USDT",
+		Side: SideBuy, PriceInt: 39000, QuantityInt: 10, GroupID: "g4",
+	})
+	if err != nil || len(canceled(result)) != 0 {
+		t.Fatalf("expected g to join the open group g4, got %v (%v)", canceled(result), err)
+	}
+	result, _ = restored.PlaceLimit(&PlaceOrderRequest{
+		OrderID: "h", ClientOrderID: "c_h", AccountID: "acc1", Symbol: "BTC-USDT",
+		Side: SideSell, PriceInt: 50000, QuantityInt: 10, GroupID: "g1",
+	})
+	if got, want := canceled(result), []string{"h:OCO"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v after import, got %v", want, got)
+	}
+	if snapshot, _ := restored.GetOrderSnapshot("f"); snapshot.GroupID != "g4" {
+		t.Fatalf("expected f to keep its group, got %q", snapshot.GroupID)
+	}
+}
+
+func TestOrderGroup_LegsAtTheSameLevelTradeOnce(t *testing.T) {
+	for _, allocation := range []symbolspec.Allocation{symbolspec.AllocationFIFO, symbolspec.AllocationProRata} {
+		t.Run(string(allocation), func(t *testing.T) {
+			ob := NewOrderBook("BTC-USDT")
+			ob.SetAllocation(NewAllocationPolicy(symbolspec.Spec{Allocation: allocation, QtyStepInt: 1}))
+			for _, orderID := range []string{"leg1", "leg2"} {
+				mustPlaceLimit(t, ob, &PlaceOrderRequest{
+					OrderID: orderID, ClientOrderID: "c_" + orderID, AccountID: "acc1", Symbol: "BTC-USDT",
+					Side: SideSell, PriceInt: 43000, QuantityInt: 10, GroupID: "g1",
+				})
+			}
+			mustPlaceLimit(t, ob, &PlaceOrderRequest{
+				OrderID: "rest", ClientOrderID: "c_rest", AccountID: "acc2", Symbol: "BTC-USDT",
+				Side: SideSell, PriceInt: 43000, QuantityInt: 10,
+			})
+
+			// Only the first leg to trade fills; its sibling is canceled and the rest comes from acc2
+			result := mustPlaceLimit(t, ob, &PlaceOrderRequest{
+				OrderID: "taker", ClientOrderID: "c_taker", AccountID: "acc3", Symbol: "BTC-USDT",
+				Side: SideBuy, PriceInt: 43000, QuantityInt: 20,
+			})
+			var filled int64
+			for _, trade := range result.Trades {
+				if trade.MakerOrderID == "leg2" {
+					t.Fatalf("expected the canceled leg not to trade")
+				}
+				filled += trade.Quantity
+			}
+			if filled != 20 {
+				t.Fatalf("expected the taker to fill 20, got %d", filled)
+			}
+			if len(ob.AskLevels) != 0 || len(ob.Orders) != 0 {
+				t.Fatalf("expected the level to be cleared, got %d orders left", len(ob.Orders))
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package matching
+
+import (
+	"fmt"
+	"time"
+)
+
+// PriceBands protect a symbol against trading far from its reference price: the last trade
+// price, or the mid price before the first trade. Widths are in basis points; 0 disables a band.
+type PriceBands struct {
+	LimitBps      int64        // Limit orders priced further than this from the reference are rejected
+	TradeBps      int64        // A trade further than this from the reference trips the circuit breaker
+	BreakerStatus SymbolStatus // Status a tripped breaker moves the symbol to: HALTED (default) or PRE_OPEN
+}
+
+// SetPriceBands sets the book's price bands
+func (ob *OrderBook) SetPriceBands(bands PriceBands) {
+	ob.bands = bands
+}
+
+// PriceBands returns the book's price bands
+func (ob *OrderBook) PriceBands() PriceBands {
+	return ob.bands
+}
+
+// referencePrice returns the last trade price, or the mid price if nothing traded yet, or 0 if neither exists
+func (ob *OrderBook) referencePrice() int64 {
+	if ob.lastPrice > 0 {
+		return ob.lastPrice
+	}
+	bestBid, bestAsk := ob.getBestBid(), ob.getBestAsk()
+	if bestBid == 0 || bestAsk == 0 {
+		return 0
+	}
+	return bestBid + (bestAsk-bestBid)/2
+}
+
+// checkLimitBand rejects a limit price outside the static band around the reference price
+func (ob *OrderBook) checkLimitBand(price, reference int64) error {
+	if outsideBand(price, reference, ob.bands.LimitBps) {
+		return fmt.Errorf("price %d is outside the price band of %d bps around %d", price, ob.bands.LimitBps, reference)
+	}
+	return nil
+}
+
+// tripBreaker records a trade that would have breached the dynamic band and moves the
+// symbol to the breaker status. The incoming order has already stopped matching.
+func (ob *OrderBook) tripBreaker(order *Order, reference, price int64, now time.Time, result *CommandResult) {
+	seq := ob.nextEventSequence()
+	result.Events = append(result.Events, &PriceBandBreachedEvent{
+		EventIDValue:    fmt.Sprintf("evt_%d", seq),
+		SequenceValue:   seq,
+		SymbolValue:     ob.Symbol,
+		OccurredAtValue: now,
+		OrderID:         order.OrderID,
+		ReferencePrice:  reference,
+		Price:           price,
+		BandBps:         ob.bands.TradeBps,
+	})
+
+	status := ob.bands.BreakerStatus
+	if status == "" {
+		status = SymbolStatusHalted
+	}
+	if status == ob.status {
+		return
+	}
+	seq = ob.nextEventSequence()
+	result.Events = append(result.Events, &SymbolStatusChangedEvent{
+		EventIDValue:    fmt.Sprintf("evt_%d", seq),
+		SequenceValue:   seq,
+		SymbolValue:     ob.Symbol,
+		OccurredAtValue: now,
+		OldStatus:       ob.status,
+		NewStatus:       status,
+		Reason:          "price band breached",
+	})
+	ob.status = status
+}
+
+// outsideBand reports whether price is more than bps basis points away from reference
+func outsideBand(price, reference, bps int64) bool {
+	if bps <= 0 || reference <= 0 {
+		return false
+	}
+	// reference*bps/10000 without overflowing for large references
+	width := reference/10000*bps + reference%10000*bps/10000
+	return abs64(price-reference) > width
+}
@@ -0,0 +1,58 @@
+package matching
+
+import (
+	"fmt"
+
+	"matching-engine/internal/symbolspec"
+)
+
+// ChangeSpec records a new spec for the symbol.
+// The change is rejected if a resting order would be invalid under it: scales cannot change while
+// orders rest, and every resting price and quantity must stay on the new tick and step.
+// Order limits only apply to new orders; resting orders outside them keep their place.
+// The spec's allocation policy applies from the change on, live and in replay.
+func (ob *OrderBook) ChangeSpec(previous, spec symbolspec.Spec) (*CommandResult, error) {
+	if spec.Symbol != ob.Symbol {
+		return nil, fmt.Errorf("symbol mismatch: spec %s, orderbook %s", spec.Symbol, ob.Symbol)
+	}
+
+	result := &CommandResult{
+		OrderStatusChanges: []OrderStatusChange{},
+		Trades:             []Trade{},
+		Events:             []Event{},
+	}
+	if len(ob.Orders) > 0 {
+		if spec.PriceScale != previous.PriceScale || spec.QuantityScale != previous.QuantityScale {
+			return nil, fmt.Errorf("spec conflict: cannot change scales of %s with %d resting orders", ob.Symbol, len(ob.Orders))
+		}
+		for _, order := range ob.Orders {
+			if order.Price%spec.PriceTickInt != 0 {
+				return nil, fmt.Errorf("spec conflict: resting order %s price %d is not a multiple of tick %d", order.OrderID, order.Price, spec.PriceTickInt)
+			}
+			if order.Quantity%spec.QtyStepInt != 0 || order.RemainingQty%spec.QtyStepInt != 0 {
+				return nil, fmt.Errorf("spec conflict: resting order %s quantity is not a multiple of step %d", order.OrderID, spec.QtyStepInt)
+			}
+		}
+	}
+
+	seq := ob.nextEventSequence()
+	result.Events = append(result.Events, &SymbolSpecChangedEvent{
+		EventIDValue:    fmt.Sprintf("evt_%d", seq),
+		SequenceValue:   seq,
+		SymbolValue:     ob.Symbol,
+		OccurredAtValue: ob.clock.Now(),
+		Spec:            spec,
+	})
+	ob.allocation = NewAllocationPolicy(spec)
+	return result, nil
+}
+
+// SetOrderLimits sets the spec whose order limits places are checked against
+func (ob *OrderBook) SetOrderLimits(spec symbolspec.Spec) {
+	ob.limits = spec
+}
+
+// OrderLimits returns the spec whose order limits places are checked against
+func (ob *OrderBook) OrderLimits() symbolspec.Spec {
+	return ob.limits
+}
@@ -3,6 +3,8 @@ package matching
 import (
 	"errors"
 	"time"
+
+	"matching-engine/internal/symbolspec"
 )
 
 // Side represents order side (buy/sell)
@@ -34,8 +36,28 @@ const (
 	CancelReasonUser    CancelReason = "USER"
 	CancelReasonSystem  CancelReason = "SYSTEM"
 	CancelReasonExpired CancelReason = "EXPIRED"
+	CancelReasonOCO     CancelReason = "OCO" // Another leg of the order's group filled or was canceled
+)
+
+// SymbolStatus is the trading status of a symbol
+type SymbolStatus string
+
+const (
+	SymbolStatusTrading    SymbolStatus = "TRADING"     // Orders are accepted and matched
+	SymbolStatusHalted     SymbolStatus = "HALTED"      // Every order command is rejected
+	SymbolStatusCancelOnly SymbolStatus = "CANCEL_ONLY" // Only cancels are accepted
+	SymbolStatusPreOpen    SymbolStatus = "PRE_OPEN"    // Call auction: orders rest without matching until the uncross
 )
 
+// IsValid checks if the symbol status is valid
+func (s SymbolStatus) IsValid() bool {
+	switch s {
+	case SymbolStatusTrading, SymbolStatusHalted, SymbolStatusCancelOnly, SymbolStatusPreOpen:
+		return true
+	}
+	return false
+}
+
 // PlaceOrderRequest internal place order request (converted by gateway/access layer)
 type PlaceOrderRequest struct {
 	OrderID       string // System-generated order ID
@@ -45,6 +67,8 @@ type PlaceOrderRequest struct {
 	Side          Side   // Order side
 	PriceInt      int64  // Price in minimum units
 	QuantityInt   int64  // Quantity in minimum units
+	APIKeyID      string `json:",omitempty"` // ID of the API key the order was placed with (optional)
+	GroupID       string `json:",omitempty"` // One-cancels-other group shared with the account's other legs (optional)
 }
 
 // Validate validates place order request
@@ -73,11 +97,20 @@ func (r *PlaceOrderRequest) Validate() error {
 	return nil
 }
 
+// ValidateLimits validates the request, then checks it against the order limits of the symbol's spec
+func (r *PlaceOrderRequest) ValidateLimits(spec symbolspec.Spec) error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+	return spec.CheckOrder(r.PriceInt, r.QuantityInt)
+}
+
 // CancelOrderRequest cancel order request
 type CancelOrderRequest struct {
-	OrderID   string // Order ID
-	AccountID string // Account ID (for permission check)
-	Symbol    string // Trading pair
+	OrderID   string       // Order ID
+	AccountID string       // Account ID (for permission check)
+	Symbol    string       // Trading pair
+	Reason    CancelReason `json:",omitempty"` // Recorded on the OrderCanceled event; empty means USER
 }
 
 // Validate validates cancel order request
@@ -94,6 +127,51 @@ func (r *CancelOrderRequest) Validate() error {
 	return nil
 }
 
+// MassCancelRequest cancels every resting order of a book that matches all of its filters
+type MassCancelRequest struct {
+	AccountID string       // Only this account's orders; empty for every account (admin)
+	Symbol    string       // Trading pair; empty for every symbol (engine fans out per book)
+	Side      Side         // Only this side; empty for both
+	APIKeyID  string       // Only orders placed with the API key of this ID; empty for any
+	Reason    CancelReason // Recorded on every OrderCanceled event; empty means USER
+}
+
+// Validate validates mass cancel request
+func (r *MassCancelRequest) Validate() error {
+	if r.Symbol == "" && r.AccountID == "" && r.APIKeyID == "" {
+		return errors.New("symbol, account_id or API key required")
+	}
+	if r.Side != "" && !r.Side.IsValid() {
+		return errors.New("invalid side")
+	}
+	return nil
+}
+
+// matches reports whether an order passes the request's filters
+func (r *MassCancelRequest) matches(order *Order) bool {
+	return (r.AccountID == "" || order.AccountID == r.AccountID) &&
+		(r.Side == "" || order.Side == r.Side) &&
+		(r.APIKeyID == "" || order.APIKeyID == r.APIKeyID)
+}
+
+// SetSymbolStatusRequest changes a symbol's trading status
+type SetSymbolStatusRequest struct {
+	Symbol string       // Trading pair
+	Status SymbolStatus // New status
+	Reason string       // Why the status changed, recorded on the event (optional)
+}
+
+// Validate validates set symbol status request
+func (r *SetSymbolStatusRequest) Validate() error {
+	if r.Symbol == "" {
+		return errors.New("symbol required")
+	}
+	if !r.Status.IsValid() {
+		return errors.New("invalid status")
+	}
+	return nil
+}
+
 // QueryOrderRequest query order request
 type QueryOrderRequest struct {
 	OrderID   string // Order ID
@@ -115,6 +193,40 @@ func (r *QueryOrderRequest) Validate() error {
 	return nil
 }
 
+// DepthRequest query aggregated book depth
+type DepthRequest struct {
+	Symbol string // Trading pair
+	Levels int    // Price levels per side, 0 for all
+}
+
+// Validate validates depth request
+func (r *DepthRequest) Validate() error {
+	if r.Symbol == "" {
+		return errors.New("symbol required")
+	}
+	if r.Levels < 0 {
+		return errors.New("levels must not be negative")
+	}
+	return nil
+}
+
+// DepthLevel is the aggregated resting quantity at one price
+type DepthLevel struct {
+	Price    int64 // Price in minimum units
+	Quantity int64 // Total remaining quantity
+	Orders   int   // Number of resting orders
+}
+
+// BookDepth aggregated book depth, best prices first
+type BookDepth struct {
+	Symbol   string             // Trading pair
+	Status   SymbolStatus       // Trading status
+	Sequence int64              // Last event sequence applied to the book
+	Bids     []DepthLevel       // Highest price first
+	Asks     []DepthLevel       // Lowest price first
+	Auction  *AuctionIndicative // Indicative uncross while PRE_OPEN, nil otherwise
+}
+
 // CommandResult command execution result
 type CommandResult struct {
 	OrderStatusChanges []OrderStatusChange // Order status changes
@@ -168,6 +280,8 @@ type OrderAcceptedEvent struct {
 	Price           int64       // Price
 	Quantity        int64       // Quantity
 	Status          OrderStatus // Order status
+	APIKeyID        string      // ID of the API key the order was placed with, if any
+	GroupID         string      // One-cancels-other group of the order, if any
 }
 
 func (e *OrderAcceptedEvent) EventID() string       { return e.EventIDValue }
@@ -206,7 +320,7 @@ type OrderCanceledEvent struct {
 	OrderID         string       // Order ID
 	AccountID       string       // Account ID
 	RemainingQty    int64        // Remaining quantity at cancellation
-	CanceledBy      CancelReason // Cancellation reason (USER/SYSTEM/EXPIRED)
+	CanceledBy      CancelReason // Cancellation reason (USER/SYSTEM/EXPIRED/OCO)
 }
 
 func (e *OrderCanceledEvent) EventID() string       { return e.EventIDValue }
@@ -214,3 +328,53 @@ func (e *OrderCanceledEvent) EventType() string     { return "OrderCanceled" }
 func (e *OrderCanceledEvent) Sequence() int64       { return e.SequenceValue }
 func (e *OrderCanceledEvent) Symbol() string        { return e.SymbolValue }
 func (e *OrderCanceledEvent) OccurredAt() time.Time { return e.OccurredAtValue }
+
+// SymbolStatusChangedEvent symbol trading status changed event
+type SymbolStatusChangedEvent struct {
+	EventIDValue    string       // Event ID
+	SequenceValue   int64        // Sequence number
+	SymbolValue     string       // Trading pair
+	OccurredAtValue time.Time    // Event time
+	OldStatus       SymbolStatus // Status before the change
+	NewStatus       SymbolStatus // Status after the change
+	Reason          string       // Why the status changed
+}
+
+func (e *SymbolStatusChangedEvent) EventID() string       { return e.EventIDValue }
+func (e *SymbolStatusChangedEvent) EventType() string     { return "SymbolStatusChanged" }
+func (e *SymbolStatusChangedEvent) Sequence() int64       { return e.SequenceValue }
+func (e *SymbolStatusChangedEvent) Symbol() string        { return e.SymbolValue }
+func (e *SymbolStatusChangedEvent) OccurredAt() time.Time { return e.OccurredAtValue }
+
+// PriceBandBreachedEvent a trade beyond the dynamic price band tripped the circuit breaker
+type PriceBandBreachedEvent struct {
+	EventIDValue    string    // Event ID
+	SequenceValue   int64     // Sequence number
+	SymbolValue     string    // Trading pair
+	OccurredAtValue time.Time // Event time
+	OrderID         string    // Incoming order that stopped matching at the band
+	ReferencePrice  int64     // Price the band is centered on
+	Price           int64     // Price of the trade that was not executed
+	BandBps         int64     // Band width in basis points
+}
+
+func (e *PriceBandBreachedEvent) EventID() string       { return e.EventIDValue }
+func (e *PriceBandBreachedEvent) EventType() string     { return "PriceBandBreached" }
+func (e *PriceBandBreachedEvent) Sequence() int64       { return e.SequenceValue }
+func (e *PriceBandBreachedEvent) Symbol() string        { return e.SymbolValue }
+func (e *PriceBandBreachedEvent) OccurredAt() time.Time { return e.OccurredAtValue }
+
+// SymbolSpecChangedEvent an admin created or updated the symbol's spec
+type SymbolSpecChangedEvent struct {
+	EventIDValue    string          // Event ID
+	SequenceValue   int64           // Sequence number
+	SymbolValue     string          // Trading pair
+	OccurredAtValue time.Time       // Event time
+	Spec            symbolspec.Spec // Spec in force from this event on
+}
+
+func (e *SymbolSpecChangedEvent) EventID() string       { return e.EventIDValue }
+func (e *SymbolSpecChangedEvent) EventType() string     { return "SymbolSpecChanged" }
+func (e *SymbolSpecChangedEvent) Sequence() int64       { return e.SequenceValue }
+func (e *SymbolSpecChangedEvent) Symbol() string        { return e.SymbolValue }
+func (e *SymbolSpecChangedEvent) OccurredAt() time.Time { return e.OccurredAtValue }
@@ -0,0 +1,327 @@
+package persistence
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"matching-engine/internal/matching"
+)
+
+// EventEncoding selects how event records are encoded in new segments
+type EventEncoding string
+
+const (
+	// EncodingJSON writes each record as a JSON EventRecord
+	EncodingJSON EventEncoding = "json"
+	// EncodingBinary writes each record in the compact binary format
+	EncodingBinary EventEncoding = "binary"
+)
+
+// ParseEventEncoding parses an event encoding name
+func ParseEventEncoding(value string) (EventEncoding, error) {
+	switch EventEncoding(value) {
+	case EncodingJSON, EncodingBinary:
+		return EventEncoding(value), nil
+	default:
+		return "", fmt.Errorf("unknown event encoding: %s", value)
+	}
+}
+
+// Codec identifiers stored in the segment header
+const (
+	codecJSON   byte = 0
+	codecBinary byte = 1
+)
+
+// Binary record layout version, the first byte of every binary payload.
+// Version 1 records are [1][tag][fields] and always hold schema version 1;
+// version 2 records are [2][tag][schema version][fields].
+const (
+	binaryFormatV1      byte = 1
+	binaryFormatVersion byte = 2
+)
+
+// Binary event type tags
+const (
+	binaryTagOrderAccepted byte = 1
+	binaryTagOrderMatched  byte = 2
+	binaryTagOrderCanceled byte = 3
+	binaryTagSymbolStatus  byte = 4
+	binaryTagPriceBand     byte = 5
+	binaryTagSymbolSpec    byte = 6
+)
+
+// eventCodec converts events to and from record payloads.
+// Decoded records carry the typed event in Payload.
+type eventCodec interface {
+	id() byte
+	encode(event matching.Event) ([]byte, error)
+	decode(payload []byte) (*EventRecord, error)
+}
+
+// codecForEncoding returns the codec used to write an encoding
+func codecForEncoding(encoding EventEncoding) (eventCodec, error) {
+	switch encoding {
+	case EncodingJSON:
+		return jsonCodec{}, nil
+	case EncodingBinary:
+		return binaryCodec{}, nil
+	default:
+		return nil, fmt.Errorf("unknown event encoding: %s", encoding)
+	}
+}
+
+// codecByID returns the codec for a segment header codec identifier
+func codecByID(id byte) (eventCodec, error) {
+	switch id {
+	case codecJSON:
+		return jsonCodec{}, nil
+	case codecBinary:
+		return binaryCodec{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported event codec %d", id)
+	}
+}
+
+// jsonCodec encodes records as JSON EventRecords, the original on-disk format
+type jsonCodec struct{}
+
+// jsonRecord defers payload decoding until the event type is known
+type jsonRecord struct {
+	Version    int             `json:"version"`
+	Symbol     string          `json:"symbol"`
+	Sequence   int64           `json:"sequence"`
+	Type       string          `json:"type"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+func (jsonCodec) id() byte { return codecJSON }
+
+func (jsonCodec) encode(event matching.Event) ([]byte, error) {
+	schema, err := schemaForEvent(event)
+	if err != nil {
+		return nil, err
+	}
+
+	// Convert event to EventRecord
+	record := EventRecord{
+		Version:    schema.version,
+		Symbol:     event.Symbol(),
+		Sequence:   event.Sequence(),
+		Type:       event.EventType(),
+		OccurredAt: event.OccurredAt(),
+		Payload:    event,
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal event: %w", err)
+	}
+	return data, nil
+}
+
+func (jsonCodec) decode(payload []byte) (*EventRecord, error) {
+	var raw jsonRecord
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal event record: %w", err)
+	}
+
+	schema, err := defaultEventRegistry.lookup(raw.Type)
+	if err != nil {
+		return nil, err
+	}
+	event, err := schema.decodeJSON(raw.Version, raw.Payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EventRecord{
+		Version:    raw.Version,
+		Symbol:     raw.Symbol,
+		Sequence:   raw.Sequence,
+		Type:       raw.Type,
+		OccurredAt: raw.OccurredAt,
+		Payload:    event,
+	}, nil
+}
+
+// binaryCodec encodes records as a format byte, a type tag, the schema version and the event fields.
+// Integers are varints, strings are length-prefixed and times are seconds, nanoseconds and zone offset.
+type binaryCodec struct{}
+
+func (binaryCodec) id() byte { return codecBinary }
+
+func (binaryCodec) encode(event matching.Event) ([]byte, error) {
+	schema, err := schemaForEvent(event)
+	if err != nil {
+		return nil, err
+	}
+
+	w := binaryWriter{buf: make([]byte, 0, 128)}
+	w.buf = append(w.buf, binaryFormatVersion, schema.tag)
+	w.buf = binary.AppendUvarint(w.buf, uint64(schema.version))
+	schema.encodeBinary(&w, event)
+	return w.buf, nil
+}
+
+func (binaryCodec) decode(payload []byte) (*EventRecord, error) {
+	if len(payload) < 2 {
+		return nil, errors.New("binary event record too short")
+	}
+	format := payload[0]
+	if format != binaryFormatV1 && format != binaryFormatVersion {
+		return nil, fmt.Errorf("unsupported binary event record version %d", format)
+	}
+	schema, err := defaultEventRegistry.lookupTag(payload[1])
+	if err != nil {
+		return nil, err
+	}
+
+	r := binaryReader{data: payload[2:]}
+	version := 1
+	if format != binaryFormatV1 {
+		version = int(r.uvarint())
+		if r.err != nil {
+			return nil, fmt.Errorf("failed to decode binary event record: %w", r.err)
+		}
+	}
+	event, err := schema.decodeBinary(version, &r)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.err != nil {
+		return nil, fmt.Errorf("failed to decode binary event record: %w", r.err)
+	}
+	if len(r.data) != 0 {
+		return nil, fmt.Errorf("failed to decode binary event record: %d trailing bytes", len(r.data))
+	}
+
+	return &EventRecord{
+		Version:    version,
+		Symbol:     event.Symbol(),
+		Sequence:   event.Sequence(),
+		Type:       event.EventType(),
+		OccurredAt: event.OccurredAt(),
+		Payload:    event,
+	}, nil
+}
+
+// schemaForEvent returns the registered schema of an event about to be encoded
+func schemaForEvent(event matching.Event) (*eventSchema, error) {
+	schema, err := defaultEventRegistry.lookup(event.EventType())
+	if err != nil {
+		return nil, err
+	}
+	if reflect.TypeOf(event) != reflect.TypeOf(schema.newEvent()) {
+		return nil, fmt.Errorf("unsupported event type %T for %s", event, schema.name)
+	}
+	return schema, nil
+}
+
+// binaryWriter appends binary record fields to a buffer
+type binaryWriter struct {
+	buf []byte
+}
+
+func (w *binaryWriter) header(eventID string, seq int64, symbol string, occurredAt time.Time) {
+	w.string(eventID)
+	w.varint(seq)
+	w.string(symbol)
+	w.time(occurredAt)
+}
+
+func (w *binaryWriter) varint(v int64) {
+	w.buf = binary.AppendVarint(w.buf, v)
+}
+
+func (w *binaryWriter) string(s string) {
+	w.buf = binary.AppendUvarint(w.buf, uint64(len(s)))
+	w.buf = append(w.buf, s...)
+}
+
+func (w *binaryWriter) time(t time.Time) {
+	_, offset := t.Zone()
+	w.buf = binary.AppendVarint(w.buf, t.Unix())
+	w.buf = binary.AppendUvarint(w.buf, uint64(t.Nanosecond()))
+	w.buf = binary.AppendVarint(w.buf, int64(offset))
+}
+
+// binaryReader consumes binary record fields; the first error sticks and later reads return zero values
+type binaryReader struct {
+	data []byte
+	err  error
+}
+
+var errShortBinaryRecord = errors.New("unexpected end of binary event record")
+
+func (r *binaryReader) header(eventID *string, seq *int64, symbol *string, occurredAt *time.Time) {
+	*eventID = r.string()
+	*seq = r.varint()
+	*symbol = r.string()
+	*occurredAt = r.time()
+}
+
+func (r *binaryReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.data)
+	if n <= 0 {
+		r.err = errShortBinaryRecord
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *binaryReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.err = errShortBinaryRecord
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *binaryReader) string() string {
+	length := r.uvarint()
+	if r.err != nil {
+		return ""
+	}
+	if length > uint64(len(r.data)) {
+		r.err = errShortBinaryRecord
+		return ""
+	}
+	s := string(r.data[:length])
+	r.data = r.data[length:]
+	return s
+}
+
+func (r *binaryReader) time() time.Time {
+	sec := r.varint()
+	nsec := r.uvarint()
+	offset := r.varint()
+	if r.err != nil {
+		return time.Time{}
+	}
+	if nsec >= uint64(time.Second) {
+		r.err = fmt.Errorf("invalid nanoseconds %d", nsec)
+		return time.Time{}
+	}
+
+	t := time.Unix(sec, int64(nsec))
+	if offset == 0 {
+		return t.UTC()
+	}
+	return t.In(time.FixedZone("", int(offset)))
+}
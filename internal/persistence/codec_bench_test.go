@@ -0,0 +1,71 @@
+package persistence
+
+import (
+	"testing"
+	"time"
+
+	"matching-engine/internal/matching"
+)
+
+// benchEvents is one event of each persisted type
+var benchEvents = []matching.Event{
+	newBenchEvent("BTC-USDT", 1),
+	&matching.OrderMatchedEvent{
+		EventIDValue:    "evt_2",
+		SequenceValue:   2,
+		SymbolValue:     "BTC-USDT",
+		OccurredAtValue: time.Now(),
+		TradeID:         "trd_2",
+		MakerOrderID:    "ord_BTC-USDT_1",
+		TakerOrderID:    "ord_BTC-USDT_2",
+		Price:           43000000000,
+		Quantity:        500000,
+		MakerSide:       matching.SideBuy,
+		TakerSide:       matching.SideSell,
+	},
+	&matching.OrderCanceledEvent{
+		EventIDValue:    "evt_3",
+		SequenceValue:   3,
+		SymbolValue:     "BTC-USDT",
+		OccurredAtValue: time.Now(),
+		OrderID:         "ord_BTC-USDT_1",
+		AccountID:       "acc-1",
+		RemainingQty:    500000,
+		CanceledBy:      matching.CancelReasonUser,
+	},
+}
+
+func benchmarkEncode(b *testing.B, codec eventCodec) {
+	var size int
+	for i := 0; i < b.N; i++ {
+		data, err := codec.encode(benchEvents[i%len(benchEvents)])
+		if err != nil {
+			b.Fatalf("encode failed: %v", err)
+		}
+		size += len(data)
+	}
+	b.ReportMetric(float64(size)/float64(b.N), "bytes/event")
+}
+
+func benchmarkDecode(b *testing.B, codec eventCodec) {
+	payloads := make([][]byte, len(benchEvents))
+	for i, event := range benchEvents {
+		data, err := codec.encode(event)
+		if err != nil {
+			b.Fatalf("encode failed: %v", err)
+		}
+		payloads[i] = data
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := codec.decode(payloads[i%len(payloads)]); err != nil {
+			b.Fatalf("decode failed: %v", err)
+		}
+	}
+}
+
+func BenchmarkCodec_EncodeJSON(b *testing.B)   { benchmarkEncode(b, jsonCodec{}) }
+func BenchmarkCodec_EncodeBinary(b *testing.B) { benchmarkEncode(b, binaryCodec{}) }
+func BenchmarkCodec_DecodeJSON(b *testing.B)   { benchmarkDecode(b, jsonCodec{}) }
+func BenchmarkCodec_DecodeBinary(b *testing.B) { benchmarkDecode(b, binaryCodec{}) }
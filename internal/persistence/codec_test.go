@@ -0,0 +1,255 @@
+package persistence
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/quick"
+	"time"
+
+	"matching-engine/internal/matching"
+)
+
+var testCodecs = []eventCodec{jsonCodec{}, binaryCodec{}}
+
+// quickTime builds a time JSON can also represent: years 1970-2106 and a quarter-hour zone offset
+func quickTime(sec uint32, nsec uint32, zone int8) time.Time {
+	t := time.Unix(int64(sec), int64(nsec%uint32(time.Second)))
+	return t.In(time.FixedZone("", int(zone%56)*15*60))
+}
+
+// roundTrip encodes and decodes an event and reports whether it survived unchanged
+func roundTrip(t *testing.T, codec eventCodec, event matching.Event) bool {
+	t.Helper()
+	data, err := codec.encode(event)
+	if err != nil {
+		t.Errorf("%T encode failed: %v", codec, err)
+		return false
+	}
+	record, err := codec.decode(data)
+	if err != nil {
+		t.Errorf("%T decode failed: %v", codec, err)
+		return false
+	}
+	if record.Sequence != event.Sequence() || record.Symbol != event.Symbol() || record.Type != event.EventType() {
+		t.Errorf("%T record header mismatch: %+v", codec, record)
+		return false
+	}
+	return eventsEqual(event, record.Payload.(matching.Event))
+}
+
+// eventsEqual compares events field by field, treating equal instants as equal times
+func eventsEqual(want, got matching.Event) bool {
+	if !want.OccurredAt().Equal(got.OccurredAt()) {
+		return false
+	}
+	w := reflect.ValueOf(want).Elem()
+	g := reflect.ValueOf(got).Elem()
+	if w.Type() != g.Type() {
+		return false
+	}
+	for i := 0; i < w.NumField(); i++ {
+		if w.Type().Field(i).Name == "OccurredAtValue" {
+			continue
+		}
+		if !reflect.DeepEqual(w.Field(i).Interface(), g.Field(i).Interface()) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestCodec_OrderAcceptedRoundTrip(t *testing.T) {
+	for _, codec := range testCodecs {
+		property := func(id, symbol, orderID, clientOrderID, accountID string, seq, price, qty int64, buy bool, sec, nsec uint32, zone int8) bool {
+			side := matching.SideSell
+			if buy {
+				side = matching.SideBuy
+			}
+			return roundTrip(t, codec, &matching.OrderAcceptedEvent{
+				EventIDValue:    id,
+				SequenceValue:   seq,
+				SymbolValue:     symbol,
+				OccurredAtValue: quickTime(sec, nsec, zone),
+				OrderID:         orderID,
+				ClientOrderID:   clientOrderID,
+				AccountID:       accountID,
+				Side:            side,
+				Price:           price,
+				Quantity:        qty,
+				Status:          matching.OrderStatusPartiallyFilled,
+			})
+		}
+		if err := quick.Check(property, nil); err != nil {
+			t.Fatalf("%T: %v", codec, err)
+		}
+	}
+}
+
+func TestCodec_OrderMatchedRoundTrip(t *testing.T) {
+	for _, codec := range testCodecs {
+		property := func(id, symbol, tradeID, makerOrderID, takerOrderID string, seq, price, qty int64, sec, nsec uint32, zone int8) bool {
+			return roundTrip(t, codec, &matching.OrderMatchedEvent{
+				EventIDValue:    id,
+				SequenceValue:   seq,
+				SymbolValue:     symbol,
+				OccurredAtValue: quickTime(sec, nsec, zone),
+				TradeID:         tradeID,
+				MakerOrderID:    makerOrderID,
+				TakerOrderID:    takerOrderID,
+				Price:           price,
+				Quantity:        qty,
+				MakerSide:       matching.SideSell,
+				TakerSide:       matching.SideBuy,
+			})
+		}
+		if err := quick.Check(property, nil); err != nil {
+			t.Fatalf("%T: %v", codec, err)
+		}
+	}
+}
+
+func TestCodec_OrderCanceledRoundTrip(t *testing.T) {
+	for _, codec := range testCodecs {
+		property := func(id, symbol, orderID, accountID, reason string, seq, remaining int64, sec, nsec uint32, zone int8) bool {
+			return roundTrip(t, codec, &matching.OrderCanceledEvent{
+				EventIDValue:    id,
+				SequenceValue:   seq,
+				SymbolValue:     symbol,
+				OccurredAtValue: quickTime(sec, nsec, zone),
+				OrderID:         orderID,
+				AccountID:       accountID,
+				RemainingQty:    remaining,
+				CanceledBy:      matching.CancelReason(reason),
+			})
+		}
+		if err := quick.Check(property, nil); err != nil {
+			t.Fatalf("%T: %v", codec, err)
+		}
+	}
+}
+
+func TestCodec_BinaryRejectsDamagedPayloads(t *testing.T) {
+	data, err := binaryCodec{}.encode(newBenchEvent("BTC-USDT", 7))
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+
+	for i := 0; i < len(data); i++ {
+		if _, err := (binaryCodec{}).decode(data[:i]); err == nil {
+			t.Fatalf("expected error decoding payload truncated to %d bytes", i)
+		}
+	}
+	if _, err := (binaryCodec{}).decode(append(append([]byte{}, data...), 0)); err == nil {
+		t.Fatalf("expected error for trailing bytes")
+	}
+
+	future := append([]byte{}, data...)
+	future[0] = binaryFormatVersion + 1
+	if _, err := (binaryCodec{}).decode(future); err == nil {
+		t.Fatalf("expected error for unknown binary record version")
+	}
+}
+
+func TestFileEventStore_MixedEncodings(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "events")
+	symbol := "BTC-USDT"
+	ctx := context.Background()
+
+	for i, encoding := range []EventEncoding{EncodingJSON, EncodingBinary, EncodingJSON} {
+		config := DefaultFileEventStoreConfig()
+		config.Encoding = encoding
+		store, err := NewFileEventStoreWithConfig(dir, config)
+		if err != nil {
+			t.Fatalf("failed to create event store: %v", err)
+		}
+		from := int64(i*5 + 1)
+		appendRange(t, store, symbol, from, from+4)
+		store.Close()
+	}
+
+	// Switching encoding starts a new segment; every segment is read with its own codec
+	for _, start := range []int64{1, 6, 11} {
+		format, err := readSegmentFormatFile(filepath.Join(dir, symbol, segmentFileName(start)))
+		if err != nil {
+			t.Fatalf("expected segment starting at %d: %v", start, err)
+		}
+		want := codecJSON
+		if start == 6 {
+			want = codecBinary
+		}
+		if format.codec.id() != want {
+			t.Fatalf("segment %d: expected codec %d, got %d", start, want, format.codec.id())
+		}
+	}
+
+	store, err := NewFileEventStore(dir)
+	if err != nil {
+		t.Fatalf("failed to create event store: %v", err)
+	}
+	defer store.Close()
+	events, err := store.ReadFrom(ctx, symbol, 1)
+	if err != nil {
+		t.Fatalf("ReadFrom failed: %v", err)
+	}
+	assertSequences(t, events, 1, 15)
+}
+
+func TestConvertEventLog(t *testing.T) {
+	base := t.TempDir()
+	jsonDir := filepath.Join(base, "json")
+	binaryDir := filepath.Join(base, "binary")
+	backDir := filepath.Join(base, "back")
+	ctx := context.Background()
+
+	store := newSegmentedStore(t, jsonDir, 7)
+	appendRange(t, store, "BTC-USDT", 1, 20)
+	appendRange(t, store, "ETH-USDT", 1, 3)
+	store.Close()
+
+	count, err := ConvertEventLog(ctx, jsonDir, binaryDir, EncodingBinary)
+	if err != nil {
+		t.Fatalf("convert to binary failed: %v", err)
+	}
+	if count != 23 {
+		t.Fatalf("expected 23 converted events, got %d", count)
+	}
+	if _, err := ConvertEventLog(ctx, jsonDir, binaryDir, EncodingBinary); err == nil {
+		t.Fatalf("expected conversion into a non-empty directory to fail")
+	}
+	if _, err := ConvertEventLog(ctx, binaryDir, backDir, EncodingJSON); err != nil {
+		t.Fatalf("convert back to json failed: %v", err)
+	}
+
+	original, err := NewFileEventStore(jsonDir)
+	if err != nil {
+		t.Fatalf("failed to open original store: %v", err)
+	}
+	defer original.Close()
+	for _, dir := range []string{binaryDir, backDir} {
+		converted, err := NewFileEventStore(dir)
+		if err != nil {
+			t.Fatalf("failed to open converted store: %v", err)
+		}
+		for _, symbol := range []string{"BTC-USDT", "ETH-USDT"} {
+			want, err := original.ReadFrom(ctx, symbol, 1)
+			if err != nil {
+				t.Fatalf("ReadFrom original failed: %v", err)
+			}
+			got, err := converted.ReadFrom(ctx, symbol, 1)
+			if err != nil {
+				t.Fatalf("ReadFrom converted failed: %v", err)
+			}
+			if len(got) != len(want) {
+				t.Fatalf("%s %s: expected %d events, got %d", dir, symbol, len(want), len(got))
+			}
+			for i := range want {
+				if !eventsEqual(want[i], got[i]) {
+					t.Fatalf("%s %s: event %d differs: %+v vs %+v", dir, symbol, i, want[i], got[i])
+				}
+			}
+		}
+		converted.Close()
+	}
+}
@@ -0,0 +1,232 @@
+package persistence
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const journalFileSuffix = ".journal"
+
+// JournalRecord is one command in a shard's input journal
+type JournalRecord struct {
+	Shard    int             `json:"shard"`
+	Sequence int64           `json:"seq"`
+	Command  json.RawMessage `json:"command"`
+}
+
+// FileCommandJournal records the commands every shard executes, in execution order,
+// one framed file per shard (shard-<id>.journal). Like the idempotency store it writes
+// through the page cache without fsync; the journal is for replay validation, not recovery.
+type FileCommandJournal struct {
+	baseDir string
+	mu      sync.Mutex
+	shards  map[int]*journalFile
+	closed  bool
+}
+
+// journalFile is the open journal of one shard
+type journalFile struct {
+	mu      sync.Mutex
+	file    *os.File
+	lastSeq int64
+}
+
+// NewFileCommandJournal opens the command journal in baseDir
+func NewFileCommandJournal(baseDir string) (*FileCommandJournal, error) {
+	if err := os.MkdirAll(baseDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create base directory: %w", err)
+	}
+	return &FileCommandJournal{
+		baseDir: baseDir,
+		shards:  make(map[int]*journalFile),
+	}, nil
+}
+
+// Append records a command for a shard under the shard's next journal sequence
+func (j *FileCommandJournal) Append(ctx context.Context, shardID int, command any) error {
+	data, err := json.Marshal(command)
+	if err != nil {
+		return fmt.Errorf("failed to marshal journaled command: %w", err)
+	}
+
+	jf, err := j.openShard(shardID)
+	if err != nil {
+		return err
+	}
+
+	jf.mu.Lock()
+	defer jf.mu.Unlock()
+	if jf.file == nil {
+		return fmt.Errorf("command journal is closed")
+	}
+	payload, err := json.Marshal(JournalRecord{Shard: shardID, Sequence: jf.lastSeq + 1, Command: data})
+	if err != nil {
+		return fmt.Errorf("failed to marshal journal record: %w", err)
+	}
+	if _, err := jf.file.Write(appendFrame(nil, payload)); err != nil {
+		return fmt.Errorf("failed to write journal record: %w", err)
+	}
+	jf.lastSeq++
+	return nil
+}
+
+// ListShards returns the shard IDs that have a journal, in ascending order
+func (j *FileCommandJournal) ListShards(ctx context.Context) ([]int, error) {
+	entries, err := os.ReadDir(j.baseDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read journal directory: %w", err)
+	}
+
+	var shards []int
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, "shard-") || !strings.HasSuffix(name, journalFileSuffix) {
+			continue
+		}
+		id, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, "shard-"), journalFileSuffix))
+		if err != nil {
+			continue
+		}
+		shards = append(shards, id)
+	}
+	sort.Ints(shards)
+	return shards, nil
+}
+
+// ReadShard returns the journaled commands of a shard in sequence order.
+// A torn record at the tail is ignored.
+func (j *FileCommandJournal) ReadShard(ctx context.Context, shardID int) ([]JournalRecord, error) {
+	records, _, err := readJournal(j.shardPath(shardID))
+	return records, err
+}
+
+// Close closes every open shard journal
+func (j *FileCommandJournal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.closed = true
+
+	var firstErr error
+	for _, jf := range j.shards {
+		jf.mu.Lock()
+		if jf.file != nil {
+			if err := jf.file.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+			jf.file = nil
+		}
+		jf.mu.Unlock()
+	}
+	return firstErr
+}
+
+func (j *FileCommandJournal) shardPath(shardID int) string {
+	return filepath.Join(j.baseDir, fmt.Sprintf("shard-%d%s", shardID, journalFileSuffix))
+}
+
+// openShard opens a shard's journal for appending, truncating a torn tail record left by a crash
+func (j *FileCommandJournal) openShard(shardID int) (*journalFile, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.closed {
+		return nil, fmt.Errorf("command journal is closed")
+	}
+	if jf, ok := j.shards[shardID]; ok {
+		return jf, nil
+	}
+
+	path := j.shardPath(shardID)
+	records, end, err := readJournal(path)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open command journal: %w", err)
+	}
+	if end == 0 {
+		end = segmentHeaderSize
+		if _, err := file.WriteAt(newSegmentHeader(codecJSON), 0); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to write journal header: %w", err)
+		}
+	}
+	if err := file.Truncate(end); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to truncate command journal: %w", err)
+	}
+	if _, err := file.Seek(end, io.SeekStart); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to seek command journal: %w", err)
+	}
+
+	jf := &journalFile{file: file}
+	if len(records) > 0 {
+		jf.lastSeq = records[len(records)-1].Sequence
+	}
+	j.shards[shardID] = jf
+	return jf, nil
+}
+
+// readJournal reads a shard journal and returns its records and the offset after the last good one.
+// A missing file reads as empty.
+func readJournal(path string) ([]JournalRecord, int64, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open command journal: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to stat command journal: %w", err)
+	}
+	if info.Size() < segmentHeaderSize {
+		return nil, 0, nil // Created, or crashed while writing the header
+	}
+	reader, err := newRecordReader(file, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !reader.framed {
+		return nil, 0, fmt.Errorf("command journal %s has no segment header", path)
+	}
+
+	var records []JournalRecord
+	var corrupt *corruptRecordError
+	end := reader.offset
+	for {
+		payload, offset, err := reader.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if errors.As(err, &corrupt) && corrupt.torn {
+			log.Printf("WARNING: ignoring %s", err)
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+
+		var record JournalRecord
+		if err := json.Unmarshal(payload, &record); err != nil {
+			return nil, 0, fmt.Errorf("failed to unmarshal journal record at offset %d of %s: %w", offset, path, err)
+		}
+		records = append(records, record)
+		end = reader.offset
+	}
+	return records, end, nil
+}
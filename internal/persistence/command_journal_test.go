@@ -0,0 +1,61 @@
+package persistence
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileCommandJournal_SequencesPerShardAcrossReopen(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	journal, err := NewFileCommandJournal(dir)
+	if err != nil {
+		t.Fatalf("NewFileCommandJournal failed: %v", err)
+	}
+	for i, shard := range []int{1, 0, 1} {
+		if err := journal.Append(ctx, shard, map[string]int{"n": i}); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+	journal.Close()
+
+	// A torn record at the tail is dropped on reopen
+	f, _ := os.OpenFile(filepath.Join(dir, "shard-1.journal"), os.O_APPEND|os.O_WRONLY, 0644)
+	f.Write([]byte{0xff, 0x00, 0x00})
+	f.Close()
+
+	journal, err = NewFileCommandJournal(dir)
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	defer journal.Close()
+	if err := journal.Append(ctx, 1, map[string]int{"n": 3}); err != nil {
+		t.Fatalf("Append after reopen failed: %v", err)
+	}
+
+	shards, err := journal.ListShards(ctx)
+	if err != nil || len(shards) != 2 || shards[0] != 0 || shards[1] != 1 {
+		t.Fatalf("expected shards [0 1], got %v (%v)", shards, err)
+	}
+	records, err := journal.ReadShard(ctx, 1)
+	if err != nil {
+		t.Fatalf("ReadShard failed: %v", err)
+	}
+	want := []int{0, 2, 3}
+	if len(records) != len(want) {
+		t.Fatalf("expected %d records, got %d", len(want), len(records))
+	}
+	for i, record := range records {
+		var command map[string]int
+		if err := json.Unmarshal(record.Command, &command); err != nil {
+			t.Fatalf("unmarshal failed: %v", err)
+		}
+		if record.Shard != 1 || record.Sequence != int64(i+1) || command["n"] != want[i] {
+			t.Fatalf("record %d: got %+v (%v)", i, record, command)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package persistence
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"matching-engine/internal/matching"
+)
+
+// convertBatchSize is the number of events written per append while converting
+const convertBatchSize = 1024
+
+// ConvertEventLog copies every symbol's event log from srcDir into a new store at dstDir
+// written with the given encoding. Any source format is accepted, including unframed
+// JSON Lines logs. dstDir must be empty or missing. Returns the number of events copied.
+func ConvertEventLog(ctx context.Context, srcDir, dstDir string, encoding EventEncoding) (int64, error) {
+	if _, err := ParseEventEncoding(string(encoding)); err != nil {
+		return 0, err
+	}
+	if _, err := os.Stat(srcDir); err != nil {
+		return 0, fmt.Errorf("failed to open source event log: %w", err)
+	}
+	entries, err := os.ReadDir(dstDir)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, fmt.Errorf("failed to read destination directory: %w", err)
+	}
+	if len(entries) > 0 {
+		return 0, fmt.Errorf("destination directory %s is not empty", dstDir)
+	}
+
+	src, err := NewFileEventStore(srcDir)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	config := DefaultFileEventStoreConfig()
+	config.Encoding = encoding
+	dst, err := NewFileEventStoreWithConfig(dstDir, config)
+	if err != nil {
+		return 0, err
+	}
+	defer dst.Close()
+
+	symbols, err := src.ListSymbols(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, symbol := range symbols {
+		n, err := convertSymbol(ctx, src, dst, symbol)
+		total += n
+		if err != nil {
+			return total, fmt.Errorf("failed to convert symbol %s: %w", symbol, err)
+		}
+
+		srcLast, err := src.GetLastSequence(ctx, symbol)
+		if err != nil {
+			return total, err
+		}
+		dstLast, err := dst.GetLastSequence(ctx, symbol)
+		if err != nil {
+			return total, err
+		}
+		if srcLast != dstLast {
+			return total, fmt.Errorf("converted log for symbol %s ends at sequence %d, source ends at %d", symbol, dstLast, srcLast)
+		}
+	}
+
+	return total, dst.Close()
+}
+
+// convertSymbol streams one symbol's events from src to dst in batches
+func convertSymbol(ctx context.Context, src, dst *FileEventStore, symbol string) (int64, error) {
+	log, err := src.loadLog(symbol)
+	if err != nil {
+		return 0, err
+	}
+
+	src.mu.RLock()
+	defer src.mu.RUnlock()
+
+	var total int64
+	batch := make([]matching.Event, 0, convertBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := dst.AppendBatch(ctx, symbol, batch); err != nil {
+			return err
+		}
+		total += int64(len(batch))
+		batch = batch[:0]
+		return nil
+	}
+
+	err = log.readFrom(0, func(record *EventRecord) error {
+		event, err := src.deserializeEvent(record)
+		if err != nil {
+			return err
+		}
+		batch = append(batch, event)
+		if len(batch) >= convertBatchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return total, err
+	}
+	return total, flush()
+}
@@ -0,0 +1,95 @@
+package persistence
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const deadManSwitchesFile = "dead_man_switches.json"
+
+// deadManSwitchesFormatVersion is the version of the dead-man's switch file layout
+const deadManSwitchesFormatVersion = 1
+
+// deadManSwitchesDocument is the on-disk form of the armed dead-man's switches
+type deadManSwitchesDocument struct {
+	FormatVersion int              `json:"format_version"`
+	TimeoutsMs    map[string]int64 `json:"timeouts_ms"` // account -> timeout in milliseconds
+}
+
+// FileDeadManSwitchStore keeps the timeouts of the armed dead-man's switches in one JSON file,
+// replaced atomically on every change
+type FileDeadManSwitchStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileDeadManSwitchStore opens the dead-man's switch store in baseDir
+func NewFileDeadManSwitchStore(baseDir string) (*FileDeadManSwitchStore, error) {
+	if err := os.MkdirAll(baseDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create base directory: %w", err)
+	}
+	return &FileDeadManSwitchStore{path: filepath.Join(baseDir, deadManSwitchesFile)}, nil
+}
+
+// Load returns the persisted timeouts by account; a missing file loads as no switches
+func (s *FileDeadManSwitchStore) Load(ctx context.Context) (map[string]time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return map[string]time.Duration{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dead-man's switches: %w", err)
+	}
+
+	var doc deadManSwitchesDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal dead-man's switches: %w", err)
+	}
+	if doc.FormatVersion != deadManSwitchesFormatVersion {
+		return nil, fmt.Errorf("unsupported dead-man's switches format version %d", doc.FormatVersion)
+	}
+	timeouts := make(map[string]time.Duration, len(doc.TimeoutsMs))
+	for accountID, ms := range doc.TimeoutsMs {
+		timeouts[accountID] = time.Duration(ms) * time.Millisecond
+	}
+	return timeouts, nil
+}
+
+// SaveDeadManSwitches replaces the persisted switches with timeouts
+func (s *FileDeadManSwitchStore) SaveDeadManSwitches(ctx context.Context, timeouts map[string]time.Duration) error {
+	doc := deadManSwitchesDocument{
+		FormatVersion: deadManSwitchesFormatVersion,
+		TimeoutsMs:    make(map[string]int64, len(timeouts)),
+	}
+	for accountID, timeout := range timeouts {
+		doc.TimeoutsMs[accountID] = timeout.Milliseconds()
+	}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal dead-man's switches: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Write to temporary file first
+	tempPath := s.path + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write dead-man's switches: %w", err)
+	}
+
+	// Atomic rename
+	if err := os.Rename(tempPath, s.path); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to replace dead-man's switches: %w", err)
+	}
+	return nil
+}
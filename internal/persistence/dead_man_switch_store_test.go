@@ -0,0 +1,40 @@
+package persistence
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestFileDeadManSwitchStore_SaveAndLoad(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	store, err := NewFileDeadManSwitchStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileDeadManSwitchStore failed: %v", err)
+	}
+	loaded, err := store.Load(ctx)
+	if err != nil || len(loaded) != 0 {
+		t.Fatalf("expected no switches before the first save, got %v, %v", loaded, err)
+	}
+
+	if err := store.SaveDeadManSwitches(ctx, map[string]time.Duration{"mm1": 5 * time.Second, "mm2": 1500 * time.Millisecond}); err != nil {
+		t.Fatalf("SaveDeadManSwitches failed: %v", err)
+	}
+	if err := store.SaveDeadManSwitches(ctx, map[string]time.Duration{"mm2": 1500 * time.Millisecond}); err != nil {
+		t.Fatalf("SaveDeadManSwitches failed: %v", err)
+	}
+
+	reopened, err := NewFileDeadManSwitchStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileDeadManSwitchStore failed: %v", err)
+	}
+	loaded, err = reopened.Load(ctx)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(loaded) != 1 || loaded["mm2"] != 1500*time.Millisecond {
+		t.Fatalf("unexpected switches %v", loaded)
+	}
+}
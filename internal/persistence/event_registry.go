@@ -0,0 +1,395 @@
+package persistence
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"matching-engine/internal/matching"
+	"matching-engine/internal/symbolspec"
+)
+
+// ErrUnsupportedEventVersion is returned for records whose schema version this build cannot read,
+// typically written by a newer release. Such records fail the read instead of being skipped.
+var ErrUnsupportedEventVersion = errors.New("unsupported event schema version")
+
+// Changing a persisted event type:
+//  1. bump its version,
+//  2. add upcasters[old] rewriting an old JSON payload into the new shape,
+//  3. add binaryDecoders[new] for the new layout and point encodeBinary at it,
+//  4. add golden files for the new version under testdata/golden.
+// Never edit the decoder, upcaster or golden files of a version that has been released.
+
+// jsonUpcaster rewrites a JSON payload of one schema version into the shape of the next
+type jsonUpcaster func(fields map[string]json.RawMessage) error
+
+// binaryDecoder reads the binary fields of one schema version into the current event struct,
+// filling fields the version did not have
+type binaryDecoder func(r *binaryReader) matching.Event
+
+// eventSchema describes one persisted event type
+type eventSchema struct {
+	name           string                // EventType() and the JSON record type
+	tag            byte                  // Binary type tag
+	version        int                   // Schema version written by this build
+	newEvent       func() matching.Event // Zero value of the current struct
+	upcasters      map[int]jsonUpcaster  // upcasters[v] turns version v into v+1
+	binaryDecoders map[int]binaryDecoder // One per schema version
+	encodeBinary   func(w *binaryWriter, event matching.Event)
+}
+
+// eventRegistry maps persisted event types to their schemas
+type eventRegistry struct {
+	byName map[string]*eventSchema
+	byTag  map[byte]*eventSchema
+}
+
+func newEventRegistry(schemas ...*eventSchema) *eventRegistry {
+	r := &eventRegistry{
+		byName: make(map[string]*eventSchema),
+		byTag:  make(map[byte]*eventSchema),
+	}
+	for _, schema := range schemas {
+		r.register(schema)
+	}
+	return r
+}
+
+// register adds a schema. An incomplete version history is a programming error and panics.
+func (r *eventRegistry) register(schema *eventSchema) {
+	if _, exists := r.byName[schema.name]; exists {
+		panic(fmt.Sprintf("event type %s registered twice", schema.name))
+	}
+	if _, exists := r.byTag[schema.tag]; exists {
+		panic(fmt.Sprintf("binary tag %d registered twice", schema.tag))
+	}
+	for v := 1; v <= schema.version; v++ {
+		if _, ok := schema.binaryDecoders[v]; !ok {
+			panic(fmt.Sprintf("event type %s has no binary decoder for version %d", schema.name, v))
+		}
+		if _, ok := schema.upcasters[v]; v < schema.version && !ok {
+			panic(fmt.Sprintf("event type %s has no upcaster from version %d", schema.name, v))
+		}
+	}
+	r.byName[schema.name] = schema
+	r.byTag[schema.tag] = schema
+}
+
+func (r *eventRegistry) lookup(name string) (*eventSchema, error) {
+	schema, ok := r.byName[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown event type: %s", name)
+	}
+	return schema, nil
+}
+
+func (r *eventRegistry) lookupTag(tag byte) (*eventSchema, error) {
+	schema, ok := r.byTag[tag]
+	if !ok {
+		return nil, fmt.Errorf("unknown binary event type tag %d", tag)
+	}
+	return schema, nil
+}
+
+// checkVersion rejects versions this build has no decoder for
+func (s *eventSchema) checkVersion(version int) error {
+	if version < 1 || version > s.version {
+		return fmt.Errorf("%w: %s version %d, this build reads versions 1 to %d", ErrUnsupportedEventVersion, s.name, version, s.version)
+	}
+	return nil
+}
+
+// decodeJSON upcasts a JSON payload of the given version and decodes it into the current struct
+func (s *eventSchema) decodeJSON(version int, payload json.RawMessage) (matching.Event, error) {
+	if err := s.checkVersion(version); err != nil {
+		return nil, err
+	}
+	if version < s.version {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(payload, &fields); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal %s v%d payload: %w", s.name, version, err)
+		}
+		for v := version; v < s.version; v++ {
+			if err := s.upcasters[v](fields); err != nil {
+				return nil, fmt.Errorf("failed to upcast %s from v%d: %w", s.name, v, err)
+			}
+		}
+		var err error
+		if payload, err = json.Marshal(fields); err != nil {
+			return nil, err
+		}
+	}
+
+	event := s.newEvent()
+	if err := json.Unmarshal(payload, event); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %sEvent: %w", s.name, err)
+	}
+	return event, nil
+}
+
+// decodeBinary reads binary fields of the given version into the current struct
+func (s *eventSchema) decodeBinary(version int, r *binaryReader) (matching.Event, error) {
+	if err := s.checkVersion(version); err != nil {
+		return nil, err
+	}
+	return s.binaryDecoders[version](r), nil
+}
+
+// defaultEventRegistry holds every event type this build persists
+var defaultEventRegistry = newEventRegistry(
+	orderAcceptedSchema,
+	orderMatchedSchema,
+	orderCanceledSchema,
+	symbolStatusChangedSchema,
+	priceBandBreachedSchema,
+	symbolSpecChangedSchema,
+)
+
+var orderAcceptedSchema = &eventSchema{
+	name:     "OrderAccepted",
+	tag:      binaryTagOrderAccepted,
+	version:  4,
+	newEvent: func() matching.Event { return &matching.OrderAcceptedEvent{} },
+	upcasters: map[int]jsonUpcaster{
+		// v2 added APIKey; orders accepted before it have none
+		1: func(fields map[string]json.RawMessage) error { return nil },
+		// v3 added GroupID; orders accepted before it are in no group
+		2: func(fields map[string]json.RawMessage) error { return nil },
+		// v4 replaced the raw APIKey with APIKeyID; raw keys are dropped, not carried forward
+		3: func(fields map[string]json.RawMessage) error {
+			delete(fields, "APIKey")
+			return nil
+		},
+	},
+	binaryDecoders: map[int]binaryDecoder{
+		1: decodeOrderAcceptedV1,
+		2: decodeOrderAcceptedV2,
+		3: func(r *binaryReader) matching.Event {
+			e := decodeOrderAcceptedV2(r).(*matching.OrderAcceptedEvent)
+			e.GroupID = r.string()
+			return e
+		},
+		4: func(r *binaryReader) matching.Event {
+			e := decodeOrderAcceptedV1(r).(*matching.OrderAcceptedEvent)
+			e.APIKeyID = r.string()
+			e.GroupID = r.string()
+			return e
+		},
+	},
+	encodeBinary: func(w *binaryWriter, event matching.Event) {
+		e := event.(*matching.OrderAcceptedEvent)
+		w.header(e.EventIDValue, e.SequenceValue, e.SymbolValue, e.OccurredAtValue)
+		w.string(e.OrderID)
+		w.string(e.ClientOrderID)
+		w.string(e.AccountID)
+		w.string(string(e.Side))
+		w.varint(e.Price)
+		w.varint(e.Quantity)
+		w.string(string(e.Status))
+		w.string(e.APIKeyID)
+		w.string(e.GroupID)
+	},
+}
+
+func decodeOrderAcceptedV1(r *binaryReader) matching.Event {
+	e := &matching.OrderAcceptedEvent{}
+	r.header(&e.EventIDValue, &e.SequenceValue, &e.SymbolValue, &e.OccurredAtValue)
+	e.OrderID = r.string()
+	e.ClientOrderID = r.string()
+	e.AccountID = r.string()
+	e.Side = matching.Side(r.string())
+	e.Price = r.varint()
+	e.Quantity = r.varint()
+	e.Status = matching.OrderStatus(r.string())
+	return e
+}
+
+// decodeOrderAcceptedV2 skips the raw API key of v2 and v3 records
+func decodeOrderAcceptedV2(r *binaryReader) matching.Event {
+	e := decodeOrderAcceptedV1(r).(*matching.OrderAcceptedEvent)
+	r.string()
+	return e
+}
+
+var orderMatchedSchema = &eventSchema{
+	name:     "OrderMatched",
+	tag:      binaryTagOrderMatched,
+	version:  1,
+	newEvent: func() matching.Event { return &matching.OrderMatchedEvent{} },
+	binaryDecoders: map[int]binaryDecoder{
+		1: func(r *binaryReader) matching.Event {
+			e := &matching.OrderMatchedEvent{}
+			r.header(&e.EventIDValue, &e.SequenceValue, &e.SymbolValue, &e.OccurredAtValue)
+			e.TradeID = r.string()
+			e.MakerOrderID = r.string()
+			e.TakerOrderID = r.string()
+			e.Price = r.varint()
+			e.Quantity = r.varint()
+			e.MakerSide = matching.Side(r.string())
+			e.TakerSide = matching.Side(r.string())
+			return e
+		},
+	},
+	encodeBinary: func(w *binaryWriter, event matching.Event) {
+		e := event.(*matching.OrderMatchedEvent)
+		w.header(e.EventIDValue, e.SequenceValue, e.SymbolValue, e.OccurredAtValue)
+		w.string(e.TradeID)
+		w.string(e.MakerOrderID)
+		w.string(e.TakerOrderID)
+		w.varint(e.Price)
+		w.varint(e.Quantity)
+		w.string(string(e.MakerSide))
+		w.string(string(e.TakerSide))
+	},
+}
+
+var orderCanceledSchema = &eventSchema{
+	name:     "OrderCanceled",
+	tag:      binaryTagOrderCanceled,
+	version:  1,
+	newEvent: func() matching.Event { return &matching.OrderCanceledEvent{} },
+	binaryDecoders: map[int]binaryDecoder{
+		1: func(r *binaryReader) matching.Event {
+			e := &matching.OrderCanceledEvent{}
+			r.header(&e.EventIDValue, &e.SequenceValue, &e.SymbolValue, &e.OccurredAtValue)
+			e.OrderID = r.string()
+			e.AccountID = r.string()
+			e.RemainingQty = r.varint()
+			e.CanceledBy = matching.CancelReason(r.string())
+			return e
+		},
+	},
+	encodeBinary: func(w *binaryWriter, event matching.Event) {
+		e := event.(*matching.OrderCanceledEvent)
+		w.header(e.EventIDValue, e.SequenceValue, e.SymbolValue, e.OccurredAtValue)
+		w.string(e.OrderID)
+		w.string(e.AccountID)
+		w.varint(e.RemainingQty)
+		w.string(string(e.CanceledBy))
+	},
+}
+
+var symbolStatusChangedSchema = &eventSchema{
+	name:     "SymbolStatusChanged",
+	tag:      binaryTagSymbolStatus,
+	version:  1,
+	newEvent: func() matching.Event { return &matching.SymbolStatusChangedEvent{} },
+	binaryDecoders: map[int]binaryDecoder{
+		1: func(r *binaryReader) matching.Event {
+			e := &matching.SymbolStatusChangedEvent{}
+			r.header(&e.EventIDValue, &e.SequenceValue, &e.SymbolValue, &e.OccurredAtValue)
+			e.OldStatus = matching.SymbolStatus(r.string())
+			e.NewStatus = matching.SymbolStatus(r.string())
+			e.Reason = r.string()
+			return e
+		},
+	},
+	encodeBinary: func(w *binaryWriter, event matching.Event) {
+		e := event.(*matching.SymbolStatusChangedEvent)
+		w.header(e.EventIDValue, e.SequenceValue, e.SymbolValue, e.OccurredAtValue)
+		w.string(string(e.OldStatus))
+		w.string(string(e.NewStatus))
+		w.string(e.Reason)
+	},
+}
+
+var priceBandBreachedSchema = &eventSchema{
+	name:     "PriceBandBreached",
+	tag:      binaryTagPriceBand,
+	version:  1,
+	newEvent: func() matching.Event { return &matching.PriceBandBreachedEvent{} },
+	binaryDecoders: map[int]binaryDecoder{
+		1: func(r *binaryReader) matching.Event {
+			e := &matching.PriceBandBreachedEvent{}
+			r.header(&e.EventIDValue, &e.SequenceValue, &e.SymbolValue, &e.OccurredAtValue)
+			e.OrderID = r.string()
+			e.ReferencePrice = r.varint()
+			e.Price = r.varint()
+			e.BandBps = r.varint()
+			return e
+		},
+	},
+	encodeBinary: func(w *binaryWriter, event matching.Event) {
+		e := event.(*matching.PriceBandBreachedEvent)
+		w.header(e.EventIDValue, e.SequenceValue, e.SymbolValue, e.OccurredAtValue)
+		w.string(e.OrderID)
+		w.varint(e.ReferencePrice)
+		w.varint(e.Price)
+		w.varint(e.BandBps)
+	},
+}
+
+var symbolSpecChangedSchema = &eventSchema{
+	name:     "SymbolSpecChanged",
+	tag:      binaryTagSymbolSpec,
+	version:  3,
+	newEvent: func() matching.Event { return &matching.SymbolSpecChangedEvent{} },
+	upcasters: map[int]jsonUpcaster{
+		// v2 added order limits; specs changed before them have none
+		1: func(fields map[string]json.RawMessage) error { return nil },
+		// v3 added the allocation policy; specs changed before it are FIFO
+		2: func(fields map[string]json.RawMessage) error { return nil },
+	},
+	binaryDecoders: map[int]binaryDecoder{
+		1: decodeSymbolSpecChangedV1,
+		2: decodeSymbolSpecChangedV2,
+		3: func(r *binaryReader) matching.Event {
+			e := decodeSymbolSpecChangedV2(r).(*matching.SymbolSpecChangedEvent)
+			e.Spec.Allocation = symbolspec.Allocation(r.string())
+			e.Spec.LMMAccountID = r.string()
+			e.Spec.LMMShareBps = r.varint()
+			return e
+		},
+	},
+	encodeBinary: func(w *binaryWriter, event matching.Event) {
+		e := event.(*matching.SymbolSpecChangedEvent)
+		w.header(e.EventIDValue, e.SequenceValue, e.SymbolValue, e.OccurredAtValue)
+		w.string(e.Spec.Symbol)
+		w.varint(int64(e.Spec.PriceScale))
+		w.varint(int64(e.Spec.QuantityScale))
+		w.varint(e.Spec.PriceTickInt)
+		w.varint(e.Spec.QtyStepInt)
+		w.varint(e.Spec.PriceBandBps)
+		w.varint(e.Spec.TradeBandBps)
+		var auction int64
+		if e.Spec.BreakerAuction {
+			auction = 1
+		}
+		w.varint(auction)
+		w.varint(int64(e.Spec.BreakerCoolingOff))
+		w.varint(e.Spec.MinQtyInt)
+		w.varint(e.Spec.MaxQtyInt)
+		w.varint(e.Spec.MinPriceInt)
+		w.varint(e.Spec.MaxPriceInt)
+		w.varint(e.Spec.MinNotionalInt)
+		w.string(string(e.Spec.Allocation))
+		w.string(e.Spec.LMMAccountID)
+		w.varint(e.Spec.LMMShareBps)
+	},
+}
+
+func decodeSymbolSpecChangedV1(r *binaryReader) matching.Event {
+	e := &matching.SymbolSpecChangedEvent{}
+	r.header(&e.EventIDValue, &e.SequenceValue, &e.SymbolValue, &e.OccurredAtValue)
+	e.Spec.Symbol = r.string()
+	e.Spec.PriceScale = int(r.varint())
+	e.Spec.QuantityScale = int(r.varint())
+	e.Spec.PriceTickInt = r.varint()
+	e.Spec.QtyStepInt = r.varint()
+	e.Spec.PriceBandBps = r.varint()
+	e.Spec.TradeBandBps = r.varint()
+	e.Spec.BreakerAuction = r.varint() != 0
+	e.Spec.BreakerCoolingOff = time.Duration(r.varint())
+	return e
+}
+
+func decodeSymbolSpecChangedV2(r *binaryReader) matching.Event {
+	e := decodeSymbolSpecChangedV1(r).(*matching.SymbolSpecChangedEvent)
+	e.Spec.MinQtyInt = r.varint()
+	e.Spec.MaxQtyInt = r.varint()
+	e.Spec.MinPriceInt = r.varint()
+	e.Spec.MaxPriceInt = r.varint()
+	e.Spec.MinNotionalInt = r.varint()
+	return e
+}
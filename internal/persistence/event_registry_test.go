@@ -0,0 +1,280 @@
+package persistence
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"matching-engine/internal/matching"
+	"matching-engine/internal/symbolspec"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files of the current event versions")
+
+const goldenDir = "testdata/golden"
+
+var goldenTime = time.Date(2025, 1, 2, 3, 4, 5, 600000000, time.UTC)
+
+// goldenEvents is what every golden record of a type decodes to, whatever its version
+var goldenEvents = map[string]matching.Event{
+	"OrderAccepted": &matching.OrderAcceptedEvent{
+		EventIDValue:    "evt_1",
+		SequenceValue:   1,
+		SymbolValue:     "BTC-USDT",
+		OccurredAtValue: goldenTime,
+		OrderID:         "ord_1",
+		ClientOrderID:   "cli_1",
+		AccountID:       "acc-001",
+		Side:            matching.SideBuy,
+		Price:           4300000000000,
+		Quantity:        150000000,
+		Status:          matching.OrderStatusNew,
+	},
+	"OrderMatched": &matching.OrderMatchedEvent{
+		EventIDValue:    "evt_2",
+		SequenceValue:   2,
+		SymbolValue:     "BTC-USDT",
+		OccurredAtValue: goldenTime,
+		TradeID:         "trd_1",
+		MakerOrderID:    "ord_1",
+		TakerOrderID:    "ord_2",
+		Price:           4300000000000,
+		Quantity:        50000000,
+		MakerSide:       matching.SideBuy,
+		TakerSide:       matching.SideSell,
+	},
+	"OrderCanceled": &matching.OrderCanceledEvent{
+		EventIDValue:    "evt_3",
+		SequenceValue:   3,
+		SymbolValue:     "BTC-USDT",
+		OccurredAtValue: goldenTime,
+		OrderID:         "ord_1",
+		AccountID:       "acc-001",
+		RemainingQty:    100000000,
+		CanceledBy:      matching.CancelReasonUser,
+	},
+	"SymbolStatusChanged": &matching.SymbolStatusChangedEvent{
+		EventIDValue:    "evt_4",
+		SequenceValue:   4,
+		SymbolValue:     "BTC-USDT",
+		OccurredAtValue: goldenTime,
+		OldStatus:       matching.SymbolStatusTrading,
+		NewStatus:       matching.SymbolStatusHalted,
+		Reason:          "exchange incident",
+	},
+	"PriceBandBreached": &matching.PriceBandBreachedEvent{
+		EventIDValue:    "evt_5",
+		SequenceValue:   5,
+		SymbolValue:     "BTC-USDT",
+		OccurredAtValue: goldenTime,
+		OrderID:         "ord_1",
+		ReferencePrice:  43000000000,
+		Price:           47500000000,
+		BandBps:         500,
+	},
+	"SymbolSpecChanged": &matching.SymbolSpecChangedEvent{
+		EventIDValue:    "evt_6",
+		SequenceValue:   6,
+		SymbolValue:     "SOL-USDT",
+		OccurredAtValue: goldenTime,
+		Spec: symbolspec.Spec{
+			Symbol:            "SOL-USDT",
+			PriceScale:        3,
+			QuantityScale:     4,
+			PriceTickInt:      10,
+			QtyStepInt:        100,
+			PriceBandBps:      1000,
+			TradeBandBps:      500,
+			BreakerAuction:    true,
+			BreakerCoolingOff: 5 * time.Minute,
+		},
+	},
+}
+
+// goldenFile names a golden record: <Type>.v<version>.json, <Type>.v<version>.bin,
+// or <Type>.v1.format1.bin for the binary layout that carried no schema version
+func goldenFile(name string, version int, ext string) string {
+	return filepath.Join(goldenDir, fmt.Sprintf("%s.v%d.%s", name, version, ext))
+}
+
+func TestGolden_EveryVersionHasFiles(t *testing.T) {
+	for name, schema := range defaultEventRegistry.byName {
+		if _, ok := goldenEvents[name]; !ok {
+			t.Fatalf("no golden event for %s", name)
+		}
+		for v := 1; v <= schema.version; v++ {
+			for _, ext := range []string{"json", "bin"} {
+				if _, err := os.Stat(goldenFile(name, v, ext)); err != nil {
+					t.Errorf("missing golden file for %s v%d: %v", name, v, err)
+				}
+			}
+		}
+	}
+}
+
+func TestGolden_DecodesEveryVersion(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join(goldenDir, "*"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no golden files: %v", err)
+	}
+
+	for _, path := range files {
+		parts := strings.Split(filepath.Base(path), ".")
+		name := parts[0]
+		version, err := strconv.Atoi(strings.TrimPrefix(parts[1], "v"))
+		if err != nil {
+			t.Fatalf("%s: bad golden file name", path)
+		}
+		var codec eventCodec = jsonCodec{}
+		if parts[len(parts)-1] == "bin" {
+			codec = binaryCodec{}
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("read %s: %v", path, err)
+		}
+		record, err := codec.decode(data)
+		if err != nil {
+			t.Fatalf("%s: decode failed: %v", path, err)
+		}
+		if record.Type != name || record.Version != version {
+			t.Fatalf("%s: decoded as %s v%d", path, record.Type, record.Version)
+		}
+		if !eventsEqual(goldenEvents[name], record.Payload.(matching.Event)) {
+			t.Fatalf("%s: decoded %+v, want %+v", path, record.Payload, goldenEvents[name])
+		}
+	}
+}
+
+// TestGolden_CurrentVersionEncoding guards against accidental format changes.
+// Run with -update after bumping a version to write the new version's files.
+func TestGolden_CurrentVersionEncoding(t *testing.T) {
+	for name, schema := range defaultEventRegistry.byName {
+		for ext, codec := range map[string]eventCodec{"json": jsonCodec{}, "bin": binaryCodec{}} {
+			data, err := codec.encode(goldenEvents[name])
+			if err != nil {
+				t.Fatalf("%s: encode failed: %v", name, err)
+			}
+			path := goldenFile(name, schema.version, ext)
+			if *updateGolden {
+				if err := os.WriteFile(path, data, 0644); err != nil {
+					t.Fatalf("write %s: %v", path, err)
+				}
+				continue
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("read %s: %v", path, err)
+			}
+			if !bytes.Equal(data, want) {
+				t.Errorf("%s: encoding changed without a version bump\n got %q\nwant %q", path, data, want)
+			}
+		}
+	}
+}
+
+func TestDecode_RejectsFutureVersions(t *testing.T) {
+	for name, schema := range defaultEventRegistry.byName {
+		data, err := os.ReadFile(goldenFile(name, schema.version, "json"))
+		if err != nil {
+			t.Fatalf("read golden: %v", err)
+		}
+		var record map[string]any
+		if err := json.Unmarshal(data, &record); err != nil {
+			t.Fatalf("unmarshal golden: %v", err)
+		}
+		record["version"] = schema.version + 1
+		future, _ := json.Marshal(record)
+		if _, err := (jsonCodec{}).decode(future); !errors.Is(err, ErrUnsupportedEventVersion) {
+			t.Fatalf("%s json: expected ErrUnsupportedEventVersion, got %v", name, err)
+		}
+
+		data, err = os.ReadFile(goldenFile(name, schema.version, "bin"))
+		if err != nil {
+			t.Fatalf("read golden: %v", err)
+		}
+		future = append([]byte{}, data...)
+		future[2] = byte(schema.version + 1) // Single-byte uvarint schema version
+		if _, err := (binaryCodec{}).decode(future); !errors.Is(err, ErrUnsupportedEventVersion) {
+			t.Fatalf("%s binary: expected ErrUnsupportedEventVersion, got %v", name, err)
+		}
+	}
+}
+
+func TestOrderAccepted_DropsRawAPIKeysOfOldVersions(t *testing.T) {
+	for version := 2; version <= 3; version++ {
+		event, err := orderAcceptedSchema.decodeJSON(version, json.RawMessage(`{"OrderID":"ord_1","APIKey":"secret"}`))
+		if err != nil {
+			t.Fatalf("v%d: decode failed: %v", version, err)
+		}
+		if e := event.(*matching.OrderAcceptedEvent); e.OrderID != "ord_1" || e.APIKeyID != "" {
+			t.Fatalf("v%d: expected the raw key dropped, got %+v", version, e)
+		}
+	}
+}
+
+func TestEventRegistry_UpcastsOldPayloads(t *testing.T) {
+	// A hypothetical history: v1 called the reason "Reason", v2 left it empty for user cancels
+	schema := &eventSchema{
+		name:     "OrderCanceled",
+		tag:      binaryTagOrderCanceled,
+		version:  3,
+		newEvent: func() matching.Event { return &matching.OrderCanceledEvent{} },
+		upcasters: map[int]jsonUpcaster{
+			1: func(fields map[string]json.RawMessage) error {
+				fields["CanceledBy"] = fields["Reason"]
+				delete(fields, "Reason")
+				return nil
+			},
+			2: func(fields map[string]json.RawMessage) error {
+				if reason, ok := fields["CanceledBy"]; !ok || string(reason) == `""` {
+					fields["CanceledBy"] = json.RawMessage(`"USER"`)
+				}
+				return nil
+			},
+		},
+		binaryDecoders: map[int]binaryDecoder{
+			1: orderCanceledSchema.binaryDecoders[1],
+			2: orderCanceledSchema.binaryDecoders[1],
+			3: orderCanceledSchema.binaryDecoders[1],
+		},
+	}
+	registry := newEventRegistry(schema)
+
+	for version, payload := range map[int]string{
+		1: `{"OrderID":"ord_1","Reason":"SYSTEM"}`,
+		2: `{"OrderID":"ord_1","CanceledBy":""}`,
+		3: `{"OrderID":"ord_1","CanceledBy":"EXPIRED"}`,
+	} {
+		s, _ := registry.lookup("OrderCanceled")
+		event, err := s.decodeJSON(version, json.RawMessage(payload))
+		if err != nil {
+			t.Fatalf("v%d: decode failed: %v", version, err)
+		}
+		want := map[int]matching.CancelReason{1: "SYSTEM", 2: "USER", 3: "EXPIRED"}[version]
+		if got := event.(*matching.OrderCanceledEvent).CanceledBy; got != want {
+			t.Fatalf("v%d: expected %s, got %s", version, want, got)
+		}
+	}
+	if _, err := schema.decodeJSON(4, json.RawMessage(`{}`)); !errors.Is(err, ErrUnsupportedEventVersion) {
+		t.Fatalf("expected ErrUnsupportedEventVersion, got %v", err)
+	}
+
+	// A version without an upcaster is refused at registration
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected registration of an incomplete history to panic")
+		}
+	}()
+	delete(schema.upcasters, 2)
+	newEventRegistry(schema)
+}
@@ -1,233 +1,406 @@
 package persistence
 
 import (
-	"bufio"
 	"context"
-	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
+	"time"
 
 	"matching-engine/internal/matching"
 )
 
-// FileEventStore implements EventStore using JSONL files
+// DurabilityPolicy controls when appended events are fsynced to disk
+type DurabilityPolicy string
+
+const (
+	// DurabilityAlways fsyncs every append before returning
+	DurabilityAlways DurabilityPolicy = "always"
+	// DurabilityBatch coalesces concurrent appends into one shared fsync (group commit).
+	// Callers are released only after the shared fsync completes.
+	DurabilityBatch DurabilityPolicy = "batch"
+	// DurabilityInterval writes immediately and fsyncs on a timer.
+	// A crash may lose events appended within the last interval.
+	DurabilityInterval DurabilityPolicy = "interval"
+)
+
+// DefaultDurability is the durability policy used when none is configured.
+// Group commit is as durable as an fsync per append and holds up under concurrent shards.
+const DefaultDurability = DurabilityBatch
+
+// ParseDurabilityPolicy parses a durability policy name
+func ParseDurabilityPolicy(value string) (DurabilityPolicy, error) {
+	switch policy := DurabilityPolicy(strings.ToLower(strings.TrimSpace(value))); policy {
+	case DurabilityAlways, DurabilityBatch, DurabilityInterval:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown durability policy: %s", value)
+	}
+}
+
+// FileEventStoreConfig holds configuration for the file event store
+type FileEventStoreConfig struct {
+	Durability        DurabilityPolicy // Fsync policy (default: DefaultDurability)
+	GroupCommitWindow time.Duration    // Extra time a group commit waits for more appends (default: 0 = commit what is queued)
+	GroupCommitSize   int              // Pending records that force an early group commit (default: 512)
+	SyncInterval      time.Duration    // Fsync period for the interval policy (default: 50ms)
+	SegmentMaxBytes   int64            // Roll over to a new segment after this many bytes (default: 64MiB, 0 = unlimited)
+	SegmentMaxRecords int64            // Roll over to a new segment after this many records (default: 0 = unlimited)
+	IndexInterval     int64            // Records between sparse index entries (default: 64)
+	RepairMode        bool             // Verify all segments on open and truncate at the first damaged record
+	Encoding          EventEncoding    // Record encoding for new segments (default: json)
+}
+
+// DefaultFileEventStoreConfig returns default file event store configuration
+func DefaultFileEventStoreConfig() *FileEventStoreConfig {
+	return &FileEventStoreConfig{
+		Durability:        DefaultDurability,
+		GroupCommitWindow: 0,
+		GroupCommitSize:   512,
+		SyncInterval:      50 * time.Millisecond,
+		SegmentMaxBytes:   64 << 20,
+		IndexInterval:     64,
+		Encoding:          EncodingJSON,
+	}
+}
+
+// FileEventStore implements EventStore using segmented, CRC32C framed log files.
+// Each symbol directory holds segment-<start_seq>.log files with a sparse .idx offset index.
+// A pre-segmentation events.log is still read as the first segment, and segments moved to
+// the per-symbol archive directory by ArchiveThrough stay readable.
 type FileEventStore struct {
 	baseDir string
+	config  FileEventStoreConfig
+	codec   eventCodec // Codec for new segments
 	mu      sync.RWMutex
-	files   map[string]*os.File // symbol -> file handle
+	logs    map[string]*symbolLog // symbol -> segmented log
+	dirty   map[string]bool       // symbol -> written but not yet fsynced (interval policy)
+	syncErr error                 // last background fsync error (interval policy)
+
+	committer *groupCommitter // Group commit writer (batch policy only)
+	stopSync  chan struct{}   // Stops the background syncer (interval policy only)
+	bgWg      sync.WaitGroup
+
+	closeMu sync.RWMutex
+	closed  bool
 }
 
 // NewFileEventStore creates a new file-based event store
 func NewFileEventStore(baseDir string) (*FileEventStore, error) {
-	if err := os.MkdirAll(baseDir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create base directory: %w", err)
-	}
-
-	return &FileEventStore{
-		baseDir: baseDir,
-		files:   make(map[string]*os.File),
-	}, nil
+	return NewFileEventStoreWithConfig(baseDir, nil)
 }
 
-// Append appends an event to the log for a specific symbol
-func (s *FileEventStore) Append(ctx context.Context, symbol string, event matching.Event) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	// Get or create file handle
-	file, err := s.getOrCreateFile(symbol)
+// NewFileEventStoreWithConfig creates a new file-based event store with the given configuration
+func NewFileEventStoreWithConfig(baseDir string, config *FileEventStoreConfig) (*FileEventStore, error) {
+	cfg, err := normalizeFileEventStoreConfig(config)
 	if err != nil {
-		return fmt.Errorf("failed to get file for symbol %s: %w", symbol, err)
+		return nil, err
 	}
-
-	// Convert event to EventRecord
-	record := EventRecord{
-		Version:    1,
-		Symbol:     event.Symbol(),
-		Sequence:   event.Sequence(),
-		Type:       event.EventType(),
-		OccurredAt: event.OccurredAt(),
-		Payload:    event,
+	if err := os.MkdirAll(baseDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create base directory: %w", err)
 	}
 
-	// Marshal to JSON
-	data, err := json.Marshal(record)
+	codec, err := codecForEncoding(cfg.Encoding)
 	if err != nil {
-		return fmt.Errorf("failed to marshal event: %w", err)
+		return nil, err
 	}
 
-	// Append to file with newline
-	if _, err := file.Write(append(data, '\n')); err != nil {
-		return fmt.Errorf("failed to write event: %w", err)
+	s := &FileEventStore{
+		baseDir: baseDir,
+		config:  cfg,
+		codec:   codec,
+		logs:    make(map[string]*symbolLog),
+		dirty:   make(map[string]bool),
 	}
 
-	// Sync to disk for durability
-	if err := file.Sync(); err != nil {
-		return fmt.Errorf("failed to sync file: %w", err)
+	switch cfg.Durability {
+	case DurabilityBatch:
+		s.committer = newGroupCommitter(s, cfg.GroupCommitWindow, cfg.GroupCommitSize)
+		s.bgWg.Add(1)
+		go s.committer.run(&s.bgWg)
+	case DurabilityInterval:
+		s.stopSync = make(chan struct{})
+		s.bgWg.Add(1)
+		go s.syncLoop()
 	}
 
-	return nil
+	return s, nil
 }
 
-// getOrCreateFile gets or creates a file handle for a symbol
-func (s *FileEventStore) getOrCreateFile(symbol string) (*os.File, error) {
-	if file, ok := s.files[symbol]; ok {
-		return file, nil
+func normalizeFileEventStoreConfig(config *FileEventStoreConfig) (FileEventStoreConfig, error) {
+	defaults := DefaultFileEventStoreConfig()
+	if config == nil {
+		return *defaults, nil
 	}
 
-	// Create symbol directory
-	symbolDir := filepath.Join(s.baseDir, symbol)
-	if err := os.MkdirAll(symbolDir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create symbol directory: %w", err)
+	normalized := *config
+	if normalized.Durability == "" {
+		normalized.Durability = defaults.Durability
 	}
-
-	// Open or create events.log file
-	filePath := filepath.Join(symbolDir, "events.log")
-	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open events file: %w", err)
+	if _, err := ParseDurabilityPolicy(string(normalized.Durability)); err != nil {
+		return FileEventStoreConfig{}, err
+	}
+	if normalized.GroupCommitWindow < 0 {
+		normalized.GroupCommitWindow = defaults.GroupCommitWindow
+	}
+	if normalized.GroupCommitSize <= 0 {
+		normalized.GroupCommitSize = defaults.GroupCommitSize
+	}
+	if normalized.SyncInterval <= 0 {
+		normalized.SyncInterval = defaults.SyncInterval
+	}
+	if normalized.SegmentMaxBytes < 0 {
+		normalized.SegmentMaxBytes = defaults.SegmentMaxBytes
+	}
+	if normalized.SegmentMaxRecords < 0 {
+		normalized.SegmentMaxRecords = defaults.SegmentMaxRecords
+	}
+	if normalized.IndexInterval <= 0 {
+		normalized.IndexInterval = defaults.IndexInterval
+	}
+	if normalized.Encoding == "" {
+		normalized.Encoding = defaults.Encoding
+	}
+	if _, err := ParseEventEncoding(string(normalized.Encoding)); err != nil {
+		return FileEventStoreConfig{}, err
 	}
 
-	s.files[symbol] = file
-	return file, nil
+	return normalized, nil
 }
 
-// ReadFrom reads events from a specific sequence number (inclusive)
-func (s *FileEventStore) ReadFrom(ctx context.Context, symbol string, fromSeq int64) ([]matching.Event, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	// Build file path
-	filePath := filepath.Join(s.baseDir, symbol, "events.log")
+// Append appends an event to the log for a specific symbol
+func (s *FileEventStore) Append(ctx context.Context, symbol string, event matching.Event) error {
+	return s.AppendBatch(ctx, symbol, []matching.Event{event})
+}
 
-	// Check if file exists
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		return []matching.Event{}, nil // No events yet
+// AppendBatch appends events to the log for a specific symbol as one unit.
+// The events are written contiguously and made durable according to the store's durability policy.
+func (s *FileEventStore) AppendBatch(ctx context.Context, symbol string, events []matching.Event) error {
+	if len(events) == 0 {
+		return nil
 	}
 
-	// Open file for reading
-	file, err := os.Open(filePath)
+	records, err := encodeEventRecords(s.codec, events)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open events file: %w", err)
+		return err
 	}
-	defer file.Close()
 
-	var events []matching.Event
-	scanner := bufio.NewScanner(file)
-
-	for scanner.Scan() {
-		line := scanner.Bytes()
-		if len(line) == 0 {
-			continue
-		}
+	s.closeMu.RLock()
+	defer s.closeMu.RUnlock()
+	if s.closed {
+		return fmt.Errorf("event store is closed")
+	}
 
-		// Parse EventRecord
-		var record EventRecord
-		if err := json.Unmarshal(line, &record); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal event record: %w", err)
-		}
+	switch s.config.Durability {
+	case DurabilityBatch:
+		return s.committer.commit(ctx, symbol, records)
+	case DurabilityInterval:
+		return s.appendBuffered(symbol, records)
+	default:
+		return s.appendSynced(symbol, records)
+	}
+}
 
-		// Skip events before fromSeq
-		if record.Sequence < fromSeq {
-			continue
+// encodeEventRecords encodes events with a codec as CRC32C framed records
+func encodeEventRecords(codec eventCodec, events []matching.Event) ([]encodedRecord, error) {
+	records := make([]encodedRecord, 0, len(events))
+	for _, event := range events {
+		if event == nil {
+			return nil, fmt.Errorf("event is nil")
 		}
 
-		// Deserialize payload to concrete event type
-		event, err := s.deserializeEvent(&record)
+		data, err := codec.encode(event)
 		if err != nil {
-			return nil, fmt.Errorf("failed to deserialize event: %w", err)
+			return nil, err
 		}
 
-		events = append(events, event)
+		records = append(records, encodedRecord{
+			seq:  event.Sequence(),
+			data: appendFrame(make([]byte, 0, frameHeaderSize+len(data)), data),
+		})
 	}
+	return records, nil
+}
 
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("failed to scan events file: %w", err)
+// appendSynced writes and fsyncs under the store lock (always policy)
+func (s *FileEventStore) appendSynced(symbol string, records []encodedRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	log, err := s.writeLocked(symbol, records)
+	if err != nil {
+		return err
 	}
 
-	return events, nil
+	// Sync to disk for durability
+	return log.sync()
 }
 
-// deserializeEvent deserializes an EventRecord to a concrete event type
-func (s *FileEventStore) deserializeEvent(record *EventRecord) (matching.Event, error) {
-	// Re-marshal payload to JSON for type-specific unmarshaling
-	payloadBytes, err := json.Marshal(record.Payload)
+// appendBuffered writes without fsync and leaves the sync to the background syncer (interval policy)
+func (s *FileEventStore) appendBuffered(symbol string, records []encodedRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.syncErr != nil {
+		err := s.syncErr
+		s.syncErr = nil
+		return fmt.Errorf("previous background sync failed: %w", err)
+	}
+
+	if _, err := s.writeLocked(symbol, records); err != nil {
+		return err
+	}
+	s.dirty[symbol] = true
+
+	return nil
+}
+
+// writeLocked appends encoded records to the symbol's log. Caller must hold s.mu.
+func (s *FileEventStore) writeLocked(symbol string, records []encodedRecord) (*symbolLog, error) {
+	log, err := s.getOrOpenLogLocked(symbol)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+		return nil, fmt.Errorf("failed to open log for symbol %s: %w", symbol, err)
 	}
 
-	switch record.Type {
-	case "OrderAccepted":
-		var event matching.OrderAcceptedEvent
-		if err := json.Unmarshal(payloadBytes, &event); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal OrderAcceptedEvent: %w", err)
-		}
-		return &event, nil
+	if err := log.append(records, s.config.SegmentMaxBytes, s.config.SegmentMaxRecords); err != nil {
+		return nil, err
+	}
 
-	case "OrderMatched":
-		var event matching.OrderMatchedEvent
-		if err := json.Unmarshal(payloadBytes, &event); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal OrderMatchedEvent: %w", err)
+	return log, nil
+}
+
+// syncLoop periodically fsyncs files written since the last tick (interval policy)
+func (s *FileEventStore) syncLoop() {
+	defer s.bgWg.Done()
+
+	ticker := time.NewTicker(s.config.SyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.mu.Lock()
+			s.syncDirtyLocked()
+			s.mu.Unlock()
+		case <-s.stopSync:
+			return
 		}
-		return &event, nil
+	}
+}
 
-	case "OrderCanceled":
-		var event matching.OrderCanceledEvent
-		if err := json.Unmarshal(payloadBytes, &event); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal OrderCanceledEvent: %w", err)
+// syncDirtyLocked fsyncs all dirty files. Caller must hold s.mu.
+func (s *FileEventStore) syncDirtyLocked() {
+	for symbol := range s.dirty {
+		if log, ok := s.logs[symbol]; ok {
+			if err := log.sync(); err != nil && s.syncErr == nil {
+				s.syncErr = fmt.Errorf("failed to sync log for symbol %s: %w", symbol, err)
+			}
 		}
-		return &event, nil
+		delete(s.dirty, symbol)
+	}
+}
 
-	default:
-		return nil, fmt.Errorf("unknown event type: %s", record.Type)
+// getOrOpenLogLocked returns the symbol's log, loading segment metadata on first use.
+// Caller must hold s.mu for writing.
+func (s *FileEventStore) getOrOpenLogLocked(symbol string) (*symbolLog, error) {
+	if log, ok := s.logs[symbol]; ok {
+		return log, nil
 	}
+
+	log, err := openSymbolLog(filepath.Join(s.baseDir, symbol), logOptions{
+		indexInterval: s.config.IndexInterval,
+		repair:        s.config.RepairMode,
+		codec:         s.codec,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.logs[symbol] = log
+	return log, nil
 }
 
-// GetLastSequence returns the last sequence number for a symbol
-func (s *FileEventStore) GetLastSequence(ctx context.Context, symbol string) (int64, error) {
+// loadLog returns the symbol's log for reading; callers then hold s.mu.RLock while using it
+func (s *FileEventStore) loadLog(symbol string) (*symbolLog, error) {
 	s.mu.RLock()
-	defer s.mu.RUnlock()
+	log, ok := s.logs[symbol]
+	s.mu.RUnlock()
+	if ok {
+		return log, nil
+	}
 
-	filePath := filepath.Join(s.baseDir, symbol, "events.log")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.getOrOpenLogLocked(symbol)
+}
+
+// ReadFrom reads events from a specific sequence number (inclusive).
+// The sparse index is used to seek directly to fromSeq instead of scanning the whole log.
+func (s *FileEventStore) ReadFrom(ctx context.Context, symbol string, fromSeq int64) ([]matching.Event, error) {
+	log, err := s.loadLog(symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-	// Check if file exists
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		return 0, nil // No events yet, start from 0
+	if len(log.segments) == 0 {
+		return []matching.Event{}, nil // No events yet
 	}
 
-	// Open file for reading
-	file, err := os.Open(filePath)
+	var events []matching.Event
+	err = log.readFrom(fromSeq, func(record *EventRecord) error {
+		// Deserialize payload to concrete event type
+		event, err := s.deserializeEvent(record)
+		if err != nil {
+			return fmt.Errorf("failed to deserialize event: %w", err)
+		}
+
+		events = append(events, event)
+		return nil
+	})
 	if err != nil {
-		return 0, fmt.Errorf("failed to open events file: %w", err)
+		return nil, err
 	}
-	defer file.Close()
 
-	var lastSeq int64 = 0
-	scanner := bufio.NewScanner(file)
+	return events, nil
+}
 
-	for scanner.Scan() {
-		line := scanner.Bytes()
-		if len(line) == 0 {
-			continue
-		}
+// deserializeEvent returns the concrete event decoded by the segment codec
+func (s *FileEventStore) deserializeEvent(record *EventRecord) (matching.Event, error) {
+	event, ok := record.Payload.(matching.Event)
+	if !ok {
+		return nil, fmt.Errorf("unknown event type: %s", record.Type)
+	}
+	return event, nil
+}
 
-		var record EventRecord
-		if err := json.Unmarshal(line, &record); err != nil {
-			return 0, fmt.Errorf("failed to unmarshal event record: %w", err)
-		}
+// ArchiveThrough moves sealed segments that only hold events with sequence <= seq into the
+// symbol's archive directory. Archived events remain readable through ReadFrom.
+func (s *FileEventStore) ArchiveThrough(ctx context.Context, symbol string, seq int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-		if record.Sequence > lastSeq {
-			lastSeq = record.Sequence
-		}
+	log, err := s.getOrOpenLogLocked(symbol)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open log for symbol %s: %w", symbol, err)
 	}
+	return log.archiveThrough(seq)
+}
 
-	if err := scanner.Err(); err != nil {
-		return 0, fmt.Errorf("failed to scan events file: %w", err)
+// GetLastSequence returns the last sequence number for a symbol
+func (s *FileEventStore) GetLastSequence(ctx context.Context, symbol string) (int64, error) {
+	log, err := s.loadLog(symbol)
+	if err != nil {
+		return 0, err
 	}
 
-	return lastSeq, nil
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return log.lastSeq, nil
 }
 
 // ListSymbols lists all symbols that have event logs
@@ -249,9 +422,8 @@ func (s *FileEventStore) ListSymbols(ctx context.Context) ([]string, error) {
 	var symbols []string
 	for _, entry := range entries {
 		if entry.IsDir() {
-			// Check if events.log exists in this directory
-			eventsFile := filepath.Join(s.baseDir, entry.Name(), "events.log")
-			if _, err := os.Stat(eventsFile); err == nil {
+			// Check if a segment or legacy events.log exists in this directory
+			if hasEventLog(filepath.Join(s.baseDir, entry.Name())) {
 				symbols = append(symbols, entry.Name())
 			}
 		}
@@ -260,15 +432,37 @@ func (s *FileEventStore) ListSymbols(ctx context.Context) ([]string, error) {
 	return symbols, nil
 }
 
-// Close closes all open file handles
+// Close flushes pending appends and closes all open file handles
 func (s *FileEventStore) Close() error {
+	s.closeMu.Lock()
+	if s.closed {
+		s.closeMu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.closeMu.Unlock()
+
+	// Stop background writers; the group committer drains its queue before exiting.
+	if s.committer != nil {
+		s.committer.stop()
+	}
+	if s.stopSync != nil {
+		close(s.stopSync)
+	}
+	s.bgWg.Wait()
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	s.syncDirtyLocked()
+
 	var errs []error
-	for symbol, file := range s.files {
-		if err := file.Close(); err != nil {
-			errs = append(errs, fmt.Errorf("failed to close file for symbol %s: %w", symbol, err))
+	if s.syncErr != nil {
+		errs = append(errs, s.syncErr)
+	}
+	for symbol, log := range s.logs {
+		if err := log.close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close log for symbol %s: %w", symbol, err))
 		}
 	}
 
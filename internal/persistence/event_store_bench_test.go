@@ -0,0 +1,69 @@
+package persistence
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"matching-engine/internal/matching"
+)
+
+func newBenchEvent(symbol string, seq int64) matching.Event {
+	return &matching.OrderAcceptedEvent{
+		EventIDValue:    fmt.Sprintf("evt_%d", seq),
+		SequenceValue:   seq,
+		SymbolValue:     symbol,
+		OccurredAtValue: time.Now(),
+		OrderID:         fmt.Sprintf("ord_%s_%d", symbol, seq),
+		ClientOrderID:   fmt.Sprintf("cli_%d", seq),
+		AccountID:       "acc-1",
+		Side:            matching.SideBuy,
+		Price:           43000000000,
+		Quantity:        1000000,
+		Status:          matching.OrderStatusNew,
+	}
+}
+
+// benchmarkAppend appends from parallel writers, each owning one symbol like a shard does.
+func benchmarkAppend(b *testing.B, policy DurabilityPolicy) {
+	config := DefaultFileEventStoreConfig()
+	config.Durability = policy
+	store, err := NewFileEventStoreWithConfig(filepath.Join(b.TempDir(), "events"), config)
+	if err != nil {
+		b.Fatalf("failed to create event store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	var writerID atomic.Int64
+
+	b.SetParallelism(8)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		symbol := fmt.Sprintf("SYM%d-USDT", writerID.Add(1))
+		var seq int64
+		for pb.Next() {
+			seq++
+			if err := store.Append(ctx, symbol, newBenchEvent(symbol, seq)); err != nil {
+				b.Errorf("append failed: %v", err)
+				return
+			}
+		}
+	})
+}
+
+func BenchmarkFileEventStore_AppendAlways(b *testing.B) {
+	benchmarkAppend(b, DurabilityAlways)
+}
+
+func BenchmarkFileEventStore_AppendBatch(b *testing.B) {
+	benchmarkAppend(b, DurabilityBatch)
+}
+
+func BenchmarkFileEventStore_AppendInterval(b *testing.B) {
+	benchmarkAppend(b, DurabilityInterval)
+}
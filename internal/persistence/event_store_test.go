@@ -2,7 +2,9 @@ package persistence
 
 import (
 	"context"
+	"fmt"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
@@ -254,3 +256,131 @@ func TestFileEventStore_MultipleSymbols(t *testing.T) {
 		t.Errorf("expected ETH-USDT, got %s", ethEvents[0].Symbol())
 	}
 }
+
+func TestFileEventStore_AppendBatch(t *testing.T) {
+	tempDir := t.TempDir()
+	store, err := NewFileEventStore(filepath.Join(tempDir, "events"))
+	if err != nil {
+		t.Fatalf("failed to create event store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	symbol := "BTC-USDT"
+
+	batch := make([]matching.Event, 0, 3)
+	for i := int64(1); i <= 3; i++ {
+		batch = append(batch, &matching.OrderAcceptedEvent{
+			EventIDValue:    fmt.Sprintf("evt-%d", i),
+			SequenceValue:   i,
+			SymbolValue:     symbol,
+			OccurredAtValue: time.Now(),
+			OrderID:         fmt.Sprintf("order-%d", i),
+			ClientOrderID:   fmt.Sprintf("client-%d", i),
+			AccountID:       "acc-1",
+			Side:            matching.SideBuy,
+			Price:           100000,
+			Quantity:        10000,
+			Status:          matching.OrderStatusNew,
+		})
+	}
+
+	if err := store.AppendBatch(ctx, symbol, batch); err != nil {
+		t.Fatalf("failed to append batch: %v", err)
+	}
+
+	events, err := store.ReadFrom(ctx, symbol, 1)
+	if err != nil {
+		t.Fatalf("failed to read events: %v", err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(events))
+	}
+	for i, event := range events {
+		if event.Sequence() != int64(i+1) {
+			t.Errorf("expected sequence %d, got %d", i+1, event.Sequence())
+		}
+	}
+}
+
+func TestFileEventStore_DurabilityPolicies(t *testing.T) {
+	policies := []DurabilityPolicy{DurabilityAlways, DurabilityBatch, DurabilityInterval}
+
+	for _, policy := range policies {
+		t.Run(string(policy), func(t *testing.T) {
+			tempDir := t.TempDir()
+			config := DefaultFileEventStoreConfig()
+			config.Durability = policy
+			store, err := NewFileEventStoreWithConfig(filepath.Join(tempDir, "events"), config)
+			if err != nil {
+				t.Fatalf("failed to create event store: %v", err)
+			}
+
+			ctx := context.Background()
+			symbols := []string{"BTC-USDT", "ETH-USDT", "SOL-USDT", "DOGE-USDT"}
+			const perSymbol = 50
+
+			// One writer per symbol, like one shard per symbol.
+			var wg sync.WaitGroup
+			errCh := make(chan error, len(symbols))
+			for _, symbol := range symbols {
+				wg.Add(1)
+				go func(sym string) {
+					defer wg.Done()
+					for i := int64(1); i <= perSymbol; i++ {
+						if err := store.Append(ctx, sym, newBenchEvent(sym, i)); err != nil {
+							errCh <- err
+							return
+						}
+					}
+				}(symbol)
+			}
+			wg.Wait()
+			close(errCh)
+			for err := range errCh {
+				t.Fatalf("append failed: %v", err)
+			}
+
+			if err := store.Close(); err != nil {
+				t.Fatalf("failed to close event store: %v", err)
+			}
+			if err := store.Append(ctx, "BTC-USDT", newBenchEvent("BTC-USDT", perSymbol+1)); err == nil {
+				t.Fatalf("expected append after close to fail")
+			}
+
+			// Reopen and verify every symbol has an ordered, complete log.
+			reopened, err := NewFileEventStore(filepath.Join(tempDir, "events"))
+			if err != nil {
+				t.Fatalf("failed to reopen event store: %v", err)
+			}
+			defer reopened.Close()
+
+			for _, symbol := range symbols {
+				events, err := reopened.ReadFrom(ctx, symbol, 1)
+				if err != nil {
+					t.Fatalf("failed to read %s: %v", symbol, err)
+				}
+				if len(events) != perSymbol {
+					t.Fatalf("expected %d events for %s, got %d", perSymbol, symbol, len(events))
+				}
+				for i, event := range events {
+					if event.Sequence() != int64(i+1) {
+						t.Fatalf("%s: expected sequence %d, got %d", symbol, i+1, event.Sequence())
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestParseDurabilityPolicy(t *testing.T) {
+	if policy, err := ParseDurabilityPolicy(" Batch "); err != nil || policy != DurabilityBatch {
+		t.Fatalf("expected batch policy, got %q (err=%v)", policy, err)
+	}
+	if _, err := ParseDurabilityPolicy("sometimes"); err == nil {
+		t.Fatalf("expected error for unknown policy")
+	}
+	if _, err := NewFileEventStoreWithConfig(t.TempDir(), &FileEventStoreConfig{Durability: "sometimes"}); err == nil {
+		t.Fatalf("expected error for unknown policy in config")
+	}
+}
@@ -0,0 +1,147 @@
+package persistence
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// commitRequest is a pending append waiting for the next group commit
+type commitRequest struct {
+	symbol  string
+	records []encodedRecord
+	done    chan error
+}
+
+// groupCommitter coalesces appends from all shards and fsyncs each touched file once per batch
+type groupCommitter struct {
+	store    *FileEventStore
+	reqs     chan *commitRequest
+	window   time.Duration // Max time to wait for more appends after the first one
+	maxBatch int           // Pending records that force an early commit
+}
+
+// newGroupCommitter creates a group committer for a store
+func newGroupCommitter(store *FileEventStore, window time.Duration, maxBatch int) *groupCommitter {
+	return &groupCommitter{
+		store:    store,
+		reqs:     make(chan *commitRequest, maxBatch),
+		window:   window,
+		maxBatch: maxBatch,
+	}
+}
+
+// commit enqueues encoded records and waits until they are durable
+func (g *groupCommitter) commit(ctx context.Context, symbol string, records []encodedRecord) error {
+	req := &commitRequest{
+		symbol:  symbol,
+		records: records,
+		done:    make(chan error, 1),
+	}
+
+	select {
+	case g.reqs <- req:
+	case <-ctx.Done():
+		return fmt.Errorf("failed to enqueue append: %w", ctx.Err())
+	}
+
+	// Once enqueued the write will happen, so wait for the outcome regardless of ctx
+	// to never report a durable event as failed.
+	return <-req.done
+}
+
+// stop closes the request queue; run drains pending requests before returning.
+// Caller must guarantee no further commit calls (FileEventStore.closeMu).
+func (g *groupCommitter) stop() {
+	close(g.reqs)
+}
+
+// run is the writer loop that forms batches and commits them
+func (g *groupCommitter) run(wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	for {
+		first, ok := <-g.reqs
+		if !ok {
+			return
+		}
+
+		batch := g.collect(first)
+		g.flush(batch)
+	}
+}
+
+// collect gathers requests following first until the window expires or the size limit is hit
+func (g *groupCommitter) collect(first *commitRequest) []*commitRequest {
+	batch := []*commitRequest{first}
+	pending := len(first.records)
+
+	if g.window <= 0 {
+		// Drain only what is already queued
+		for pending < g.maxBatch {
+			select {
+			case req, ok := <-g.reqs:
+				if !ok {
+					return batch
+				}
+				batch = append(batch, req)
+				pending += len(req.records)
+			default:
+				return batch
+			}
+		}
+		return batch
+	}
+
+	timer := time.NewTimer(g.window)
+	defer timer.Stop()
+
+	for pending < g.maxBatch {
+		select {
+		case req, ok := <-g.reqs:
+			if !ok {
+				return batch
+			}
+			batch = append(batch, req)
+			pending += len(req.records)
+		case <-timer.C:
+			return batch
+		}
+	}
+	return batch
+}
+
+// flush writes every request in order, fsyncs each touched file once and releases the callers.
+// A request whose write fails is truncated away by the log, so the requests after it still
+// append at a record boundary.
+func (g *groupCommitter) flush(batch []*commitRequest) {
+	s := g.store
+	results := make([]error, len(batch))
+
+	s.mu.Lock()
+	touched := make(map[string]*symbolLog)
+	for i, req := range batch {
+		log, err := s.writeLocked(req.symbol, req.records)
+		if err != nil {
+			results[i] = err
+			continue
+		}
+		touched[req.symbol] = log
+	}
+
+	syncErrs := make(map[string]error, len(touched))
+	for symbol, log := range touched {
+		if err := log.sync(); err != nil {
+			syncErrs[symbol] = err
+		}
+	}
+	s.mu.Unlock()
+
+	for i, req := range batch {
+		if results[i] == nil {
+			results[i] = syncErrs[req.symbol]
+		}
+		req.done <- results[i]
+	}
+}
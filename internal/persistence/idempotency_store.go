@@ -0,0 +1,170 @@
+package persistence
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const idempotencyFileName = "records.log"
+
+// idempotencyRecordHeader is the part of a persisted idempotency record the store needs:
+// the key to keep only the newest record per key, and the expiry to drop stale ones
+type idempotencyRecordHeader struct {
+	AccountID      string    `json:"account_id"`
+	Symbol         string    `json:"symbol"`
+	CommandType    string    `json:"command_type"`
+	IdempotencyKey string    `json:"idempotency_key"`
+	ExpiresAt      time.Time `json:"expires_at"`
+}
+
+// FileIdempotencyStore persists idempotency records as JSON lines in one file.
+// Expired and superseded records are compacted away when the store is opened.
+// Records go through the OS page cache without fsync: they survive a process crash,
+// while a power loss may drop the newest ones, whose retries then hit the order ID duplicate check.
+type FileIdempotencyStore struct {
+	path string
+	file *os.File
+	mu   sync.Mutex
+}
+
+// NewFileIdempotencyStore opens the idempotency store in baseDir, compacting it
+func NewFileIdempotencyStore(baseDir string) (*FileIdempotencyStore, error) {
+	if err := os.MkdirAll(baseDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create base directory: %w", err)
+	}
+	path := filepath.Join(baseDir, idempotencyFileName)
+
+	live, err := readIdempotencyRecords(path, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if err := rewriteIdempotencyRecords(path, live); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open idempotency records: %w", err)
+	}
+	return &FileIdempotencyStore{path: path, file: file}, nil
+}
+
+// Save appends a record. Any JSON-serializable record with key and expires_at fields is accepted.
+func (s *FileIdempotencyStore) Save(ctx context.Context, record any) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal idempotency record: %w", err)
+	}
+	data = append(data, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return fmt.Errorf("idempotency store is closed")
+	}
+	if _, err := s.file.Write(data); err != nil {
+		return fmt.Errorf("failed to write idempotency record: %w", err)
+	}
+	return nil
+}
+
+// Load returns the unexpired records, the newest per key, in the order they were saved
+func (s *FileIdempotencyStore) Load(ctx context.Context) ([]json.RawMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return readIdempotencyRecords(s.path, time.Now())
+}
+
+// Close closes the store
+func (s *FileIdempotencyStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// readIdempotencyRecords reads the record file. An unterminated last line is a torn write and is ignored;
+// any other unreadable line is an error.
+func readIdempotencyRecords(path string, now time.Time) ([]json.RawMessage, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read idempotency records: %w", err)
+	}
+
+	// Everything after the last newline is a torn write
+	data = data[:bytes.LastIndexByte(data, '\n')+1]
+
+	type entry struct {
+		raw    json.RawMessage
+		header idempotencyRecordHeader
+	}
+	var entries []entry
+	latest := make(map[idempotencyRecordHeader]int) // Key fields only -> index in entries
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), maxFramePayload)
+	line := 0
+	for scanner.Scan() {
+		line++
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		var header idempotencyRecordHeader
+		if err := json.Unmarshal(raw, &header); err != nil {
+			return nil, fmt.Errorf("corrupt idempotency record at line %d of %s: %w", line, path, err)
+		}
+
+		key := header
+		key.ExpiresAt = time.Time{}
+		if i, ok := latest[key]; ok {
+			entries[i].raw = nil // Superseded by a re-execution after expiry
+		}
+		latest[key] = len(entries)
+		entries = append(entries, entry{raw: append(json.RawMessage(nil), raw...), header: header})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read idempotency records: %w", err)
+	}
+
+	var live []json.RawMessage
+	for _, e := range entries {
+		if e.raw != nil && now.Before(e.header.ExpiresAt) {
+			live = append(live, e.raw)
+		}
+	}
+	return live, nil
+}
+
+// rewriteIdempotencyRecords atomically replaces the record file with the given records
+func rewriteIdempotencyRecords(path string, records []json.RawMessage) error {
+	var buf bytes.Buffer
+	for _, record := range records {
+		buf.Write(record)
+		buf.WriteByte('\n')
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write idempotency records: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to replace idempotency records: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package persistence
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testIdempotencyRecord struct {
+	AccountID      string    `json:"account_id"`
+	Symbol         string    `json:"symbol"`
+	CommandType    string    `json:"command_type"`
+	IdempotencyKey string    `json:"idempotency_key"`
+	ExpiresAt      time.Time `json:"expires_at"`
+	Result         string    `json:"result"`
+}
+
+func TestFileIdempotencyStore_CompactsOnOpen(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	future := time.Now().Add(time.Hour)
+
+	store, err := NewFileIdempotencyStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileIdempotencyStore failed: %v", err)
+	}
+	records := []testIdempotencyRecord{
+		{AccountID: "acc-001", Symbol: "BTC-USDT", CommandType: "PLACE", IdempotencyKey: "k1", ExpiresAt: future, Result: "old"},
+		{AccountID: "acc-001", Symbol: "BTC-USDT", CommandType: "PLACE", IdempotencyKey: "k2", ExpiresAt: time.Now().Add(-time.Second)},
+		{AccountID: "acc-001", Symbol: "BTC-USDT", CommandType: "PLACE", IdempotencyKey: "k1", ExpiresAt: future.Add(time.Minute), Result: "new"},
+		{AccountID: "acc-002", Symbol: "BTC-USDT", CommandType: "PLACE", IdempotencyKey: "k1", ExpiresAt: future, Result: "other"},
+	}
+	for _, record := range records {
+		if err := store.Save(ctx, record); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+	}
+	store.Close()
+
+	// A torn write at the tail is ignored
+	path := filepath.Join(dir, idempotencyFileName)
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString(`{"account_id":"acc-0`)
+	f.Close()
+
+	store, err = NewFileIdempotencyStore(dir)
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	defer store.Close()
+	loaded, err := store.Load(ctx)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	var results []string
+	for _, raw := range loaded {
+		var record testIdempotencyRecord
+		if err := json.Unmarshal(raw, &record); err != nil {
+			t.Fatalf("unmarshal failed: %v", err)
+		}
+		results = append(results, record.Result)
+	}
+	if len(results) != 2 || results[0] != "new" || results[1] != "other" {
+		t.Fatalf("expected [new other], got %v", results)
+	}
+
+	// Compaction rewrote the file without the expired, superseded and torn records
+	data, _ := os.ReadFile(path)
+	if lines := bytes.Count(data, []byte("\n")); lines != 2 {
+		t.Fatalf("unexpected compacted file %q", data)
+	}
+}
+
+func TestFileIdempotencyStore_RejectsCorruptRecord(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, idempotencyFileName), []byte("not json\n{}\n"), 0644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if _, err := NewFileIdempotencyStore(dir); err == nil {
+		t.Fatal("expected an error for a corrupt record")
+	}
+}
@@ -0,0 +1,214 @@
+package persistence
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// Framed segment layout:
+//
+//	header: magic "MEVL" | format version (1 byte) | codec (1 byte) | reserved (2 bytes)
+//	record: payload length (uint32 LE) | CRC32C of payload (uint32 LE) | payload
+//
+// Segments without the magic are unframed JSON Lines written by older versions.
+// The codec byte selects how record payloads are encoded (see codec.go).
+const (
+	segmentMagic        = "MEVL"
+	segmentHeaderSize   = 8
+	segmentFormatFramed = 1
+	frameHeaderSize     = 8
+	maxFramePayload     = 16 << 20 // Larger lengths can only come from corruption
+)
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrCorruptRecord is returned when an event record fails its length or checksum check
+var ErrCorruptRecord = errors.New("corrupt event record")
+
+// corruptRecordError describes a damaged record and whether it is a torn tail write
+type corruptRecordError struct {
+	path   string
+	offset int64
+	reason string
+	torn   bool // Record runs into end of file: an interrupted write, not mid-log damage
+}
+
+func (e *corruptRecordError) Error() string {
+	kind := "corrupt record"
+	if e.torn {
+		kind = "torn tail record"
+	}
+	return fmt.Sprintf("%s in %s at offset %d: %s", kind, e.path, e.offset, e.reason)
+}
+
+func (e *corruptRecordError) Is(target error) bool {
+	return target == ErrCorruptRecord
+}
+
+// newSegmentHeader builds the header written at the start of every framed segment
+func newSegmentHeader(codec byte) []byte {
+	header := make([]byte, segmentHeaderSize)
+	copy(header, segmentMagic)
+	header[4] = segmentFormatFramed
+	header[5] = codec
+	return header
+}
+
+// appendFrame appends a length and CRC32C framed payload to buf
+func appendFrame(buf []byte, payload []byte) []byte {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(payload)))
+	buf = binary.LittleEndian.AppendUint32(buf, crc32.Checksum(payload, crc32cTable))
+	return append(buf, payload...)
+}
+
+// segmentFormat describes how the records of a segment file are stored
+type segmentFormat struct {
+	framed    bool
+	codec     eventCodec
+	dataStart int64 // Offset of the first record
+}
+
+// readSegmentFormat reads the segment header; files without one are unframed JSON Lines
+func readSegmentFormat(file *os.File) (segmentFormat, error) {
+	unframed := segmentFormat{codec: jsonCodec{}}
+
+	header := make([]byte, segmentHeaderSize)
+	n, err := file.ReadAt(header, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return segmentFormat{}, fmt.Errorf("failed to read segment header: %w", err)
+	}
+	if n < len(segmentMagic) || string(header[:len(segmentMagic)]) != segmentMagic {
+		return unframed, nil
+	}
+	if n < segmentHeaderSize {
+		return segmentFormat{}, &corruptRecordError{path: file.Name(), offset: 0, reason: "truncated segment header", torn: true}
+	}
+	if header[4] != segmentFormatFramed {
+		return segmentFormat{}, fmt.Errorf("unsupported segment format version %d in %s", header[4], file.Name())
+	}
+	codec, err := codecByID(header[5])
+	if err != nil {
+		return segmentFormat{}, fmt.Errorf("%w in %s", err, file.Name())
+	}
+	return segmentFormat{framed: true, codec: codec, dataStart: segmentHeaderSize}, nil
+}
+
+// recordReader yields raw record payloads from a framed or JSON Lines segment
+type recordReader struct {
+	path   string
+	reader *bufio.Reader
+	framed bool
+	codec  eventCodec
+	offset int64 // Offset of the next record
+	size   int64 // File size when the reader was opened
+}
+
+// newRecordReader opens a segment for reading starting at offset (clamped to the first record)
+func newRecordReader(file *os.File, offset int64) (*recordReader, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat events file: %w", err)
+	}
+	format, err := readSegmentFormat(file)
+	if err != nil {
+		return nil, err
+	}
+	if offset < format.dataStart {
+		offset = format.dataStart
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to seek events file: %w", err)
+	}
+
+	return &recordReader{
+		path:   file.Name(),
+		reader: bufio.NewReader(file),
+		framed: format.framed,
+		codec:  format.codec,
+		offset: offset,
+		size:   info.Size(),
+	}, nil
+}
+
+// next returns the next payload and its offset, io.EOF at a clean end,
+// or a *corruptRecordError for damaged data
+func (rr *recordReader) next() ([]byte, int64, error) {
+	if rr.framed {
+		return rr.nextFrame()
+	}
+	return rr.nextLine()
+}
+
+func (rr *recordReader) nextFrame() ([]byte, int64, error) {
+	offset := rr.offset
+	if offset >= rr.size {
+		return nil, offset, io.EOF
+	}
+
+	var header [frameHeaderSize]byte
+	if _, err := io.ReadFull(rr.reader, header[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+			return nil, offset, &corruptRecordError{path: rr.path, offset: offset, reason: "incomplete frame header", torn: true}
+		}
+		return nil, offset, fmt.Errorf("failed to read events file: %w", err)
+	}
+
+	length := int64(binary.LittleEndian.Uint32(header[0:]))
+	checksum := binary.LittleEndian.Uint32(header[4:])
+	end := offset + frameHeaderSize + length
+	if length > maxFramePayload {
+		// An absurd length in the final bytes of the file is a partially written header
+		return nil, offset, &corruptRecordError{path: rr.path, offset: offset, reason: fmt.Sprintf("invalid frame length %d", length), torn: rr.size-offset <= frameHeaderSize}
+	}
+	if end > rr.size {
+		return nil, offset, &corruptRecordError{path: rr.path, offset: offset, reason: "frame extends past end of file", torn: true}
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(rr.reader, payload); err != nil {
+		return nil, offset, fmt.Errorf("failed to read events file: %w", err)
+	}
+	if crc32.Checksum(payload, crc32cTable) != checksum {
+		// A bad checksum on the very last frame is an interrupted write
+		return nil, offset, &corruptRecordError{path: rr.path, offset: offset, reason: "checksum mismatch", torn: end == rr.size}
+	}
+
+	rr.offset = end
+	return payload, offset, nil
+}
+
+func (rr *recordReader) nextLine() ([]byte, int64, error) {
+	for {
+		offset := rr.offset
+		line, err := rr.reader.ReadBytes('\n')
+		rr.offset += int64(len(line))
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, offset, fmt.Errorf("failed to scan events file: %w", err)
+		}
+		if len(line) == 0 {
+			return nil, offset, io.EOF
+		}
+
+		terminated := line[len(line)-1] == '\n'
+		if terminated {
+			line = line[:len(line)-1]
+		}
+		if len(line) == 0 {
+			continue
+		}
+		if !json.Valid(line) {
+			// Only an unterminated final line can be the result of an interrupted write
+			if !terminated {
+				return nil, offset, &corruptRecordError{path: rr.path, offset: offset, reason: "incomplete JSON line", torn: true}
+			}
+			return nil, offset, &corruptRecordError{path: rr.path, offset: offset, reason: "malformed JSON line"}
+		}
+		return line, offset, nil
+	}
+}
@@ -0,0 +1,206 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"matching-engine/internal/matching"
+)
+
+// recordOffsets maps each sequence in a segment file to the offset of its record
+func recordOffsets(t *testing.T, path string) map[int64]int64 {
+	t.Helper()
+	offsets := make(map[int64]int64)
+	err := scanRecords(path, 0, func(record *EventRecord, offset int64) error {
+		offsets[record.Sequence] = offset
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to scan %s: %v", path, err)
+	}
+	return offsets
+}
+
+// flipPayloadByte damages the payload of the record at offset without changing its length
+func flipPayloadByte(t *testing.T, path string, offset int64) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read segment: %v", err)
+	}
+	data[offset+frameHeaderSize+2] ^= 0xFF
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("failed to write segment: %v", err)
+	}
+}
+
+func TestRecordFrame_TornTailIsTruncated(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "events")
+	symbol := "BTC-USDT"
+
+	store := newSegmentedStore(t, dir, 0)
+	appendRange(t, store, symbol, 1, 10)
+	store.Close()
+
+	// Simulate a crash halfway through writing record 11
+	records, err := encodeEventRecords(jsonCodec{}, []matching.Event{newBenchEvent(symbol, 11)})
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	path := filepath.Join(dir, symbol, segmentFileName(1))
+	intact, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read segment: %v", err)
+	}
+	torn := append(append([]byte{}, intact...), records[0].data[:len(records[0].data)/2]...)
+	if err := os.WriteFile(path, torn, 0644); err != nil {
+		t.Fatalf("failed to write segment: %v", err)
+	}
+
+	reopened := newSegmentedStore(t, dir, 0)
+	defer reopened.Close()
+
+	ctx := context.Background()
+	lastSeq, err := reopened.GetLastSequence(ctx, symbol)
+	if err != nil {
+		t.Fatalf("GetLastSequence failed: %v", err)
+	}
+	if lastSeq != 10 {
+		t.Fatalf("expected last sequence 10 after dropping torn record, got %d", lastSeq)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("failed to stat segment: %v", err)
+	}
+	if info.Size() != int64(len(intact)) {
+		t.Fatalf("expected segment truncated to %d bytes, got %d", len(intact), info.Size())
+	}
+
+	// The log continues cleanly after the truncation point
+	appendRange(t, reopened, symbol, 11, 12)
+	events, err := reopened.ReadFrom(ctx, symbol, 1)
+	if err != nil {
+		t.Fatalf("ReadFrom failed: %v", err)
+	}
+	assertSequences(t, events, 1, 12)
+}
+
+func TestRecordFrame_MidLogCorruptionIsRefused(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "events")
+	symbol := "BTC-USDT"
+
+	store := newSegmentedStore(t, dir, 0)
+	appendRange(t, store, symbol, 1, 10)
+	store.Close()
+
+	path := filepath.Join(dir, symbol, segmentFileName(1))
+	offsets := recordOffsets(t, path)
+
+	// Damage outside the scanned tail is caught when read
+	flipPayloadByte(t, path, offsets[3])
+	reopened := newSegmentedStore(t, dir, 0)
+	if _, err := reopened.ReadFrom(context.Background(), symbol, 1); !errors.Is(err, ErrCorruptRecord) {
+		t.Fatalf("expected ErrCorruptRecord from ReadFrom, got %v", err)
+	}
+	reopened.Close()
+
+	// Damage inside the tail fails the open and points at repair mode
+	flipPayloadByte(t, path, offsets[3])
+	flipPayloadByte(t, path, offsets[9])
+	reopened = newSegmentedStore(t, dir, 0)
+	defer reopened.Close()
+	_, err := reopened.GetLastSequence(context.Background(), symbol)
+	if !errors.Is(err, ErrCorruptRecord) {
+		t.Fatalf("expected ErrCorruptRecord on open, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "repair mode") {
+		t.Fatalf("expected error to mention repair mode, got %v", err)
+	}
+}
+
+func TestRecordFrame_RepairModeTruncatesAtFirstDamage(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "events")
+	symbol := "BTC-USDT"
+
+	store := newSegmentedStore(t, dir, 5)
+	appendRange(t, store, symbol, 1, 15)
+	store.Close()
+
+	path := filepath.Join(dir, symbol, segmentFileName(6))
+	flipPayloadByte(t, path, recordOffsets(t, path)[8])
+
+	config := DefaultFileEventStoreConfig()
+	config.SegmentMaxRecords = 5
+	config.IndexInterval = 4
+	config.RepairMode = true
+	repaired, err := NewFileEventStoreWithConfig(dir, config)
+	if err != nil {
+		t.Fatalf("failed to create event store: %v", err)
+	}
+	defer repaired.Close()
+
+	ctx := context.Background()
+	lastSeq, err := repaired.GetLastSequence(ctx, symbol)
+	if err != nil {
+		t.Fatalf("GetLastSequence in repair mode failed: %v", err)
+	}
+	if lastSeq != 7 {
+		t.Fatalf("expected log cut before damaged record 8, got last sequence %d", lastSeq)
+	}
+
+	// Damaged bytes and the later segment are kept aside, not deleted
+	for _, name := range []string{segmentFileName(6) + ".corrupt", segmentFileName(11) + ".corrupt"} {
+		if _, err := os.Stat(filepath.Join(dir, symbol, name)); err != nil {
+			t.Fatalf("expected quarantined file %s: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, symbol, segmentFileName(11))); !os.IsNotExist(err) {
+		t.Fatalf("expected segment after damage to be moved aside, got %v", err)
+	}
+
+	appendRange(t, repaired, symbol, 8, 9)
+	events, err := repaired.ReadFrom(ctx, symbol, 1)
+	if err != nil {
+		t.Fatalf("ReadFrom after repair failed: %v", err)
+	}
+	assertSequences(t, events, 1, 9)
+}
+
+func TestRecordFrame_ReadsUnframedSegments(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "events")
+	symbol := "BTC-USDT"
+
+	// Segment written before records were framed
+	if err := os.MkdirAll(filepath.Join(dir, symbol), 0755); err != nil {
+		t.Fatalf("mkdir failed: %v", err)
+	}
+	unframed := encodeJSONLines(t, symbol, 1, 5)
+	if err := os.WriteFile(filepath.Join(dir, symbol, segmentFileName(1)), unframed, 0644); err != nil {
+		t.Fatalf("failed to write segment: %v", err)
+	}
+
+	store := newSegmentedStore(t, dir, 0)
+	defer store.Close()
+
+	appendRange(t, store, symbol, 6, 7)
+	after, err := os.ReadFile(filepath.Join(dir, symbol, segmentFileName(1)))
+	if err != nil {
+		t.Fatalf("failed to read segment: %v", err)
+	}
+	if len(after) != len(unframed) {
+		t.Fatalf("unframed segment must not be appended to")
+	}
+	if _, err := os.Stat(filepath.Join(dir, symbol, segmentFileName(6))); err != nil {
+		t.Fatalf("expected framed segment after unframed one: %v", err)
+	}
+
+	events, err := store.ReadFrom(context.Background(), symbol, 1)
+	if err != nil {
+		t.Fatalf("ReadFrom failed: %v", err)
+	}
+	assertSequences(t, events, 1, 7)
+}
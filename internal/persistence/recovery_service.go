@@ -3,6 +3,7 @@ package persistence
 import (
 	"context"
 	"fmt"
+	"log"
 
 	"matching-engine/internal/matching"
 )
@@ -21,13 +22,49 @@ func NewFileRecoveryService(eventStore EventStore, snapshotStore SnapshotStore)
 	}
 }
 
+// reportingSnapshotStore is a snapshot store that explains which snapshot it loaded
+type reportingSnapshotStore interface {
+	LoadWithReport(ctx context.Context, symbol string) (*Snapshot, *SnapshotLoadReport, error)
+}
+
+// pointInTimeSnapshotStore is a snapshot store that can load the newest snapshot at or before a sequence
+type pointInTimeSnapshotStore interface {
+	LoadAtOrBefore(ctx context.Context, symbol string, seq int64) (*Snapshot, *SnapshotLoadReport, error)
+}
+
 // Recover recovers engine state for a specific symbol
 // Returns the recovered snapshot and events to replay
 func (s *FileRecoveryService) Recover(ctx context.Context, symbol string) (*Snapshot, []matching.Event, error) {
-	// Step 1: Load the latest snapshot
-	snapshot, err := s.snapshotStore.Load(ctx, symbol)
+	snapshot, events, report, err := s.RecoverWithReport(ctx, symbol)
+	if report != nil {
+		for _, skipped := range report.Skipped {
+			log.Printf("WARNING: skipped snapshot %s@%d for recovery: %s", symbol, skipped.Snapshot.LastSequence, skipped.Reason)
+		}
+		if len(report.Skipped) > 0 {
+			if report.Used != nil {
+				log.Printf("Recovering %s from older snapshot at sequence %d", symbol, report.Used.LastSequence)
+			} else {
+				log.Printf("WARNING: no valid snapshot for %s, replaying the full event log", symbol)
+			}
+		}
+	}
+	return snapshot, events, err
+}
+
+// RecoverWithReport is Recover that also reports which snapshot was used and which were skipped.
+// The report is nil if the snapshot store cannot produce one.
+func (s *FileRecoveryService) RecoverWithReport(ctx context.Context, symbol string) (*Snapshot, []matching.Event, *SnapshotLoadReport, error) {
+	// Step 1: Load the latest valid snapshot
+	var snapshot *Snapshot
+	var report *SnapshotLoadReport
+	var err error
+	if reporting, ok := s.snapshotStore.(reportingSnapshotStore); ok {
+		snapshot, report, err = reporting.LoadWithReport(ctx, symbol)
+	} else {
+		snapshot, err = s.snapshotStore.Load(ctx, symbol)
+	}
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to load snapshot: %w", err)
+		return nil, nil, report, fmt.Errorf("failed to load snapshot: %w", err)
 	}
 
 	var fromSeq int64 = 1
@@ -38,21 +75,112 @@ func (s *FileRecoveryService) Recover(ctx context.Context, symbol string) (*Snap
 
 	// Step 2: Read events from last_sequence + 1
 	events, err := s.eventStore.ReadFrom(ctx, symbol, fromSeq)
+	if err != nil {
+		return nil, nil, report, fmt.Errorf("failed to read events: %w", err)
+	}
+	if len(events) > 0 && events[0].Sequence() != fromSeq {
+		return nil, nil, report, fmt.Errorf("sequence mismatch at start: expected %d, got %d", fromSeq, events[0].Sequence())
+	}
+
+	// Step 3: Validate sequence continuity
+	if err := s.ValidateSequence(events); err != nil {
+		return nil, nil, report, fmt.Errorf("sequence validation failed: %w", err)
+	}
+
+	return snapshot, events, report, nil
+}
+
+// RecoverTo recovers a symbol as it was at target.
+// A time target resolves to the last event of the prefix of the log that occurred at or before it.
+// The returned events end exactly at the resolved sequence; a target past the end of the log is an error.
+func (s *FileRecoveryService) RecoverTo(ctx context.Context, symbol string, target RecoveryTarget) (*Snapshot, []matching.Event, error) {
+	targetSeq, err := s.resolveTarget(ctx, symbol, target)
+	if err != nil {
+		return nil, nil, err
+	}
+	if targetSeq == 0 {
+		return nil, nil, nil // Before the first event: empty state
+	}
+
+	// Step 1: Load the newest valid snapshot not past the target.
+	// Stores that cannot select by sequence fall back to a full replay.
+	var snapshot *Snapshot
+	if pointInTime, ok := s.snapshotStore.(pointInTimeSnapshotStore); ok {
+		var report *SnapshotLoadReport
+		snapshot, report, err = pointInTime.LoadAtOrBefore(ctx, symbol, targetSeq)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load snapshot: %w", err)
+		}
+		for _, skipped := range report.Skipped {
+			log.Printf("WARNING: skipped snapshot %s@%d for recovery: %s", symbol, skipped.Snapshot.LastSequence, skipped.Reason)
+		}
+	}
+
+	var fromSeq int64 = 1
+	if snapshot != nil {
+		fromSeq = snapshot.LastSequence + 1
+	}
+
+	// Step 2: Read events from the snapshot up to the target
+	events, err := s.eventStore.ReadFrom(ctx, symbol, fromSeq)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to read events: %w", err)
 	}
 	if len(events) > 0 && events[0].Sequence() != fromSeq {
 		return nil, nil, fmt.Errorf("sequence mismatch at start: expected %d, got %d", fromSeq, events[0].Sequence())
 	}
+	for i, event := range events {
+		if event.Sequence() > targetSeq {
+			events = events[:i]
+			break
+		}
+	}
 
-	// Step 3: Validate sequence continuity
+	// Step 3: Validate sequence continuity and that the target was reached
 	if err := s.ValidateSequence(events); err != nil {
 		return nil, nil, fmt.Errorf("sequence validation failed: %w", err)
 	}
+	lastSeq := fromSeq - 1
+	if len(events) > 0 {
+		lastSeq = events[len(events)-1].Sequence()
+	}
+	if lastSeq != targetSeq {
+		return nil, nil, fmt.Errorf("target sequence %d is past the end of the %s event log (%d)", targetSeq, symbol, lastSeq)
+	}
 
 	return snapshot, events, nil
 }
 
+// resolveTarget turns a recovery target into the last sequence to include
+func (s *FileRecoveryService) resolveTarget(ctx context.Context, symbol string, target RecoveryTarget) (int64, error) {
+	if target.Sequence < 0 {
+		return 0, fmt.Errorf("invalid target sequence: %d", target.Sequence)
+	}
+	if target.Time.IsZero() {
+		if target.Sequence == 0 {
+			return 0, fmt.Errorf("recovery target needs a sequence or a time")
+		}
+		return target.Sequence, nil
+	}
+
+	// Event times are not indexed: scan the log for the last event at or before the target time
+	events, err := s.eventStore.ReadFrom(ctx, symbol, 1)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read events: %w", err)
+	}
+	var seq int64
+	for _, event := range events {
+		if event.OccurredAt().After(target.Time) {
+			break
+		}
+		seq = event.Sequence()
+		if target.Sequence > 0 && seq >= target.Sequence {
+			return target.Sequence, nil
+		}
+	}
+	return seq, nil
+}
+
 // ValidateSequence validates that event sequences are continuous
 func (s *FileRecoveryService) ValidateSequence(events []matching.Event) error {
 	if len(events) == 0 {
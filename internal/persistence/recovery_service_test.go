@@ -298,3 +298,106 @@ func TestFileRecoveryService_RecoverStartSequenceMismatch(t *testing.T) {
 		t.Fatal("expected recover error on start sequence mismatch")
 	}
 }
+
+func TestFileRecoveryService_RecoverToSequence(t *testing.T) {
+	tempDir := t.TempDir()
+	symbol := "BTC-USDT"
+	ctx := context.Background()
+
+	eventStore := newSegmentedStore(t, filepath.Join(tempDir, "events"), 5)
+	defer eventStore.Close()
+	appendRange(t, eventStore, symbol, 1, 22)
+
+	snapshotStore, err := NewFileSnapshotStore(filepath.Join(tempDir, "snapshots"))
+	if err != nil {
+		t.Fatalf("failed to create snapshot store: %v", err)
+	}
+	for _, seq := range []int64{10, 20} {
+		saveSnapshotAt(t, snapshotStore, symbol, seq)
+	}
+	recoveryService := NewFileRecoveryService(eventStore, snapshotStore)
+
+	// Snapshot 20 is past the target, so 10 is used and replay stops at 15
+	snapshot, events, err := recoveryService.RecoverTo(ctx, symbol, RecoveryTarget{Sequence: 15})
+	if err != nil {
+		t.Fatalf("RecoverTo failed: %v", err)
+	}
+	if snapshot == nil || snapshot.LastSequence != 10 {
+		t.Fatalf("expected snapshot 10, got %+v", snapshot)
+	}
+	assertSequences(t, events, 11, 15)
+
+	snapshot, events, err = recoveryService.RecoverTo(ctx, symbol, RecoveryTarget{Sequence: 20})
+	if err != nil {
+		t.Fatalf("RecoverTo failed: %v", err)
+	}
+	if snapshot == nil || snapshot.LastSequence != 20 || len(events) != 0 {
+		t.Fatalf("expected snapshot 20 and no events, got %+v and %d events", snapshot, len(events))
+	}
+
+	snapshot, events, err = recoveryService.RecoverTo(ctx, symbol, RecoveryTarget{Sequence: 3})
+	if err != nil {
+		t.Fatalf("RecoverTo failed: %v", err)
+	}
+	if snapshot != nil {
+		t.Fatalf("expected full replay before the first snapshot, got snapshot %d", snapshot.LastSequence)
+	}
+	assertSequences(t, events, 1, 3)
+
+	if _, _, err := recoveryService.RecoverTo(ctx, symbol, RecoveryTarget{Sequence: 23}); err == nil {
+		t.Fatal("expected error for a target past the end of the log")
+	}
+}
+
+func TestFileRecoveryService_RecoverToTime(t *testing.T) {
+	tempDir := t.TempDir()
+	symbol := "BTC-USDT"
+	ctx := context.Background()
+
+	eventStore, err := NewFileEventStore(filepath.Join(tempDir, "events"))
+	if err != nil {
+		t.Fatalf("failed to create event store: %v", err)
+	}
+	defer eventStore.Close()
+	snapshotStore, err := NewFileSnapshotStore(filepath.Join(tempDir, "snapshots"))
+	if err != nil {
+		t.Fatalf("failed to create snapshot store: %v", err)
+	}
+	recoveryService := NewFileRecoveryService(eventStore, snapshotStore)
+
+	// One event per minute
+	base := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	for seq := int64(1); seq <= 10; seq++ {
+		event := newBenchEvent(symbol, seq).(*matching.OrderAcceptedEvent)
+		event.OccurredAtValue = base.Add(time.Duration(seq) * time.Minute)
+		if err := eventStore.Append(ctx, symbol, event); err != nil {
+			t.Fatalf("failed to append event: %v", err)
+		}
+	}
+	saveSnapshotAt(t, snapshotStore, symbol, 4)
+
+	_, events, err := recoveryService.RecoverTo(ctx, symbol, RecoveryTarget{Time: base.Add(6*time.Minute + 30*time.Second)})
+	if err != nil {
+		t.Fatalf("RecoverTo failed: %v", err)
+	}
+	assertSequences(t, events, 5, 6)
+
+	// With both set, the earlier target wins
+	_, events, err = recoveryService.RecoverTo(ctx, symbol, RecoveryTarget{Sequence: 5, Time: base.Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("RecoverTo failed: %v", err)
+	}
+	assertSequences(t, events, 5, 5)
+
+	snapshot, events, err := recoveryService.RecoverTo(ctx, symbol, RecoveryTarget{Time: base})
+	if err != nil {
+		t.Fatalf("RecoverTo failed: %v", err)
+	}
+	if snapshot != nil || len(events) != 0 {
+		t.Fatalf("expected empty state before the first event")
+	}
+
+	if _, _, err := recoveryService.RecoverTo(ctx, symbol, RecoveryTarget{}); err == nil {
+		t.Fatal("expected error for an empty target")
+	}
+}
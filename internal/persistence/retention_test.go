@@ -0,0 +1,175 @@
+package persistence
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func saveSnapshotAt(t *testing.T, store *FileSnapshotStore, symbol string, seq int64) {
+	t.Helper()
+	snapshot := &Snapshot{
+		Version:      1,
+		Symbol:       symbol,
+		LastSequence: seq,
+		CapturedAt:   time.Now(),
+	}
+	if err := store.Save(context.Background(), snapshot); err != nil {
+		t.Fatalf("failed to save snapshot %d: %v", seq, err)
+	}
+}
+
+func snapshotSequences(t *testing.T, store *FileSnapshotStore, symbol string) []int64 {
+	t.Helper()
+	snapshots, err := store.ListSnapshots(context.Background(), symbol)
+	if err != nil {
+		t.Fatalf("ListSnapshots failed: %v", err)
+	}
+	seqs := make([]int64, 0, len(snapshots))
+	for _, meta := range snapshots {
+		seqs = append(seqs, meta.LastSequence)
+	}
+	return seqs
+}
+
+func assertInt64s(t *testing.T, got []int64, want ...int64) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+}
+
+func TestSnapshotRetention_KeepLast(t *testing.T) {
+	store, err := NewFileSnapshotStoreWithConfig(t.TempDir(), &FileSnapshotStoreConfig{
+		Retention: SnapshotRetention{KeepLast: 2},
+	})
+	if err != nil {
+		t.Fatalf("failed to create snapshot store: %v", err)
+	}
+
+	symbol := "BTC-USDT"
+	for _, seq := range []int64{10, 20, 30, 40} {
+		saveSnapshotAt(t, store, symbol, seq)
+	}
+	assertInt64s(t, snapshotSequences(t, store, symbol), 40, 30)
+}
+
+func TestSnapshotRetention_MaxAge(t *testing.T) {
+	store, err := NewFileSnapshotStoreWithConfig(t.TempDir(), &FileSnapshotStoreConfig{
+		Retention: SnapshotRetention{MaxAge: time.Hour},
+	})
+	if err != nil {
+		t.Fatalf("failed to create snapshot store: %v", err)
+	}
+
+	symbol := "BTC-USDT"
+	for _, seq := range []int64{10, 20, 30} {
+		saveSnapshotAt(t, store, symbol, seq)
+	}
+
+	// Age every snapshot past the limit; the newest one is still kept
+	old := time.Now().Add(-2 * time.Hour)
+	snapshots, _ := store.ListSnapshots(context.Background(), symbol)
+	for _, meta := range snapshots {
+		if err := os.Chtimes(meta.FilePath, old, old); err != nil {
+			t.Fatalf("chtimes failed: %v", err)
+		}
+	}
+	result, err := store.Prune(context.Background(), symbol)
+	if err != nil {
+		t.Fatalf("Prune failed: %v", err)
+	}
+	if len(result.Pruned) != 2 {
+		t.Fatalf("expected 2 pruned snapshots, got %d", len(result.Pruned))
+	}
+	assertInt64s(t, snapshotSequences(t, store, symbol), 30)
+
+	// A fresh snapshot is kept by age alongside the newest
+	saveSnapshotAt(t, store, symbol, 25)
+	assertInt64s(t, snapshotSequences(t, store, symbol), 30, 25)
+}
+
+func TestSnapshotRetention_ArchivesCoveredSegments(t *testing.T) {
+	tempDir := t.TempDir()
+	eventsDir := filepath.Join(tempDir, "events")
+	symbol := "BTC-USDT"
+	ctx := context.Background()
+
+	eventStore := newSegmentedStore(t, eventsDir, 5)
+	defer eventStore.Close()
+	appendRange(t, eventStore, symbol, 1, 23)
+
+	snapshotStore, err := NewFileSnapshotStoreWithConfig(filepath.Join(tempDir, "snapshots"), &FileSnapshotStoreConfig{
+		Retention: SnapshotRetention{KeepLast: 2},
+		Archiver:  eventStore,
+	})
+	if err != nil {
+		t.Fatalf("failed to create snapshot store: %v", err)
+	}
+	for _, seq := range []int64{8, 12, 17} {
+		saveSnapshotAt(t, snapshotStore, symbol, seq)
+	}
+	assertInt64s(t, snapshotSequences(t, snapshotStore, symbol), 17, 12)
+
+	// Oldest retained snapshot is at 12: segments 1-5 and 6-10 are covered, 11-15 is not
+	for start, archived := range map[int64]bool{1: true, 6: true, 11: false, 16: false, 21: false} {
+		dir := filepath.Join(eventsDir, symbol)
+		if archived {
+			dir = filepath.Join(dir, archiveDirName)
+		}
+		if _, err := os.Stat(filepath.Join(dir, segmentFileName(start))); err != nil {
+			t.Fatalf("segment %d (archived=%v) not found: %v", start, archived, err)
+		}
+	}
+
+	// Recovery from the newest snapshot and full-history reads keep working, also after reopening
+	recovery := NewFileRecoveryService(eventStore, snapshotStore)
+	snapshot, events, err := recovery.Recover(ctx, symbol)
+	if err != nil {
+		t.Fatalf("Recover failed: %v", err)
+	}
+	if snapshot.LastSequence != 17 {
+		t.Fatalf("expected snapshot 17, got %d", snapshot.LastSequence)
+	}
+	assertSequences(t, events, 18, 23)
+
+	eventStore.Close()
+	reopened := newSegmentedStore(t, eventsDir, 5)
+	defer reopened.Close()
+	all, err := reopened.ReadFrom(ctx, symbol, 1)
+	if err != nil {
+		t.Fatalf("ReadFrom after archival failed: %v", err)
+	}
+	assertSequences(t, all, 1, 23)
+	appendRange(t, reopened, symbol, 24, 26)
+}
+
+func TestFileEventStore_ArchiveNeverTakesActiveSegment(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "events")
+	symbol := "BTC-USDT"
+
+	store := newSegmentedStore(t, dir, 5)
+	defer store.Close()
+	appendRange(t, store, symbol, 1, 8)
+
+	moved, err := store.ArchiveThrough(context.Background(), symbol, 100)
+	if err != nil {
+		t.Fatalf("ArchiveThrough failed: %v", err)
+	}
+	if moved != 1 {
+		t.Fatalf("expected only the sealed segment to be archived, moved %d", moved)
+	}
+	appendRange(t, store, symbol, 9, 12)
+	events, err := store.ReadFrom(context.Background(), symbol, 1)
+	if err != nil {
+		t.Fatalf("ReadFrom failed: %v", err)
+	}
+	assertSequences(t, events, 1, 12)
+}
@@ -0,0 +1,816 @@
+package persistence
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	legacyLogName   = "events.log" // Single-file log written before segmentation
+	segmentPrefix   = "segment-"
+	segmentExt      = ".log"
+	segmentIndexExt = ".idx"
+	indexEntrySize  = 16        // int64 sequence + int64 byte offset
+	archiveDirName  = "archive" // Per-symbol directory for segments covered by a snapshot
+)
+
+// encodedRecord is a serialized event ready to be appended to a segment
+type encodedRecord struct {
+	seq  int64
+	data []byte
+}
+
+// indexEntry maps a sequence number to the byte offset of its record within a segment
+type indexEntry struct {
+	seq    int64
+	offset int64
+}
+
+// segment is one file of a symbol's event log, named by its starting sequence
+type segment struct {
+	startSeq int64
+	path     string
+	legacy   bool         // Pre-segmentation events.log, read-only
+	framed   bool         // CRC32C framed records; unframed JSONL segments are never appended to
+	codec    byte         // Payload codec of a framed segment
+	archived bool         // Moved to the archive directory; still readable
+	index    []indexEntry // Sparse index, ascending by sequence
+}
+
+// segmentFileName builds the segment file name for a starting sequence
+func segmentFileName(startSeq int64) string {
+	return fmt.Sprintf("%s%020d%s", segmentPrefix, startSeq, segmentExt)
+}
+
+// parseSegmentFileName extracts the starting sequence from a segment file name
+func parseSegmentFileName(name string) (int64, bool) {
+	if !strings.HasPrefix(name, segmentPrefix) || !strings.HasSuffix(name, segmentExt) {
+		return 0, false
+	}
+	var startSeq int64
+	if _, err := fmt.Sscanf(strings.TrimSuffix(strings.TrimPrefix(name, segmentPrefix), segmentExt), "%d", &startSeq); err != nil {
+		return 0, false
+	}
+	return startSeq, true
+}
+
+// indexPath returns the sparse index path for a segment
+func (seg *segment) indexPath() string {
+	return strings.TrimSuffix(seg.path, segmentExt) + segmentIndexExt
+}
+
+// lookup returns the offset to start scanning from to reach fromSeq
+func (seg *segment) lookup(fromSeq int64) indexEntry {
+	i := sort.Search(len(seg.index), func(i int) bool {
+		return seg.index[i].seq > fromSeq
+	})
+	if i == 0 {
+		return indexEntry{seq: seg.startSeq, offset: 0}
+	}
+	return seg.index[i-1]
+}
+
+// logOptions configures how a symbol log is opened and written
+type logOptions struct {
+	indexInterval int64
+	repair        bool       // Verify all segments on open and truncate at the first damaged record
+	codec         eventCodec // Codec for new segments
+}
+
+// symbolLog is the segmented event log of one symbol
+type symbolLog struct {
+	dir           string
+	indexInterval int64
+	codec         eventCodec
+	segments      []*segment // Sorted by starting sequence
+	lastSeq       int64
+
+	active      *os.File // Append handle of the last segment, opened lazily
+	activeIndex *os.File
+	activeSize  int64
+	torn        error // A failed write that could not be rolled back; appends are refused until recovery
+}
+
+// appendMark is where an append started, so a failed one can be rolled back
+type appendMark struct {
+	segments int
+	size     int64
+	lastSeq  int64
+}
+
+// hasEventLog reports whether a symbol directory contains an event log
+func hasEventLog(dir string) bool {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if entry.Name() == legacyLogName {
+			return true
+		}
+		if _, ok := parseSegmentFileName(entry.Name()); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// openSymbolLog loads segment metadata for a symbol directory.
+// Only the tail of the last segment is scanned, so opening is independent of log length.
+// A torn record at the tail is truncated; damage anywhere else fails the open unless
+// repair is set, in which case every segment is verified and the log is cut at the first bad record.
+func openSymbolLog(dir string, opts logOptions) (*symbolLog, error) {
+	l := &symbolLog{
+		dir:           dir,
+		indexInterval: opts.indexInterval,
+		codec:         opts.codec,
+	}
+
+	if _, err := os.Stat(dir); err != nil {
+		if os.IsNotExist(err) {
+			return l, nil // No events yet
+		}
+		return nil, fmt.Errorf("failed to read symbol directory: %w", err)
+	}
+
+	// Archived segments are still part of the log so full-history reads keep working
+	for _, source := range []struct {
+		dir      string
+		archived bool
+	}{{filepath.Join(dir, archiveDirName), true}, {dir, false}} {
+		segments, err := collectSegments(source.dir, source.archived, opts)
+		if err != nil {
+			return nil, err
+		}
+		l.segments = append(l.segments, segments...)
+	}
+
+	sort.Slice(l.segments, func(i, j int) bool {
+		return l.segments[i].startSeq < l.segments[j].startSeq
+	})
+
+	for i, seg := range l.segments {
+		if seg.legacy {
+			if i != 0 {
+				return nil, fmt.Errorf("legacy event log %s overlaps segmented log", seg.path)
+			}
+			continue
+		}
+		if err := seg.loadIndex(); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.repair {
+		if err := l.repair(); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(l.segments) > 0 {
+		if err := l.recoverTail(); err != nil {
+			return nil, err
+		}
+	}
+
+	return l, nil
+}
+
+// collectSegments lists the segments stored in one directory
+func collectSegments(dir string, archived bool, opts logOptions) ([]*segment, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read symbol directory: %w", err)
+	}
+
+	var segments []*segment
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		if name == legacyLogName {
+			seg, err := openLegacySegment(filepath.Join(dir, name), opts.indexInterval, opts.repair)
+			if err != nil {
+				return nil, err
+			}
+			if seg != nil {
+				seg.archived = archived
+				segments = append(segments, seg)
+			}
+			continue
+		}
+		if startSeq, ok := parseSegmentFileName(name); ok {
+			segments = append(segments, &segment{
+				startSeq: startSeq,
+				path:     filepath.Join(dir, name),
+				archived: archived,
+			})
+		}
+	}
+	return segments, nil
+}
+
+// openLegacySegment wraps a pre-segmentation events.log as a read-only segment.
+// The sparse index is built in memory since the legacy format has none.
+func openLegacySegment(path string, indexInterval int64, repair bool) (*segment, error) {
+	seg := &segment{path: path, legacy: true}
+	first := true
+	err := scanRecords(path, 0, func(record *EventRecord, offset int64) error {
+		if first {
+			seg.startSeq = record.Sequence
+			first = false
+		}
+		if (record.Sequence-seg.startSeq)%indexInterval == 0 {
+			seg.index = append(seg.index, indexEntry{seq: record.Sequence, offset: offset})
+		}
+		return nil
+	})
+	var corrupt *corruptRecordError
+	switch {
+	case err == nil:
+	case errors.As(err, &corrupt) && corrupt.torn:
+		log.Printf("WARNING: truncating %s", err)
+		if err := seg.truncate(corrupt.offset); err != nil {
+			return nil, err
+		}
+	case errors.As(err, &corrupt) && repair:
+		// Keep what was readable; repair cuts the file at the damaged record
+	default:
+		return nil, err
+	}
+	if first {
+		return nil, nil // Empty legacy file
+	}
+	return seg, nil
+}
+
+// recoverTail finds the last sequence of the log, truncating a torn record left by a crash mid-write
+func (l *symbolLog) recoverTail() error {
+	last := l.segments[len(l.segments)-1]
+	if !last.legacy {
+		if err := last.ensureHeader(l.codec.id()); err != nil {
+			return err
+		}
+		format, err := readSegmentFormatFile(last.path)
+		if err != nil {
+			return err
+		}
+		last.framed = format.framed
+		last.codec = format.codec.id()
+	}
+
+	lastSeq, err := last.scanTail(l.indexInterval)
+	var corrupt *corruptRecordError
+	if errors.As(err, &corrupt) && corrupt.torn {
+		log.Printf("WARNING: truncating %s", err)
+		if err := last.truncate(corrupt.offset); err != nil {
+			return err
+		}
+		lastSeq, err = last.scanTail(l.indexInterval)
+	}
+	if err != nil {
+		if errors.Is(err, ErrCorruptRecord) {
+			return fmt.Errorf("%w (enable event log repair mode to truncate the log at the damaged record)", err)
+		}
+		return err
+	}
+
+	l.lastSeq = lastSeq
+	return nil
+}
+
+// repair verifies every segment and cuts the log at the first damaged record.
+// The damaged bytes and all later segments are moved aside with a .corrupt suffix.
+func (l *symbolLog) repair() error {
+	for i, seg := range l.segments {
+		err := scanRecords(seg.path, 0, func(record *EventRecord, offset int64) error {
+			return nil
+		})
+		if err == nil {
+			continue
+		}
+		var corrupt *corruptRecordError
+		if !errors.As(err, &corrupt) {
+			return err
+		}
+
+		later := l.segments[i+1:]
+		log.Printf("WARNING: event log repair: %s; discarding the rest of the segment and %d later segment(s)", err, len(later))
+		if err := seg.quarantineFrom(corrupt.offset); err != nil {
+			return err
+		}
+		for _, next := range later {
+			if err := next.quarantineFrom(0); err != nil {
+				return err
+			}
+		}
+
+		l.segments = l.segments[:i+1]
+		if seg.legacy && corrupt.offset == 0 {
+			l.segments = l.segments[:i] // Nothing readable left in the legacy file
+		}
+		return nil
+	}
+	return nil
+}
+
+// quarantineFrom moves the bytes from offset onwards into a .corrupt file next to the segment
+func (seg *segment) quarantineFrom(offset int64) error {
+	target := seg.path + ".corrupt"
+	if offset == 0 {
+		if err := os.Rename(seg.path, target); err != nil {
+			return fmt.Errorf("failed to quarantine segment: %w", err)
+		}
+		if err := os.Remove(seg.indexPath()); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove segment index: %w", err)
+		}
+		log.Printf("WARNING: moved %s to %s", seg.path, target)
+		return nil
+	}
+
+	data, err := os.ReadFile(seg.path)
+	if err != nil {
+		return fmt.Errorf("failed to read segment: %w", err)
+	}
+	if offset < int64(len(data)) {
+		if err := os.WriteFile(target, data[offset:], 0644); err != nil {
+			return fmt.Errorf("failed to quarantine damaged records: %w", err)
+		}
+		log.Printf("WARNING: moved %d damaged byte(s) of %s to %s", int64(len(data))-offset, seg.path, target)
+	}
+	return seg.truncate(offset)
+}
+
+// truncate cuts the segment file at offset and drops index entries past it
+func (seg *segment) truncate(offset int64) error {
+	if err := os.Truncate(seg.path, offset); err != nil {
+		return fmt.Errorf("failed to truncate segment: %w", err)
+	}
+	i := sort.Search(len(seg.index), func(i int) bool {
+		return seg.index[i].offset >= offset
+	})
+	seg.index = seg.index[:i]
+	if seg.legacy {
+		return nil
+	}
+	return seg.writeIndex()
+}
+
+// ensureHeader rewrites the header of a segment whose creation was interrupted before it was complete
+func (seg *segment) ensureHeader(codec byte) error {
+	info, err := os.Stat(seg.path)
+	if err != nil {
+		return fmt.Errorf("failed to stat segment: %w", err)
+	}
+	if info.Size() >= segmentHeaderSize {
+		return nil
+	}
+	if info.Size() > 0 {
+		log.Printf("WARNING: rewriting incomplete header of %s", seg.path)
+	}
+	if err := os.WriteFile(seg.path, newSegmentHeader(codec), 0644); err != nil {
+		return fmt.Errorf("failed to write segment header: %w", err)
+	}
+	seg.index = nil
+	return nil
+}
+
+// readSegmentFormatFile reads the format of a segment file by path
+func readSegmentFormatFile(path string) (segmentFormat, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return segmentFormat{}, fmt.Errorf("failed to open events file: %w", err)
+	}
+	defer file.Close()
+
+	return readSegmentFormat(file)
+}
+
+// loadIndex reads the sparse index file of a segment, dropping entries that do not fit the data file.
+// A missing or damaged index only makes reads scan more; it never affects correctness.
+func (seg *segment) loadIndex() error {
+	data, err := os.ReadFile(seg.indexPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read segment index: %w", err)
+	}
+
+	info, err := os.Stat(seg.path)
+	if err != nil {
+		return fmt.Errorf("failed to stat segment: %w", err)
+	}
+
+	for off := 0; off+indexEntrySize <= len(data); off += indexEntrySize {
+		entry := indexEntry{
+			seq:    int64(binary.LittleEndian.Uint64(data[off:])),
+			offset: int64(binary.LittleEndian.Uint64(data[off+8:])),
+		}
+		if entry.offset >= info.Size() {
+			break
+		}
+		if n := len(seg.index); n > 0 && (entry.seq <= seg.index[n-1].seq || entry.offset <= seg.index[n-1].offset) {
+			break
+		}
+		seg.index = append(seg.index, entry)
+	}
+	return nil
+}
+
+// scanTail scans the segment from its last index entry and returns the last sequence.
+// Index entries for the scanned records are added to the in-memory index.
+// A stale index is discarded and the segment rescanned from the start.
+func (seg *segment) scanTail(indexInterval int64) (int64, error) {
+	start := seg.lookup(1<<63 - 1)
+	lastSeq, err := seg.scanTailFrom(start, indexInterval)
+	if err != nil && start.offset > 0 {
+		seg.index = nil
+		return seg.scanTailFrom(indexEntry{seq: seg.startSeq}, indexInterval)
+	}
+	return lastSeq, err
+}
+
+func (seg *segment) scanTailFrom(start indexEntry, indexInterval int64) (int64, error) {
+	lastSeq := seg.startSeq - 1
+	err := scanRecords(seg.path, start.offset, func(record *EventRecord, offset int64) error {
+		if offset == start.offset && start.offset > 0 && record.Sequence != start.seq {
+			return errStaleIndex
+		}
+		if record.Sequence > lastSeq {
+			lastSeq = record.Sequence
+		}
+		n := len(seg.index)
+		if !seg.legacy && (record.Sequence-seg.startSeq)%indexInterval == 0 && (n == 0 || record.Sequence > seg.index[n-1].seq) {
+			seg.index = append(seg.index, indexEntry{seq: record.Sequence, offset: offset})
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return lastSeq, nil
+}
+
+// scanRecords decodes records of a segment file starting at a byte offset.
+// Damaged records are reported as *corruptRecordError.
+func scanRecords(path string, offset int64, fn func(record *EventRecord, offset int64) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open events file: %w", err)
+	}
+	defer file.Close()
+
+	reader, err := newRecordReader(file, offset)
+	if err != nil {
+		return err
+	}
+
+	for {
+		payload, recordOffset, err := reader.next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+
+		// A payload that passed its checksum but does not decode is not treated as
+		// corruption, so repair mode never truncates records this version cannot read.
+		record, err := reader.codec.decode(payload)
+		if err != nil {
+			return fmt.Errorf("failed to decode record in %s at offset %d: %w", path, recordOffset, err)
+		}
+		if err := fn(record, recordOffset); err != nil {
+			return err
+		}
+	}
+}
+
+// append writes records to the active segment, rotating when it is full.
+// A failed append is truncated back to where it started, so the log still ends at a record
+// boundary and none of the records is kept.
+func (l *symbolLog) append(records []encodedRecord, maxBytes int64, maxRecords int64) (err error) {
+	if l.torn != nil {
+		return fmt.Errorf("event log needs recovery: %w", l.torn)
+	}
+	var mark *appendMark
+	defer func() {
+		if err == nil || mark == nil {
+			return
+		}
+		if rollbackErr := l.rollback(*mark); rollbackErr != nil {
+			l.torn = rollbackErr
+			err = fmt.Errorf("%w; %v", err, rollbackErr)
+		}
+	}()
+
+	for _, rec := range records {
+		if err := l.ensureActive(rec.seq, maxBytes, maxRecords); err != nil {
+			return err
+		}
+		if mark == nil {
+			mark = &appendMark{segments: len(l.segments), size: l.activeSize, lastSeq: l.lastSeq}
+		}
+
+		seg := l.segments[len(l.segments)-1]
+		offset := l.activeSize
+		n, err := l.active.Write(rec.data)
+		l.activeSize += int64(n)
+		if err != nil {
+			return fmt.Errorf("failed to write event: %w", err)
+		}
+
+		if (rec.seq-seg.startSeq)%l.indexInterval == 0 {
+			entry := indexEntry{seq: rec.seq, offset: offset}
+			var buf [indexEntrySize]byte
+			binary.LittleEndian.PutUint64(buf[0:], uint64(entry.seq))
+			binary.LittleEndian.PutUint64(buf[8:], uint64(entry.offset))
+			if _, err := l.activeIndex.Write(buf[:]); err != nil {
+				return fmt.Errorf("failed to write segment index: %w", err)
+			}
+			seg.index = append(seg.index, entry)
+		}
+
+		if rec.seq > l.lastSeq {
+			l.lastSeq = rec.seq
+		}
+	}
+	return nil
+}
+
+// rollback removes the segments a failed append created and truncates the one it started in
+func (l *symbolLog) rollback(mark appendMark) error {
+	for len(l.segments) > mark.segments {
+		seg := l.segments[len(l.segments)-1]
+		if err := l.close(); err != nil {
+			return fmt.Errorf("failed to roll back segment %s: %w", seg.path, err)
+		}
+		if err := os.Remove(seg.path); err != nil {
+			return fmt.Errorf("failed to roll back segment %s: %w", seg.path, err)
+		}
+		if err := os.Remove(seg.indexPath()); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to roll back segment index %s: %w", seg.indexPath(), err)
+		}
+		l.segments = l.segments[:len(l.segments)-1]
+	}
+	if err := l.segments[mark.segments-1].truncate(mark.size); err != nil {
+		return fmt.Errorf("failed to roll back partial write: %w", err)
+	}
+	if l.active != nil {
+		l.activeSize = mark.size
+	}
+	l.lastSeq = mark.lastSeq
+	return nil
+}
+
+// ensureActive opens the last segment for appending or rolls over to a new one
+func (l *symbolLog) ensureActive(nextSeq int64, maxBytes int64, maxRecords int64) error {
+	if l.active != nil {
+		seg := l.segments[len(l.segments)-1]
+		full := (maxBytes > 0 && l.activeSize >= maxBytes) ||
+			(maxRecords > 0 && l.lastSeq-seg.startSeq+1 >= maxRecords)
+		if !full {
+			return nil
+		}
+		if err := l.seal(); err != nil {
+			return err
+		}
+		return l.createSegment(nextSeq)
+	}
+
+	if len(l.segments) == 0 {
+		return l.createSegment(nextSeq)
+	}
+	if last := l.segments[len(l.segments)-1]; !last.framed || last.codec != l.codec.id() {
+		// Legacy, unframed and other-codec segments stay as written; new records go to a new segment
+		if !last.legacy && l.lastSeq < last.startSeq {
+			// Empty segment: replace it rather than collide on its starting sequence
+			if err := os.Remove(last.path); err != nil {
+				return fmt.Errorf("failed to remove empty segment: %w", err)
+			}
+			l.segments = l.segments[:len(l.segments)-1]
+		}
+		return l.createSegment(nextSeq)
+	}
+
+	seg := l.segments[len(l.segments)-1]
+	file, err := os.OpenFile(seg.path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open segment: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat segment: %w", err)
+	}
+	index, err := l.rewriteIndex(seg)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	l.active = file
+	l.activeIndex = index
+	l.activeSize = info.Size()
+	return l.ensureActive(nextSeq, maxBytes, maxRecords)
+}
+
+// createSegment starts a new segment beginning at startSeq
+func (l *symbolLog) createSegment(startSeq int64) error {
+	if err := os.MkdirAll(l.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create symbol directory: %w", err)
+	}
+
+	seg := &segment{
+		startSeq: startSeq,
+		path:     filepath.Join(l.dir, segmentFileName(startSeq)),
+		framed:   true,
+		codec:    l.codec.id(),
+	}
+	file, err := os.OpenFile(seg.path, os.O_CREATE|os.O_EXCL|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create segment: %w", err)
+	}
+	if _, err := file.Write(newSegmentHeader(l.codec.id())); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write segment header: %w", err)
+	}
+	index, err := os.OpenFile(seg.indexPath(), os.O_CREATE|os.O_TRUNC|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to create segment index: %w", err)
+	}
+
+	l.segments = append(l.segments, seg)
+	l.active = file
+	l.activeIndex = index
+	l.activeSize = segmentHeaderSize
+	return nil
+}
+
+// writeIndex replaces the index file of a segment with its in-memory index
+func (seg *segment) writeIndex() error {
+	buf := make([]byte, 0, len(seg.index)*indexEntrySize)
+	for _, entry := range seg.index {
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(entry.seq))
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(entry.offset))
+	}
+	if err := os.WriteFile(seg.indexPath(), buf, 0644); err != nil {
+		return fmt.Errorf("failed to write segment index: %w", err)
+	}
+	return nil
+}
+
+// rewriteIndex persists the in-memory index of a reopened segment, replacing any damaged file
+func (l *symbolLog) rewriteIndex(seg *segment) (*os.File, error) {
+	if err := seg.writeIndex(); err != nil {
+		return nil, err
+	}
+	index, err := os.OpenFile(seg.indexPath(), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open segment index: %w", err)
+	}
+	return index, nil
+}
+
+// sync flushes the active segment to disk.
+// The index is a rebuildable hint and is not fsynced.
+func (l *symbolLog) sync() error {
+	if l.active == nil {
+		return nil
+	}
+	if err := l.active.Sync(); err != nil {
+		return fmt.Errorf("failed to sync file: %w", err)
+	}
+	return nil
+}
+
+// seal syncs and closes the active segment
+func (l *symbolLog) seal() error {
+	if l.active == nil {
+		return nil
+	}
+	if err := l.sync(); err != nil {
+		return err
+	}
+	return l.close()
+}
+
+// close closes the active segment handles
+func (l *symbolLog) close() error {
+	var errs []error
+	if l.active != nil {
+		if err := l.active.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		l.active = nil
+	}
+	if l.activeIndex != nil {
+		if err := l.activeIndex.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		l.activeIndex = nil
+	}
+	return errors.Join(errs...)
+}
+
+// archiveThrough moves sealed segments whose records all have sequence <= seq into the archive directory.
+// The active segment is never archived. Returns the number of segments moved.
+func (l *symbolLog) archiveThrough(seq int64) (int, error) {
+	archiveDir := filepath.Join(l.dir, archiveDirName)
+	moved := 0
+	for i := 0; i < len(l.segments)-1; i++ {
+		seg := l.segments[i]
+		if seg.archived {
+			continue
+		}
+		if l.segments[i+1].startSeq-1 > seq {
+			break
+		}
+
+		if err := os.MkdirAll(archiveDir, 0755); err != nil {
+			return moved, fmt.Errorf("failed to create archive directory: %w", err)
+		}
+		oldIndex := seg.indexPath()
+		target := filepath.Join(archiveDir, filepath.Base(seg.path))
+		if err := os.Rename(seg.path, target); err != nil {
+			return moved, fmt.Errorf("failed to archive segment: %w", err)
+		}
+		seg.path = target
+		seg.archived = true
+		moved++
+
+		if !seg.legacy {
+			// The index is only a hint; a missing one is rebuilt by scanning
+			if err := os.Rename(oldIndex, seg.indexPath()); err != nil && !os.IsNotExist(err) {
+				return moved, fmt.Errorf("failed to archive segment index: %w", err)
+			}
+		}
+	}
+	return moved, nil
+}
+
+// readFrom decodes events with sequence >= fromSeq, seeking via the sparse index
+func (l *symbolLog) readFrom(fromSeq int64, fn func(record *EventRecord) error) error {
+	if len(l.segments) == 0 || fromSeq > l.lastSeq {
+		return nil
+	}
+
+	// Last segment starting at or before fromSeq
+	first := sort.Search(len(l.segments), func(i int) bool {
+		return l.segments[i].startSeq > fromSeq
+	}) - 1
+	if first < 0 {
+		first = 0
+	}
+
+	for i := first; i < len(l.segments); i++ {
+		seg := l.segments[i]
+		var start indexEntry
+		if i == first {
+			start = seg.lookup(fromSeq)
+		}
+
+		delivered := false
+		err := scanRecords(seg.path, start.offset, func(record *EventRecord, offset int64) error {
+			if offset == start.offset && start.offset > 0 && record.Sequence != start.seq {
+				return errStaleIndex
+			}
+			if record.Sequence < fromSeq {
+				return nil
+			}
+			delivered = true
+			return fn(record)
+		})
+		if err != nil && start.offset > 0 && !delivered {
+			// Index does not match the data file; fall back to a full segment scan.
+			err = scanRecords(seg.path, 0, func(record *EventRecord, offset int64) error {
+				if record.Sequence < fromSeq {
+					return nil
+				}
+				return fn(record)
+			})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var errStaleIndex = errors.New("stale segment index")
@@ -0,0 +1,267 @@
+package persistence
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"matching-engine/internal/matching"
+)
+
+func newSegmentedStore(t *testing.T, dir string, maxRecords int64) *FileEventStore {
+	t.Helper()
+	config := DefaultFileEventStoreConfig()
+	config.SegmentMaxRecords = maxRecords
+	config.IndexInterval = 4
+	store, err := NewFileEventStoreWithConfig(dir, config)
+	if err != nil {
+		t.Fatalf("failed to create event store: %v", err)
+	}
+	return store
+}
+
+func appendRange(t *testing.T, store *FileEventStore, symbol string, from, to int64) {
+	t.Helper()
+	ctx := context.Background()
+	for i := from; i <= to; i++ {
+		if err := store.Append(ctx, symbol, newBenchEvent(symbol, i)); err != nil {
+			t.Fatalf("failed to append event %d: %v", i, err)
+		}
+	}
+}
+
+func assertSequences(t *testing.T, events []matching.Event, from, to int64) {
+	t.Helper()
+	if int64(len(events)) != to-from+1 {
+		t.Fatalf("expected %d events, got %d", to-from+1, len(events))
+	}
+	for i, event := range events {
+		if event.Sequence() != from+int64(i) {
+			t.Fatalf("expected sequence %d at position %d, got %d", from+int64(i), i, event.Sequence())
+		}
+	}
+}
+
+// encodeJSONLines encodes events in the unframed JSON Lines format of older logs
+func encodeJSONLines(t *testing.T, symbol string, from, to int64) []byte {
+	t.Helper()
+	var data []byte
+	for i := from; i <= to; i++ {
+		event := newBenchEvent(symbol, i)
+		line, err := json.Marshal(EventRecord{
+			Version:    1,
+			Symbol:     symbol,
+			Sequence:   i,
+			Type:       event.EventType(),
+			OccurredAt: event.OccurredAt(),
+			Payload:    event,
+		})
+		if err != nil {
+			t.Fatalf("encode failed: %v", err)
+		}
+		data = append(append(data, line...), '\n')
+	}
+	return data
+}
+
+func TestSegmentedLog_RotationAndReadFrom(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "events")
+	store := newSegmentedStore(t, dir, 10)
+	defer store.Close()
+
+	symbol := "BTC-USDT"
+	appendRange(t, store, symbol, 1, 35)
+
+	// 35 records at 10 per segment -> 4 segments named by start sequence
+	for _, start := range []int64{1, 11, 21, 31} {
+		path := filepath.Join(dir, symbol, segmentFileName(start))
+		if _, err := os.Stat(path); err != nil {
+			t.Fatalf("expected segment %s: %v", path, err)
+		}
+	}
+
+	ctx := context.Background()
+	for _, fromSeq := range []int64{1, 5, 10, 11, 17, 30, 35} {
+		events, err := store.ReadFrom(ctx, symbol, fromSeq)
+		if err != nil {
+			t.Fatalf("ReadFrom(%d) failed: %v", fromSeq, err)
+		}
+		assertSequences(t, events, fromSeq, 35)
+	}
+
+	events, err := store.ReadFrom(ctx, symbol, 36)
+	if err != nil {
+		t.Fatalf("ReadFrom past end failed: %v", err)
+	}
+	if len(events) != 0 {
+		t.Fatalf("expected no events past end, got %d", len(events))
+	}
+}
+
+func TestSegmentedLog_ReopenContinuesActiveSegment(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "events")
+	symbol := "BTC-USDT"
+
+	store := newSegmentedStore(t, dir, 10)
+	appendRange(t, store, symbol, 1, 15)
+	if err := store.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+
+	reopened := newSegmentedStore(t, dir, 10)
+	defer reopened.Close()
+
+	ctx := context.Background()
+	lastSeq, err := reopened.GetLastSequence(ctx, symbol)
+	if err != nil {
+		t.Fatalf("GetLastSequence failed: %v", err)
+	}
+	if lastSeq != 15 {
+		t.Fatalf("expected last sequence 15, got %d", lastSeq)
+	}
+
+	// Active segment 11 has 5 records; 5 more fill it and the next goes to segment 21.
+	appendRange(t, reopened, symbol, 16, 21)
+	if _, err := os.Stat(filepath.Join(dir, symbol, segmentFileName(21))); err != nil {
+		t.Fatalf("expected rollover to segment 21: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, symbol, segmentFileName(16))); !os.IsNotExist(err) {
+		t.Fatalf("reopened store must append to the active segment instead of starting a new one")
+	}
+
+	events, err := reopened.ReadFrom(ctx, symbol, 1)
+	if err != nil {
+		t.Fatalf("ReadFrom failed: %v", err)
+	}
+	assertSequences(t, events, 1, 21)
+}
+
+func TestSegmentedLog_FailedAppendIsRolledBack(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "events")
+	symbol := "BTC-USDT"
+	store := newSegmentedStore(t, dir, 10)
+	appendRange(t, store, symbol, 1, 9)
+
+	// Record 10 fills segment 1, and a stray file keeps record 11 from starting segment 11
+	blocker := filepath.Join(dir, symbol, segmentFileName(11))
+	if err := os.WriteFile(blocker, nil, 0644); err != nil {
+		t.Fatalf("failed to create blocker: %v", err)
+	}
+	ctx := context.Background()
+	batch := []matching.Event{newBenchEvent(symbol, 10), newBenchEvent(symbol, 11)}
+	if err := store.AppendBatch(ctx, symbol, batch); err == nil {
+		t.Fatalf("expected the append to fail")
+	}
+	events, err := store.ReadFrom(ctx, symbol, 1)
+	if err != nil {
+		t.Fatalf("ReadFrom failed: %v", err)
+	}
+	assertSequences(t, events, 1, 9)
+
+	// The retry appends at the record boundary the failed write left
+	if err := os.Remove(blocker); err != nil {
+		t.Fatalf("failed to remove blocker: %v", err)
+	}
+	if err := store.AppendBatch(ctx, symbol, batch); err != nil {
+		t.Fatalf("retry failed: %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	reopened := newSegmentedStore(t, dir, 10)
+	defer reopened.Close()
+	if events, err = reopened.ReadFrom(ctx, symbol, 1); err != nil {
+		t.Fatalf("ReadFrom after reopen failed: %v", err)
+	}
+	assertSequences(t, events, 1, 11)
+}
+
+func TestSegmentedLog_DamagedIndexFallsBackToScan(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "events")
+	symbol := "BTC-USDT"
+
+	store := newSegmentedStore(t, dir, 0)
+	appendRange(t, store, symbol, 1, 20)
+	if err := store.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+
+	// Point every index entry at a wrong offset.
+	indexPath := filepath.Join(dir, symbol, "segment-00000000000000000001.idx")
+	data, err := os.ReadFile(indexPath)
+	if err != nil {
+		t.Fatalf("failed to read index: %v", err)
+	}
+	for off := 8; off+8 <= len(data); off += indexEntrySize {
+		data[off] ^= 0x07
+	}
+	if err := os.WriteFile(indexPath, data, 0644); err != nil {
+		t.Fatalf("failed to corrupt index: %v", err)
+	}
+
+	reopened := newSegmentedStore(t, dir, 0)
+	defer reopened.Close()
+
+	events, err := reopened.ReadFrom(context.Background(), symbol, 13)
+	if err != nil {
+		t.Fatalf("ReadFrom with damaged index failed: %v", err)
+	}
+	assertSequences(t, events, 13, 20)
+}
+
+func TestSegmentedLog_ReadsLegacySingleFileLog(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "events")
+	symbol := "BTC-USDT"
+
+	// Write a pre-segmentation events.log by hand.
+	legacy := encodeJSONLines(t, symbol, 1, 3)
+	if err := os.MkdirAll(filepath.Join(dir, symbol), 0755); err != nil {
+		t.Fatalf("mkdir failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, symbol, legacyLogName), legacy, 0644); err != nil {
+		t.Fatalf("failed to write legacy log: %v", err)
+	}
+
+	store := newSegmentedStore(t, dir, 0)
+	defer store.Close()
+
+	ctx := context.Background()
+	symbols, err := store.ListSymbols(ctx)
+	if err != nil {
+		t.Fatalf("ListSymbols failed: %v", err)
+	}
+	if len(symbols) != 1 || symbols[0] != symbol {
+		t.Fatalf("expected legacy symbol to be listed, got %v", symbols)
+	}
+
+	lastSeq, err := store.GetLastSequence(ctx, symbol)
+	if err != nil {
+		t.Fatalf("GetLastSequence failed: %v", err)
+	}
+	if lastSeq != 3 {
+		t.Fatalf("expected last sequence 3 from legacy log, got %d", lastSeq)
+	}
+
+	// New events go to a segment; the legacy file is left untouched.
+	appendRange(t, store, symbol, 4, 6)
+	if _, err := os.Stat(filepath.Join(dir, symbol, segmentFileName(4))); err != nil {
+		t.Fatalf("expected new segment after legacy log: %v", err)
+	}
+	after, err := os.ReadFile(filepath.Join(dir, symbol, legacyLogName))
+	if err != nil {
+		t.Fatalf("failed to read legacy log: %v", err)
+	}
+	if len(after) != len(legacy) {
+		t.Fatalf("legacy log must not be appended to")
+	}
+
+	for _, fromSeq := range []int64{1, 2, 4, 6} {
+		events, err := store.ReadFrom(ctx, symbol, fromSeq)
+		if err != nil {
+			t.Fatalf("ReadFrom(%d) failed: %v", fromSeq, err)
+		}
+		assertSequences(t, events, fromSeq, 6)
+	}
+}
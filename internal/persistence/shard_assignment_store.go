@@ -0,0 +1,89 @@
+package persistence
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const shardAssignmentsFile = "shard_assignments.json"
+
+// shardAssignmentsFormatVersion is the version of the assignment file layout
+const shardAssignmentsFormatVersion = 1
+
+// shardAssignmentsDocument is the on-disk form of the symbol→shard assignment table
+type shardAssignmentsDocument struct {
+	FormatVersion int            `json:"format_version"`
+	Assignments   map[string]int `json:"assignments"`
+}
+
+// FileShardAssignmentStore keeps the symbol→shard assignment table in one JSON file,
+// replaced atomically on every change
+type FileShardAssignmentStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileShardAssignmentStore opens the assignment store in baseDir
+func NewFileShardAssignmentStore(baseDir string) (*FileShardAssignmentStore, error) {
+	if err := os.MkdirAll(baseDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create base directory: %w", err)
+	}
+	return &FileShardAssignmentStore{path: filepath.Join(baseDir, shardAssignmentsFile)}, nil
+}
+
+// Load returns the persisted assignments; a missing file loads as an empty table
+func (s *FileShardAssignmentStore) Load(ctx context.Context) (map[string]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return map[string]int{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read shard assignments: %w", err)
+	}
+
+	var doc shardAssignmentsDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal shard assignments: %w", err)
+	}
+	if doc.FormatVersion != shardAssignmentsFormatVersion {
+		return nil, fmt.Errorf("unsupported shard assignments format version %d", doc.FormatVersion)
+	}
+	if doc.Assignments == nil {
+		doc.Assignments = map[string]int{}
+	}
+	return doc.Assignments, nil
+}
+
+// SaveShardAssignments replaces the persisted table with assignments
+func (s *FileShardAssignmentStore) SaveShardAssignments(ctx context.Context, assignments map[string]int) error {
+	data, err := json.MarshalIndent(shardAssignmentsDocument{
+		FormatVersion: shardAssignmentsFormatVersion,
+		Assignments:   assignments,
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal shard assignments: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Write to temporary file first
+	tempPath := s.path + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write shard assignments: %w", err)
+	}
+
+	// Atomic rename
+	if err := os.Rename(tempPath, s.path); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to replace shard assignments: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package persistence
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileShardAssignmentStore_SaveAndLoad(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	store, err := NewFileShardAssignmentStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileShardAssignmentStore failed: %v", err)
+	}
+	loaded, err := store.Load(ctx)
+	if err != nil || len(loaded) != 0 {
+		t.Fatalf("expected an empty table before the first save, got %v, %v", loaded, err)
+	}
+
+	if err := store.SaveShardAssignments(ctx, map[string]int{"BTC-USDT": 1}); err != nil {
+		t.Fatalf("SaveShardAssignments failed: %v", err)
+	}
+	if err := store.SaveShardAssignments(ctx, map[string]int{"BTC-USDT": 3, "ETH-USDT": 0}); err != nil {
+		t.Fatalf("SaveShardAssignments failed: %v", err)
+	}
+
+	reopened, err := NewFileShardAssignmentStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileShardAssignmentStore failed: %v", err)
+	}
+	loaded, err = reopened.Load(ctx)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(loaded) != 2 || loaded["BTC-USDT"] != 3 || loaded["ETH-USDT"] != 0 {
+		t.Fatalf("unexpected assignments %v", loaded)
+	}
+	if _, err := os.Stat(filepath.Join(dir, shardAssignmentsFile+".tmp")); !os.IsNotExist(err) {
+		t.Fatalf("temporary file left behind: %v", err)
+	}
+}
@@ -1,31 +1,103 @@
 package persistence
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
 	"reflect"
 	"sort"
 	"strings"
 	"sync"
+	"time"
 )
 
+// Snapshot file format version. Files written before versioning hold the bare
+// snapshot JSON (format 1); format 2 wraps it in a snapshotEnvelope with a content hash.
+const (
+	snapshotFormatVersion = 2
+	snapshotHashPrefix    = "sha256:"
+)
+
+// snapshotEnvelope is the on-disk form of a snapshot. The hash covers the compact JSON of Snapshot.
+type snapshotEnvelope struct {
+	FormatVersion int             `json:"format_version"`
+	ContentHash   string          `json:"content_hash"`
+	Snapshot      json.RawMessage `json:"snapshot"`
+}
+
+// SkippedSnapshot is a snapshot that was not used for recovery and why
+type SkippedSnapshot struct {
+	Snapshot SnapshotMetadata `json:"snapshot"`
+	Reason   string           `json:"reason"`
+}
+
+// SnapshotLoadReport describes which snapshot Load picked for a symbol
+type SnapshotLoadReport struct {
+	Symbol   string            `json:"symbol"`
+	Used     *SnapshotMetadata `json:"used,omitempty"` // nil when no valid snapshot exists
+	Verified bool              `json:"verified"`       // false for legacy snapshots without a content hash
+	Skipped  []SkippedSnapshot `json:"skipped,omitempty"`
+}
+
+// SnapshotRetention selects which snapshots are kept when pruning.
+// A snapshot is kept if it is one of the KeepLast newest or younger than MaxAge;
+// the newest snapshot is always kept. With both rules zero every snapshot is kept.
+type SnapshotRetention struct {
+	KeepLast int           // Number of newest snapshots to keep (0 = rule disabled)
+	MaxAge   time.Duration // Keep snapshots captured within this age (0 = rule disabled)
+}
+
+// SegmentArchiver moves event log segments that a snapshot fully covers out of the live log
+type SegmentArchiver interface {
+	ArchiveThrough(ctx context.Context, symbol string, seq int64) (int, error)
+}
+
+// FileSnapshotStoreConfig holds configuration for the file snapshot store
+type FileSnapshotStoreConfig struct {
+	Retention SnapshotRetention // Applied after every Save
+	Archiver  SegmentArchiver   // Optional: archives event segments covered by the oldest retained snapshot
+}
+
+// PruneResult reports the outcome of applying retention to a symbol
+type PruneResult struct {
+	Retained         []SnapshotMetadata // Sorted by sequence desc
+	Pruned           []SnapshotMetadata
+	ArchivedSegments int
+}
+
 // FileSnapshotStore implements SnapshotStore using JSON files
 type FileSnapshotStore struct {
 	baseDir string
+	config  FileSnapshotStoreConfig
 	mu      sync.RWMutex
 }
 
 // NewFileSnapshotStore creates a new file-based snapshot store
 func NewFileSnapshotStore(baseDir string) (*FileSnapshotStore, error) {
+	return NewFileSnapshotStoreWithConfig(baseDir, nil)
+}
+
+// NewFileSnapshotStoreWithConfig creates a new file-based snapshot store with retention
+func NewFileSnapshotStoreWithConfig(baseDir string, config *FileSnapshotStoreConfig) (*FileSnapshotStore, error) {
+	if config == nil {
+		config = &FileSnapshotStoreConfig{}
+	}
+	if config.Retention.KeepLast < 0 || config.Retention.MaxAge < 0 {
+		return nil, fmt.Errorf("snapshot retention must not be negative")
+	}
 	if err := os.MkdirAll(baseDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create base directory: %w", err)
 	}
 
 	return &FileSnapshotStore{
 		baseDir: baseDir,
+		config:  *config,
 	}, nil
 }
 
@@ -51,8 +123,16 @@ func (s *FileSnapshotStore) Save(ctx context.Context, snapshot any) error {
 	filename := fmt.Sprintf("snapshot-%d.json", lastSeq)
 	filePath := filepath.Join(symbolDir, filename)
 
-	// Marshal snapshot to JSON
-	data, err := json.MarshalIndent(snapshot, "", "  ")
+	// Marshal snapshot to JSON and wrap it with its content hash
+	content, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to marshal snapshot: %w", err)
+	}
+	data, err := json.MarshalIndent(snapshotEnvelope{
+		FormatVersion: snapshotFormatVersion,
+		ContentHash:   snapshotContentHash(content),
+		Snapshot:      content,
+	}, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal snapshot: %w", err)
 	}
@@ -69,9 +149,62 @@ func (s *FileSnapshotStore) Save(ctx context.Context, snapshot any) error {
 		return fmt.Errorf("failed to rename snapshot file: %w", err)
 	}
 
+	if _, err := s.pruneLocked(ctx, symbol, time.Now()); err != nil {
+		return fmt.Errorf("snapshot saved but retention failed: %w", err)
+	}
+
 	return nil
 }
 
+// Prune applies the retention policy to a symbol's snapshots and archives
+// event segments the oldest retained snapshot fully covers
+func (s *FileSnapshotStore) Prune(ctx context.Context, symbol string) (*PruneResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.pruneLocked(ctx, symbol, time.Now())
+}
+
+// pruneLocked implements Prune. Caller must hold s.mu.
+func (s *FileSnapshotStore) pruneLocked(ctx context.Context, symbol string, now time.Time) (*PruneResult, error) {
+	snapshots, err := s.listSnapshotsInternal(symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &PruneResult{}
+	retention := s.config.Retention
+	for i, meta := range snapshots {
+		keep := i == 0 ||
+			(retention.KeepLast == 0 && retention.MaxAge == 0) ||
+			(retention.KeepLast > 0 && i < retention.KeepLast) ||
+			(retention.MaxAge > 0 && now.Sub(meta.CapturedAt) < retention.MaxAge)
+		if keep {
+			result.Retained = append(result.Retained, meta)
+		} else {
+			result.Pruned = append(result.Pruned, meta)
+		}
+	}
+
+	for _, meta := range result.Pruned {
+		if err := os.Remove(meta.FilePath); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to remove snapshot: %w", err)
+		}
+	}
+
+	// Events up to the oldest retained snapshot are never needed for recovery from a retained snapshot
+	if s.config.Archiver != nil && len(result.Retained) > 0 {
+		oldest := result.Retained[len(result.Retained)-1]
+		archived, err := s.config.Archiver.ArchiveThrough(ctx, symbol, oldest.LastSequence)
+		if err != nil {
+			return nil, fmt.Errorf("failed to archive event segments: %w", err)
+		}
+		result.ArchivedSegments = archived
+	}
+
+	return result, nil
+}
+
 // extractSnapshotMetadata extracts symbol and last_sequence from a snapshot using reflection
 func extractSnapshotMetadata(snapshot any) (string, int64, error) {
 	// Try type assertion first for common types
@@ -112,34 +245,99 @@ func extractSnapshotMetadata(snapshot any) (string, int64, error) {
 	return symbol, lastSeq, nil
 }
 
-// Load loads the latest snapshot for a specific symbol
+// Load loads the latest valid snapshot for a specific symbol.
+// Corrupt snapshots are skipped in favour of older ones; see LoadWithReport.
 func (s *FileSnapshotStore) Load(ctx context.Context, symbol string) (*Snapshot, error) {
+	snapshot, _, err := s.LoadWithReport(ctx, symbol)
+	return snapshot, err
+}
+
+// LoadWithReport loads the newest snapshot that passes verification, falling back to
+// older ones. The report names the snapshot used and why newer ones were skipped.
+// Returns a nil snapshot when none is usable, so recovery replays the full log.
+func (s *FileSnapshotStore) LoadWithReport(ctx context.Context, symbol string) (*Snapshot, *SnapshotLoadReport, error) {
+	return s.LoadAtOrBefore(ctx, symbol, math.MaxInt64)
+}
+
+// LoadAtOrBefore is LoadWithReport restricted to snapshots with LastSequence <= seq.
+// Newer snapshots are ignored, not reported as skipped.
+func (s *FileSnapshotStore) LoadAtOrBefore(ctx context.Context, symbol string, seq int64) (*Snapshot, *SnapshotLoadReport, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	// List all snapshots
 	snapshots, err := s.listSnapshotsInternal(symbol)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	if len(snapshots) == 0 {
-		return nil, nil // No snapshot available
+	report := &SnapshotLoadReport{Symbol: symbol}
+	for _, meta := range snapshots {
+		if meta.LastSequence > seq {
+			continue
+		}
+		snapshot, verified, err := readSnapshotFile(meta)
+		if err != nil {
+			report.Skipped = append(report.Skipped, SkippedSnapshot{Snapshot: meta, Reason: err.Error()})
+			continue
+		}
+		used := meta
+		report.Used = &used
+		report.Verified = verified
+		return snapshot, report, nil
 	}
 
-	// Load the latest snapshot (first in sorted list)
-	latestSnapshot := snapshots[0]
-	data, err := os.ReadFile(latestSnapshot.FilePath)
+	return nil, report, nil // No valid snapshot available
+}
+
+// readSnapshotFile decodes and verifies one snapshot file.
+// verified is false for legacy files, which carry no hash to check.
+func readSnapshotFile(meta SnapshotMetadata) (*Snapshot, bool, error) {
+	data, err := os.ReadFile(meta.FilePath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read snapshot file: %w", err)
+		return nil, false, fmt.Errorf("failed to read snapshot file: %w", err)
+	}
+
+	var envelope snapshotEnvelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, false, fmt.Errorf("failed to unmarshal snapshot: %w", err)
+	}
+
+	content := data
+	verified := false
+	switch {
+	case envelope.FormatVersion == 0 && envelope.Snapshot == nil:
+		// Legacy bare snapshot
+	case envelope.FormatVersion == snapshotFormatVersion:
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, envelope.Snapshot); err != nil {
+			return nil, false, fmt.Errorf("failed to read snapshot content: %w", err)
+		}
+		if hash := snapshotContentHash(compact.Bytes()); hash != envelope.ContentHash {
+			return nil, false, fmt.Errorf("content hash mismatch: stored %s, computed %s", envelope.ContentHash, hash)
+		}
+		content = compact.Bytes()
+		verified = true
+	default:
+		return nil, false, fmt.Errorf("unsupported snapshot format version %d", envelope.FormatVersion)
 	}
 
 	var snapshot Snapshot
-	if err := json.Unmarshal(data, &snapshot); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal snapshot: %w", err)
+	if err := json.Unmarshal(content, &snapshot); err != nil {
+		return nil, false, fmt.Errorf("failed to unmarshal snapshot: %w", err)
+	}
+	if snapshot.Symbol != meta.Symbol || snapshot.LastSequence != meta.LastSequence {
+		return nil, false, fmt.Errorf("snapshot content is for %s@%d, file name says %s@%d",
+			snapshot.Symbol, snapshot.LastSequence, meta.Symbol, meta.LastSequence)
 	}
 
-	return &snapshot, nil
+	return &snapshot, verified, nil
+}
+
+// snapshotContentHash hashes the compact JSON of a snapshot
+func snapshotContentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return snapshotHashPrefix + hex.EncodeToString(sum[:])
 }
 
 // ListSnapshots lists all available snapshots for a symbol (sorted by sequence desc)
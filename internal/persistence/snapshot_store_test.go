@@ -2,7 +2,9 @@ package persistence
 
 import (
 	"context"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -181,3 +183,125 @@ func TestFileSnapshotStore_NoSnapshot(t *testing.T) {
 		t.Errorf("expected nil snapshot, got %v", loaded)
 	}
 }
+
+func TestFileSnapshotStore_FallsBackPastCorruptSnapshots(t *testing.T) {
+	tempDir := t.TempDir()
+	store, err := NewFileSnapshotStore(filepath.Join(tempDir, "snapshots"))
+	if err != nil {
+		t.Fatalf("failed to create snapshot store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	symbol := "BTC-USDT"
+	for _, seq := range []int64{10, 20, 30} {
+		saveSnapshotAt(t, store, symbol, seq)
+	}
+	snapshots, _ := store.ListSnapshots(ctx, symbol)
+
+	// 30: content edited after the hash was taken; 20: truncated write
+	data, err := os.ReadFile(snapshots[0].FilePath)
+	if err != nil {
+		t.Fatalf("failed to read snapshot: %v", err)
+	}
+	tampered := strings.Replace(string(data), `"version": 1`, `"version": 7`, 1)
+	if tampered == string(data) {
+		t.Fatalf("test setup: snapshot content not found")
+	}
+	if err := os.WriteFile(snapshots[0].FilePath, []byte(tampered), 0644); err != nil {
+		t.Fatalf("failed to write snapshot: %v", err)
+	}
+	data, _ = os.ReadFile(snapshots[1].FilePath)
+	if err := os.WriteFile(snapshots[1].FilePath, data[:len(data)/2], 0644); err != nil {
+		t.Fatalf("failed to write snapshot: %v", err)
+	}
+
+	loaded, report, err := store.LoadWithReport(ctx, symbol)
+	if err != nil {
+		t.Fatalf("LoadWithReport failed: %v", err)
+	}
+	if loaded == nil || loaded.LastSequence != 10 {
+		t.Fatalf("expected fallback to snapshot 10, got %+v", loaded)
+	}
+	if report.Used == nil || report.Used.LastSequence != 10 || !report.Verified {
+		t.Fatalf("expected report to name verified snapshot 10, got %+v", report)
+	}
+	if len(report.Skipped) != 2 ||
+		!strings.Contains(report.Skipped[0].Reason, "content hash mismatch") ||
+		!strings.Contains(report.Skipped[1].Reason, "unmarshal") {
+		t.Fatalf("unexpected skip reasons: %+v", report.Skipped)
+	}
+
+	// With every snapshot unusable, recovery falls back to the full log
+	if err := os.WriteFile(snapshots[2].FilePath, []byte("{}"), 0644); err != nil {
+		t.Fatalf("failed to write snapshot: %v", err)
+	}
+	loaded, report, err = store.LoadWithReport(ctx, symbol)
+	if err != nil {
+		t.Fatalf("LoadWithReport failed: %v", err)
+	}
+	if loaded != nil || report.Used != nil || len(report.Skipped) != 3 {
+		t.Fatalf("expected no usable snapshot, got %+v / %+v", loaded, report)
+	}
+}
+
+func TestFileSnapshotStore_LoadsLegacySnapshot(t *testing.T) {
+	tempDir := t.TempDir()
+	store, err := NewFileSnapshotStore(tempDir)
+	if err != nil {
+		t.Fatalf("failed to create snapshot store: %v", err)
+	}
+	defer store.Close()
+
+	// Snapshot written before the envelope existed
+	symbol := "BTC-USDT"
+	legacy := `{"version": 1, "symbol": "BTC-USDT", "last_sequence": 42, "captured_at": "2025-01-01T00:00:00Z"}`
+	if err := os.MkdirAll(filepath.Join(tempDir, symbol), 0755); err != nil {
+		t.Fatalf("mkdir failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, symbol, "snapshot-42.json"), []byte(legacy), 0644); err != nil {
+		t.Fatalf("failed to write snapshot: %v", err)
+	}
+
+	loaded, report, err := store.LoadWithReport(context.Background(), symbol)
+	if err != nil {
+		t.Fatalf("LoadWithReport failed: %v", err)
+	}
+	if loaded == nil || loaded.LastSequence != 42 {
+		t.Fatalf("expected legacy snapshot 42, got %+v", loaded)
+	}
+	if report.Verified {
+		t.Fatalf("legacy snapshot has no hash and must not be reported as verified")
+	}
+}
+
+func TestFileRecoveryService_ReplaysMoreEventsAfterSnapshotFallback(t *testing.T) {
+	tempDir := t.TempDir()
+	eventStore := newSegmentedStore(t, filepath.Join(tempDir, "events"), 0)
+	defer eventStore.Close()
+	snapshotStore, err := NewFileSnapshotStore(filepath.Join(tempDir, "snapshots"))
+	if err != nil {
+		t.Fatalf("failed to create snapshot store: %v", err)
+	}
+
+	ctx := context.Background()
+	symbol := "BTC-USDT"
+	appendRange(t, eventStore, symbol, 1, 12)
+	saveSnapshotAt(t, snapshotStore, symbol, 4)
+	saveSnapshotAt(t, snapshotStore, symbol, 8)
+
+	snapshots, _ := snapshotStore.ListSnapshots(ctx, symbol)
+	if err := os.WriteFile(snapshots[0].FilePath, []byte("not json"), 0644); err != nil {
+		t.Fatalf("failed to write snapshot: %v", err)
+	}
+
+	recovery := NewFileRecoveryService(eventStore, snapshotStore)
+	snapshot, events, report, err := recovery.RecoverWithReport(ctx, symbol)
+	if err != nil {
+		t.Fatalf("RecoverWithReport failed: %v", err)
+	}
+	if snapshot.LastSequence != 4 || len(report.Skipped) != 1 {
+		t.Fatalf("expected recovery from snapshot 4 with one skipped, got %d / %+v", snapshot.LastSequence, report)
+	}
+	assertSequences(t, events, 5, 12)
+}
@@ -34,6 +34,9 @@ type EventStore interface {
 	// Append appends an event to the log for a specific symbol
 	Append(ctx context.Context, symbol string, event matching.Event) error
 
+	// AppendBatch appends multiple events for a symbol as one durable unit
+	AppendBatch(ctx context.Context, symbol string, events []matching.Event) error
+
 	// ReadFrom reads events from a specific sequence number (inclusive)
 	ReadFrom(ctx context.Context, symbol string, fromSeq int64) ([]matching.Event, error)
 
@@ -77,6 +80,17 @@ type RecoveryService interface {
 	// Returns the recovered snapshot and events to replay
 	Recover(ctx context.Context, symbol string) (*Snapshot, []matching.Event, error)
 
+	// RecoverTo recovers a symbol as it was at a past point: the newest snapshot
+	// at or before the target and only the events up to it
+	RecoverTo(ctx context.Context, symbol string, target RecoveryTarget) (*Snapshot, []matching.Event, error)
+
 	// ValidateSequence validates that event sequences are continuous
 	ValidateSequence(events []matching.Event) error
 }
+
+// RecoveryTarget is a point in a symbol's history to recover to.
+// With both fields set, recovery stops at whichever comes first.
+type RecoveryTarget struct {
+	Sequence int64     // Last event sequence to include, 0 for no limit
+	Time     time.Time // Last OccurredAt to include, zero for no limit
+}
@@ -52,6 +52,8 @@ func (p *Projector) Project(ctx context.Context, event matching.Event) error {
 		if err := p.projectOrderCanceled(ctx, e); err != nil {
 			return fmt.Errorf("failed to project OrderCanceled: %w", err)
 		}
+	case *matching.SymbolStatusChangedEvent, *matching.PriceBandBreachedEvent, *matching.SymbolSpecChangedEvent:
+		// Orders and trades are unaffected; only the sequence cursor advances
 	default:
 		return fmt.Errorf("unknown event type: %T", event)
 	}
@@ -127,6 +129,7 @@ func (p *Projector) projectOrderAccepted(ctx context.Context, event *matching.Or
 		CreatedAt:     event.OccurredAt(),
 		UpdatedAt:     event.OccurredAt(),
 		LastSequence:  event.Sequence(),
+		GroupID:       event.GroupID,
 	}
 
 	return p.orderRepo.Save(ctx, order)
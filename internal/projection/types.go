@@ -32,6 +32,7 @@ type OrderView struct {
 	CreatedAt     time.Time   `json:"created_at"`
 	UpdatedAt     time.Time   `json:"updated_at"`
 	LastSequence  int64       `json:"last_sequence"` // Last event sequence that updated this order
+	GroupID       string      `json:"group_id,omitempty"`
 }
 
 // TradeView represents the read model for a trade
@@ -0,0 +1,32 @@
+package recovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"matching-engine/internal/engine"
+	"matching-engine/internal/persistence"
+)
+
+// RestoreIdempotencyRecords loads the unexpired persisted idempotency records into the engine,
+// so a command retried after a restart gets its original result. Returns the number restored.
+func RestoreIdempotencyRecords(ctx context.Context, eng *engine.Engine, store *persistence.FileIdempotencyStore) (int, error) {
+	raws, err := store.Load(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	records := make([]*engine.PersistedIdempotencyRecord, 0, len(raws))
+	for _, raw := range raws {
+		var record engine.PersistedIdempotencyRecord
+		if err := json.Unmarshal(raw, &record); err != nil {
+			return 0, fmt.Errorf("failed to decode idempotency record: %w", err)
+		}
+		records = append(records, &record)
+	}
+	if err := eng.RestoreIdempotencyRecords(records); err != nil {
+		return 0, err
+	}
+	return len(records), nil
+}
@@ -0,0 +1,79 @@
+package recovery
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"matching-engine/internal/engine"
+	"matching-engine/internal/matching"
+	"matching-engine/internal/persistence"
+)
+
+func TestRestoreIdempotencyRecords_RetryAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	req := &matching.PlaceOrderRequest{
+		OrderID:       "ord-1",
+		ClientOrderID: "c-ord-1",
+		AccountID:     "acc-001",
+		Symbol:        testSymbol,
+		Side:          matching.SideBuy,
+		PriceInt:      4300000000000,
+		QuantityInt:   100000000,
+	}
+	hash, _ := engine.ComputePayloadHash(req)
+	envelope := func(payloadHash string) *engine.CommandEnvelope {
+		return &engine.CommandEnvelope{
+			CommandType:    engine.CommandTypePlace,
+			IdempotencyKey: "idem-1",
+			Symbol:         testSymbol,
+			AccountID:      "acc-001",
+			PayloadHash:    payloadHash,
+			Payload:        req,
+			CreatedAt:      time.Now(),
+		}
+	}
+
+	store, err := persistence.NewFileIdempotencyStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileIdempotencyStore failed: %v", err)
+	}
+	first := engine.NewEngine(nil)
+	first.SetIdempotencyRecordStore(store)
+	original := first.Submit(envelope(hash))
+	if original.ErrorCode != engine.ErrorCodeNone {
+		t.Fatalf("place failed: %v", original.Err)
+	}
+	first.Close()
+	store.Close()
+
+	store, err = persistence.NewFileIdempotencyStore(dir)
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	defer store.Close()
+	restarted := engine.NewEngine(nil)
+	defer restarted.Close()
+	n, err := RestoreIdempotencyRecords(context.Background(), restarted, store)
+	if err != nil || n != 1 {
+		t.Fatalf("expected 1 restored record, got %d (%v)", n, err)
+	}
+
+	retry := restarted.Submit(envelope(hash))
+	if retry.ErrorCode != engine.ErrorCodeNone {
+		t.Fatalf("retry should return the cached result, got %q: %v", retry.ErrorCode, retry.Err)
+	}
+	want := original.Result.(*matching.CommandResult).Events
+	got := retry.Result.(*matching.CommandResult).Events
+	if len(got) != len(want) || got[0].EventID() != want[0].EventID() {
+		t.Fatalf("retry returned events %+v, want %+v", got, want)
+	}
+	if accepted, ok := got[0].(*matching.OrderAcceptedEvent); !ok || accepted.OrderID != "ord-1" {
+		t.Fatalf("unexpected first event %+v", got[0])
+	}
+
+	conflict := restarted.Submit(envelope("other-hash"))
+	if conflict.ErrorCode != engine.ErrorCodeDuplicateRequest {
+		t.Fatalf("expected DUPLICATE_REQUEST, got %q", conflict.ErrorCode)
+	}
+}
@@ -0,0 +1,167 @@
+package recovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"matching-engine/internal/engine"
+	"matching-engine/internal/matching"
+	"matching-engine/internal/persistence"
+)
+
+// EventDivergence is the first event where a journal replay differs from the stored log
+type EventDivergence struct {
+	Sequence int64  `json:"sequence"`
+	Field    string `json:"field"` // Event field, or "type" / "missing" / "extra"
+	Replayed any    `json:"replayed"`
+	Stored   any    `json:"stored"`
+}
+
+// JournalSymbolReport is the journal replay result of one symbol
+type JournalSymbolReport struct {
+	Symbol         string           `json:"symbol"`
+	Commands       int              `json:"commands"`
+	ReplayedEvents int              `json:"replayed_events"`
+	StoredEvents   int              `json:"stored_events"`
+	Divergence     *EventDivergence `json:"divergence,omitempty"`
+}
+
+// JournalReplayReport is the result of replaying the command journal against the event log
+type JournalReplayReport struct {
+	Symbols []JournalSymbolReport `json:"symbols"`
+}
+
+// OK reports whether every symbol's replayed events matched the stored log
+func (r *JournalReplayReport) OK() bool {
+	for _, symbol := range r.Symbols {
+		if symbol.Divergence != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// ReplayJournal feeds every journaled command through fresh order books and compares the
+// events they produce with the stored event log, symbol by symbol. Run against production
+// journals, it shows whether a change to matching logic would have produced different events.
+// The journal must cover each symbol's history from its first command; archived log
+// segments are skipped by comparing from the first stored sequence.
+// Commands of a symbol that moved between shards are merged by book sequence.
+func ReplayJournal(ctx context.Context, journal *persistence.FileCommandJournal, eventStore persistence.EventStore) (*JournalReplayReport, error) {
+	shards, err := journal.ListShards(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// A symbol that moved between shards has commands in several journals;
+	// merge them by the book sequence each command executed at
+	bySymbol := make(map[string][]*engine.JournaledCommand)
+	for _, shardID := range shards {
+		records, err := journal.ReadShard(ctx, shardID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read journal of shard %d: %w", shardID, err)
+		}
+		for _, record := range records {
+			var command engine.JournaledCommand
+			if err := json.Unmarshal(record.Command, &command); err != nil {
+				return nil, fmt.Errorf("failed to decode shard %d journal record %d: %w", shardID, record.Sequence, err)
+			}
+			bySymbol[command.Symbol] = append(bySymbol[command.Symbol], &command)
+		}
+	}
+
+	replayer := engine.NewJournalReplayer()
+	commands := make(map[string]int)
+	for symbol, journaled := range bySymbol {
+		sort.SliceStable(journaled, func(i, j int) bool {
+			return journaled[i].BookSeq < journaled[j].BookSeq
+		})
+		for _, command := range journaled {
+			if _, err := replayer.Apply(command); err != nil {
+				return nil, fmt.Errorf("failed to replay %s command %s: %w", symbol, command.IdempotencyKey, err)
+			}
+		}
+		commands[symbol] = len(journaled)
+	}
+
+	storedSymbols, err := eventStore.ListSymbols(ctx)
+	if err != nil {
+		return nil, err
+	}
+	replayed := replayer.Events()
+	symbols := make(map[string]struct{}, len(replayed)+len(storedSymbols))
+	for symbol := range replayed {
+		symbols[symbol] = struct{}{}
+	}
+	for _, symbol := range storedSymbols {
+		symbols[symbol] = struct{}{}
+	}
+	sorted := make([]string, 0, len(symbols))
+	for symbol := range symbols {
+		sorted = append(sorted, symbol)
+	}
+	sort.Strings(sorted)
+
+	report := &JournalReplayReport{}
+	for _, symbol := range sorted {
+		stored, err := eventStore.ReadFrom(ctx, symbol, 1)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read events for %s: %w", symbol, err)
+		}
+		report.Symbols = append(report.Symbols, JournalSymbolReport{
+			Symbol:         symbol,
+			Commands:       commands[symbol],
+			ReplayedEvents: len(replayed[symbol]),
+			StoredEvents:   len(stored),
+			Divergence:     diffEventLogs(replayed[symbol], stored),
+		})
+	}
+	return report, nil
+}
+
+// diffEventLogs returns the first difference between replayed and stored events, or nil
+func diffEventLogs(replayed, stored []matching.Event) *EventDivergence {
+	// Events archived out of the log cannot be compared
+	if len(stored) > 0 {
+		first := stored[0].Sequence()
+		for len(replayed) > 0 && replayed[0].Sequence() < first {
+			replayed = replayed[1:]
+		}
+	}
+
+	for i := 0; i < len(replayed) || i < len(stored); i++ {
+		switch {
+		case i >= len(stored):
+			return &EventDivergence{Sequence: replayed[i].Sequence(), Field: "extra", Replayed: replayed[i]}
+		case i >= len(replayed):
+			return &EventDivergence{Sequence: stored[i].Sequence(), Field: "missing", Stored: stored[i]}
+		}
+		if divergence := diffEvents(replayed[i], stored[i]); divergence != nil {
+			return divergence
+		}
+	}
+	return nil
+}
+
+// diffEvents compares two events field by field
+func diffEvents(replayed, stored matching.Event) *EventDivergence {
+	if replayed.EventType() != stored.EventType() {
+		return &EventDivergence{Sequence: stored.Sequence(), Field: "type", Replayed: replayed, Stored: stored}
+	}
+	rv := reflect.ValueOf(replayed).Elem()
+	sv := reflect.ValueOf(stored).Elem()
+	for i := 0; i < rv.NumField(); i++ {
+		if !fieldEqual(rv.Field(i).Interface(), sv.Field(i).Interface()) {
+			return &EventDivergence{
+				Sequence: stored.Sequence(),
+				Field:    rv.Type().Field(i).Name,
+				Replayed: rv.Field(i).Interface(),
+				Stored:   sv.Field(i).Interface(),
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package recovery
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"matching-engine/internal/engine"
+	"matching-engine/internal/matching"
+	"matching-engine/internal/persistence"
+)
+
+func TestReplayJournal_MatchesEventLog(t *testing.T) {
+	ctx := context.Background()
+	stores := newTestStores(t)
+	journal, err := persistence.NewFileCommandJournal(filepath.Join(t.TempDir(), "journal"))
+	if err != nil {
+		t.Fatalf("NewFileCommandJournal failed: %v", err)
+	}
+	defer journal.Close()
+
+	eng := engine.NewEngine(&engine.EngineConfig{ShardCount: 2, QueueSize: 10, IdempotencyTTL: time.Hour})
+	eng.SetEventStore(stores.events)
+	eng.SetCommandJournal(journal)
+
+	submit := func(key string, commandType engine.CommandType, accountID string, payload any) {
+		t.Helper()
+		result := eng.Submit(&engine.CommandEnvelope{
+			CommandType:    commandType,
+			IdempotencyKey: key,
+			Symbol:         testSymbol,
+			AccountID:      accountID,
+			Payload:        payload,
+			CreatedAt:      time.Now(),
+		})
+		if result.ErrorCode != engine.ErrorCodeNone {
+			t.Fatalf("%s failed: %v", key, result.Err)
+		}
+	}
+	place := func(orderID, accountID string, side matching.Side, price, qty int64) {
+		submit(orderID, engine.CommandTypePlace, accountID, &matching.PlaceOrderRequest{
+			OrderID: orderID, ClientOrderID: "c-" + orderID, AccountID: accountID, Symbol: testSymbol,
+			Side: side, PriceInt: price, QuantityInt: qty,
+		})
+	}
+	place("ord-1", "acc-001", matching.SideBuy, 100, 10)
+	place("ord-2", "acc-002", matching.SideBuy, 100, 10)
+	place("ord-3", "acc-003", matching.SideSell, 99, 15)
+	submit("cancel-2", engine.CommandTypeCancel, "acc-002", &matching.CancelOrderRequest{OrderID: "ord-2", AccountID: "acc-002", Symbol: testSymbol})
+	eng.Close()
+
+	report, err := ReplayJournal(ctx, journal, stores.events)
+	if err != nil {
+		t.Fatalf("ReplayJournal failed: %v", err)
+	}
+	if !report.OK() || len(report.Symbols) != 1 {
+		t.Fatalf("expected a clean report, got %+v", report)
+	}
+	if symbol := report.Symbols[0]; symbol.Commands != 4 || symbol.ReplayedEvents != 6 || symbol.StoredEvents != 6 {
+		t.Fatalf("unexpected symbol report %+v", symbol)
+	}
+
+	// A journaled command whose events never reached the log shows up as a divergence
+	command := &engine.JournaledCommand{
+		CommandType: engine.CommandTypePlace,
+		Symbol:      testSymbol,
+		AccountID:   "acc-001",
+		CreatedAt:   time.Now().UTC(),
+		BookSeq:     6,
+		Payload:     []byte(`{"OrderID":"ord-4","ClientOrderID":"c-ord-4","AccountID":"acc-001","Symbol":"BTC-USDT","Side":"BUY","PriceInt":90,"QuantityInt":1}`),
+	}
+	if err := journal.Append(ctx, eng.GetShardID(testSymbol), command); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	report, err = ReplayJournal(ctx, journal, stores.events)
+	if err != nil {
+		t.Fatalf("ReplayJournal failed: %v", err)
+	}
+	if divergence := report.Symbols[0].Divergence; report.OK() || divergence == nil || divergence.Field != "extra" || divergence.Sequence != 7 {
+		t.Fatalf("expected an extra event at sequence 7, got %+v", report.Symbols[0])
+	}
+}
+
+func TestReplayJournal_MergesSymbolMovedBetweenShards(t *testing.T) {
+	ctx := context.Background()
+	stores := newTestStores(t)
+	journal, err := persistence.NewFileCommandJournal(filepath.Join(t.TempDir(), "journal"))
+	if err != nil {
+		t.Fatalf("NewFileCommandJournal failed: %v", err)
+	}
+	defer journal.Close()
+
+	eng := engine.NewEngine(&engine.EngineConfig{ShardCount: 2, QueueSize: 10, IdempotencyTTL: time.Hour})
+	eng.SetEventStore(stores.events)
+	eng.SetCommandJournal(journal)
+	// Start on the higher shard, so replaying journals in shard order would run the later commands first
+	if err := eng.RestoreShardAssignments(map[string]int{testSymbol: 1}); err != nil {
+		t.Fatalf("RestoreShardAssignments failed: %v", err)
+	}
+
+	place := func(orderID string, side matching.Side, qty int64) {
+		t.Helper()
+		result := eng.Submit(&engine.CommandEnvelope{
+			CommandType:    engine.CommandTypePlace,
+			IdempotencyKey: orderID,
+			Symbol:         testSymbol,
+			AccountID:      "acc-001",
+			Payload: &matching.PlaceOrderRequest{
+				OrderID: orderID, ClientOrderID: "c-" + orderID, AccountID: "acc-001", Symbol: testSymbol,
+				Side: side, PriceInt: 100, QuantityInt: qty,
+			},
+			CreatedAt: time.Now(),
+		})
+		if result.ErrorCode != engine.ErrorCodeNone {
+			t.Fatalf("%s failed: %v", orderID, result.Err)
+		}
+	}
+	place("ord-1", matching.SideBuy, 10)
+	place("ord-2", matching.SideBuy, 10)
+	if err := eng.MoveSymbol(ctx, testSymbol, 0); err != nil {
+		t.Fatalf("MoveSymbol failed: %v", err)
+	}
+	place("ord-3", matching.SideSell, 15)
+	eng.Close()
+
+	report, err := ReplayJournal(ctx, journal, stores.events)
+	if err != nil {
+		t.Fatalf("ReplayJournal failed: %v", err)
+	}
+	if !report.OK() || len(report.Symbols) != 1 || report.Symbols[0].Commands != 3 {
+		t.Fatalf("expected a clean report over 3 commands, got %+v", report.Symbols)
+	}
+}
@@ -0,0 +1,91 @@
+package recovery
+
+import (
+	"context"
+	"fmt"
+
+	"matching-engine/internal/engine"
+	"matching-engine/internal/matching"
+	"matching-engine/internal/persistence"
+	"matching-engine/internal/symbolspec"
+)
+
+// NewTimeTravelEngine builds a read-only engine holding every symbol as it was at target.
+// The engine persists nothing and only answers queries; place and cancel are rejected.
+func NewTimeTravelEngine(
+	ctx context.Context,
+	config *engine.EngineConfig,
+	eventStore persistence.EventStore,
+	recoveryService persistence.RecoveryService,
+	target persistence.RecoveryTarget,
+) (*engine.Engine, error) {
+	cfg := engine.DefaultEngineConfig()
+	if config != nil {
+		*cfg = *config
+	}
+	cfg.ReadOnly = true
+
+	symbols, err := eventStore.ListSymbols(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	eng := engine.NewEngine(cfg)
+	for _, symbol := range symbols {
+		if err := loadSymbolAt(ctx, eng, eventStore, recoveryService, symbol, target); err != nil {
+			eng.Close()
+			return nil, err
+		}
+	}
+	return eng, nil
+}
+
+// loadSymbolAt loads one symbol's snapshot and events up to target into the engine,
+// and registers the symbol's spec as it was at target
+func loadSymbolAt(ctx context.Context, eng *engine.Engine, eventStore persistence.EventStore, recoveryService persistence.RecoveryService, symbol string, target persistence.RecoveryTarget) error {
+	snapshot, events, err := recoveryService.RecoverTo(ctx, symbol, target)
+	if err != nil {
+		return fmt.Errorf("failed to recover %s: %w", symbol, err)
+	}
+	var lastSeq int64
+	if snapshot != nil {
+		state, err := DecodeOrderBookState(snapshot.Orderbook, symbol)
+		if err != nil {
+			return fmt.Errorf("failed to decode snapshot for %s: %w", symbol, err)
+		}
+		if err := eng.LoadSymbolSnapshot(symbol, state, snapshot.LastSequence); err != nil {
+			return fmt.Errorf("failed to load snapshot for %s: %w", symbol, err)
+		}
+		lastSeq = snapshot.LastSequence
+	}
+	if len(events) > 0 {
+		lastSeq = events[len(events)-1].Sequence()
+	}
+	if err := eng.RecoverSymbol(symbol, events); err != nil {
+		return err
+	}
+	return registerSpecsAt(ctx, eventStore, symbol, lastSeq)
+}
+
+// registerSpecsAt registers the last spec a symbol's log recorded up to lastSeq.
+// Spec changes can predate the snapshot, so the log is read from the start.
+func registerSpecsAt(ctx context.Context, eventStore persistence.EventStore, symbol string, lastSeq int64) error {
+	if lastSeq == 0 {
+		return nil
+	}
+	events, err := eventStore.ReadFrom(ctx, symbol, 1)
+	if err != nil {
+		return fmt.Errorf("failed to read spec changes of %s: %w", symbol, err)
+	}
+	for _, event := range events {
+		if event.Sequence() > lastSeq {
+			break
+		}
+		if changed, ok := event.(*matching.SymbolSpecChangedEvent); ok {
+			if err := symbolspec.Put(changed.Spec); err != nil {
+				return fmt.Errorf("spec change failed for %s: %w", symbol, err)
+			}
+		}
+	}
+	return nil
+}
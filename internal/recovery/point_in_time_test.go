@@ -0,0 +1,98 @@
+package recovery
+
+import (
+	"context"
+	"testing"
+
+	"matching-engine/internal/engine"
+	"matching-engine/internal/matching"
+	"matching-engine/internal/persistence"
+	"matching-engine/internal/symbolspec"
+)
+
+func TestTimeTravelEngine_ServesHistoricalDepth(t *testing.T) {
+	stores := newTestStores(t)
+	stores.trade(t)
+	stores.snapshot(t, nil)
+	asOf := stores.book.GetEventSequence()
+	stores.place(t, "ord-3", "acc-002", matching.SideSell, 100000000, 100000000)
+
+	recoveryService := persistence.NewFileRecoveryService(stores.events, stores.snapshots)
+	for _, tc := range []struct {
+		seq    int64
+		bidQty int64
+	}{
+		{seq: asOf, bidQty: 200000000},
+		{seq: asOf + 1, bidQty: 100000000},
+	} {
+		eng, err := NewTimeTravelEngine(context.Background(), nil, stores.events, recoveryService, persistence.RecoveryTarget{Sequence: tc.seq})
+		if err != nil {
+			t.Fatalf("NewTimeTravelEngine failed: %v", err)
+		}
+		result := eng.Submit(&engine.CommandEnvelope{
+			CommandType:    engine.CommandTypeDepth,
+			IdempotencyKey: "depth",
+			Symbol:         testSymbol,
+			Payload:        &matching.DepthRequest{Symbol: testSymbol},
+		})
+		depth, ok := result.Result.(*matching.BookDepth)
+		if !ok || len(depth.Bids) != 1 || depth.Bids[0].Quantity != tc.bidQty {
+			t.Fatalf("as of %d: unexpected depth %+v (%v)", tc.seq, result.Result, result.Err)
+		}
+
+		place := eng.Submit(&engine.CommandEnvelope{
+			CommandType: engine.CommandTypePlace,
+			Symbol:      testSymbol,
+			Payload:     &matching.PlaceOrderRequest{},
+		})
+		if place.ErrorCode != engine.ErrorCodeReadOnly {
+			t.Fatalf("expected READ_ONLY, got %q", place.ErrorCode)
+		}
+		eng.Close()
+	}
+}
+
+func TestTimeTravelEngine_RegistersTheSpecOfTheTime(t *testing.T) {
+	original, err := symbolspec.Get(testSymbol)
+	if err != nil {
+		t.Fatalf("spec not found: %v", err)
+	}
+	t.Cleanup(func() { symbolspec.Put(original) })
+
+	stores := newTestStores(t)
+	changeSpec := func(bandBps int64) {
+		t.Helper()
+		spec := original
+		spec.PriceBandBps = bandBps
+		result, err := stores.book.ChangeSpec(original, spec)
+		if err != nil {
+			t.Fatalf("ChangeSpec failed: %v", err)
+		}
+		if err := stores.events.AppendBatch(context.Background(), testSymbol, result.Events); err != nil {
+			t.Fatalf("AppendBatch failed: %v", err)
+		}
+	}
+	stores.trade(t)
+	changeSpec(200)
+	stores.snapshot(t, nil)
+	asOf := stores.book.GetEventSequence()
+	changeSpec(300)
+
+	recoveryService := persistence.NewFileRecoveryService(stores.events, stores.snapshots)
+	for _, tc := range []struct {
+		seq     int64
+		bandBps int64
+	}{
+		{seq: asOf, bandBps: 200}, // Changed before the snapshot the engine loads
+		{seq: asOf + 1, bandBps: 300},
+	} {
+		eng, err := NewTimeTravelEngine(context.Background(), nil, stores.events, recoveryService, persistence.RecoveryTarget{Sequence: tc.seq})
+		if err != nil {
+			t.Fatalf("NewTimeTravelEngine failed: %v", err)
+		}
+		eng.Close()
+		if spec, _ := symbolspec.Get(testSymbol); spec.PriceBandBps != tc.bandBps {
+			t.Fatalf("as of %d: expected a %d bps band, got %+v", tc.seq, tc.bandBps, spec)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package recovery
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"matching-engine/internal/engine"
+	"matching-engine/internal/matching"
+	"matching-engine/internal/persistence"
+	"matching-engine/internal/symbolspec"
+)
+
+// RecordSpecChanges records, through the engine, each spec that differs from the last one its
+// symbol's event log recorded, or that the log never recorded. Replay then matches every order
+// under the spec in force when it was placed, whatever specs the engine restarts with.
+// Returns the number of changes recorded.
+func RecordSpecChanges(ctx context.Context, eng *engine.Engine, eventStore persistence.EventStore, specs []symbolspec.Spec) (int, error) {
+	recorded := 0
+	for _, spec := range specs {
+		last, lastSeq, err := lastRecordedSpec(ctx, eventStore, spec.Symbol)
+		if err != nil {
+			return recorded, err
+		}
+		if last != nil && *last == spec {
+			continue
+		}
+
+		payloadHash, err := engine.ComputePayloadHash(&spec)
+		if err != nil {
+			return recorded, fmt.Errorf("failed to compute payload hash for %s: %w", spec.Symbol, err)
+		}
+		// The log's last sequence keeps the key unique across restarts
+		commandID := fmt.Sprintf("startup_spec_%s_%d", spec.Symbol, lastSeq)
+		result := eng.SubmitContext(ctx, &engine.CommandEnvelope{
+			CommandID:      commandID,
+			CommandType:    engine.CommandTypeSetSymbolSpec,
+			IdempotencyKey: "symbol_spec_" + commandID,
+			Symbol:         spec.Symbol,
+			PayloadHash:    payloadHash,
+			Payload:        &spec,
+			CreatedAt:      time.Now(),
+		})
+		if result.ErrorCode != engine.ErrorCodeNone {
+			return recorded, fmt.Errorf("spec change of %s rejected with %s: %v", spec.Symbol, result.ErrorCode, result.Err)
+		}
+		recorded++
+	}
+	return recorded, nil
+}
+
+// lastRecordedSpec returns the last spec a symbol's log recorded, or nil when it recorded none,
+// and the log's last sequence
+func lastRecordedSpec(ctx context.Context, eventStore persistence.EventStore, symbol string) (*symbolspec.Spec, int64, error) {
+	events, err := eventStore.ReadFrom(ctx, symbol, 1)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read spec changes of %s: %w", symbol, err)
+	}
+	var last *symbolspec.Spec
+	var lastSeq int64
+	for _, event := range events {
+		lastSeq = event.Sequence()
+		if changed, ok := event.(*matching.SymbolSpecChangedEvent); ok {
+			last = &changed.Spec
+		}
+	}
+	return last, lastSeq, nil
+}
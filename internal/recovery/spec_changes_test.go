@@ -0,0 +1,60 @@
+package recovery
+
+import (
+	"context"
+	"testing"
+
+	"matching-engine/internal/engine"
+	"matching-engine/internal/matching"
+	"matching-engine/internal/symbolspec"
+)
+
+func TestRecordSpecChanges_RecordsSpecsTheLogDiffersFrom(t *testing.T) {
+	original, err := symbolspec.Get(testSymbol)
+	if err != nil {
+		t.Fatalf("spec not found: %v", err)
+	}
+	t.Cleanup(func() { symbolspec.Put(original) })
+
+	stores := newTestStores(t)
+	stores.trade(t)
+	eng := engine.NewEngine(nil)
+	defer eng.Close()
+	logged, err := stores.events.ReadFrom(context.Background(), testSymbol, 1)
+	if err != nil {
+		t.Fatalf("ReadFrom failed: %v", err)
+	}
+	if err := eng.RecoverSymbol(testSymbol, logged); err != nil {
+		t.Fatalf("RecoverSymbol failed: %v", err)
+	}
+	eng.SetEventStore(stores.events)
+
+	proRata := original
+	proRata.Allocation = symbolspec.AllocationProRata
+	for _, tc := range []struct {
+		name     string
+		spec     symbolspec.Spec
+		recorded int
+	}{
+		{name: "never recorded", spec: original, recorded: 1},
+		{name: "unchanged", spec: original, recorded: 0},
+		{name: "allocation changed", spec: proRata, recorded: 1},
+	} {
+		recorded, err := RecordSpecChanges(context.Background(), eng, stores.events, []symbolspec.Spec{tc.spec})
+		if err != nil {
+			t.Fatalf("%s: RecordSpecChanges failed: %v", tc.name, err)
+		}
+		if recorded != tc.recorded {
+			t.Fatalf("%s: expected %d changes recorded, got %d", tc.name, tc.recorded, recorded)
+		}
+	}
+
+	events, err := stores.events.ReadFrom(context.Background(), testSymbol, 1)
+	if err != nil {
+		t.Fatalf("ReadFrom failed: %v", err)
+	}
+	changed, ok := events[len(events)-1].(*matching.SymbolSpecChangedEvent)
+	if !ok || changed.Sequence() != int64(len(logged)+2) || changed.Spec.Allocation != symbolspec.AllocationProRata {
+		t.Fatalf("expected the log to end with the pro-rata spec, got %+v", events[len(events)-1])
+	}
+}
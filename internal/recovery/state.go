@@ -0,0 +1,116 @@
+// Package recovery rebuilds engine and account state from snapshots and the event log.
+package recovery
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"matching-engine/internal/account"
+	"matching-engine/internal/matching"
+	"matching-engine/internal/symbolspec"
+)
+
+// DecodeOrderBookState decodes the order book of a persisted snapshot
+func DecodeOrderBookState(raw any, symbol string) (*matching.OrderBookState, error) {
+	if raw == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	var state matching.OrderBookState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	if state.Symbol == "" {
+		state.Symbol = symbol
+	}
+
+	return &state, nil
+}
+
+// ReplayAccountEvents applies a symbol's events to account balances and freezes.
+// It also registers the symbol specs the events record, leaving the latest one in force.
+func ReplayAccountEvents(accountSvc account.Service, symbol string, events []matching.Event) error {
+	type orderMeta struct {
+		accountID string
+		side      matching.Side
+	}
+
+	orderLookup := make(map[string]orderMeta)
+	for _, event := range events {
+		switch e := event.(type) {
+		case *matching.OrderAcceptedEvent:
+			intent := account.PlaceIntent{
+				AccountID: e.AccountID,
+				OrderID:   e.OrderID,
+				Symbol:    symbol,
+				Side:      string(e.Side),
+				PriceInt:  e.Price,
+				QtyInt:    e.Quantity,
+				GroupID:   e.GroupID,
+			}
+			if err := accountSvc.CheckAndFreezeForPlace(intent); err != nil {
+				return fmt.Errorf("freeze failed for order %s: %w", e.OrderID, err)
+			}
+			orderLookup[e.OrderID] = orderMeta{accountID: e.AccountID, side: e.Side}
+
+		case *matching.OrderMatchedEvent:
+			maker, ok := orderLookup[e.MakerOrderID]
+			if !ok {
+				return fmt.Errorf("missing maker order metadata for %s", e.MakerOrderID)
+			}
+			taker, ok := orderLookup[e.TakerOrderID]
+			if !ok {
+				return fmt.Errorf("missing taker order metadata for %s", e.TakerOrderID)
+			}
+
+			tradeIntent := account.TradeIntent{
+				TradeID:     e.TradeID,
+				Symbol:      symbol,
+				PriceInt:    e.Price,
+				QuantityInt: e.Quantity,
+			}
+
+			if maker.side == matching.SideBuy {
+				tradeIntent.BuyerAccountID = maker.accountID
+				tradeIntent.BuyerOrderID = e.MakerOrderID
+				tradeIntent.SellerAccountID = taker.accountID
+				tradeIntent.SellerOrderID = e.TakerOrderID
+			} else {
+				tradeIntent.BuyerAccountID = taker.accountID
+				tradeIntent.BuyerOrderID = e.TakerOrderID
+				tradeIntent.SellerAccountID = maker.accountID
+				tradeIntent.SellerOrderID = e.MakerOrderID
+			}
+
+			if err := accountSvc.ApplyTrade(tradeIntent); err != nil {
+				return fmt.Errorf("trade apply failed for %s: %w", e.TradeID, err)
+			}
+
+		case *matching.OrderCanceledEvent:
+			cancelIntent := account.CancelIntent{
+				AccountID: e.AccountID,
+				OrderID:   e.OrderID,
+				Symbol:    symbol,
+			}
+			if err := accountSvc.ReleaseOnCancel(cancelIntent); err != nil {
+				return fmt.Errorf("cancel release failed for order %s: %w", e.OrderID, err)
+			}
+		case *matching.SymbolSpecChangedEvent:
+			// Later trades settle at the scales of the spec in force when they happened
+			if err := symbolspec.Put(e.Spec); err != nil {
+				return fmt.Errorf("spec change failed for %s: %w", symbol, err)
+			}
+		case *matching.SymbolStatusChangedEvent, *matching.PriceBandBreachedEvent:
+			// No balance effect
+		default:
+			return fmt.Errorf("unknown event type: %T", e)
+		}
+	}
+
+	return nil
+}
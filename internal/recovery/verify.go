@@ -0,0 +1,310 @@
+package recovery
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"matching-engine/internal/account"
+	"matching-engine/internal/engine"
+	"matching-engine/internal/matching"
+	"matching-engine/internal/persistence"
+	"matching-engine/internal/symbolspec"
+)
+
+// Divergence is one field that differs between the full replay and the snapshot + tail rebuild
+type Divergence struct {
+	OrderID      string `json:"order_id,omitempty"` // Empty for book-level fields
+	Field        string `json:"field"`
+	FullReplay   any    `json:"full_replay"`
+	SnapshotTail any    `json:"snapshot_tail"`
+}
+
+// BalanceDivergence is an account balance that differs between the two rebuilds
+type BalanceDivergence struct {
+	AccountID    string `json:"account_id"`
+	Asset        string `json:"asset"`
+	Field        string `json:"field"` // available or frozen
+	FullReplay   int64  `json:"full_replay"`
+	SnapshotTail int64  `json:"snapshot_tail"`
+}
+
+// SymbolReport is the verification result of one symbol
+type SymbolReport struct {
+	Symbol           string       `json:"symbol"`
+	SnapshotSequence int64        `json:"snapshot_sequence"` // 0 when no snapshot was usable
+	LastSequence     int64        `json:"last_sequence"`
+	Divergences      []Divergence `json:"divergences,omitempty"`
+	Errors           []string     `json:"errors,omitempty"`
+}
+
+// VerifyReport is the result of cross-checking snapshots against full replay
+type VerifyReport struct {
+	Symbols  []SymbolReport      `json:"symbols"`
+	Balances []BalanceDivergence `json:"balances,omitempty"`
+	Errors   []string            `json:"errors,omitempty"` // Account replay failures
+}
+
+// OK reports whether both rebuilds agreed everywhere
+func (r *VerifyReport) OK() bool {
+	if len(r.Balances) > 0 || len(r.Errors) > 0 {
+		return false
+	}
+	for _, symbol := range r.Symbols {
+		if len(symbol.Divergences) > 0 || len(symbol.Errors) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Verifier rebuilds every symbol from the full event log and from its latest snapshot
+// plus the tail, and reports where the resulting books and account balances disagree.
+type Verifier struct {
+	eventStore      persistence.EventStore
+	recoveryService persistence.RecoveryService
+	newAccounts     func() (*account.MemoryService, error) // Starting balances before any event
+}
+
+// NewVerifier creates a verifier. newAccounts must return the balances replay starts from.
+func NewVerifier(eventStore persistence.EventStore, recoveryService persistence.RecoveryService, newAccounts func() (*account.MemoryService, error)) *Verifier {
+	return &Verifier{
+		eventStore:      eventStore,
+		recoveryService: recoveryService,
+		newAccounts:     newAccounts,
+	}
+}
+
+// Verify cross-checks every symbol with an event log.
+// Account balances are derived on each path from the events that path's replay produced,
+// so a divergent book shows up as divergent balances too.
+func (v *Verifier) Verify(ctx context.Context) (*VerifyReport, error) {
+	symbols, err := v.eventStore.ListSymbols(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(symbols)
+
+	fullAccounts, err := v.newAccounts()
+	if err != nil {
+		return nil, err
+	}
+	snapshotAccounts, err := v.newAccounts()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &VerifyReport{Symbols: make([]SymbolReport, 0, len(symbols))}
+	for _, symbol := range symbols {
+		symbolReport, fullEvents, snapshotEvents, err := v.verifySymbol(ctx, symbol)
+		if err != nil {
+			return nil, err
+		}
+		report.Symbols = append(report.Symbols, *symbolReport)
+
+		if err := ReplayAccountEvents(fullAccounts, symbol, fullEvents); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("full replay accounts for %s: %v", symbol, err))
+		}
+		if err := ReplayAccountEvents(snapshotAccounts, symbol, snapshotEvents); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("snapshot + tail accounts for %s: %v", symbol, err))
+		}
+	}
+
+	report.Balances = diffBalances(fullAccounts.ExportBalances(), snapshotAccounts.ExportBalances())
+	return report, nil
+}
+
+// verifySymbol rebuilds one symbol both ways. It returns the account-affecting events of each path:
+// all replay-produced events for the full path, and the logged events up to the snapshot
+// followed by the replay-produced tail for the snapshot path.
+func (v *Verifier) verifySymbol(ctx context.Context, symbol string) (*SymbolReport, []matching.Event, []matching.Event, error) {
+	report := &SymbolReport{Symbol: symbol}
+
+	allEvents, err := v.eventStore.ReadFrom(ctx, symbol, 1)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to read events for %s: %w", symbol, err)
+	}
+	if len(allEvents) > 0 && allEvents[0].Sequence() != 1 {
+		return nil, nil, nil, fmt.Errorf("event log for %s starts at sequence %d, full replay needs 1", symbol, allEvents[0].Sequence())
+	}
+	if err := v.recoveryService.ValidateSequence(allEvents); err != nil {
+		return nil, nil, nil, fmt.Errorf("sequence validation failed for %s: %w", symbol, err)
+	}
+	if len(allEvents) > 0 {
+		report.LastSequence = allEvents[len(allEvents)-1].Sequence()
+	}
+
+	// Path 1: every event from an empty book
+	fullBook := newReplayBook(symbol)
+	fullEvents, err := engine.ReplayBook(fullBook, allEvents)
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("full replay: %v", err))
+		return report, nil, nil, nil
+	}
+
+	// Path 2: the snapshot recovery would pick, then the tail
+	snapshot, tail, err := v.recoveryService.Recover(ctx, symbol)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to recover %s: %w", symbol, err)
+	}
+	snapshotBook := newReplayBook(symbol)
+	var snapshotEvents []matching.Event
+	if snapshot != nil {
+		report.SnapshotSequence = snapshot.LastSequence
+		state, err := DecodeOrderBookState(snapshot.Orderbook, symbol)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("decode snapshot: %v", err))
+			return report, fullEvents, nil, nil
+		}
+		if state != nil {
+			if err := snapshotBook.ImportState(state); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("import snapshot: %v", err))
+				return report, fullEvents, nil, nil
+			}
+		}
+		if snapshotBook.GetEventSequence() < snapshot.LastSequence {
+			snapshotBook.SetEventSequence(snapshot.LastSequence)
+		}
+		for _, event := range allEvents {
+			if event.Sequence() <= snapshot.LastSequence {
+				snapshotEvents = append(snapshotEvents, event)
+			}
+		}
+	}
+	tailEvents, err := engine.ReplayBook(snapshotBook, tail)
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("snapshot + tail replay: %v", err))
+		return report, fullEvents, snapshotEvents, nil
+	}
+	snapshotEvents = append(snapshotEvents, tailEvents...)
+
+	report.Divergences = DiffOrderBookStates(fullBook.ExportState(), snapshotBook.ExportState())
+	return report, fullEvents, snapshotEvents, nil
+}
+
+// newReplayBook creates an empty book that allocates as the symbol's spec configures,
+// until a snapshot or a logged spec change says otherwise
+func newReplayBook(symbol string) *matching.OrderBook {
+	book := matching.NewOrderBook(symbol)
+	if spec, err := symbolspec.Get(symbol); err == nil {
+		book.SetAllocation(matching.NewAllocationPolicy(spec))
+	}
+	return book
+}
+
+// DiffOrderBookStates compares two exported books field by field, keyed by order ID
+func DiffOrderBookStates(full, snapshot *matching.OrderBookState) []Divergence {
+	var diffs []Divergence
+	if full.EventSeq != snapshot.EventSeq {
+		diffs = append(diffs, Divergence{Field: "EventSeq", FullReplay: full.EventSeq, SnapshotTail: snapshot.EventSeq})
+	}
+	if full.TradeSeq != snapshot.TradeSeq {
+		diffs = append(diffs, Divergence{Field: "TradeSeq", FullReplay: full.TradeSeq, SnapshotTail: snapshot.TradeSeq})
+	}
+
+	fullOpen := make(map[string]matching.OrderState, len(full.Orders))
+	for _, order := range full.Orders {
+		fullOpen[order.OrderID] = order
+	}
+	snapshotOpen := make(map[string]matching.OrderState, len(snapshot.Orders))
+	for _, order := range snapshot.Orders {
+		snapshotOpen[order.OrderID] = order
+	}
+
+	diffs = append(diffs, diffOrderMaps("open.", fullOpen, snapshotOpen)...)
+	diffs = append(diffs, diffOrderMaps("closed.", full.ClosedOrders, snapshot.ClosedOrders)...)
+
+	sort.SliceStable(diffs, func(i, j int) bool {
+		return diffs[i].OrderID < diffs[j].OrderID
+	})
+	return diffs
+}
+
+// diffOrderMaps compares orders present in either map, field by field
+func diffOrderMaps[T any](prefix string, full, snapshot map[string]T) []Divergence {
+	ids := make(map[string]struct{}, len(full)+len(snapshot))
+	for id := range full {
+		ids[id] = struct{}{}
+	}
+	for id := range snapshot {
+		ids[id] = struct{}{}
+	}
+	sorted := make([]string, 0, len(ids))
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Strings(sorted)
+
+	var diffs []Divergence
+	for _, id := range sorted {
+		a, inFull := full[id]
+		b, inSnapshot := snapshot[id]
+		if inFull != inSnapshot {
+			diffs = append(diffs, Divergence{OrderID: id, Field: prefix + "present", FullReplay: inFull, SnapshotTail: inSnapshot})
+			continue
+		}
+
+		av := reflect.ValueOf(a)
+		bv := reflect.ValueOf(b)
+		for i := 0; i < av.NumField(); i++ {
+			if !fieldEqual(av.Field(i).Interface(), bv.Field(i).Interface()) {
+				diffs = append(diffs, Divergence{
+					OrderID:      id,
+					Field:        prefix + av.Type().Field(i).Name,
+					FullReplay:   av.Field(i).Interface(),
+					SnapshotTail: bv.Field(i).Interface(),
+				})
+			}
+		}
+	}
+	return diffs
+}
+
+// fieldEqual compares two field values; times compare by instant, whichever zone a codec decoded them in
+func fieldEqual(a, b any) bool {
+	if at, ok := a.(time.Time); ok {
+		bt, ok := b.(time.Time)
+		return ok && at.Equal(bt)
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// diffBalances compares available and frozen balances of every account and asset
+func diffBalances(full, snapshot map[string]map[string]account.Balance) []BalanceDivergence {
+	keys := make(map[[2]string]struct{})
+	for accountID, assets := range full {
+		for asset := range assets {
+			keys[[2]string{accountID, asset}] = struct{}{}
+		}
+	}
+	for accountID, assets := range snapshot {
+		for asset := range assets {
+			keys[[2]string{accountID, asset}] = struct{}{}
+		}
+	}
+	sorted := make([][2]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i][0] != sorted[j][0] {
+			return sorted[i][0] < sorted[j][0]
+		}
+		return sorted[i][1] < sorted[j][1]
+	})
+
+	var diffs []BalanceDivergence
+	for _, key := range sorted {
+		a := full[key[0]][key[1]]
+		b := snapshot[key[0]][key[1]]
+		if a.Available != b.Available {
+			diffs = append(diffs, BalanceDivergence{AccountID: key[0], Asset: key[1], Field: "available", FullReplay: a.Available, SnapshotTail: b.Available})
+		}
+		if a.Frozen != b.Frozen {
+			diffs = append(diffs, BalanceDivergence{AccountID: key[0], Asset: key[1], Field: "frozen", FullReplay: a.Frozen, SnapshotTail: b.Frozen})
+		}
+	}
+	return diffs
+}
@@ -0,0 +1,141 @@
+package recovery
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"matching-engine/internal/account"
+	"matching-engine/internal/matching"
+	"matching-engine/internal/persistence"
+)
+
+const testSymbol = "BTC-USDT"
+
+type testStores struct {
+	events    *persistence.FileEventStore
+	snapshots *persistence.FileSnapshotStore
+	book      *matching.OrderBook
+}
+
+func newTestStores(t *testing.T) *testStores {
+	t.Helper()
+	dir := t.TempDir()
+	events, err := persistence.NewFileEventStore(filepath.Join(dir, "events"))
+	if err != nil {
+		t.Fatalf("failed to create event store: %v", err)
+	}
+	t.Cleanup(func() { events.Close() })
+	snapshots, err := persistence.NewFileSnapshotStore(filepath.Join(dir, "snapshots"))
+	if err != nil {
+		t.Fatalf("failed to create snapshot store: %v", err)
+	}
+	return &testStores{events: events, snapshots: snapshots, book: matching.NewOrderBook(testSymbol)}
+}
+
+// place runs a limit order through the live book and logs its events
+func (s *testStores) place(t *testing.T, orderID, accountID string, side matching.Side, price, qty int64) {
+	t.Helper()
+	result, err := s.book.PlaceLimit(&matching.PlaceOrderRequest{
+		OrderID:       orderID,
+		ClientOrderID: "c-" + orderID,
+		AccountID:     accountID,
+		Symbol:        testSymbol,
+		Side:          side,
+		PriceInt:      price,
+		QuantityInt:   qty,
+	})
+	if err != nil {
+		t.Fatalf("PlaceLimit %s failed: %v", orderID, err)
+	}
+	if err := s.events.AppendBatch(context.Background(), testSymbol, result.Events); err != nil {
+		t.Fatalf("AppendBatch failed: %v", err)
+	}
+}
+
+// snapshot saves the live book as a snapshot
+func (s *testStores) snapshot(t *testing.T, mutate func(*matching.OrderBookState)) {
+	t.Helper()
+	state := s.book.ExportState()
+	if mutate != nil {
+		mutate(state)
+	}
+	err := s.snapshots.Save(context.Background(), &persistence.Snapshot{
+		Version:      1,
+		Symbol:       testSymbol,
+		LastSequence: state.EventSeq,
+		CapturedAt:   time.Now(),
+		Orderbook:    state,
+	})
+	if err != nil {
+		t.Fatalf("failed to save snapshot: %v", err)
+	}
+}
+
+func (s *testStores) verify(t *testing.T) *VerifyReport {
+	t.Helper()
+	verifier := NewVerifier(s.events, persistence.NewFileRecoveryService(s.events, s.snapshots), func() (*account.MemoryService, error) {
+		accountSvc := account.NewMemoryService()
+		return accountSvc, account.SeedTestAccounts(accountSvc)
+	})
+	report, err := verifier.Verify(context.Background())
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	return report
+}
+
+func (s *testStores) trade(t *testing.T) {
+	t.Helper()
+	s.place(t, "ord-1", "acc-001", matching.SideBuy, 100000000, 300000000)
+	s.place(t, "ord-2", "acc-002", matching.SideSell, 100000000, 100000000)
+}
+
+func TestVerify_SnapshotMatchesFullReplay(t *testing.T) {
+	stores := newTestStores(t)
+	stores.trade(t)
+	stores.snapshot(t, nil)
+	stores.place(t, "ord-3", "acc-002", matching.SideSell, 100000000, 100000000)
+	stores.place(t, "ord-4", "acc-002", matching.SideSell, 200000000, 100000000)
+
+	report := stores.verify(t)
+	if !report.OK() {
+		t.Fatalf("expected clean report, got %+v", report)
+	}
+	if len(report.Symbols) != 1 || report.Symbols[0].SnapshotSequence == 0 {
+		t.Fatalf("expected verification from a snapshot, got %+v", report.Symbols)
+	}
+}
+
+func TestVerify_ReportsDivergenceByOrderAndField(t *testing.T) {
+	stores := newTestStores(t)
+	stores.trade(t)
+	// A snapshot that disagrees with the log it claims to cover
+	stores.snapshot(t, func(state *matching.OrderBookState) {
+		for i := range state.Orders {
+			if state.Orders[i].OrderID == "ord-1" {
+				state.Orders[i].RemainingQty = 250000000
+			}
+		}
+	})
+	stores.place(t, "ord-3", "acc-002", matching.SideSell, 100000000, 100000000)
+
+	report := stores.verify(t)
+	if report.OK() {
+		t.Fatalf("expected divergence, got clean report")
+	}
+
+	found := false
+	for _, diff := range report.Symbols[0].Divergences {
+		if diff.OrderID == "ord-1" && diff.Field == "open.RemainingQty" {
+			if diff.FullReplay != int64(100000000) || diff.SnapshotTail != int64(150000000) {
+				t.Fatalf("unexpected values: %+v", diff)
+			}
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected ord-1 RemainingQty divergence, got %+v", report.Symbols[0].Divergences)
+	}
+}
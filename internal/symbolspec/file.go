@@ -0,0 +1,87 @@
+package symbolspec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// fileSpecs is the layout of a specs file
+type fileSpecs struct {
+	Symbols []fileSpec `json:"symbols"`
+}
+
+// fileSpec is one symbol in a specs file; prices and quantities are scaled integers
+type fileSpec struct {
+	Symbol            string `json:"symbol"`
+	PriceScale        int    `json:"price_scale"`
+	QuantityScale     int    `json:"quantity_scale"`
+	PriceTickInt      int64  `json:"price_tick_int"`
+	QtyStepInt        int64  `json:"qty_step_int"`
+	PriceBandBps      int64  `json:"price_band_bps,omitempty"`
+	TradeBandBps      int64  `json:"trade_band_bps,omitempty"`
+	BreakerAuction    bool   `json:"breaker_auction,omitempty"`
+	BreakerCoolingOff string `json:"breaker_cooling_off,omitempty"` // Go duration, e.g. "5m"
+	MinQtyInt         int64  `json:"min_qty_int,omitempty"`
+	MaxQtyInt         int64  `json:"max_qty_int,omitempty"`
+	MinPriceInt       int64  `json:"min_price_int,omitempty"`
+	MaxPriceInt       int64  `json:"max_price_int,omitempty"`
+	MinNotionalInt    int64  `json:"min_notional_int,omitempty"` // Quote units at the price scale
+	Allocation        string `json:"allocation,omitempty"`       // FIFO, PRO_RATA, PRO_RATA_TOP_ORDER or LMM
+	LMMAccountID      string `json:"lmm_account_id,omitempty"`
+	LMMShareBps       int64  `json:"lmm_share_bps,omitempty"`
+}
+
+// LoadFile replaces the built-in specs with the ones in a JSON specs file:
+//
+//	{"symbols": [{"symbol": "BTC-USDT", "price_scale": 2, "quantity_scale": 6,
+//	  "price_tick_int": 1, "qty_step_int": 1, "price_band_bps": 1000,
+//	  "trade_band_bps": 500, "breaker_cooling_off": "5m",
+//	  "min_qty_int": 100, "max_qty_int": 1000000000, "min_notional_int": 5000000}]}
+func LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read symbol specs: %w", err)
+	}
+	var file fileSpecs
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil {
+		return fmt.Errorf("failed to parse symbol specs %s: %w", path, err)
+	}
+
+	list := make([]Spec, 0, len(file.Symbols))
+	for _, fs := range file.Symbols {
+		spec := Spec{
+			Symbol:         fs.Symbol,
+			PriceScale:     fs.PriceScale,
+			QuantityScale:  fs.QuantityScale,
+			PriceTickInt:   fs.PriceTickInt,
+			QtyStepInt:     fs.QtyStepInt,
+			PriceBandBps:   fs.PriceBandBps,
+			TradeBandBps:   fs.TradeBandBps,
+			BreakerAuction: fs.BreakerAuction,
+			MinQtyInt:      fs.MinQtyInt,
+			MaxQtyInt:      fs.MaxQtyInt,
+			MinPriceInt:    fs.MinPriceInt,
+			MaxPriceInt:    fs.MaxPriceInt,
+			MinNotionalInt: fs.MinNotionalInt,
+			Allocation:     Allocation(fs.Allocation),
+			LMMAccountID:   fs.LMMAccountID,
+			LMMShareBps:    fs.LMMShareBps,
+		}
+		if fs.BreakerCoolingOff != "" {
+			spec.BreakerCoolingOff, err = time.ParseDuration(fs.BreakerCoolingOff)
+			if err != nil {
+				return fmt.Errorf("invalid breaker_cooling_off for %s: %w", fs.Symbol, err)
+			}
+		}
+		list = append(list, spec)
+	}
+	if err := Replace(list); err != nil {
+		return fmt.Errorf("invalid symbol specs %s: %w", path, err)
+	}
+	return nil
+}
@@ -1,8 +1,13 @@
 package symbolspec
 
 import (
+	"errors"
 	"fmt"
+	"math/big"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 )
 
 // Spec defines precision and step constraints for a trading symbol.
@@ -12,8 +17,133 @@ type Spec struct {
 	QuantityScale int
 	PriceTickInt  int64
 	QtyStepInt    int64
+
+	// Price protection around the last trade price, or the mid price before the first trade.
+	// Band widths are in basis points; 0 disables a band.
+	PriceBandBps      int64         // Limit orders priced further than this from the reference are rejected
+	TradeBandBps      int64         // A trade further than this from the reference trips the circuit breaker
+	BreakerAuction    bool          // A tripped breaker switches the symbol to a call auction instead of halting it
+	BreakerCoolingOff time.Duration // How long a tripped symbol stays halted or in auction; 0 until an admin reopens it
+
+	// Order size limits in the symbol's scales; 0 disables a limit.
+	MinQtyInt      int64
+	MaxQtyInt      int64
+	MinPriceInt    int64
+	MaxPriceInt    int64
+	MinNotionalInt int64 // Smallest price × quantity, in quote units at the price scale
+
+	// How an incoming order's quantity is split across the resting orders of a price level
+	Allocation   Allocation // Empty means FIFO
+	LMMAccountID string     // Lead market maker of the LMM allocation
+	LMMShareBps  int64      // Share of each fill the lead market maker gets first, in basis points
+}
+
+// Allocation is a matching algorithm: how a fill is split across the orders resting at a price
+type Allocation string
+
+const (
+	AllocationFIFO            Allocation = "FIFO"               // Price-time priority
+	AllocationProRata         Allocation = "PRO_RATA"           // In proportion to resting quantity
+	AllocationProRataTopOrder Allocation = "PRO_RATA_TOP_ORDER" // The oldest order fills first, the rest pro rata
+	AllocationLeadMarketMaker Allocation = "LMM"                // The lead market maker's share first, the rest pro rata
+)
+
+// IsValid reports whether the allocation is a known algorithm; empty means FIFO
+func (a Allocation) IsValid() bool {
+	switch a {
+	case "", AllocationFIFO, AllocationProRata, AllocationProRataTopOrder, AllocationLeadMarketMaker:
+		return true
+	}
+	return false
 }
 
+// Order limit violations, wrapped by CheckOrder
+var (
+	ErrPriceTooLow  = errors.New("price below minimum")
+	ErrPriceTooHigh = errors.New("price above maximum")
+	ErrQtyTooSmall  = errors.New("quantity below minimum")
+	ErrQtyTooLarge  = errors.New("quantity above maximum")
+	ErrMinNotional  = errors.New("notional below minimum")
+)
+
+// CheckOrder checks a price and quantity against the spec's order limits
+func (s Spec) CheckOrder(priceInt, qtyInt int64) error {
+	switch {
+	case s.MinPriceInt > 0 && priceInt < s.MinPriceInt:
+		return fmt.Errorf("%w: %s < %s", ErrPriceTooLow, FormatScaledInt(priceInt, s.PriceScale), FormatScaledInt(s.MinPriceInt, s.PriceScale))
+	case s.MaxPriceInt > 0 && priceInt > s.MaxPriceInt:
+		return fmt.Errorf("%w: %s > %s", ErrPriceTooHigh, FormatScaledInt(priceInt, s.PriceScale), FormatScaledInt(s.MaxPriceInt, s.PriceScale))
+	case s.MinQtyInt > 0 && qtyInt < s.MinQtyInt:
+		return fmt.Errorf("%w: %s < %s", ErrQtyTooSmall, FormatScaledInt(qtyInt, s.QuantityScale), FormatScaledInt(s.MinQtyInt, s.QuantityScale))
+	case s.MaxQtyInt > 0 && qtyInt > s.MaxQtyInt:
+		return fmt.Errorf("%w: %s > %s", ErrQtyTooLarge, FormatScaledInt(qtyInt, s.QuantityScale), FormatScaledInt(s.MaxQtyInt, s.QuantityScale))
+	}
+	if s.MinNotionalInt > 0 {
+		// price × qty / 10^QuantityScale >= MinNotionalInt, without rounding or overflow
+		denom, err := Pow10(s.QuantityScale)
+		if err != nil {
+			return err
+		}
+		notional := new(big.Int).Mul(big.NewInt(priceInt), big.NewInt(qtyInt))
+		minimum := new(big.Int).Mul(big.NewInt(s.MinNotionalInt), big.NewInt(denom))
+		if notional.Cmp(minimum) < 0 {
+			return fmt.Errorf("%w: %s × %s < %s", ErrMinNotional, FormatScaledInt(priceInt, s.PriceScale), FormatScaledInt(qtyInt, s.QuantityScale), FormatScaledInt(s.MinNotionalInt, s.PriceScale))
+		}
+	}
+	return nil
+}
+
+// MaxScale is the largest price or quantity scale; 10^18 still fits an int64
+const MaxScale = 18
+
+// Validate checks that the spec is complete and consistent
+func (s Spec) Validate() error {
+	base, quote, ok := strings.Cut(s.Symbol, "-")
+	if !ok || base == "" || quote == "" || strings.Contains(quote, "-") {
+		return fmt.Errorf("symbol must be BASE-QUOTE, got %q", s.Symbol)
+	}
+	if s.Symbol != strings.ToUpper(strings.TrimSpace(s.Symbol)) {
+		return fmt.Errorf("symbol must be upper case, got %q", s.Symbol)
+	}
+	if s.PriceScale < 0 || s.PriceScale > MaxScale {
+		return fmt.Errorf("price scale must be between 0 and %d", MaxScale)
+	}
+	if s.QuantityScale < 0 || s.QuantityScale > MaxScale {
+		return fmt.Errorf("quantity scale must be between 0 and %d", MaxScale)
+	}
+	if s.PriceTickInt <= 0 {
+		return fmt.Errorf("price tick must be positive")
+	}
+	if s.QtyStepInt <= 0 {
+		return fmt.Errorf("quantity step must be positive")
+	}
+	if s.PriceBandBps < 0 || s.PriceBandBps > 10000 || s.TradeBandBps < 0 || s.TradeBandBps > 10000 {
+		return fmt.Errorf("price bands must be between 0 and 10000 bps")
+	}
+	if s.BreakerCoolingOff < 0 {
+		return fmt.Errorf("breaker cooling-off must not be negative")
+	}
+	if s.MinQtyInt < 0 || s.MaxQtyInt < 0 || s.MinPriceInt < 0 || s.MaxPriceInt < 0 || s.MinNotionalInt < 0 {
+		return fmt.Errorf("order limits must not be negative")
+	}
+	if s.MaxQtyInt > 0 && s.MinQtyInt > s.MaxQtyInt {
+		return fmt.Errorf("minimum quantity exceeds maximum quantity")
+	}
+	if s.MaxPriceInt > 0 && s.MinPriceInt > s.MaxPriceInt {
+		return fmt.Errorf("minimum price exceeds maximum price")
+	}
+	if !s.Allocation.IsValid() {
+		return fmt.Errorf("unknown allocation %q", s.Allocation)
+	}
+	if s.Allocation == AllocationLeadMarketMaker && (s.LMMAccountID == "" || s.LMMShareBps <= 0 || s.LMMShareBps > 10000) {
+		return fmt.Errorf("LMM allocation needs a lead market maker account and a share between 1 and 10000 bps")
+	}
+	return nil
+}
+
+// mu guards specs, which admin changes update at runtime
+var mu sync.RWMutex
+
 var specs = map[string]Spec{
 	"BTC-USDT": {
 		Symbol:        "BTC-USDT",
@@ -41,13 +171,57 @@ var specs = map[string]Spec{
 // Get returns the symbol spec.
 func Get(symbol string) (Spec, error) {
 	s := strings.ToUpper(strings.TrimSpace(symbol))
+	mu.RLock()
 	spec, ok := specs[s]
+	mu.RUnlock()
 	if !ok {
 		return Spec{}, fmt.Errorf("unsupported symbol: %s", symbol)
 	}
 	return spec, nil
 }
 
+// List returns every symbol spec, sorted by symbol.
+func List() []Spec {
+	mu.RLock()
+	list := make([]Spec, 0, len(specs))
+	for _, spec := range specs {
+		list = append(list, spec)
+	}
+	mu.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Symbol < list[j].Symbol })
+	return list
+}
+
+// Put adds a symbol spec or replaces the symbol's current one.
+// It does not check resting orders; admin changes go through the engine, which does.
+func Put(spec Spec) error {
+	if err := spec.Validate(); err != nil {
+		return err
+	}
+	mu.Lock()
+	specs[spec.Symbol] = spec
+	mu.Unlock()
+	return nil
+}
+
+// Replace swaps every symbol spec for the given ones.
+func Replace(list []Spec) error {
+	replaced := make(map[string]Spec, len(list))
+	for _, spec := range list {
+		if err := spec.Validate(); err != nil {
+			return err
+		}
+		if _, dup := replaced[spec.Symbol]; dup {
+			return fmt.Errorf("duplicate symbol %s", spec.Symbol)
+		}
+		replaced[spec.Symbol] = spec
+	}
+	mu.Lock()
+	specs = replaced
+	mu.Unlock()
+	return nil
+}
+
 // Pow10 returns 10^scale for non-negative scale values.
 func Pow10(scale int) (int64, error) {
 	if scale < 0 {
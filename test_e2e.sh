@@ -43,6 +43,12 @@ test_fail() {
     ((TESTS_FAILED++))
 }
 
+# Count events across all log segments of the test symbol
+event_count() {
+    # Records are binary framed; count the JSON record headers instead of lines
+    cat "$DATA_DIR/events/$TEST_SYMBOL"/segment-*.log 2>/dev/null | grep -a -o '{"version":[0-9]*,"symbol"' | wc -l
+}
+
 cleanup() {
     log_info "Cleaning up..."
     if [ ! -z "$API_PID" ]; then
@@ -74,21 +80,21 @@ test_event_persistence() {
 
     sleep 1
 
-    # Check event log exists
-    if [ -f "$DATA_DIR/events/$TEST_SYMBOL/events.log" ]; then
-        test_pass "Event log file created"
+    # Check event log segments exist
+    if ls "$DATA_DIR/events/$TEST_SYMBOL"/segment-*.log > /dev/null 2>&1; then
+        test_pass "Event log segment created"
 
         # Check event count
-        EVENT_COUNT=$(wc -l < "$DATA_DIR/events/$TEST_SYMBOL/events.log")
+        EVENT_COUNT=$(event_count)
         if [ $EVENT_COUNT -ge 5 ]; then
             test_pass "Events persisted (count: $EVENT_COUNT)"
         else
             test_fail "Insufficient events (expected >= 5, got $EVENT_COUNT)"
         fi
 
-        # Check JSON format
-        if cat "$DATA_DIR/events/$TEST_SYMBOL/events.log" | head -1 | jq . > /dev/null 2>&1; then
-            test_pass "Event log format valid (JSON Lines)"
+        # Check segment header
+        if [ "$(head -c 4 "$(ls "$DATA_DIR/events/$TEST_SYMBOL"/segment-*.log | head -1)")" = "MEVL" ]; then
+            test_pass "Event log format valid (framed segments)"
         else
             test_fail "Event log format invalid"
         fi
@@ -135,11 +141,16 @@ test_snapshot_creation() {
                 test_pass "Snapshot format valid (JSON)"
 
                 # Check snapshot has required fields
-                if cat "$LATEST_SNAPSHOT" | jq -e '.last_sequence' > /dev/null 2>&1; then
+                if cat "$LATEST_SNAPSHOT" | jq -e '.snapshot.last_sequence' > /dev/null 2>&1; then
                     test_pass "Snapshot contains last_sequence field"
                 else
                     test_fail "Snapshot missing last_sequence field"
                 fi
+                if cat "$LATEST_SNAPSHOT" | jq -e '.content_hash' > /dev/null 2>&1; then
+                    test_pass "Snapshot contains content_hash field"
+                else
+                    test_fail "Snapshot missing content_hash field"
+                fi
             else
                 test_fail "Snapshot format invalid"
             fi
@@ -155,7 +166,7 @@ test_recovery() {
     log_info "Test 3: State Recovery"
 
     # Get current event count before restart
-    EVENT_COUNT_BEFORE=$(wc -l < "$DATA_DIR/events/$TEST_SYMBOL/events.log")
+    EVENT_COUNT_BEFORE=$(event_count)
     log_info "Event count before restart: $EVENT_COUNT_BEFORE"
 
     # Stop service
@@ -207,7 +218,7 @@ test_recovery() {
             test_pass "New order accepted after restart"
 
             # Check event count increased
-            EVENT_COUNT_AFTER=$(wc -l < "$DATA_DIR/events/$TEST_SYMBOL/events.log")
+            EVENT_COUNT_AFTER=$(event_count)
             if [ $EVENT_COUNT_AFTER -gt $EVENT_COUNT_BEFORE ]; then
                 test_pass "Event log continues after restart"
             else